@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"github.com/saufiroja/go-otel/auth-service/config"
+	"github.com/saufiroja/go-otel/auth-service/internal/repositories"
+	"github.com/saufiroja/go-otel/auth-service/internal/services"
+	"github.com/saufiroja/go-otel/auth-service/pkg/databases"
+	"github.com/saufiroja/go-otel/auth-service/pkg/logging"
+	"github.com/saufiroja/go-otel/auth-service/pkg/observability/providers"
+	"github.com/saufiroja/go-otel/auth-service/pkg/observability/tracing"
+	"os"
+)
+
+// audit-verify recomputes the audit_events hash chain and exits non-zero if any row was altered
+func main() {
+	logger := logging.NewLogrusAdapter()
+	conf := config.NewAppConfig(logger)
+	logger = logging.NewLogger(conf.Log.Backend)
+	logger.SetLevel(conf.Log.Level)
+	postgresInstance := databases.NewPostgres(conf, logger)
+	defer postgresInstance.CloseConnection()
+
+	ctx := context.Background()
+	tracer := tracing.NewTracer(ctx, "auth-service-audit-verify", providers.NewProviderFactory(logger), conf, logger)
+
+	auditRepository := repositories.NewAuditRepository(postgresInstance, tracer, conf)
+	auditService := services.NewAuditService(auditRepository, logger, tracer, conf)
+
+	result, err := auditService.VerifyChain(ctx)
+	if err != nil {
+		logger.LogError("audit verification failed", logging.Err(err))
+		os.Exit(2)
+	}
+
+	for _, violation := range result.Violations {
+		logger.LogError("audit event invalid", logging.Int64("sequence", violation.Sequence),
+			logging.String("event_id", violation.EventId), logging.String("reason", violation.Reason))
+	}
+
+	if !result.Valid {
+		logger.LogError("audit chain invalid", logging.Int("violations", len(result.Violations)),
+			logging.Int64("checked", result.Checked))
+		os.Exit(1)
+	}
+
+	// record the head elsewhere, a later run reporting an earlier head means the database was rewritten
+	if result.Head != nil {
+		logger.LogInfo("audit chain valid", logging.Int64("checked", result.Checked),
+			logging.Int64("head_sequence", result.Head.Sequence), logging.String("head_hash", result.Head.Hash))
+		return
+	}
+	logger.LogInfo("audit chain valid", logging.Int64("checked", result.Checked))
+}
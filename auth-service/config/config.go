@@ -6,16 +6,42 @@ import (
 	"golang.org/x/text/cases"
 	"golang.org/x/text/language"
 	"os"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 )
 
+// OidcProvider is an upstream OpenID Connect provider users may sign in with
+type OidcProvider struct {
+	Name         string
+	Issuer       string
+	ClientId     string
+	ClientSecret string
+	RedirectUrl  string
+	Scopes       []string
+}
+
 type AppConfig struct {
 	App struct {
 		Env string
 	}
+	Log struct {
+		// Level defaults to debug in development and testing and to info elsewhere, LOG_LEVEL overrides it
+		Level   logging.Level
+		Backend string
+		// Sampling limits repeated debug, info and warn entries, LOG_SAMPLING_TICK=0 turns it off
+		Sampling logging.Sampling
+	}
 	Http struct {
 		Port string
 	}
+	Tls struct {
+		CertFile string
+		KeyFile  string
+		// ClientCaFile is the CA bundle client certificates are verified against, client auth is off without it
+		ClientCaFile string
+	}
 	Postgres struct {
 		Name string
 		User string
@@ -27,8 +53,98 @@ type AppConfig struct {
 	Jwt struct {
 		Secret string
 	}
+	Audit struct {
+		// HashKey keys the audit chain HMAC so a writer with only database access cannot recompute the chain
+		HashKey string
+	}
 	Otel struct {
 		OTLPEndpoint string
+		// RedactDrop, RedactHash and RedactMask name the span attributes removed, hashed or masked before export,
+		// a name matches a whole key, its last dotted part or any of its dot or underscore separated words
+		RedactDrop []string
+		RedactHash []string
+		RedactMask []string
+		// RedactAllow keys are exported unchanged even when a redact name matches them
+		RedactAllow []string
+		// Sampler and SamplerArg follow OTEL_TRACES_SAMPLER and OTEL_TRACES_SAMPLER_ARG
+		Sampler    string
+		SamplerArg float64
+		// RouteSampleRatios override the ratio of root spans whose url path starts with the key
+		RouteSampleRatios map[string]float64
+		// SampleErrors and SlowSpanThreshold keep traces the head decision dropped when they fail or run long
+		SampleErrors      bool
+		SlowSpanThreshold time.Duration
+	}
+	Cookie struct {
+		Domain         string
+		Path           string
+		Secure         bool
+		SameSite       string
+		AccessTokenTTL time.Duration
+	}
+	ApiKey struct {
+		RotationGracePeriod time.Duration
+	}
+	Impersonation struct {
+		TokenTTL time.Duration
+	}
+	TokenExchange struct {
+		// Audiences are the downstream services a token may be exchanged for
+		Audiences []string
+		TokenTTL  time.Duration
+	}
+	Dpop struct {
+		// RequireNonce makes clients fetch a server nonce before their proofs are accepted
+		RequireNonce bool
+		NonceTTL     time.Duration
+		// ProofMaxAge bounds how far the iat of a proof may be from the server clock
+		ProofMaxAge time.Duration
+	}
+	DeviceAuthorization struct {
+		// VerificationUri is the page users enter the code on, it defaults to /device on the requested host
+		VerificationUri string
+		CodeTTL         time.Duration
+		PollInterval    time.Duration
+	}
+	Oidc struct {
+		Providers     map[string]OidcProvider
+		AutoProvision bool
+		StateTTL      time.Duration
+	}
+	Auth struct {
+		// Providers are consulted in order before the local password database
+		Providers []string
+	}
+	Ldap struct {
+		Url            string
+		StartTls       bool
+		BindDn         string
+		BindPassword   string
+		UserDnTemplate string
+		BaseDn         string
+		UserFilter     string
+		EmailAttribute string
+		NameAttribute  string
+		GroupAttribute string
+		GroupRoles     map[string]string
+		Timeout        time.Duration
+	}
+	Saml struct {
+		EntityId        string
+		RootUrl         string
+		KeyFile         string
+		CertFile        string
+		IdpMetadataUrl  string
+		IdpMetadataFile string
+		EmailAttribute  string
+		NameAttribute   string
+		GroupAttribute  string
+		GroupRoles      map[string]string
+		RequestTTL      time.Duration
+	}
+	Gdpr struct {
+		ErasureGracePeriod time.Duration
+		ErasureInterval    time.Duration
 	}
 }
 
@@ -47,10 +163,24 @@ func NewAppConfig(logging logging.Logger) *AppConfig {
 			appConfig = &AppConfig{}
 
 			appConfig.initApp()
+			appConfig.initLog()
 			appConfig.initHttp()
+			appConfig.initTls()
 			appConfig.initPostgres()
 			appConfig.initJwt()
+			appConfig.initAudit()
 			appConfig.initOtel()
+			appConfig.initCookie()
+			appConfig.initGdpr()
+			appConfig.initApiKey()
+			appConfig.initImpersonation()
+			appConfig.initTokenExchange()
+			appConfig.initDeviceAuthorization()
+			appConfig.initDpop()
+			appConfig.initOidc()
+			appConfig.initAuth()
+			appConfig.initLdap()
+			appConfig.initSaml()
 		} else {
 			logging.LogInfo("AppConfig already created")
 		}
@@ -77,6 +207,30 @@ func (c *AppConfig) initApp() {
 	}
 }
 
+func (c *AppConfig) initLog() {
+	c.Log.Level = logging.InfoLevel
+	if c.App.Env == "development" || c.App.Env == "testing" {
+		c.Log.Level = logging.DebugLevel
+	}
+	if level, err := logging.ParseLevel(os.Getenv("LOG_LEVEL")); err == nil {
+		c.Log.Level = level
+	}
+
+	c.Log.Backend = logging.LogrusBackend
+	if cases.Lower(language.English).String(os.Getenv("LOG_BACKEND")) == logging.SlogBackend {
+		c.Log.Backend = logging.SlogBackend
+	}
+
+	c.Log.Sampling = logging.Sampling{
+		Initial:    parseCount(os.Getenv("LOG_SAMPLING_INITIAL"), 100),
+		Thereafter: parseCount(os.Getenv("LOG_SAMPLING_THEREAFTER"), 100),
+		Tick:       time.Second,
+	}
+	if tick, err := time.ParseDuration(os.Getenv("LOG_SAMPLING_TICK")); err == nil && tick >= 0 {
+		c.Log.Sampling.Tick = tick
+	}
+}
+
 func (c *AppConfig) initHttp() {
 	c.Http.Port = os.Getenv("HTTP_PORT")
 	if c.Http.Port == "" {
@@ -84,6 +238,12 @@ func (c *AppConfig) initHttp() {
 	}
 }
 
+func (c *AppConfig) initTls() {
+	c.Tls.CertFile = os.Getenv("TLS_CERT_FILE")
+	c.Tls.KeyFile = os.Getenv("TLS_KEY_FILE")
+	c.Tls.ClientCaFile = os.Getenv("TLS_CLIENT_CA_FILE")
+}
+
 func (c *AppConfig) initPostgres() {
 	c.Postgres.Host = os.Getenv("DB_HOST")
 	c.Postgres.Port = os.Getenv("DB_PORT")
@@ -100,9 +260,221 @@ func (c *AppConfig) initJwt() {
 	}
 }
 
+// initAudit reads AUDIT_HASH_KEY, without it the key is derived from the jwt secret
+func (c *AppConfig) initAudit() {
+	c.Audit.HashKey = os.Getenv("AUDIT_HASH_KEY")
+	if c.Audit.HashKey == "" {
+		c.Audit.HashKey = "audit-chain:" + c.Jwt.Secret
+	}
+}
+
 func (c *AppConfig) initOtel() {
 	c.Otel.OTLPEndpoint = os.Getenv("OTEL_ENDPOINT")
 	if c.Otel.OTLPEndpoint == "" {
 		c.Otel.OTLPEndpoint = "localhost:4317"
 	}
+	c.Otel.RedactDrop = parseList(getEnvDefault("OTEL_REDACT_DROP", "password,secret,token,authorization,cookie"))
+	c.Otel.RedactHash = parseList(getEnvDefault("OTEL_REDACT_HASH", "email,dn"))
+	c.Otel.RedactMask = parseList(getEnvDefault("OTEL_REDACT_MASK", "full_name,client.address,ip"))
+	c.Otel.RedactAllow = parseList(getEnvDefault("OTEL_REDACT_ALLOW", "token.type,token.binding,token_id"))
+	c.initSampling()
+}
+
+// initSampling reads the standard sampler variables, the default is the SDK's parentbased_always_on
+func (c *AppConfig) initSampling() {
+	c.Otel.Sampler = cases.Lower(language.English).String(getEnvDefault("OTEL_TRACES_SAMPLER", "parentbased_always_on"))
+	c.Otel.SamplerArg = 1
+	if arg, err := strconv.ParseFloat(os.Getenv("OTEL_TRACES_SAMPLER_ARG"), 64); err == nil && arg >= 0 && arg <= 1 {
+		c.Otel.SamplerArg = arg
+	}
+
+	// OTEL_TRACES_ROUTE_RATIOS is a comma separated list of path=ratio, like /oauth/token=1,/admin=0.5
+	c.Otel.RouteSampleRatios = make(map[string]float64)
+	for _, route := range parseList(os.Getenv("OTEL_TRACES_ROUTE_RATIOS")) {
+		index := strings.LastIndex(route, "=")
+		if index <= 0 {
+			continue
+		}
+		ratio, err := strconv.ParseFloat(strings.TrimSpace(route[index+1:]), 64)
+		if err != nil || ratio < 0 || ratio > 1 {
+			continue
+		}
+		c.Otel.RouteSampleRatios[strings.TrimSpace(route[:index])] = ratio
+	}
+
+	// sampling errors is opt in, it records every span the head decision drops until the root ends so it costs about
+	// as much as always_on in the process while exporting only failed traces
+	c.Otel.SampleErrors = cases.Lower(language.English).String(os.Getenv("OTEL_TRACES_SAMPLE_ERRORS")) == "true"
+	// the slow threshold is off unless set, 0 turns it off again
+	c.Otel.SlowSpanThreshold = 0
+	if threshold, err := time.ParseDuration(os.Getenv("OTEL_TRACES_SLOW_THRESHOLD")); err == nil && threshold > 0 {
+		c.Otel.SlowSpanThreshold = threshold
+	}
+}
+
+func (c *AppConfig) initCookie() {
+	c.Cookie.Domain = os.Getenv("COOKIE_DOMAIN")
+	c.Cookie.Path = os.Getenv("COOKIE_PATH")
+	if c.Cookie.Path == "" {
+		c.Cookie.Path = "/"
+	}
+	// cookies are only sent over TLS unless explicitly disabled for local development
+	c.Cookie.Secure = cases.Lower(language.English).String(os.Getenv("COOKIE_SECURE")) != "false"
+	switch cases.Lower(language.English).String(os.Getenv("COOKIE_SAME_SITE")) {
+	case "lax":
+		c.Cookie.SameSite = "Lax"
+	case "none":
+		c.Cookie.SameSite = "None"
+	default:
+		c.Cookie.SameSite = "Strict"
+	}
+	c.Cookie.AccessTokenTTL = parseDuration(os.Getenv("COOKIE_ACCESS_TOKEN_TTL"), time.Minute*15)
+}
+
+func (c *AppConfig) initGdpr() {
+	c.Gdpr.ErasureGracePeriod = parseDuration(os.Getenv("GDPR_ERASURE_GRACE_PERIOD"), time.Hour*24*30)
+	c.Gdpr.ErasureInterval = parseDuration(os.Getenv("GDPR_ERASURE_INTERVAL"), time.Hour)
+}
+
+func (c *AppConfig) initApiKey() {
+	c.ApiKey.RotationGracePeriod = parseDuration(os.Getenv("API_KEY_ROTATION_GRACE_PERIOD"), time.Hour*24)
+}
+
+func (c *AppConfig) initImpersonation() {
+	c.Impersonation.TokenTTL = parseDuration(os.Getenv("IMPERSONATION_TOKEN_TTL"), time.Minute*15)
+}
+
+// initTokenExchange reads TOKEN_EXCHANGE_AUDIENCES, a comma separated list of audiences
+func (c *AppConfig) initTokenExchange() {
+	c.TokenExchange.Audiences = parseList(os.Getenv("TOKEN_EXCHANGE_AUDIENCES"))
+	c.TokenExchange.TokenTTL = parseDuration(os.Getenv("TOKEN_EXCHANGE_TTL"), time.Minute*5)
+}
+
+func (c *AppConfig) initDpop() {
+	c.Dpop.RequireNonce = cases.Lower(language.English).String(os.Getenv("DPOP_REQUIRE_NONCE")) == "true"
+	c.Dpop.NonceTTL = parseDuration(os.Getenv("DPOP_NONCE_TTL"), time.Minute*5)
+	c.Dpop.ProofMaxAge = parseDuration(os.Getenv("DPOP_PROOF_MAX_AGE"), time.Minute)
+}
+
+func (c *AppConfig) initDeviceAuthorization() {
+	c.DeviceAuthorization.VerificationUri = os.Getenv("DEVICE_VERIFICATION_URI")
+	c.DeviceAuthorization.CodeTTL = parseDuration(os.Getenv("DEVICE_CODE_TTL"), time.Minute*10)
+	c.DeviceAuthorization.PollInterval = parseDuration(os.Getenv("DEVICE_POLL_INTERVAL"), time.Second*5)
+}
+
+// initOidc reads OIDC_PROVIDERS, a comma separated list of names, and the OIDC_<NAME>_* settings of each
+func (c *AppConfig) initOidc() {
+	c.Oidc.Providers = make(map[string]OidcProvider)
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = cases.Lower(language.English).String(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		scopes := strings.Fields(os.Getenv(prefix + "SCOPES"))
+		if len(scopes) == 0 {
+			scopes = []string{"openid", "email", "profile"}
+		}
+		c.Oidc.Providers[name] = OidcProvider{
+			Name:         name,
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientId:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectUrl:  os.Getenv(prefix + "REDIRECT_URL"),
+			Scopes:       scopes,
+		}
+	}
+	c.Oidc.AutoProvision = cases.Lower(language.English).String(os.Getenv("OIDC_AUTO_PROVISION")) != "false"
+	c.Oidc.StateTTL = parseDuration(os.Getenv("OIDC_STATE_TTL"), time.Minute*10)
+}
+
+func (c *AppConfig) initAuth() {
+	c.Auth.Providers = make([]string, 0)
+	for _, name := range strings.Split(os.Getenv("AUTH_PROVIDERS"), ",") {
+		name = cases.Lower(language.English).String(strings.TrimSpace(name))
+		if name != "" {
+			c.Auth.Providers = append(c.Auth.Providers, name)
+		}
+	}
+}
+
+func (c *AppConfig) initLdap() {
+	c.Ldap.Url = os.Getenv("LDAP_URL")
+	c.Ldap.StartTls = cases.Lower(language.English).String(os.Getenv("LDAP_START_TLS")) == "true"
+	c.Ldap.BindDn = os.Getenv("LDAP_BIND_DN")
+	c.Ldap.BindPassword = os.Getenv("LDAP_BIND_PASSWORD")
+	c.Ldap.UserDnTemplate = os.Getenv("LDAP_USER_DN_TEMPLATE")
+	c.Ldap.BaseDn = os.Getenv("LDAP_BASE_DN")
+	c.Ldap.UserFilter = getEnvDefault("LDAP_USER_FILTER", "(mail=%s)")
+	c.Ldap.EmailAttribute = getEnvDefault("LDAP_EMAIL_ATTRIBUTE", "mail")
+	c.Ldap.NameAttribute = getEnvDefault("LDAP_NAME_ATTRIBUTE", "cn")
+	c.Ldap.GroupAttribute = getEnvDefault("LDAP_GROUP_ATTRIBUTE", "memberOf")
+	c.Ldap.Timeout = parseDuration(os.Getenv("LDAP_TIMEOUT"), time.Second*5)
+
+	c.Ldap.GroupRoles = parseGroupRoles(os.Getenv("LDAP_GROUP_ROLES"))
+}
+
+// initSaml configures the service provider, SAML is disabled unless SAML_ROOT_URL is set
+func (c *AppConfig) initSaml() {
+	c.Saml.RootUrl = strings.TrimSuffix(os.Getenv("SAML_ROOT_URL"), "/")
+	c.Saml.EntityId = getEnvDefault("SAML_ENTITY_ID", c.Saml.RootUrl+"/saml/metadata")
+	c.Saml.KeyFile = os.Getenv("SAML_KEY_FILE")
+	c.Saml.CertFile = os.Getenv("SAML_CERT_FILE")
+	c.Saml.IdpMetadataUrl = os.Getenv("SAML_IDP_METADATA_URL")
+	c.Saml.IdpMetadataFile = os.Getenv("SAML_IDP_METADATA_FILE")
+	c.Saml.EmailAttribute = getEnvDefault("SAML_EMAIL_ATTRIBUTE", "email")
+	c.Saml.NameAttribute = getEnvDefault("SAML_NAME_ATTRIBUTE", "displayName")
+	c.Saml.GroupAttribute = getEnvDefault("SAML_GROUP_ATTRIBUTE", "groups")
+	c.Saml.GroupRoles = parseGroupRoles(os.Getenv("SAML_GROUP_ROLES"))
+	c.Saml.RequestTTL = parseDuration(os.Getenv("SAML_REQUEST_TTL"), time.Minute*10)
+}
+
+// parseGroupRoles reads a ; separated list of <group>:<role>, the role follows the last colon so group DNs may
+// contain colons, groups are lower cased
+func parseGroupRoles(value string) map[string]string {
+	groupRoles := make(map[string]string)
+	for _, mapping := range strings.Split(value, ";") {
+		index := strings.LastIndex(mapping, ":")
+		if index <= 0 {
+			continue
+		}
+		group := cases.Lower(language.English).String(strings.TrimSpace(mapping[:index]))
+		groupRoles[group] = strings.TrimSpace(mapping[index+1:])
+	}
+	return groupRoles
+}
+
+// parseList splits a comma separated value, dropping blank entries
+func parseList(value string) []string {
+	list := make([]string, 0)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func getEnvDefault(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func parseCount(value string, fallback int) int {
+	count, err := strconv.Atoi(value)
+	if err != nil || count < 0 {
+		return fallback
+	}
+	return count
+}
+
+func parseDuration(value string, fallback time.Duration) time.Duration {
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		return fallback
+	}
+	return duration
 }
@@ -2,21 +2,33 @@ package app
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"github.com/gofiber/fiber/v2"
 	"github.com/saufiroja/go-otel/auth-service/config"
 	"github.com/saufiroja/go-otel/auth-service/internal/controllers"
 	"github.com/saufiroja/go-otel/auth-service/internal/middlerwares"
+	"github.com/saufiroja/go-otel/auth-service/internal/models"
 	"github.com/saufiroja/go-otel/auth-service/internal/repositories"
 	"github.com/saufiroja/go-otel/auth-service/internal/services"
 	"github.com/saufiroja/go-otel/auth-service/internal/utils"
+	"github.com/saufiroja/go-otel/auth-service/internal/workers"
 	"github.com/saufiroja/go-otel/auth-service/pkg/databases"
 	"github.com/saufiroja/go-otel/auth-service/pkg/logging"
+	"github.com/saufiroja/go-otel/auth-service/pkg/observability/logs"
 	"github.com/saufiroja/go-otel/auth-service/pkg/observability/metrics"
 	"github.com/saufiroja/go-otel/auth-service/pkg/observability/providers"
 	"github.com/saufiroja/go-otel/auth-service/pkg/observability/tracing"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
+// shutdownTimeout bounds how long in flight requests and buffered telemetry get to finish on exit
+const shutdownTimeout = 10 * time.Second
+
 type App struct {
 	*fiber.App
 }
@@ -28,34 +40,219 @@ func NewApp() *App {
 }
 
 func (a *App) Start() {
+	// the configuration is read with a default logger, the configured one replaces it before anything else logs
 	logger := logging.NewLogrusAdapter()
 	conf := config.NewAppConfig(logger)
+	logger = logging.NewLogger(conf.Log.Backend)
+	logger.SetLevel(conf.Log.Level)
+	logger.SetSampling(conf.Log.Sampling)
 	postgresInstance := databases.NewPostgres(conf, logger)
 	defer postgresInstance.CloseConnection()
 
 	const serviceName = "auth-service"
 	resource := providers.NewProviderFactory(logger)
-	ctx := context.Background()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 	tracer := tracing.NewTracer(ctx, serviceName, resource, conf, logger)
 	meter := metrics.NewMetric(ctx, serviceName, resource, conf, logger)
+	logExporter := logs.NewLogExporter(ctx, serviceName, resource, conf, logger)
+	logger.AddSink(logExporter)
+	// the log batch is flushed last so the shutdown itself is still shipped
+	defer func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := logExporter.Shutdown(shutdownCtx); err != nil {
+			logger.LogError("failed to flush logs", logging.Err(err))
+		}
+	}()
 
 	//middlewares
-	responseTimeMiddleware := middlerwares.NewMiddleware(meter)
+	tracingMiddleware := middlerwares.NewTracingMiddleware(tracer)
+	httpMetricsMiddleware := middlerwares.NewHttpMetricsMiddleware(meter)
 	//utils
-	generateToken := utils.NewGenerateToken(conf, tracer)
-	passwordHasher := utils.NewBcryptHasher(tracer)
+	generateToken := utils.NewGenerateToken(conf, tracer, meter)
+	passwordHasher := utils.NewBcryptHasher(tracer, meter)
+	notifier := utils.NewLogNotifier(logger, tracer)
+	browserCookies := utils.NewBrowserCookies(conf)
+	oidcClients := utils.NewOidcClients(conf, tracer)
+	authProviders := utils.NewAuthProviders(conf, tracer, logger)
+	samlServiceProvider := utils.NewSamlServiceProvider(conf, logger)
+	dpopVerifier := utils.NewDpopVerifier(conf, tracer)
 
 	userRepository := repositories.NewUserRepository(postgresInstance, tracer)
-	userService := services.NewUserService(userRepository, logger, generateToken, tracer, passwordHasher)
-	userController := controllers.NewUserController(userService, tracer, meter)
+	emailChangeRepository := repositories.NewEmailChangeRepository(postgresInstance, tracer)
+	erasureRepository := repositories.NewErasureRepository(postgresInstance, tracer)
+	auditRepository := repositories.NewAuditRepository(postgresInstance, tracer, conf)
+	sessionRepository := repositories.NewSessionRepository(postgresInstance, tracer)
+	personalAccessTokenRepository := repositories.NewPersonalAccessTokenRepository(postgresInstance, tracer)
+	apiKeyRepository := repositories.NewApiKeyRepository(postgresInstance, tracer)
+	identityRepository := repositories.NewIdentityRepository(postgresInstance, tracer)
+	samlRequestRepository := repositories.NewSamlRequestRepository(postgresInstance, tracer)
+	scimRepository := repositories.NewScimRepository(postgresInstance, tracer)
+	deviceCodeRepository := repositories.NewDeviceCodeRepository(postgresInstance, tracer)
+	auditService := services.NewAuditService(auditRepository, logger, tracer, conf)
+	userService := services.NewUserService(userRepository, sessionRepository, personalAccessTokenRepository,
+		identityRepository, authProviders, logger, generateToken, tracer, meter, passwordHasher, auditService)
+	profileService := services.NewProfileService(userRepository, emailChangeRepository, logger, tracer,
+		passwordHasher, notifier, auditService)
+	sessionService := services.NewSessionService(sessionRepository, logger, tracer, meter, auditService)
+	personalAccessTokenService := services.NewPersonalAccessTokenService(personalAccessTokenRepository,
+		userRepository, logger, tracer, auditService)
+	apiKeyService := services.NewApiKeyService(apiKeyRepository, logger, tracer, auditService, conf)
+	adminService := services.NewAdminService(userRepository, logger, generateToken, tracer, auditService)
+	privacyService := services.NewPrivacyService(userRepository, emailChangeRepository, erasureRepository,
+		auditRepository, sessionRepository, personalAccessTokenRepository, identityRepository, logger, tracer, passwordHasher,
+		conf)
+	oidcService := services.NewOidcService(oidcClients, identityRepository, userService, logger, tracer,
+		auditService, conf)
+	samlService := services.NewSamlService(samlServiceProvider, samlRequestRepository, userService, logger, tracer,
+		conf)
+	scimService := services.NewScimService(scimRepository, userRepository, logger, tracer, passwordHasher,
+		auditService)
+	oauthService := services.NewOAuthService(deviceCodeRepository, userRepository, userService, apiKeyService,
+		generateToken, logger, tracer, auditService, conf)
+	dpopMiddleware := middlerwares.NewDpopMiddleware(dpopVerifier, tracer)
+	authMiddleware := middlerwares.NewAuthMiddleware(userService, dpopMiddleware, tracer)
+	apiKeyMiddleware := middlerwares.NewApiKeyMiddleware(apiKeyService, tracer)
+	userController := controllers.NewUserController(userService, sessionService, browserCookies, tracer, meter)
+	profileController := controllers.NewProfileController(profileService, tracer, meter)
+	adminController := controllers.NewAdminController(adminService, auditService, tracer, meter)
+	privacyController := controllers.NewPrivacyController(privacyService, tracer, meter)
+	sessionController := controllers.NewSessionController(sessionService, tracer, meter)
+	personalAccessTokenController := controllers.NewPersonalAccessTokenController(personalAccessTokenService,
+		tracer, meter)
+	apiKeyController := controllers.NewApiKeyController(apiKeyService, tracer, meter)
+	oidcController := controllers.NewOidcController(oidcService, browserCookies, tracer, meter)
+	samlController := controllers.NewSamlController(samlService, browserCookies, tracer, meter)
+	scimController := controllers.NewScimController(scimService, tracer, meter)
+	oauthController := controllers.NewOAuthController(oauthService, tracer, meter)
+
+	//workers
+	erasureWorker := workers.NewErasureWorker(privacyService, logger, tracer, conf)
+	go erasureWorker.Start(ctx)
+
+	a.Use(tracingMiddleware.ServerSpan())
+	a.Use(httpMetricsMiddleware.ServerMetrics())
+	a.Use(middlerwares.RequestMetaMiddleware())
+	a.Use(middlerwares.CsrfMiddleware("/saml/acs"))
+
+	a.Post("/register", userController.RegisterUser)
+
+	a.Post("/login", dpopMiddleware.TokenEndpoint(), userController.LoginUser)
+
+	a.Post("/token/refresh", dpopMiddleware.TokenEndpoint(), userController.RefreshToken)
+
+	// the token endpoint authenticates each grant from its own parameters
+	a.Post("/oauth/token", dpopMiddleware.TokenEndpoint(), oauthController.Token)
+	a.Post("/oauth/device_authorization", oauthController.DeviceAuthorization)
+
+	// the verification page is public, answering a code needs the browser session of the user
+	a.Get(controllers.DevicePath, oauthController.DevicePage)
+	a.Get(controllers.DeviceCodePath, authMiddleware.Authenticate(), authMiddleware.RequireSession(),
+		oauthController.GetDeviceCode)
+	a.Post(controllers.DeviceCodePath, authMiddleware.Authenticate(), authMiddleware.RequireSession(),
+		oauthController.DecideDeviceCode)
+
+	a.Get("/oidc/:provider/authorize", oidcController.Authorize)
+	a.Get("/oidc/:provider/callback", oidcController.Callback)
+
+	if samlServiceProvider != nil {
+		a.Get("/saml/metadata", samlController.Metadata)
+		a.Get("/saml/login", samlController.Login)
+		a.Post("/saml/acs", samlController.AssertionConsumer)
+	}
 
-	a.Post("/register",
-		responseTimeMiddleware.ResponseTimeMiddleware(ctx, "register"), userController.RegisterUser)
+	a.Post("/logout", authMiddleware.Authenticate(), authMiddleware.RequireSession(), userController.Logout)
 
-	a.Post("/login",
-		responseTimeMiddleware.ResponseTimeMiddleware(ctx, "login"), userController.LoginUser)
+	me := a.Group("/me", authMiddleware.Authenticate())
+	me.Get("/", authMiddleware.RequireScope(models.ScopeProfileRead), profileController.GetProfile)
+	me.Patch("/", authMiddleware.RequireScope(models.ScopeProfileWrite), profileController.UpdateProfile)
+	me.Get("/sessions", authMiddleware.RequireScope(models.ScopeSessionsRead), sessionController.ListSessions)
+	me.Delete("/sessions/:id", authMiddleware.RequireScope(models.ScopeSessionsWrite), sessionController.RevokeSession)
 
-	if err := a.Listen(fmt.Sprintf(":%s", conf.Http.Port)); err != nil {
+	// account management is not delegable to personal access tokens
+	account := me.Group("", authMiddleware.RequireSession())
+	account.Post("/email", profileController.RequestEmailChange)
+	account.Post("/email/confirm", profileController.ConfirmEmailChange)
+	account.Post("/password", profileController.ChangePassword)
+	account.Get("/export", privacyController.ExportUserData)
+	account.Post("/erasure", privacyController.RequestErasure)
+	account.Delete("/erasure", privacyController.CancelErasure)
+	account.Post("/tokens", personalAccessTokenController.CreateToken)
+	account.Get("/tokens", personalAccessTokenController.ListTokens)
+	account.Delete("/tokens/:id", personalAccessTokenController.RevokeToken)
+	account.Get("/identities", oidcController.ListIdentities)
+	// registered before the oidc route so ldap and saml are not taken for a provider name
+	account.Post("/identities/ldap", userController.LinkDirectoryIdentity)
+	if samlServiceProvider != nil {
+		account.Post("/identities/saml", samlController.LinkIdentity)
+	}
+	account.Post("/identities/:provider", oidcController.LinkIdentity)
+	account.Delete("/identities/:id", oidcController.UnlinkIdentity)
+
+	admin := a.Group("/admin", authMiddleware.Authenticate(), authMiddleware.RequireRole(models.RoleAdmin),
+		authMiddleware.RequireScope(models.ScopeAdmin))
+	admin.Patch("/users/:id/status", adminController.ChangeUserStatus)
+	admin.Get("/users/:id/status", adminController.GetStatusChanges)
+	admin.Get("/audit-events", adminController.ListAuditEvents)
+	admin.Get("/log-level", adminController.GetLogLevel)
+	admin.Put("/log-level", adminController.ChangeLogLevel)
+	admin.Post("/service-accounts", apiKeyController.CreateServiceAccount)
+	admin.Post("/service-accounts/:id/api-keys", apiKeyController.CreateApiKey)
+	admin.Get("/service-accounts/:id/api-keys", apiKeyController.ListApiKeys)
+	admin.Post("/api-keys/:id/rotate", apiKeyController.RotateApiKey)
+	admin.Delete("/api-keys/:id", apiKeyController.RevokeApiKey)
+	admin.Post("/service-accounts/:id/certificates", apiKeyController.CreateClientCertificate)
+	admin.Delete("/client-certificates/:id", apiKeyController.RevokeClientCertificate)
+
+	// support staff act as a user from their own interactive session, the token is bound to that session
+	support := a.Group("/support", authMiddleware.Authenticate(), authMiddleware.RequireSession(),
+		authMiddleware.RequirePermission(models.PermissionImpersonate))
+	support.Post("/users/:id/impersonate", adminController.Impersonate)
+
+	service := a.Group("/service", apiKeyMiddleware.Authenticate())
+	service.Get("/whoami", apiKeyController.WhoAmI)
+
+	// SCIM tenants are the orgs of service accounts, identity providers send the api key as a bearer token
+	scim := a.Group(controllers.ScimBasePath, apiKeyMiddleware.Authenticate(),
+		authMiddleware.RequireScope(models.ScopeScimProvision))
+	scim.Get("/ServiceProviderConfig", scimController.ServiceProviderConfig)
+	scim.Get("/Users", scimController.ListUsers)
+	scim.Post("/Users", scimController.CreateUser)
+	scim.Get("/Users/:id", scimController.GetUser)
+	scim.Put("/Users/:id", scimController.ReplaceUser)
+	scim.Patch("/Users/:id", scimController.PatchUser)
+	scim.Delete("/Users/:id", scimController.DeleteUser)
+	scim.Get("/Groups", scimController.ListGroups)
+	scim.Get("/Groups/:id", scimController.GetGroup)
+	scim.Patch("/Groups/:id", scimController.PatchGroup)
+	scim.Post("/Groups", scimController.RejectGroupChange)
+	scim.Put("/Groups/:id", scimController.RejectGroupChange)
+	scim.Delete("/Groups/:id", scimController.RejectGroupChange)
+
+	go func() {
+		<-ctx.Done()
+		logger.LogInfo("shutting down")
+		if err := a.ShutdownWithTimeout(shutdownTimeout); err != nil {
+			logger.LogError("failed to shut down the server", logging.Err(err))
+		}
+	}()
+
+	address := fmt.Sprintf(":%s", conf.Http.Port)
+	tlsConfig := utils.NewServerTlsConfig(conf, logger)
+	if tlsConfig == nil {
+		if err := a.Listen(address); err != nil {
+			logger.LogPanic(err.Error())
+		}
+		return
+	}
+
+	// fiber's own TLS helpers always require client certificates, the listener is built here so they stay optional
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		logger.LogPanic(err.Error())
+	}
+	if err := a.Listener(tls.NewListener(listener, tlsConfig)); err != nil {
 		logger.LogPanic(err.Error())
 	}
 }
@@ -0,0 +1,14 @@
+package requests
+
+type ImpersonateRequest struct {
+	Reason string `json:"reason"`
+}
+
+type ChangeLogLevelRequest struct {
+	Level string `json:"level"`
+}
+
+type ChangeStatusRequest struct {
+	Status string `json:"status"`
+	Reason string `json:"reason"`
+}
@@ -0,0 +1,16 @@
+package requests
+
+type CreateServiceAccountRequest struct {
+	OrgId string `json:"org_id"`
+	Name  string `json:"name"`
+}
+
+type CreateApiKeyRequest struct {
+	Scopes       []string `json:"scopes"`
+	AllowedCidrs []string `json:"allowed_cidrs"`
+}
+
+type CreateClientCertificateRequest struct {
+	SubjectDn string   `json:"subject_dn"`
+	Scopes    []string `json:"scopes"`
+}
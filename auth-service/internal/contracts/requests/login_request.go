@@ -1,6 +1,14 @@
 package requests
 
 type LoginRequest struct {
-	Email    string `json:"email"`
+	Email      string `json:"email"`
+	Password   string `json:"password"`
+	DeviceName string `json:"device_name"`
+	Browser    bool   `json:"-"`
+}
+
+// LinkDirectoryRequest carries the directory credentials of a signed-in user linking their directory account
+type LinkDirectoryRequest struct {
+	Username string `json:"username"`
 	Password string `json:"password"`
 }
@@ -0,0 +1,28 @@
+package requests
+
+// OAuthTokenRequest is the form posted to the token endpoint, only the fields of the grant_type are used, ClientId
+// names the service account of a client authenticating with its certificate
+type OAuthTokenRequest struct {
+	GrantType          string `json:"grant_type" form:"grant_type"`
+	SubjectToken       string `json:"subject_token" form:"subject_token"`
+	SubjectTokenType   string `json:"subject_token_type" form:"subject_token_type"`
+	ActorToken         string `json:"actor_token" form:"actor_token"`
+	ActorTokenType     string `json:"actor_token_type" form:"actor_token_type"`
+	RequestedTokenType string `json:"requested_token_type" form:"requested_token_type"`
+	Audience           string `json:"audience" form:"audience"`
+	Resource           string `json:"resource" form:"resource"`
+	Scope              string `json:"scope" form:"scope"`
+	DeviceCode         string `json:"device_code" form:"device_code"`
+	ClientId           string `json:"client_id" form:"client_id"`
+}
+
+// DeviceAuthorizationRequest starts the device flow of RFC 8628 section 3.1
+type DeviceAuthorizationRequest struct {
+	ClientId string `json:"client_id" form:"client_id"`
+}
+
+// DeviceVerificationRequest is a signed in user's answer to the code shown on their device
+type DeviceVerificationRequest struct {
+	UserCode string `json:"user_code" form:"user_code"`
+	Approve  bool   `json:"approve" form:"approve"`
+}
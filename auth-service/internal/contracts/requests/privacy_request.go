@@ -0,0 +1,5 @@
+package requests
+
+type ErasureRequest struct {
+	Password string `json:"password"`
+}
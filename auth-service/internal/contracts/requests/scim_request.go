@@ -0,0 +1,41 @@
+package requests
+
+import "encoding/json"
+
+type ScimName struct {
+	Formatted  string `json:"formatted"`
+	GivenName  string `json:"givenName"`
+	FamilyName string `json:"familyName"`
+}
+
+type ScimEmail struct {
+	Value   string `json:"value"`
+	Type    string `json:"type"`
+	Primary bool   `json:"primary"`
+}
+
+type ScimUserRequest struct {
+	Schemas     []string    `json:"schemas"`
+	ExternalId  string      `json:"externalId"`
+	UserName    string      `json:"userName"`
+	Name        *ScimName   `json:"name"`
+	DisplayName string      `json:"displayName"`
+	Emails      []ScimEmail `json:"emails"`
+	Active      *bool       `json:"active"`
+}
+
+type ScimPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+type ScimPatchRequest struct {
+	Schemas    []string             `json:"schemas"`
+	Operations []ScimPatchOperation `json:"Operations"`
+}
+
+// ScimMember references a user in the members of a group patch
+type ScimMember struct {
+	Value string `json:"value"`
+}
@@ -1,6 +1,25 @@
 package requests
 
+import "github.com/saufiroja/go-otel/auth-service/internal/models"
+
 type GenerateTokenRequest struct {
-	UserId   string `json:"user_id"`
-	FullName string `json:"full_name"`
+	UserId    string `json:"user_id"`
+	FullName  string `json:"full_name"`
+	SessionId string `json:"session_id"`
+	TokenId   string `json:"token_id"`
+	// Actor is set when the token is issued to someone acting as UserId
+	Actor *models.Actor `json:"act"`
+	// Audience and Scopes narrow exchanged tokens
+	Audience string   `json:"aud"`
+	Scopes   []string `json:"scope"`
+	// Confirmation binds the token to the key of the client it is issued to
+	Confirmation *models.Confirmation `json:"cnf"`
+	// NotAfter caps the expiry of the token as a unix time, zero leaves it uncapped
+	NotAfter int64 `json:"-"`
+	Browser  bool  `json:"-"`
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+	Browser      bool   `json:"-"`
 }
@@ -0,0 +1,9 @@
+package responses
+
+import "github.com/saufiroja/go-otel/auth-service/internal/models"
+
+// CreatedApiKeyResponse is the only response that ever carries the plaintext api key
+type CreatedApiKeyResponse struct {
+	*models.ApiKey
+	Key string `json:"key"`
+}
@@ -0,0 +1,72 @@
+package responses
+
+import (
+	"github.com/saufiroja/go-otel/auth-service/internal/models"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// OAuthTokenResponse is the body of RFC 6749 section 5.1 with the issued_token_type of RFC 8693
+type OAuthTokenResponse struct {
+	AccessToken     string `json:"access_token"`
+	IssuedTokenType string `json:"issued_token_type,omitempty"`
+	TokenType       string `json:"token_type"`
+	ExpiresIn       int64  `json:"expires_in"`
+	RefreshToken    string `json:"refresh_token,omitempty"`
+	Scope           string `json:"scope,omitempty"`
+}
+
+// NewDeviceTokenResponse renders the token pair issued to a device, the same pair /login returns
+func NewDeviceTokenResponse(token *models.Token) *OAuthTokenResponse {
+	return &OAuthTokenResponse{
+		AccessToken:  token.AccessToken,
+		TokenType:    token.TokenType,
+		ExpiresIn:    max(token.AccessTokenExpiresAt-time.Now().Unix(), 0),
+		RefreshToken: token.RefreshToken,
+	}
+}
+
+func NewExchangedTokenResponse(token *models.ExchangedToken) *OAuthTokenResponse {
+	return &OAuthTokenResponse{
+		AccessToken:     token.AccessToken,
+		IssuedTokenType: token.IssuedTokenType,
+		TokenType:       token.TokenType,
+		ExpiresIn:       max(token.ExpiresAt-time.Now().Unix(), 0),
+		Scope:           strings.Join(token.Scopes, " "),
+	}
+}
+
+// OAuthErrorResponse is the error body of RFC 6749 section 5.2
+type OAuthErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+func NewOAuthErrorResponse(err *models.OAuthError) *OAuthErrorResponse {
+	return &OAuthErrorResponse{
+		Error:            err.Code,
+		ErrorDescription: err.Description,
+	}
+}
+
+// DeviceAuthorizationResponse is the body of RFC 8628 section 3.2
+type DeviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationUri         string `json:"verification_uri"`
+	VerificationUriComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int64  `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+func NewDeviceAuthorizationResponse(authorization *models.DeviceAuthorization) *DeviceAuthorizationResponse {
+	return &DeviceAuthorizationResponse{
+		DeviceCode:              authorization.DeviceCode,
+		UserCode:                authorization.UserCode,
+		VerificationUri:         authorization.VerificationUri,
+		VerificationUriComplete: authorization.VerificationUri + "?user_code=" + url.QueryEscape(authorization.UserCode),
+		ExpiresIn:               max(int64(time.Until(authorization.ExpiresAt).Seconds()), 0),
+		Interval:                authorization.Interval,
+	}
+}
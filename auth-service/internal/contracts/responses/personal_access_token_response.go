@@ -0,0 +1,9 @@
+package responses
+
+import "github.com/saufiroja/go-otel/auth-service/internal/models"
+
+// CreatedPersonalAccessTokenResponse is the only response that ever carries the plaintext token
+type CreatedPersonalAccessTokenResponse struct {
+	*models.PersonalAccessToken
+	Token string `json:"token"`
+}
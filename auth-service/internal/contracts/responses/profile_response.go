@@ -0,0 +1,26 @@
+package responses
+
+import (
+	"github.com/saufiroja/go-otel/auth-service/internal/models"
+	"time"
+)
+
+type ProfileResponse struct {
+	UserId    string    `json:"user_id"`
+	FullName  string    `json:"full_name"`
+	Email     string    `json:"email"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func NewProfileResponse(user *models.User) *ProfileResponse {
+	return &ProfileResponse{
+		UserId:    user.UserId,
+		FullName:  user.FullName,
+		Email:     user.Email,
+		Status:    user.Status,
+		CreatedAt: user.CreatedAt,
+		UpdatedAt: user.UpdatedAt,
+	}
+}
@@ -0,0 +1,193 @@
+package responses
+
+import (
+	"github.com/saufiroja/go-otel/auth-service/internal/models"
+	"strconv"
+	"time"
+)
+
+type ScimMeta struct {
+	ResourceType string     `json:"resourceType"`
+	Created      *time.Time `json:"created,omitempty"`
+	LastModified *time.Time `json:"lastModified,omitempty"`
+	Location     string     `json:"location"`
+	Version      string     `json:"version"`
+}
+
+type ScimNameResponse struct {
+	Formatted string `json:"formatted"`
+}
+
+type ScimEmailResponse struct {
+	Value   string `json:"value"`
+	Type    string `json:"type"`
+	Primary bool   `json:"primary"`
+}
+
+type ScimReference struct {
+	Value   string `json:"value"`
+	Display string `json:"display"`
+	Ref     string `json:"$ref"`
+}
+
+type ScimUserResponse struct {
+	Schemas     []string            `json:"schemas"`
+	Id          string              `json:"id"`
+	ExternalId  string              `json:"externalId,omitempty"`
+	UserName    string              `json:"userName"`
+	Name        ScimNameResponse    `json:"name"`
+	DisplayName string              `json:"displayName"`
+	Emails      []ScimEmailResponse `json:"emails"`
+	Active      bool                `json:"active"`
+	Groups      []ScimReference     `json:"groups"`
+	Meta        ScimMeta            `json:"meta"`
+}
+
+// NewScimUserResponse renders a user, baseUrl is the root of the SCIM api such as https://host/scim/v2
+func NewScimUserResponse(user *models.ScimUser, baseUrl string) *ScimUserResponse {
+	return &ScimUserResponse{
+		Schemas:     []string{models.ScimSchemaUser},
+		Id:          user.UserId,
+		ExternalId:  user.ExternalId,
+		UserName:    user.Email,
+		Name:        ScimNameResponse{Formatted: user.FullName},
+		DisplayName: user.FullName,
+		Emails:      []ScimEmailResponse{{Value: user.Email, Type: "work", Primary: true}},
+		Active:      user.Status == models.StatusActive,
+		Groups: []ScimReference{
+			{Value: user.Role, Display: user.Role, Ref: baseUrl + "/Groups/" + user.Role},
+		},
+		Meta: ScimMeta{
+			ResourceType: "User",
+			Created:      &user.CreatedAt,
+			LastModified: &user.UpdatedAt,
+			Location:     baseUrl + "/Users/" + user.UserId,
+			Version:      user.Version(),
+		},
+	}
+}
+
+type ScimGroupResponse struct {
+	Schemas     []string        `json:"schemas"`
+	Id          string          `json:"id"`
+	DisplayName string          `json:"displayName"`
+	Members     []ScimReference `json:"members"`
+	Meta        ScimMeta        `json:"meta"`
+}
+
+func NewScimGroupResponse(group *models.ScimGroup, baseUrl string) *ScimGroupResponse {
+	members := make([]ScimReference, 0, len(group.Members))
+	for _, member := range group.Members {
+		members = append(members, ScimReference{
+			Value:   member.UserId,
+			Display: member.FullName,
+			Ref:     baseUrl + "/Users/" + member.UserId,
+		})
+	}
+	return &ScimGroupResponse{
+		Schemas:     []string{models.ScimSchemaGroup},
+		Id:          group.Id,
+		DisplayName: group.Id,
+		Members:     members,
+		Meta: ScimMeta{
+			ResourceType: "Group",
+			Location:     baseUrl + "/Groups/" + group.Id,
+			Version:      group.Version(),
+		},
+	}
+}
+
+type ScimListResponse struct {
+	Schemas      []string `json:"schemas"`
+	TotalResults int      `json:"totalResults"`
+	StartIndex   int      `json:"startIndex"`
+	ItemsPerPage int      `json:"itemsPerPage"`
+	Resources    []any    `json:"Resources"`
+}
+
+func NewScimListResponse(resources []any, totalResults, startIndex int) *ScimListResponse {
+	return &ScimListResponse{
+		Schemas:      []string{models.ScimSchemaListResponse},
+		TotalResults: totalResults,
+		StartIndex:   startIndex,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	}
+}
+
+type ScimErrorResponse struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail"`
+}
+
+func NewScimErrorResponse(err *models.ScimError) *ScimErrorResponse {
+	return &ScimErrorResponse{
+		Schemas:  []string{models.ScimSchemaError},
+		Status:   strconv.Itoa(err.Status),
+		ScimType: err.ScimType,
+		Detail:   err.Detail,
+	}
+}
+
+type ScimSupported struct {
+	Supported bool `json:"supported"`
+}
+
+type ScimFilterSupported struct {
+	Supported  bool `json:"supported"`
+	MaxResults int  `json:"maxResults"`
+}
+
+type ScimBulkSupported struct {
+	Supported      bool `json:"supported"`
+	MaxOperations  int  `json:"maxOperations"`
+	MaxPayloadSize int  `json:"maxPayloadSize"`
+}
+
+type ScimAuthenticationScheme struct {
+	Type        string `json:"type"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Primary     bool   `json:"primary"`
+}
+
+// ScimGroupsConfig says which group operations are served, groups map to roles so only PATCH of members is
+type ScimGroupsConfig struct {
+	Create      bool   `json:"create"`
+	Replace     bool   `json:"replace"`
+	Patch       bool   `json:"patch"`
+	Delete      bool   `json:"delete"`
+	Description string `json:"description"`
+}
+
+type ScimServiceProviderConfigResponse struct {
+	Schemas               []string                   `json:"schemas"`
+	Patch                 ScimSupported              `json:"patch"`
+	Bulk                  ScimBulkSupported          `json:"bulk"`
+	Filter                ScimFilterSupported        `json:"filter"`
+	ChangePassword        ScimSupported              `json:"changePassword"`
+	Sort                  ScimSupported              `json:"sort"`
+	Etag                  ScimSupported              `json:"etag"`
+	AuthenticationSchemes []ScimAuthenticationScheme `json:"authenticationSchemes"`
+	Groups                ScimGroupsConfig           `json:"urn:saufiroja:params:scim:schemas:extension:auth-service:2.0:ServiceProviderConfig"`
+}
+
+func NewScimServiceProviderConfigResponse(maxResults int) *ScimServiceProviderConfigResponse {
+	return &ScimServiceProviderConfigResponse{
+		Schemas:        []string{models.ScimSchemaServiceProviderConfig, models.ScimSchemaGroupsConfig},
+		Patch:          ScimSupported{Supported: true},
+		Filter:         ScimFilterSupported{Supported: true, MaxResults: maxResults},
+		ChangePassword: ScimSupported{Supported: false},
+		Sort:           ScimSupported{Supported: false},
+		Etag:           ScimSupported{Supported: true},
+		AuthenticationSchemes: []ScimAuthenticationScheme{{
+			Type:        "oauthbearertoken",
+			Name:        "API key",
+			Description: "An api key with the scim:provision scope sent as a bearer token",
+			Primary:     true,
+		}},
+		Groups: ScimGroupsConfig{Patch: true, Description: models.ScimGroupsReadOnly},
+	}
+}
@@ -0,0 +1,222 @@
+package controllers
+
+import (
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/saufiroja/go-otel/auth-service/internal/contracts/requests"
+	"github.com/saufiroja/go-otel/auth-service/internal/contracts/responses"
+	"github.com/saufiroja/go-otel/auth-service/internal/middlerwares"
+	"github.com/saufiroja/go-otel/auth-service/internal/models"
+	"github.com/saufiroja/go-otel/auth-service/internal/services"
+	"github.com/saufiroja/go-otel/auth-service/pkg/observability/metrics"
+	"github.com/saufiroja/go-otel/auth-service/pkg/observability/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"time"
+)
+
+type adminController struct {
+	AdminService services.AdminService
+	AuditService services.AuditService
+	Trace        *tracing.Tracer
+	Meter        *metrics.Metric
+}
+
+func NewAdminController(adminService services.AdminService, auditService services.AuditService,
+	trace *tracing.Tracer, meter *metrics.Metric) AdminController {
+	return &adminController{
+		AdminService: adminService,
+		AuditService: auditService,
+		Trace:        trace,
+		Meter:        meter,
+	}
+}
+
+func (a *adminController) ChangeUserStatus(c *fiber.Ctx) error {
+	ctx, span := a.Trace.StartSpan(c.Context(), "controller.ChangeUserStatus")
+	defer span.End()
+
+	a.Meter.Add(ctx, metrics.StatusChanges, 1)
+
+	actorId, _ := c.Locals(middlerwares.UserIdKey).(string)
+	userId := c.Params("id")
+	span.SetAttributes(
+		attribute.Key("actor_id").String(actorId),
+		attribute.Key("user_id").String(userId),
+	)
+
+	request := &requests.ChangeStatusRequest{}
+	err := c.BodyParser(request)
+	if err != nil {
+		span.AddEvent("Failed to parse request body")
+		span.SetStatus(codes.Error, "Bad request body")
+		response := responses.NewResponse[any](
+			err.Error(), fiber.StatusBadRequest, nil)
+		return c.Status(fiber.StatusBadRequest).JSON(response)
+	}
+
+	err = a.AdminService.ChangeUserStatus(ctx, actorId, userId, request)
+	if err != nil {
+		span.AddEvent("Failed to change user status")
+		span.SetStatus(codes.Error, err.Error())
+		response := responses.NewResponse[any](
+			err.Error(), fiber.StatusBadRequest, nil)
+		return c.Status(fiber.StatusBadRequest).JSON(response)
+	}
+
+	span.AddEvent("User status changed successfully")
+	span.SetStatus(codes.Ok, "User status changed successfully")
+
+	responseSuccess := responses.NewResponse[any](
+		"User status changed successfully", fiber.StatusOK, nil)
+	return c.Status(fiber.StatusOK).JSON(responseSuccess)
+}
+
+func (a *adminController) GetStatusChanges(c *fiber.Ctx) error {
+	ctx, span := a.Trace.StartSpan(c.Context(), "controller.GetStatusChanges")
+	defer span.End()
+
+	userId := c.Params("id")
+	span.SetAttributes(attribute.Key("user_id").String(userId))
+
+	changes, err := a.AdminService.GetStatusChanges(ctx, userId)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		response := responses.NewResponse[any](
+			err.Error(), fiber.StatusBadRequest, nil)
+		return c.Status(fiber.StatusBadRequest).JSON(response)
+	}
+
+	span.SetStatus(codes.Ok, "Status changes retrieved successfully")
+
+	responseSuccess := responses.NewResponse[any](
+		"Status changes retrieved successfully", fiber.StatusOK, changes)
+	return c.Status(fiber.StatusOK).JSON(responseSuccess)
+}
+
+func (a *adminController) ListAuditEvents(c *fiber.Ctx) error {
+	ctx, span := a.Trace.StartSpan(c.Context(), "controller.ListAuditEvents")
+	defer span.End()
+
+	filter := &models.AuditFilter{
+		ActorId:       c.Query("actor_id"),
+		TargetId:      c.Query("target_id"),
+		EventType:     c.Query("event_type"),
+		AfterSequence: int64(c.QueryInt("after_sequence")),
+		Limit:         c.QueryInt("limit"),
+	}
+	for key, target := range map[string]**time.Time{"from": &filter.From, "to": &filter.To} {
+		value := c.Query(key)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			span.SetStatus(codes.Error, "Bad query parameter")
+			response := responses.NewResponse[any](
+				fmt.Sprintf("%s must be an RFC 3339 timestamp", key), fiber.StatusBadRequest, nil)
+			return c.Status(fiber.StatusBadRequest).JSON(response)
+		}
+		parsed = parsed.UTC()
+		*target = &parsed
+	}
+
+	events, err := a.AuditService.ListEvents(ctx, filter)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		response := responses.NewResponse[any](
+			err.Error(), fiber.StatusBadRequest, nil)
+		return c.Status(fiber.StatusBadRequest).JSON(response)
+	}
+
+	span.SetStatus(codes.Ok, "Audit events retrieved successfully")
+
+	responseSuccess := responses.NewResponse[any](
+		"Audit events retrieved successfully", fiber.StatusOK, events)
+	return c.Status(fiber.StatusOK).JSON(responseSuccess)
+}
+
+func (a *adminController) Impersonate(c *fiber.Ctx) error {
+	ctx, span := a.Trace.StartSpan(c.Context(), "controller.Impersonate")
+	defer span.End()
+
+	a.Meter.Add(ctx, metrics.Impersonations, 1)
+
+	actor, _ := c.Locals(middlerwares.PrincipalKey).(*models.Principal)
+	userId := c.Params("id")
+	span.SetAttributes(
+		attribute.Key("actor_id").String(actor.UserId),
+		attribute.Key("user_id").String(userId),
+	)
+
+	request := &requests.ImpersonateRequest{}
+	err := c.BodyParser(request)
+	if err != nil {
+		span.AddEvent("Failed to parse request body")
+		span.SetStatus(codes.Error, "Bad request body")
+		response := responses.NewResponse[any](
+			err.Error(), fiber.StatusBadRequest, nil)
+		return c.Status(fiber.StatusBadRequest).JSON(response)
+	}
+
+	impersonation, err := a.AdminService.Impersonate(ctx, actor, userId, request)
+	if err != nil {
+		span.AddEvent("Failed to impersonate user")
+		span.SetStatus(codes.Error, err.Error())
+		response := responses.NewResponse[any](
+			err.Error(), fiber.StatusBadRequest, nil)
+		return c.Status(fiber.StatusBadRequest).JSON(response)
+	}
+
+	span.SetStatus(codes.Ok, "Impersonation token issued")
+
+	responseSuccess := responses.NewResponse[any](
+		"Impersonation token issued successfully", fiber.StatusCreated, impersonation)
+	return c.Status(fiber.StatusCreated).JSON(responseSuccess)
+}
+
+func (a *adminController) GetLogLevel(c *fiber.Ctx) error {
+	ctx, span := a.Trace.StartSpan(c.Context(), "controller.GetLogLevel")
+	defer span.End()
+
+	level := a.AdminService.GetLogLevel(ctx)
+
+	span.SetStatus(codes.Ok, "Log level retrieved successfully")
+
+	responseSuccess := responses.NewResponse[any](
+		"Log level retrieved successfully", fiber.StatusOK, level)
+	return c.Status(fiber.StatusOK).JSON(responseSuccess)
+}
+
+func (a *adminController) ChangeLogLevel(c *fiber.Ctx) error {
+	ctx, span := a.Trace.StartSpan(c.Context(), "controller.ChangeLogLevel")
+	defer span.End()
+
+	actorId, _ := c.Locals(middlerwares.UserIdKey).(string)
+	span.SetAttributes(attribute.Key("actor_id").String(actorId))
+
+	request := &requests.ChangeLogLevelRequest{}
+	err := c.BodyParser(request)
+	if err != nil {
+		span.AddEvent("Failed to parse request body")
+		span.SetStatus(codes.Error, "Bad request body")
+		response := responses.NewResponse[any](
+			err.Error(), fiber.StatusBadRequest, nil)
+		return c.Status(fiber.StatusBadRequest).JSON(response)
+	}
+
+	level, err := a.AdminService.ChangeLogLevel(ctx, actorId, request)
+	if err != nil {
+		span.AddEvent("Failed to change log level")
+		span.SetStatus(codes.Error, err.Error())
+		response := responses.NewResponse[any](
+			err.Error(), fiber.StatusBadRequest, nil)
+		return c.Status(fiber.StatusBadRequest).JSON(response)
+	}
+
+	span.SetStatus(codes.Ok, "Log level changed successfully")
+
+	responseSuccess := responses.NewResponse[any](
+		"Log level changed successfully", fiber.StatusOK, level)
+	return c.Status(fiber.StatusOK).JSON(responseSuccess)
+}
@@ -0,0 +1,14 @@
+package controllers
+
+import (
+	"github.com/gofiber/fiber/v2"
+)
+
+type AdminController interface {
+	ChangeUserStatus(c *fiber.Ctx) error
+	GetStatusChanges(c *fiber.Ctx) error
+	ListAuditEvents(c *fiber.Ctx) error
+	Impersonate(c *fiber.Ctx) error
+	GetLogLevel(c *fiber.Ctx) error
+	ChangeLogLevel(c *fiber.Ctx) error
+}
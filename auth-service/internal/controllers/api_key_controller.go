@@ -0,0 +1,257 @@
+package controllers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/saufiroja/go-otel/auth-service/internal/contracts/requests"
+	"github.com/saufiroja/go-otel/auth-service/internal/contracts/responses"
+	"github.com/saufiroja/go-otel/auth-service/internal/middlerwares"
+	"github.com/saufiroja/go-otel/auth-service/internal/models"
+	"github.com/saufiroja/go-otel/auth-service/internal/services"
+	"github.com/saufiroja/go-otel/auth-service/pkg/observability/metrics"
+	"github.com/saufiroja/go-otel/auth-service/pkg/observability/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+type apiKeyController struct {
+	ApiKeyService services.ApiKeyService
+	Trace         *tracing.Tracer
+	Meter         *metrics.Metric
+}
+
+func NewApiKeyController(apiKeyService services.ApiKeyService, trace *tracing.Tracer,
+	meter *metrics.Metric) ApiKeyController {
+	return &apiKeyController{
+		ApiKeyService: apiKeyService,
+		Trace:         trace,
+		Meter:         meter,
+	}
+}
+
+func (a *apiKeyController) CreateServiceAccount(c *fiber.Ctx) error {
+	ctx, span := a.Trace.StartSpan(c.Context(), "controller.CreateServiceAccount")
+	defer span.End()
+
+	actorId, _ := c.Locals(middlerwares.UserIdKey).(string)
+	span.SetAttributes(attribute.Key("actor_id").String(actorId))
+
+	request := &requests.CreateServiceAccountRequest{}
+	err := c.BodyParser(request)
+	if err != nil {
+		span.AddEvent("Failed to parse request body")
+		span.SetStatus(codes.Error, "Bad request body")
+		response := responses.NewResponse[any](
+			err.Error(), fiber.StatusBadRequest, nil)
+		return c.Status(fiber.StatusBadRequest).JSON(response)
+	}
+
+	account, err := a.ApiKeyService.CreateServiceAccount(ctx, actorId, request)
+	if err != nil {
+		span.AddEvent("Failed to create service account")
+		span.SetStatus(codes.Error, err.Error())
+		response := responses.NewResponse[any](
+			err.Error(), fiber.StatusBadRequest, nil)
+		return c.Status(fiber.StatusBadRequest).JSON(response)
+	}
+
+	span.SetStatus(codes.Ok, "Service account created")
+
+	responseSuccess := responses.NewResponse[any](
+		"Service account created successfully", fiber.StatusCreated, account)
+	return c.Status(fiber.StatusCreated).JSON(responseSuccess)
+}
+
+func (a *apiKeyController) CreateApiKey(c *fiber.Ctx) error {
+	ctx, span := a.Trace.StartSpan(c.Context(), "controller.CreateApiKey")
+	defer span.End()
+
+	a.Meter.Add(ctx, metrics.ApiKeyCreations, 1)
+
+	actorId, _ := c.Locals(middlerwares.UserIdKey).(string)
+	serviceAccountId := c.Params("id")
+	span.SetAttributes(
+		attribute.Key("actor_id").String(actorId),
+		attribute.Key("service_account_id").String(serviceAccountId),
+	)
+
+	request := &requests.CreateApiKeyRequest{}
+	err := c.BodyParser(request)
+	if err != nil {
+		span.AddEvent("Failed to parse request body")
+		span.SetStatus(codes.Error, "Bad request body")
+		response := responses.NewResponse[any](
+			err.Error(), fiber.StatusBadRequest, nil)
+		return c.Status(fiber.StatusBadRequest).JSON(response)
+	}
+
+	key, plaintext, err := a.ApiKeyService.CreateApiKey(ctx, actorId, serviceAccountId, request)
+	if err != nil {
+		span.AddEvent("Failed to create api key")
+		span.SetStatus(codes.Error, err.Error())
+		response := responses.NewResponse[any](
+			err.Error(), fiber.StatusBadRequest, nil)
+		return c.Status(fiber.StatusBadRequest).JSON(response)
+	}
+
+	span.SetStatus(codes.Ok, "Api key created")
+
+	responseSuccess := responses.NewResponse[any](
+		"Api key created, it will not be shown again", fiber.StatusCreated,
+		&responses.CreatedApiKeyResponse{ApiKey: key, Key: plaintext})
+	return c.Status(fiber.StatusCreated).JSON(responseSuccess)
+}
+
+func (a *apiKeyController) ListApiKeys(c *fiber.Ctx) error {
+	ctx, span := a.Trace.StartSpan(c.Context(), "controller.ListApiKeys")
+	defer span.End()
+
+	serviceAccountId := c.Params("id")
+	span.SetAttributes(attribute.Key("service_account_id").String(serviceAccountId))
+
+	keys, err := a.ApiKeyService.ListApiKeys(ctx, serviceAccountId)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		response := responses.NewResponse[any](
+			err.Error(), fiber.StatusBadRequest, nil)
+		return c.Status(fiber.StatusBadRequest).JSON(response)
+	}
+
+	span.SetStatus(codes.Ok, "Api keys retrieved successfully")
+
+	responseSuccess := responses.NewResponse[any](
+		"Api keys retrieved successfully", fiber.StatusOK, keys)
+	return c.Status(fiber.StatusOK).JSON(responseSuccess)
+}
+
+func (a *apiKeyController) RotateApiKey(c *fiber.Ctx) error {
+	ctx, span := a.Trace.StartSpan(c.Context(), "controller.RotateApiKey")
+	defer span.End()
+
+	actorId, _ := c.Locals(middlerwares.UserIdKey).(string)
+	keyId := c.Params("id")
+	span.SetAttributes(
+		attribute.Key("actor_id").String(actorId),
+		attribute.Key("key_id").String(keyId),
+	)
+
+	key, plaintext, err := a.ApiKeyService.RotateApiKey(ctx, actorId, keyId)
+	if err != nil {
+		span.AddEvent("Failed to rotate api key")
+		span.SetStatus(codes.Error, err.Error())
+		response := responses.NewResponse[any](
+			err.Error(), fiber.StatusBadRequest, nil)
+		return c.Status(fiber.StatusBadRequest).JSON(response)
+	}
+
+	span.SetStatus(codes.Ok, "Api key rotated")
+
+	responseSuccess := responses.NewResponse[any](
+		"Api key rotated, the previous key stays valid for the grace period", fiber.StatusCreated,
+		&responses.CreatedApiKeyResponse{ApiKey: key, Key: plaintext})
+	return c.Status(fiber.StatusCreated).JSON(responseSuccess)
+}
+
+func (a *apiKeyController) RevokeApiKey(c *fiber.Ctx) error {
+	ctx, span := a.Trace.StartSpan(c.Context(), "controller.RevokeApiKey")
+	defer span.End()
+
+	actorId, _ := c.Locals(middlerwares.UserIdKey).(string)
+	keyId := c.Params("id")
+	span.SetAttributes(
+		attribute.Key("actor_id").String(actorId),
+		attribute.Key("key_id").String(keyId),
+	)
+
+	err := a.ApiKeyService.RevokeApiKey(ctx, actorId, keyId)
+	if err != nil {
+		span.AddEvent("Failed to revoke api key")
+		span.SetStatus(codes.Error, err.Error())
+		response := responses.NewResponse[any](
+			err.Error(), fiber.StatusNotFound, nil)
+		return c.Status(fiber.StatusNotFound).JSON(response)
+	}
+
+	span.SetStatus(codes.Ok, "Api key revoked")
+
+	responseSuccess := responses.NewResponse[any](
+		"Api key revoked successfully", fiber.StatusOK, nil)
+	return c.Status(fiber.StatusOK).JSON(responseSuccess)
+}
+
+// WhoAmI lets integrations check which service account and scopes their key resolves to
+func (a *apiKeyController) CreateClientCertificate(c *fiber.Ctx) error {
+	ctx, span := a.Trace.StartSpan(c.Context(), "controller.CreateClientCertificate")
+	defer span.End()
+
+	actorId, _ := c.Locals(middlerwares.UserIdKey).(string)
+	serviceAccountId := c.Params("id")
+	span.SetAttributes(
+		attribute.Key("actor_id").String(actorId),
+		attribute.Key("service_account_id").String(serviceAccountId),
+	)
+
+	request := &requests.CreateClientCertificateRequest{}
+	err := c.BodyParser(request)
+	if err != nil {
+		span.AddEvent("Failed to parse request body")
+		span.SetStatus(codes.Error, "Bad request body")
+		response := responses.NewResponse[any](
+			err.Error(), fiber.StatusBadRequest, nil)
+		return c.Status(fiber.StatusBadRequest).JSON(response)
+	}
+
+	certificate, err := a.ApiKeyService.CreateClientCertificate(ctx, actorId, serviceAccountId, request)
+	if err != nil {
+		span.AddEvent("Failed to create client certificate")
+		span.SetStatus(codes.Error, err.Error())
+		response := responses.NewResponse[any](
+			err.Error(), fiber.StatusBadRequest, nil)
+		return c.Status(fiber.StatusBadRequest).JSON(response)
+	}
+
+	span.SetStatus(codes.Ok, "Client certificate created")
+
+	responseSuccess := responses.NewResponse[any](
+		"Client certificate registered successfully", fiber.StatusCreated, certificate)
+	return c.Status(fiber.StatusCreated).JSON(responseSuccess)
+}
+
+func (a *apiKeyController) RevokeClientCertificate(c *fiber.Ctx) error {
+	ctx, span := a.Trace.StartSpan(c.Context(), "controller.RevokeClientCertificate")
+	defer span.End()
+
+	actorId, _ := c.Locals(middlerwares.UserIdKey).(string)
+	certificateId := c.Params("id")
+	span.SetAttributes(
+		attribute.Key("actor_id").String(actorId),
+		attribute.Key("certificate_id").String(certificateId),
+	)
+
+	err := a.ApiKeyService.RevokeClientCertificate(ctx, actorId, certificateId)
+	if err != nil {
+		span.AddEvent("Failed to revoke client certificate")
+		span.SetStatus(codes.Error, err.Error())
+		response := responses.NewResponse[any](
+			err.Error(), fiber.StatusNotFound, nil)
+		return c.Status(fiber.StatusNotFound).JSON(response)
+	}
+
+	span.SetStatus(codes.Ok, "Client certificate revoked")
+
+	responseSuccess := responses.NewResponse[any](
+		"Client certificate revoked successfully", fiber.StatusOK, nil)
+	return c.Status(fiber.StatusOK).JSON(responseSuccess)
+}
+
+func (a *apiKeyController) WhoAmI(c *fiber.Ctx) error {
+	_, span := a.Trace.StartSpan(c.Context(), "controller.WhoAmI")
+	defer span.End()
+
+	principal, _ := c.Locals(middlerwares.PrincipalKey).(*models.Principal)
+
+	span.SetStatus(codes.Ok, "Principal retrieved")
+
+	responseSuccess := responses.NewResponse[any](
+		"Principal retrieved successfully", fiber.StatusOK, principal)
+	return c.Status(fiber.StatusOK).JSON(responseSuccess)
+}
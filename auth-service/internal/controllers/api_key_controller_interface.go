@@ -0,0 +1,16 @@
+package controllers
+
+import (
+	"github.com/gofiber/fiber/v2"
+)
+
+type ApiKeyController interface {
+	CreateServiceAccount(c *fiber.Ctx) error
+	CreateApiKey(c *fiber.Ctx) error
+	ListApiKeys(c *fiber.Ctx) error
+	RotateApiKey(c *fiber.Ctx) error
+	RevokeApiKey(c *fiber.Ctx) error
+	CreateClientCertificate(c *fiber.Ctx) error
+	RevokeClientCertificate(c *fiber.Ctx) error
+	WhoAmI(c *fiber.Ctx) error
+}
@@ -0,0 +1,90 @@
+package controllers
+
+import "html/template"
+
+// devicePage is where users enter the code shown on their device, it must be opened in a browser signed in with
+// /login?mode=browser since answering the code needs the session cookies and the csrf token
+var devicePage = template.Must(template.New("device").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Connect a device</title>
+</head>
+<body>
+<h1>Connect a device</h1>
+<form id="lookup">
+  <label for="user_code">Enter the code shown on your device</label>
+  <input id="user_code" name="user_code" value="{{.UserCode}}" autocomplete="off" autocapitalize="characters" required>
+  <button type="submit">Continue</button>
+</form>
+<div id="decision" hidden>
+  <p><strong id="client"></strong> is asking to sign in to your account.</p>
+  <button type="button" data-approve="true">Allow</button>
+  <button type="button" data-approve="false">Deny</button>
+</div>
+<p id="message" role="status"></p>
+<script>
+const codePath = "{{.CodePath}}";
+const message = document.getElementById("message");
+const decision = document.getElementById("decision");
+const userCode = document.getElementById("user_code");
+
+function csrfToken() {
+  const match = document.cookie.match(/(?:^|; )csrf_token=([^;]*)/);
+  return match ? decodeURIComponent(match[1]) : "";
+}
+
+async function send(method, body) {
+  const url = method === "GET" ? codePath + "?user_code=" + encodeURIComponent(userCode.value) : codePath;
+  const response = await fetch(url, {
+    method: method,
+    credentials: "same-origin",
+    headers: {"Content-Type": "application/json", "X-CSRF-Token": csrfToken()},
+    body: body ? JSON.stringify(body) : undefined,
+  });
+  const payload = await response.json().catch(() => ({}));
+  if (response.status === 401) {
+    throw new Error("Sign in on this browser, then try again.");
+  }
+  if (!response.ok) {
+    throw new Error(payload.message || "Something went wrong.");
+  }
+  return payload;
+}
+
+document.getElementById("lookup").addEventListener("submit", async (event) => {
+  event.preventDefault();
+  message.textContent = "";
+  try {
+    const payload = await send("GET");
+    document.getElementById("client").textContent = payload.data.client_id;
+    decision.hidden = false;
+  } catch (error) {
+    decision.hidden = true;
+    message.textContent = error.message;
+  }
+});
+
+decision.addEventListener("click", async (event) => {
+  const approve = event.target.dataset.approve;
+  if (approve === undefined) {
+    return;
+  }
+  try {
+    await send("POST", {user_code: userCode.value, approve: approve === "true"});
+    decision.hidden = true;
+    message.textContent = approve === "true" ? "Your device is connected, you can close this page." : "The request was denied.";
+  } catch (error) {
+    message.textContent = error.message;
+  }
+});
+</script>
+</body>
+</html>
+`))
+
+type devicePageData struct {
+	UserCode string
+	CodePath string
+}
@@ -0,0 +1,219 @@
+package controllers
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/saufiroja/go-otel/auth-service/internal/contracts/requests"
+	"github.com/saufiroja/go-otel/auth-service/internal/contracts/responses"
+	"github.com/saufiroja/go-otel/auth-service/internal/middlerwares"
+	"github.com/saufiroja/go-otel/auth-service/internal/models"
+	"github.com/saufiroja/go-otel/auth-service/internal/services"
+	"github.com/saufiroja/go-otel/auth-service/pkg/observability/metrics"
+	"github.com/saufiroja/go-otel/auth-service/pkg/observability/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+const (
+	// DevicePath is the verification page of the device flow, DeviceCodePath is the api behind it
+	DevicePath     = "/device"
+	DeviceCodePath = "/device/code"
+)
+
+type oauthController struct {
+	OAuthService services.OAuthService
+	Trace        *tracing.Tracer
+	Meter        *metrics.Metric
+}
+
+func NewOAuthController(oauthService services.OAuthService, trace *tracing.Tracer,
+	meter *metrics.Metric) OAuthController {
+	return &oauthController{
+		OAuthService: oauthService,
+		Trace:        trace,
+		Meter:        meter,
+	}
+}
+
+// Token is the OAuth token endpoint, it answers with the bodies of RFC 6749 rather than the api's envelope
+func (o *oauthController) Token(c *fiber.Ctx) error {
+	ctx, span := o.Trace.StartSpan(c.Context(), "controller.OAuthToken")
+	defer span.End()
+
+	// tokens must never be cached by intermediaries, RFC 6749 section 5.1
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	c.Set(fiber.HeaderPragma, "no-cache")
+
+	request := &requests.OAuthTokenRequest{}
+	err := c.BodyParser(request)
+	if err != nil {
+		span.AddEvent("Failed to parse request body")
+		span.SetStatus(codes.Error, "Bad request body")
+		return oauthErrorResponse(c, models.NewOAuthError(models.OAuthErrorInvalidRequest, err.Error()))
+	}
+
+	span.SetAttributes(attribute.Key("grant_type").String(request.GrantType))
+
+	switch request.GrantType {
+	case models.GrantTypeTokenExchange:
+		o.Meter.Add(ctx, metrics.TokenExchanges, 1)
+
+		token, err := o.OAuthService.ExchangeToken(ctx, request)
+		if err != nil {
+			span.AddEvent("Failed to exchange token")
+			span.SetStatus(codes.Error, err.Error())
+			return oauthErrorResponse(c, err)
+		}
+
+		span.SetStatus(codes.Ok, "Token exchanged")
+		return c.Status(fiber.StatusOK).JSON(responses.NewExchangedTokenResponse(token))
+	case models.GrantTypeDeviceCode:
+		o.Meter.Add(ctx, metrics.DeviceCodePolls, 1)
+
+		token, err := o.OAuthService.PollDeviceCode(ctx, request)
+		if err != nil {
+			span.AddEvent("Device not authorized")
+			span.SetStatus(codes.Error, err.Error())
+			return oauthErrorResponse(c, err)
+		}
+
+		span.SetStatus(codes.Ok, "Device authorized")
+		return c.Status(fiber.StatusOK).JSON(responses.NewDeviceTokenResponse(token))
+	default:
+		span.AddEvent("Unsupported grant type")
+		span.SetStatus(codes.Error, "Unsupported grant type")
+		return oauthErrorResponse(c, models.NewOAuthError(models.OAuthErrorUnsupportedGrantType,
+			"unsupported grant_type"))
+	}
+}
+
+// DeviceAuthorization starts the device flow of a client that cannot open a browser, RFC 8628 section 3.1
+func (o *oauthController) DeviceAuthorization(c *fiber.Ctx) error {
+	ctx, span := o.Trace.StartSpan(c.Context(), "controller.DeviceAuthorization")
+	defer span.End()
+
+	o.Meter.Add(ctx, metrics.DeviceAuthorizations, 1)
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+
+	request := &requests.DeviceAuthorizationRequest{}
+	err := c.BodyParser(request)
+	if err != nil {
+		span.AddEvent("Failed to parse request body")
+		span.SetStatus(codes.Error, "Bad request body")
+		return oauthErrorResponse(c, models.NewOAuthError(models.OAuthErrorInvalidRequest, err.Error()))
+	}
+
+	authorization, err := o.OAuthService.AuthorizeDevice(ctx, request)
+	if err != nil {
+		span.AddEvent("Failed to authorize device")
+		span.SetStatus(codes.Error, err.Error())
+		return oauthErrorResponse(c, err)
+	}
+
+	if authorization.VerificationUri == "" {
+		authorization.VerificationUri = c.BaseURL() + DevicePath
+	}
+
+	span.SetStatus(codes.Ok, "Device code issued")
+	return c.Status(fiber.StatusOK).JSON(responses.NewDeviceAuthorizationResponse(authorization))
+}
+
+// DevicePage serves the page users enter their code on, verification_uri_complete pre-fills the code
+func (o *oauthController) DevicePage(c *fiber.Ctx) error {
+	_, span := o.Trace.StartSpan(c.Context(), "controller.DevicePage")
+	defer span.End()
+
+	c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+	c.Set(fiber.HeaderXFrameOptions, "DENY")
+
+	err := devicePage.Execute(c.Response().BodyWriter(), &devicePageData{
+		UserCode: c.Query("user_code"),
+		CodePath: DeviceCodePath,
+	})
+	if err != nil {
+		span.AddEvent("Failed to render device page")
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	span.SetStatus(codes.Ok, "Device page rendered")
+	return nil
+}
+
+func (o *oauthController) GetDeviceCode(c *fiber.Ctx) error {
+	ctx, span := o.Trace.StartSpan(c.Context(), "controller.GetDeviceCode")
+	defer span.End()
+
+	code, err := o.OAuthService.GetDeviceCode(ctx, c.Query("user_code"))
+	if err != nil {
+		span.AddEvent("Failed to get device code")
+		span.SetStatus(codes.Error, err.Error())
+		response := responses.NewResponse[any](
+			err.Error(), fiber.StatusNotFound, nil)
+		return c.Status(fiber.StatusNotFound).JSON(response)
+	}
+
+	span.SetStatus(codes.Ok, "Device code found")
+
+	responseSuccess := responses.NewResponse[any](
+		"Device code found", fiber.StatusOK, code)
+	return c.Status(fiber.StatusOK).JSON(responseSuccess)
+}
+
+func (o *oauthController) DecideDeviceCode(c *fiber.Ctx) error {
+	ctx, span := o.Trace.StartSpan(c.Context(), "controller.DecideDeviceCode")
+	defer span.End()
+
+	o.Meter.Add(ctx, metrics.DeviceDecisions, 1)
+
+	userId, _ := c.Locals(middlerwares.UserIdKey).(string)
+	span.SetAttributes(attribute.Key("user_id").String(userId))
+
+	request := &requests.DeviceVerificationRequest{}
+	err := c.BodyParser(request)
+	if err != nil {
+		span.AddEvent("Failed to parse request body")
+		span.SetStatus(codes.Error, "Bad request body")
+		response := responses.NewResponse[any](
+			err.Error(), fiber.StatusBadRequest, nil)
+		return c.Status(fiber.StatusBadRequest).JSON(response)
+	}
+
+	err = o.OAuthService.DecideDeviceCode(ctx, userId, request)
+	if err != nil {
+		span.AddEvent("Failed to decide device code")
+		span.SetStatus(codes.Error, err.Error())
+		response := responses.NewResponse[any](
+			err.Error(), fiber.StatusBadRequest, nil)
+		return c.Status(fiber.StatusBadRequest).JSON(response)
+	}
+
+	span.SetStatus(codes.Ok, "Device code decided")
+
+	message := "Device denied successfully"
+	if request.Approve {
+		message = "Device approved successfully"
+	}
+	responseSuccess := responses.NewResponse[any](
+		message, fiber.StatusOK, nil)
+	return c.Status(fiber.StatusOK).JSON(responseSuccess)
+}
+
+// oauthErrorResponse renders err as in RFC 6749 section 5.2, errors that are not an OAuthError become server_error
+func oauthErrorResponse(c *fiber.Ctx, err error) error {
+	oauthError := &models.OAuthError{}
+	if !errors.As(err, &oauthError) {
+		oauthError = models.NewOAuthError(models.OAuthErrorServerError, err.Error())
+	}
+
+	status := fiber.StatusBadRequest
+	switch oauthError.Code {
+	case models.OAuthErrorInvalidClient:
+		status = fiber.StatusUnauthorized
+	case models.OAuthErrorServerError:
+		status = fiber.StatusInternalServerError
+	}
+
+	return c.Status(status).JSON(responses.NewOAuthErrorResponse(oauthError))
+}
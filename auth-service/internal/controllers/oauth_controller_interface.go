@@ -0,0 +1,13 @@
+package controllers
+
+import (
+	"github.com/gofiber/fiber/v2"
+)
+
+type OAuthController interface {
+	Token(c *fiber.Ctx) error
+	DeviceAuthorization(c *fiber.Ctx) error
+	DevicePage(c *fiber.Ctx) error
+	GetDeviceCode(c *fiber.Ctx) error
+	DecideDeviceCode(c *fiber.Ctx) error
+}
@@ -0,0 +1,172 @@
+package controllers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/saufiroja/go-otel/auth-service/internal/contracts/responses"
+	"github.com/saufiroja/go-otel/auth-service/internal/middlerwares"
+	"github.com/saufiroja/go-otel/auth-service/internal/services"
+	"github.com/saufiroja/go-otel/auth-service/internal/utils"
+	"github.com/saufiroja/go-otel/auth-service/pkg/observability/metrics"
+	"github.com/saufiroja/go-otel/auth-service/pkg/observability/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+type oidcController struct {
+	OidcService    services.OidcService
+	BrowserCookies *utils.BrowserCookies
+	Trace          *tracing.Tracer
+	Meter          *metrics.Metric
+}
+
+func NewOidcController(oidcService services.OidcService, browserCookies *utils.BrowserCookies,
+	trace *tracing.Tracer, meter *metrics.Metric) OidcController {
+	return &oidcController{
+		OidcService:    oidcService,
+		BrowserCookies: browserCookies,
+		Trace:          trace,
+		Meter:          meter,
+	}
+}
+
+func (o *oidcController) Authorize(c *fiber.Ctx) error {
+	ctx, span := o.Trace.StartSpan(c.Context(), "controller.OidcAuthorize")
+	defer span.End()
+
+	provider := c.Params("provider")
+	span.SetAttributes(attribute.Key("provider").String(provider))
+
+	o.Meter.Add(ctx, metrics.OidcAuthorizeRequests, 1)
+
+	authorizationUrl, err := o.OidcService.Authorize(ctx, provider, "", c.Query("mode") == browserMode)
+	if err != nil {
+		span.AddEvent("Failed to start authorization")
+		span.SetStatus(codes.Error, err.Error())
+		response := responses.NewResponse[any](
+			err.Error(), fiber.StatusBadRequest, nil)
+		return c.Status(fiber.StatusBadRequest).JSON(response)
+	}
+
+	span.SetStatus(codes.Ok, "Redirecting to provider")
+
+	return c.Redirect(authorizationUrl, fiber.StatusFound)
+}
+
+func (o *oidcController) Callback(c *fiber.Ctx) error {
+	ctx, span := o.Trace.StartSpan(c.Context(), "controller.OidcCallback")
+	defer span.End()
+
+	provider := c.Params("provider")
+	span.SetAttributes(attribute.Key("provider").String(provider))
+
+	if providerError := c.Query("error"); providerError != "" {
+		span.AddEvent("Provider returned an error")
+		span.SetStatus(codes.Error, providerError)
+		response := responses.NewResponse[any](
+			"sign-in was cancelled or denied by the provider", fiber.StatusBadRequest, nil)
+		return c.Status(fiber.StatusBadRequest).JSON(response)
+	}
+
+	result, err := o.OidcService.Callback(ctx, provider, c.Query("code"), c.Query("state"))
+	if err != nil {
+		span.AddEvent("Callback failed")
+		span.SetStatus(codes.Error, err.Error())
+		response := responses.NewResponse[any](
+			err.Error(), fiber.StatusBadRequest, nil)
+		return c.Status(fiber.StatusBadRequest).JSON(response)
+	}
+
+	if result.Linked != nil {
+		span.SetStatus(codes.Ok, "Identity linked")
+		responseSuccess := responses.NewResponse[any](
+			"Identity linked successfully", fiber.StatusOK, result.Linked)
+		return c.Status(fiber.StatusOK).JSON(responseSuccess)
+	}
+
+	span.SetStatus(codes.Ok, "User logged in successfully")
+
+	if result.Browser {
+		return respondWithCookies(c, o.BrowserCookies, result.Token, "User logged in successfully")
+	}
+
+	responseSuccess := responses.NewResponse[any](
+		"User logged in successfully", fiber.StatusOK, result.Token)
+	return c.Status(fiber.StatusOK).JSON(responseSuccess)
+}
+
+func (o *oidcController) LinkIdentity(c *fiber.Ctx) error {
+	ctx, span := o.Trace.StartSpan(c.Context(), "controller.LinkIdentity")
+	defer span.End()
+
+	userId, _ := c.Locals(middlerwares.UserIdKey).(string)
+	provider := c.Params("provider")
+	span.SetAttributes(
+		attribute.Key("user_id").String(userId),
+		attribute.Key("provider").String(provider),
+	)
+
+	authorizationUrl, err := o.OidcService.Authorize(ctx, provider, userId, c.Query("mode") == browserMode)
+	if err != nil {
+		span.AddEvent("Failed to start authorization")
+		span.SetStatus(codes.Error, err.Error())
+		response := responses.NewResponse[any](
+			err.Error(), fiber.StatusBadRequest, nil)
+		return c.Status(fiber.StatusBadRequest).JSON(response)
+	}
+
+	span.SetStatus(codes.Ok, "Link started")
+
+	responseSuccess := responses.NewResponse[any](
+		"Continue at the provider to link the identity", fiber.StatusOK,
+		map[string]string{"authorization_url": authorizationUrl})
+	return c.Status(fiber.StatusOK).JSON(responseSuccess)
+}
+
+func (o *oidcController) ListIdentities(c *fiber.Ctx) error {
+	ctx, span := o.Trace.StartSpan(c.Context(), "controller.ListIdentities")
+	defer span.End()
+
+	userId, _ := c.Locals(middlerwares.UserIdKey).(string)
+	span.SetAttributes(attribute.Key("user_id").String(userId))
+
+	identities, err := o.OidcService.ListIdentities(ctx, userId)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		response := responses.NewResponse[any](
+			err.Error(), fiber.StatusBadRequest, nil)
+		return c.Status(fiber.StatusBadRequest).JSON(response)
+	}
+
+	span.SetStatus(codes.Ok, "Identities retrieved successfully")
+
+	responseSuccess := responses.NewResponse[any](
+		"Identities retrieved successfully", fiber.StatusOK, identities)
+	return c.Status(fiber.StatusOK).JSON(responseSuccess)
+}
+
+func (o *oidcController) UnlinkIdentity(c *fiber.Ctx) error {
+	ctx, span := o.Trace.StartSpan(c.Context(), "controller.UnlinkIdentity")
+	defer span.End()
+
+	userId, _ := c.Locals(middlerwares.UserIdKey).(string)
+	identityId := c.Params("id")
+	span.SetAttributes(
+		attribute.Key("user_id").String(userId),
+		attribute.Key("identity_id").String(identityId),
+	)
+
+	err := o.OidcService.UnlinkIdentity(ctx, userId, identityId)
+	if err != nil {
+		span.AddEvent("Failed to unlink identity")
+		span.SetStatus(codes.Error, err.Error())
+		response := responses.NewResponse[any](
+			err.Error(), fiber.StatusBadRequest, nil)
+		return c.Status(fiber.StatusBadRequest).JSON(response)
+	}
+
+	span.SetStatus(codes.Ok, "Identity unlinked")
+
+	responseSuccess := responses.NewResponse[any](
+		"Identity unlinked successfully", fiber.StatusOK, nil)
+	return c.Status(fiber.StatusOK).JSON(responseSuccess)
+}
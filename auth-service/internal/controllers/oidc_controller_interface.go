@@ -0,0 +1,13 @@
+package controllers
+
+import (
+	"github.com/gofiber/fiber/v2"
+)
+
+type OidcController interface {
+	Authorize(c *fiber.Ctx) error
+	Callback(c *fiber.Ctx) error
+	LinkIdentity(c *fiber.Ctx) error
+	ListIdentities(c *fiber.Ctx) error
+	UnlinkIdentity(c *fiber.Ctx) error
+}
@@ -0,0 +1,115 @@
+package controllers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/saufiroja/go-otel/auth-service/internal/contracts/requests"
+	"github.com/saufiroja/go-otel/auth-service/internal/contracts/responses"
+	"github.com/saufiroja/go-otel/auth-service/internal/middlerwares"
+	"github.com/saufiroja/go-otel/auth-service/internal/services"
+	"github.com/saufiroja/go-otel/auth-service/pkg/observability/metrics"
+	"github.com/saufiroja/go-otel/auth-service/pkg/observability/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+type personalAccessTokenController struct {
+	PersonalAccessTokenService services.PersonalAccessTokenService
+	Trace                      *tracing.Tracer
+	Meter                      *metrics.Metric
+}
+
+func NewPersonalAccessTokenController(personalAccessTokenService services.PersonalAccessTokenService,
+	trace *tracing.Tracer, meter *metrics.Metric) PersonalAccessTokenController {
+	return &personalAccessTokenController{
+		PersonalAccessTokenService: personalAccessTokenService,
+		Trace:                      trace,
+		Meter:                      meter,
+	}
+}
+
+func (p *personalAccessTokenController) CreateToken(c *fiber.Ctx) error {
+	ctx, span := p.Trace.StartSpan(c.Context(), "controller.CreatePersonalAccessToken")
+	defer span.End()
+
+	p.Meter.Add(ctx, metrics.PatCreations, 1)
+
+	userId, _ := c.Locals(middlerwares.UserIdKey).(string)
+	span.SetAttributes(attribute.Key("user_id").String(userId))
+
+	request := &requests.CreatePersonalAccessTokenRequest{}
+	err := c.BodyParser(request)
+	if err != nil {
+		span.AddEvent("Failed to parse request body")
+		span.SetStatus(codes.Error, "Bad request body")
+		response := responses.NewResponse[any](
+			err.Error(), fiber.StatusBadRequest, nil)
+		return c.Status(fiber.StatusBadRequest).JSON(response)
+	}
+
+	token, plaintext, err := p.PersonalAccessTokenService.CreateToken(ctx, userId, request)
+	if err != nil {
+		span.AddEvent("Failed to create personal access token")
+		span.SetStatus(codes.Error, err.Error())
+		response := responses.NewResponse[any](
+			err.Error(), fiber.StatusBadRequest, nil)
+		return c.Status(fiber.StatusBadRequest).JSON(response)
+	}
+
+	span.AddEvent("Personal access token created")
+	span.SetStatus(codes.Ok, "Personal access token created")
+
+	responseSuccess := responses.NewResponse[any](
+		"Personal access token created, it will not be shown again", fiber.StatusCreated,
+		&responses.CreatedPersonalAccessTokenResponse{PersonalAccessToken: token, Token: plaintext})
+	return c.Status(fiber.StatusCreated).JSON(responseSuccess)
+}
+
+func (p *personalAccessTokenController) ListTokens(c *fiber.Ctx) error {
+	ctx, span := p.Trace.StartSpan(c.Context(), "controller.ListPersonalAccessTokens")
+	defer span.End()
+
+	userId, _ := c.Locals(middlerwares.UserIdKey).(string)
+	span.SetAttributes(attribute.Key("user_id").String(userId))
+
+	tokens, err := p.PersonalAccessTokenService.ListTokens(ctx, userId)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		response := responses.NewResponse[any](
+			err.Error(), fiber.StatusBadRequest, nil)
+		return c.Status(fiber.StatusBadRequest).JSON(response)
+	}
+
+	span.SetStatus(codes.Ok, "Personal access tokens retrieved successfully")
+
+	responseSuccess := responses.NewResponse[any](
+		"Personal access tokens retrieved successfully", fiber.StatusOK, tokens)
+	return c.Status(fiber.StatusOK).JSON(responseSuccess)
+}
+
+func (p *personalAccessTokenController) RevokeToken(c *fiber.Ctx) error {
+	ctx, span := p.Trace.StartSpan(c.Context(), "controller.RevokePersonalAccessToken")
+	defer span.End()
+
+	userId, _ := c.Locals(middlerwares.UserIdKey).(string)
+	tokenId := c.Params("id")
+	span.SetAttributes(
+		attribute.Key("user_id").String(userId),
+		attribute.Key("token_id").String(tokenId),
+	)
+
+	err := p.PersonalAccessTokenService.RevokeToken(ctx, userId, tokenId)
+	if err != nil {
+		span.AddEvent("Failed to revoke personal access token")
+		span.SetStatus(codes.Error, err.Error())
+		response := responses.NewResponse[any](
+			err.Error(), fiber.StatusNotFound, nil)
+		return c.Status(fiber.StatusNotFound).JSON(response)
+	}
+
+	span.AddEvent("Personal access token revoked")
+	span.SetStatus(codes.Ok, "Personal access token revoked")
+
+	responseSuccess := responses.NewResponse[any](
+		"Personal access token revoked successfully", fiber.StatusOK, nil)
+	return c.Status(fiber.StatusOK).JSON(responseSuccess)
+}
@@ -0,0 +1,11 @@
+package controllers
+
+import (
+	"github.com/gofiber/fiber/v2"
+)
+
+type PersonalAccessTokenController interface {
+	CreateToken(c *fiber.Ctx) error
+	ListTokens(c *fiber.Ctx) error
+	RevokeToken(c *fiber.Ctx) error
+}
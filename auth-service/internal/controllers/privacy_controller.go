@@ -0,0 +1,114 @@
+package controllers
+
+import (
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/saufiroja/go-otel/auth-service/internal/contracts/requests"
+	"github.com/saufiroja/go-otel/auth-service/internal/contracts/responses"
+	"github.com/saufiroja/go-otel/auth-service/internal/middlerwares"
+	"github.com/saufiroja/go-otel/auth-service/internal/services"
+	"github.com/saufiroja/go-otel/auth-service/pkg/observability/metrics"
+	"github.com/saufiroja/go-otel/auth-service/pkg/observability/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+type privacyController struct {
+	PrivacyService services.PrivacyService
+	Trace          *tracing.Tracer
+	Meter          *metrics.Metric
+}
+
+func NewPrivacyController(privacyService services.PrivacyService, trace *tracing.Tracer,
+	meter *metrics.Metric) PrivacyController {
+	return &privacyController{
+		PrivacyService: privacyService,
+		Trace:          trace,
+		Meter:          meter,
+	}
+}
+
+func (p *privacyController) ExportUserData(c *fiber.Ctx) error {
+	ctx, span := p.Trace.StartSpan(c.Context(), "controller.ExportUserData")
+	defer span.End()
+
+	p.Meter.Add(ctx, metrics.DataExports, 1)
+
+	userId, _ := c.Locals(middlerwares.UserIdKey).(string)
+	span.SetAttributes(attribute.Key("user_id").String(userId))
+
+	export, err := p.PrivacyService.ExportUserData(ctx, userId)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		response := responses.NewResponse[any](
+			err.Error(), fiber.StatusBadRequest, nil)
+		return c.Status(fiber.StatusBadRequest).JSON(response)
+	}
+
+	span.SetStatus(codes.Ok, "User data exported successfully")
+
+	c.Attachment(fmt.Sprintf("export-%s.json", userId))
+	responseSuccess := responses.NewResponse[any](
+		"User data exported successfully", fiber.StatusOK, export)
+	return c.Status(fiber.StatusOK).JSON(responseSuccess)
+}
+
+func (p *privacyController) RequestErasure(c *fiber.Ctx) error {
+	ctx, span := p.Trace.StartSpan(c.Context(), "controller.RequestErasure")
+	defer span.End()
+
+	p.Meter.Add(ctx, metrics.ErasureRequests, 1)
+
+	userId, _ := c.Locals(middlerwares.UserIdKey).(string)
+	span.SetAttributes(attribute.Key("user_id").String(userId))
+
+	request := &requests.ErasureRequest{}
+	err := c.BodyParser(request)
+	if err != nil {
+		span.AddEvent("Failed to parse request body")
+		span.SetStatus(codes.Error, "Bad request body")
+		response := responses.NewResponse[any](
+			err.Error(), fiber.StatusBadRequest, nil)
+		return c.Status(fiber.StatusBadRequest).JSON(response)
+	}
+
+	erasure, err := p.PrivacyService.RequestErasure(ctx, userId, request)
+	if err != nil {
+		span.AddEvent("Failed to request erasure")
+		span.SetStatus(codes.Error, err.Error())
+		response := responses.NewResponse[any](
+			err.Error(), fiber.StatusBadRequest, nil)
+		return c.Status(fiber.StatusBadRequest).JSON(response)
+	}
+
+	span.AddEvent("Erasure requested")
+	span.SetStatus(codes.Ok, "Erasure requested")
+
+	responseSuccess := responses.NewResponse[any](
+		"Erasure scheduled", fiber.StatusAccepted, erasure)
+	return c.Status(fiber.StatusAccepted).JSON(responseSuccess)
+}
+
+func (p *privacyController) CancelErasure(c *fiber.Ctx) error {
+	ctx, span := p.Trace.StartSpan(c.Context(), "controller.CancelErasure")
+	defer span.End()
+
+	userId, _ := c.Locals(middlerwares.UserIdKey).(string)
+	span.SetAttributes(attribute.Key("user_id").String(userId))
+
+	err := p.PrivacyService.CancelErasure(ctx, userId)
+	if err != nil {
+		span.AddEvent("Failed to cancel erasure")
+		span.SetStatus(codes.Error, err.Error())
+		response := responses.NewResponse[any](
+			err.Error(), fiber.StatusBadRequest, nil)
+		return c.Status(fiber.StatusBadRequest).JSON(response)
+	}
+
+	span.AddEvent("Erasure cancelled")
+	span.SetStatus(codes.Ok, "Erasure cancelled")
+
+	responseSuccess := responses.NewResponse[any](
+		"Erasure cancelled", fiber.StatusOK, nil)
+	return c.Status(fiber.StatusOK).JSON(responseSuccess)
+}
@@ -0,0 +1,11 @@
+package controllers
+
+import (
+	"github.com/gofiber/fiber/v2"
+)
+
+type PrivacyController interface {
+	ExportUserData(c *fiber.Ctx) error
+	RequestErasure(c *fiber.Ctx) error
+	CancelErasure(c *fiber.Ctx) error
+}
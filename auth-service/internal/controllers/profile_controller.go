@@ -0,0 +1,197 @@
+package controllers
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/saufiroja/go-otel/auth-service/internal/contracts/requests"
+	"github.com/saufiroja/go-otel/auth-service/internal/contracts/responses"
+	"github.com/saufiroja/go-otel/auth-service/internal/middlerwares"
+	"github.com/saufiroja/go-otel/auth-service/internal/services"
+	"github.com/saufiroja/go-otel/auth-service/pkg/observability/metrics"
+	"github.com/saufiroja/go-otel/auth-service/pkg/observability/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+type profileController struct {
+	ProfileService services.ProfileService
+	Trace          *tracing.Tracer
+	Meter          *metrics.Metric
+}
+
+func NewProfileController(profileService services.ProfileService, trace *tracing.Tracer,
+	meter *metrics.Metric) ProfileController {
+	return &profileController{
+		ProfileService: profileService,
+		Trace:          trace,
+		Meter:          meter,
+	}
+}
+
+func (p *profileController) GetProfile(c *fiber.Ctx) error {
+	ctx, span := p.Trace.StartSpan(c.Context(), "controller.GetProfile")
+	defer span.End()
+
+	userId, _ := c.Locals(middlerwares.UserIdKey).(string)
+	span.SetAttributes(attribute.Key("user_id").String(userId))
+
+	user, err := p.ProfileService.GetProfile(ctx, userId)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		response := responses.NewResponse[any](
+			err.Error(), fiber.StatusNotFound, nil)
+		return c.Status(fiber.StatusNotFound).JSON(response)
+	}
+
+	span.SetStatus(codes.Ok, "Profile retrieved successfully")
+
+	responseSuccess := responses.NewResponse[any](
+		"Profile retrieved successfully", fiber.StatusOK, responses.NewProfileResponse(user))
+	return c.Status(fiber.StatusOK).JSON(responseSuccess)
+}
+
+func (p *profileController) UpdateProfile(c *fiber.Ctx) error {
+	ctx, span := p.Trace.StartSpan(c.Context(), "controller.UpdateProfile")
+	defer span.End()
+
+	p.Meter.Add(ctx, metrics.ProfileUpdates, 1)
+
+	userId, _ := c.Locals(middlerwares.UserIdKey).(string)
+	span.SetAttributes(attribute.Key("user_id").String(userId))
+
+	request := &requests.UpdateProfileRequest{}
+	err := c.BodyParser(request)
+	if err != nil {
+		span.AddEvent("Failed to parse request body")
+		span.SetStatus(codes.Error, "Bad request body")
+		response := responses.NewResponse[any](
+			err.Error(), fiber.StatusBadRequest, nil)
+		return c.Status(fiber.StatusBadRequest).JSON(response)
+	}
+
+	user, err := p.ProfileService.UpdateProfile(ctx, userId, request)
+	if err != nil {
+		span.AddEvent("Failed to update profile")
+		span.SetStatus(codes.Error, err.Error())
+		response := responses.NewResponse[any](
+			err.Error(), fiber.StatusBadRequest, nil)
+		return c.Status(fiber.StatusBadRequest).JSON(response)
+	}
+
+	span.AddEvent("Profile updated successfully")
+	span.SetStatus(codes.Ok, "Profile updated successfully")
+
+	responseSuccess := responses.NewResponse[any](
+		"Profile updated successfully", fiber.StatusOK, responses.NewProfileResponse(user))
+	return c.Status(fiber.StatusOK).JSON(responseSuccess)
+}
+
+func (p *profileController) RequestEmailChange(c *fiber.Ctx) error {
+	ctx, span := p.Trace.StartSpan(c.Context(), "controller.RequestEmailChange")
+	defer span.End()
+
+	p.Meter.Add(ctx, metrics.EmailChangeRequests, 1)
+
+	userId, _ := c.Locals(middlerwares.UserIdKey).(string)
+	span.SetAttributes(attribute.Key("user_id").String(userId))
+
+	request := &requests.ChangeEmailRequest{}
+	err := c.BodyParser(request)
+	if err != nil {
+		span.AddEvent("Failed to parse request body")
+		span.SetStatus(codes.Error, "Bad request body")
+		response := responses.NewResponse[any](
+			err.Error(), fiber.StatusBadRequest, nil)
+		return c.Status(fiber.StatusBadRequest).JSON(response)
+	}
+
+	err = p.ProfileService.RequestEmailChange(ctx, userId, request)
+	if err != nil {
+		span.AddEvent("Failed to request email change")
+		span.SetStatus(codes.Error, err.Error())
+		response := responses.NewResponse[any](
+			err.Error(), fiber.StatusBadRequest, nil)
+		return c.Status(fiber.StatusBadRequest).JSON(response)
+	}
+
+	span.AddEvent("Email change requested")
+	span.SetStatus(codes.Ok, "Email change requested")
+
+	responseSuccess := responses.NewResponse[any](
+		"Verification sent to the new email address", fiber.StatusAccepted, nil)
+	return c.Status(fiber.StatusAccepted).JSON(responseSuccess)
+}
+
+func (p *profileController) ConfirmEmailChange(c *fiber.Ctx) error {
+	ctx, span := p.Trace.StartSpan(c.Context(), "controller.ConfirmEmailChange")
+	defer span.End()
+
+	userId, _ := c.Locals(middlerwares.UserIdKey).(string)
+	span.SetAttributes(attribute.Key("user_id").String(userId))
+
+	request := &requests.ConfirmEmailChangeRequest{}
+	err := c.BodyParser(request)
+	if err != nil {
+		span.AddEvent("Failed to parse request body")
+		span.SetStatus(codes.Error, "Bad request body")
+		response := responses.NewResponse[any](
+			err.Error(), fiber.StatusBadRequest, nil)
+		return c.Status(fiber.StatusBadRequest).JSON(response)
+	}
+
+	user, err := p.ProfileService.ConfirmEmailChange(ctx, userId, request)
+	if err != nil {
+		span.AddEvent("Failed to confirm email change")
+		span.SetStatus(codes.Error, err.Error())
+		status := fiber.StatusBadRequest
+		if errors.Is(err, services.ErrEmailInUse) {
+			status = fiber.StatusConflict
+		}
+		response := responses.NewResponse[any](
+			err.Error(), status, nil)
+		return c.Status(status).JSON(response)
+	}
+
+	span.AddEvent("Email changed successfully")
+	span.SetStatus(codes.Ok, "Email changed successfully")
+
+	responseSuccess := responses.NewResponse[any](
+		"Email changed successfully", fiber.StatusOK, responses.NewProfileResponse(user))
+	return c.Status(fiber.StatusOK).JSON(responseSuccess)
+}
+
+func (p *profileController) ChangePassword(c *fiber.Ctx) error {
+	ctx, span := p.Trace.StartSpan(c.Context(), "controller.ChangePassword")
+	defer span.End()
+
+	p.Meter.Add(ctx, metrics.PasswordChanges, 1)
+
+	userId, _ := c.Locals(middlerwares.UserIdKey).(string)
+	span.SetAttributes(attribute.Key("user_id").String(userId))
+
+	request := &requests.ChangePasswordRequest{}
+	err := c.BodyParser(request)
+	if err != nil {
+		span.AddEvent("Failed to parse request body")
+		span.SetStatus(codes.Error, "Bad request body")
+		response := responses.NewResponse[any](
+			err.Error(), fiber.StatusBadRequest, nil)
+		return c.Status(fiber.StatusBadRequest).JSON(response)
+	}
+
+	err = p.ProfileService.ChangePassword(ctx, userId, request)
+	if err != nil {
+		span.AddEvent("Failed to change password")
+		span.SetStatus(codes.Error, err.Error())
+		response := responses.NewResponse[any](
+			err.Error(), fiber.StatusBadRequest, nil)
+		return c.Status(fiber.StatusBadRequest).JSON(response)
+	}
+
+	span.AddEvent("Password changed successfully")
+	span.SetStatus(codes.Ok, "Password changed successfully")
+
+	responseSuccess := responses.NewResponse[any](
+		"Password changed successfully", fiber.StatusOK, nil)
+	return c.Status(fiber.StatusOK).JSON(responseSuccess)
+}
@@ -0,0 +1,13 @@
+package controllers
+
+import (
+	"github.com/gofiber/fiber/v2"
+)
+
+type ProfileController interface {
+	GetProfile(c *fiber.Ctx) error
+	UpdateProfile(c *fiber.Ctx) error
+	RequestEmailChange(c *fiber.Ctx) error
+	ConfirmEmailChange(c *fiber.Ctx) error
+	ChangePassword(c *fiber.Ctx) error
+}
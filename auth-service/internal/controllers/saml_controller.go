@@ -0,0 +1,123 @@
+package controllers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/saufiroja/go-otel/auth-service/internal/contracts/responses"
+	"github.com/saufiroja/go-otel/auth-service/internal/middlerwares"
+	"github.com/saufiroja/go-otel/auth-service/internal/services"
+	"github.com/saufiroja/go-otel/auth-service/internal/utils"
+	"github.com/saufiroja/go-otel/auth-service/pkg/observability/metrics"
+	"github.com/saufiroja/go-otel/auth-service/pkg/observability/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+type samlController struct {
+	SamlService    services.SamlService
+	BrowserCookies *utils.BrowserCookies
+	Trace          *tracing.Tracer
+	Meter          *metrics.Metric
+}
+
+func NewSamlController(samlService services.SamlService, browserCookies *utils.BrowserCookies,
+	trace *tracing.Tracer, meter *metrics.Metric) SamlController {
+	return &samlController{
+		SamlService:    samlService,
+		BrowserCookies: browserCookies,
+		Trace:          trace,
+		Meter:          meter,
+	}
+}
+
+func (s *samlController) Metadata(c *fiber.Ctx) error {
+	ctx, span := s.Trace.StartSpan(c.Context(), "controller.SamlMetadata")
+	defer span.End()
+
+	metadata, err := s.SamlService.Metadata(ctx)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		response := responses.NewResponse[any](
+			err.Error(), fiber.StatusInternalServerError, nil)
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+
+	span.SetStatus(codes.Ok, "Metadata generated")
+
+	c.Set(fiber.HeaderContentType, "application/samlmetadata+xml")
+	return c.Status(fiber.StatusOK).Send(metadata)
+}
+
+func (s *samlController) Login(c *fiber.Ctx) error {
+	ctx, span := s.Trace.StartSpan(c.Context(), "controller.SamlLogin")
+	defer span.End()
+
+	s.Meter.Add(ctx, metrics.SamlLoginRequests, 1)
+
+	redirectUrl, err := s.SamlService.Login(ctx, "", c.Query("mode") == browserMode)
+	if err != nil {
+		span.AddEvent("Failed to start SAML login")
+		span.SetStatus(codes.Error, err.Error())
+		response := responses.NewResponse[any](
+			err.Error(), fiber.StatusBadRequest, nil)
+		return c.Status(fiber.StatusBadRequest).JSON(response)
+	}
+
+	span.SetStatus(codes.Ok, "Redirecting to identity provider")
+
+	return c.Redirect(redirectUrl, fiber.StatusFound)
+}
+
+func (s *samlController) LinkIdentity(c *fiber.Ctx) error {
+	ctx, span := s.Trace.StartSpan(c.Context(), "controller.SamlLinkIdentity")
+	defer span.End()
+
+	userId, _ := c.Locals(middlerwares.UserIdKey).(string)
+	span.SetAttributes(attribute.Key("user_id").String(userId))
+
+	redirectUrl, err := s.SamlService.Login(ctx, userId, c.Query("mode") == browserMode)
+	if err != nil {
+		span.AddEvent("Failed to start SAML link")
+		span.SetStatus(codes.Error, err.Error())
+		response := responses.NewResponse[any](
+			err.Error(), fiber.StatusBadRequest, nil)
+		return c.Status(fiber.StatusBadRequest).JSON(response)
+	}
+
+	span.SetStatus(codes.Ok, "Link started")
+
+	responseSuccess := responses.NewResponse[any](
+		"Continue at the identity provider to link the identity", fiber.StatusOK,
+		map[string]string{"authorization_url": redirectUrl})
+	return c.Status(fiber.StatusOK).JSON(responseSuccess)
+}
+
+func (s *samlController) AssertionConsumer(c *fiber.Ctx) error {
+	ctx, span := s.Trace.StartSpan(c.Context(), "controller.SamlAssertionConsumer")
+	defer span.End()
+
+	result, err := s.SamlService.AssertionConsumer(ctx, c.FormValue("SAMLResponse"), c.FormValue("RelayState"))
+	if err != nil {
+		span.AddEvent("SAML sign-in failed")
+		span.SetStatus(codes.Error, err.Error())
+		response := responses.NewResponse[any](
+			err.Error(), fiber.StatusBadRequest, nil)
+		return c.Status(fiber.StatusBadRequest).JSON(response)
+	}
+
+	if result.Linked != nil {
+		span.SetStatus(codes.Ok, "Identity linked")
+		responseSuccess := responses.NewResponse[any](
+			"Identity linked successfully", fiber.StatusOK, result.Linked)
+		return c.Status(fiber.StatusOK).JSON(responseSuccess)
+	}
+
+	span.SetStatus(codes.Ok, "User logged in successfully")
+
+	if result.Browser {
+		return respondWithCookies(c, s.BrowserCookies, result.Token, "User logged in successfully")
+	}
+
+	responseSuccess := responses.NewResponse[any](
+		"User logged in successfully", fiber.StatusOK, result.Token)
+	return c.Status(fiber.StatusOK).JSON(responseSuccess)
+}
@@ -0,0 +1,12 @@
+package controllers
+
+import (
+	"github.com/gofiber/fiber/v2"
+)
+
+type SamlController interface {
+	Metadata(c *fiber.Ctx) error
+	Login(c *fiber.Ctx) error
+	LinkIdentity(c *fiber.Ctx) error
+	AssertionConsumer(c *fiber.Ctx) error
+}
@@ -0,0 +1,336 @@
+package controllers
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/saufiroja/go-otel/auth-service/internal/contracts/requests"
+	"github.com/saufiroja/go-otel/auth-service/internal/contracts/responses"
+	"github.com/saufiroja/go-otel/auth-service/internal/middlerwares"
+	"github.com/saufiroja/go-otel/auth-service/internal/models"
+	"github.com/saufiroja/go-otel/auth-service/internal/services"
+	"github.com/saufiroja/go-otel/auth-service/pkg/observability/metrics"
+	"github.com/saufiroja/go-otel/auth-service/pkg/observability/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+const (
+	// ScimBasePath is where the SCIM api is mounted, resource locations are built from it
+	ScimBasePath     = "/scim/v2"
+	scimDefaultCount = 100
+	scimMaxCount     = 200
+)
+
+type scimController struct {
+	ScimService services.ScimService
+	Trace       *tracing.Tracer
+	Meter       *metrics.Metric
+}
+
+func NewScimController(scimService services.ScimService, trace *tracing.Tracer,
+	meter *metrics.Metric) ScimController {
+	return &scimController{
+		ScimService: scimService,
+		Trace:       trace,
+		Meter:       meter,
+	}
+}
+
+func (s *scimController) ServiceProviderConfig(c *fiber.Ctx) error {
+	_, span := s.Trace.StartSpan(c.Context(), "controller.ScimServiceProviderConfig")
+	defer span.End()
+
+	span.SetStatus(codes.Ok, "Service provider config retrieved")
+
+	return c.Status(fiber.StatusOK).JSON(responses.NewScimServiceProviderConfigResponse(scimMaxCount),
+		models.ScimContentType)
+}
+
+func (s *scimController) ListUsers(c *fiber.Ctx) error {
+	ctx, span := s.Trace.StartSpan(c.Context(), "controller.ScimListUsers")
+	defer span.End()
+
+	principal, _ := c.Locals(middlerwares.PrincipalKey).(*models.Principal)
+	startIndex, count := scimPage(c)
+	filter := c.Query("filter")
+	span.SetAttributes(
+		attribute.Key("start_index").Int(startIndex),
+		attribute.Key("count").Int(count),
+	)
+
+	users, total, err := s.ScimService.ListUsers(ctx, principal, filter, startIndex, count)
+	if err != nil {
+		span.AddEvent("Failed to list scim users")
+		span.SetStatus(codes.Error, err.Error())
+		return scimErrorResponse(c, err)
+	}
+
+	baseUrl := c.BaseURL() + ScimBasePath
+	resources := make([]any, 0, len(users))
+	for _, user := range users {
+		resources = append(resources, responses.NewScimUserResponse(user, baseUrl))
+	}
+
+	span.SetStatus(codes.Ok, "Scim users retrieved")
+
+	return c.Status(fiber.StatusOK).JSON(responses.NewScimListResponse(resources, total, startIndex),
+		models.ScimContentType)
+}
+
+func (s *scimController) GetUser(c *fiber.Ctx) error {
+	ctx, span := s.Trace.StartSpan(c.Context(), "controller.ScimGetUser")
+	defer span.End()
+
+	principal, _ := c.Locals(middlerwares.PrincipalKey).(*models.Principal)
+	userId := c.Params("id")
+	span.SetAttributes(attribute.Key("user_id").String(userId))
+
+	user, err := s.ScimService.GetUser(ctx, principal, userId)
+	if err != nil {
+		span.AddEvent("Failed to get scim user")
+		span.SetStatus(codes.Error, err.Error())
+		return scimErrorResponse(c, err)
+	}
+
+	span.SetStatus(codes.Ok, "Scim user retrieved")
+
+	// a client holding the current version gets no body
+	if c.Get(fiber.HeaderIfNoneMatch) == user.Version() {
+		c.Set(fiber.HeaderETag, user.Version())
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
+	return scimUserResponse(c, fiber.StatusOK, user)
+}
+
+func (s *scimController) CreateUser(c *fiber.Ctx) error {
+	ctx, span := s.Trace.StartSpan(c.Context(), "controller.ScimCreateUser")
+	defer span.End()
+
+	s.Meter.Add(ctx, metrics.ScimUserCreations, 1)
+
+	principal, _ := c.Locals(middlerwares.PrincipalKey).(*models.Principal)
+
+	request := &requests.ScimUserRequest{}
+	err := c.BodyParser(request)
+	if err != nil {
+		span.AddEvent("Failed to parse request body")
+		span.SetStatus(codes.Error, "Bad request body")
+		return scimErrorResponse(c, models.NewScimError(fiber.StatusBadRequest, models.ScimErrorInvalidSyntax,
+			err.Error()))
+	}
+
+	user, err := s.ScimService.CreateUser(ctx, principal, request)
+	if err != nil {
+		span.AddEvent("Failed to create scim user")
+		span.SetStatus(codes.Error, err.Error())
+		return scimErrorResponse(c, err)
+	}
+
+	span.SetAttributes(attribute.Key("user_id").String(user.UserId))
+	span.SetStatus(codes.Ok, "Scim user created")
+
+	c.Location(c.BaseURL() + ScimBasePath + "/Users/" + user.UserId)
+	return scimUserResponse(c, fiber.StatusCreated, user)
+}
+
+func (s *scimController) ReplaceUser(c *fiber.Ctx) error {
+	ctx, span := s.Trace.StartSpan(c.Context(), "controller.ScimReplaceUser")
+	defer span.End()
+
+	principal, _ := c.Locals(middlerwares.PrincipalKey).(*models.Principal)
+	userId := c.Params("id")
+	span.SetAttributes(attribute.Key("user_id").String(userId))
+
+	request := &requests.ScimUserRequest{}
+	err := c.BodyParser(request)
+	if err != nil {
+		span.AddEvent("Failed to parse request body")
+		span.SetStatus(codes.Error, "Bad request body")
+		return scimErrorResponse(c, models.NewScimError(fiber.StatusBadRequest, models.ScimErrorInvalidSyntax,
+			err.Error()))
+	}
+
+	user, err := s.ScimService.ReplaceUser(ctx, principal, userId, c.Get(fiber.HeaderIfMatch), request)
+	if err != nil {
+		span.AddEvent("Failed to replace scim user")
+		span.SetStatus(codes.Error, err.Error())
+		return scimErrorResponse(c, err)
+	}
+
+	span.SetStatus(codes.Ok, "Scim user replaced")
+
+	return scimUserResponse(c, fiber.StatusOK, user)
+}
+
+func (s *scimController) PatchUser(c *fiber.Ctx) error {
+	ctx, span := s.Trace.StartSpan(c.Context(), "controller.ScimPatchUser")
+	defer span.End()
+
+	principal, _ := c.Locals(middlerwares.PrincipalKey).(*models.Principal)
+	userId := c.Params("id")
+	span.SetAttributes(attribute.Key("user_id").String(userId))
+
+	request := &requests.ScimPatchRequest{}
+	err := c.BodyParser(request)
+	if err != nil {
+		span.AddEvent("Failed to parse request body")
+		span.SetStatus(codes.Error, "Bad request body")
+		return scimErrorResponse(c, models.NewScimError(fiber.StatusBadRequest, models.ScimErrorInvalidSyntax,
+			err.Error()))
+	}
+
+	user, err := s.ScimService.PatchUser(ctx, principal, userId, c.Get(fiber.HeaderIfMatch), request)
+	if err != nil {
+		span.AddEvent("Failed to patch scim user")
+		span.SetStatus(codes.Error, err.Error())
+		return scimErrorResponse(c, err)
+	}
+
+	span.SetStatus(codes.Ok, "Scim user patched")
+
+	return scimUserResponse(c, fiber.StatusOK, user)
+}
+
+func (s *scimController) DeleteUser(c *fiber.Ctx) error {
+	ctx, span := s.Trace.StartSpan(c.Context(), "controller.ScimDeleteUser")
+	defer span.End()
+
+	principal, _ := c.Locals(middlerwares.PrincipalKey).(*models.Principal)
+	userId := c.Params("id")
+	span.SetAttributes(attribute.Key("user_id").String(userId))
+
+	err := s.ScimService.DeleteUser(ctx, principal, userId, c.Get(fiber.HeaderIfMatch))
+	if err != nil {
+		span.AddEvent("Failed to delete scim user")
+		span.SetStatus(codes.Error, err.Error())
+		return scimErrorResponse(c, err)
+	}
+
+	span.SetStatus(codes.Ok, "Scim user deleted")
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (s *scimController) ListGroups(c *fiber.Ctx) error {
+	ctx, span := s.Trace.StartSpan(c.Context(), "controller.ScimListGroups")
+	defer span.End()
+
+	principal, _ := c.Locals(middlerwares.PrincipalKey).(*models.Principal)
+
+	groups, err := s.ScimService.ListGroups(ctx, principal, c.Query("filter"))
+	if err != nil {
+		span.AddEvent("Failed to list scim groups")
+		span.SetStatus(codes.Error, err.Error())
+		return scimErrorResponse(c, err)
+	}
+
+	baseUrl := c.BaseURL() + ScimBasePath
+	resources := make([]any, 0, len(groups))
+	for _, group := range groups {
+		resources = append(resources, responses.NewScimGroupResponse(group, baseUrl))
+	}
+
+	span.SetStatus(codes.Ok, "Scim groups retrieved")
+
+	return c.Status(fiber.StatusOK).JSON(responses.NewScimListResponse(resources, len(resources), 1),
+		models.ScimContentType)
+}
+
+func (s *scimController) GetGroup(c *fiber.Ctx) error {
+	ctx, span := s.Trace.StartSpan(c.Context(), "controller.ScimGetGroup")
+	defer span.End()
+
+	principal, _ := c.Locals(middlerwares.PrincipalKey).(*models.Principal)
+	groupId := c.Params("id")
+	span.SetAttributes(attribute.Key("group_id").String(groupId))
+
+	group, err := s.ScimService.GetGroup(ctx, principal, groupId)
+	if err != nil {
+		span.AddEvent("Failed to get scim group")
+		span.SetStatus(codes.Error, err.Error())
+		return scimErrorResponse(c, err)
+	}
+
+	span.SetStatus(codes.Ok, "Scim group retrieved")
+
+	return scimGroupResponse(c, group)
+}
+
+func (s *scimController) PatchGroup(c *fiber.Ctx) error {
+	ctx, span := s.Trace.StartSpan(c.Context(), "controller.ScimPatchGroup")
+	defer span.End()
+
+	principal, _ := c.Locals(middlerwares.PrincipalKey).(*models.Principal)
+	groupId := c.Params("id")
+	span.SetAttributes(attribute.Key("group_id").String(groupId))
+
+	request := &requests.ScimPatchRequest{}
+	err := c.BodyParser(request)
+	if err != nil {
+		span.AddEvent("Failed to parse request body")
+		span.SetStatus(codes.Error, "Bad request body")
+		return scimErrorResponse(c, models.NewScimError(fiber.StatusBadRequest, models.ScimErrorInvalidSyntax,
+			err.Error()))
+	}
+
+	group, err := s.ScimService.PatchGroup(ctx, principal, groupId, c.Get(fiber.HeaderIfMatch), request)
+	if err != nil {
+		span.AddEvent("Failed to patch scim group")
+		span.SetStatus(codes.Error, err.Error())
+		return scimErrorResponse(c, err)
+	}
+
+	span.SetStatus(codes.Ok, "Scim group patched")
+
+	return scimGroupResponse(c, group)
+}
+
+// RejectGroupChange answers POST, PUT and DELETE of groups, the groups are the fixed role set and cannot be created,
+// replaced or deleted by a tenant
+func (s *scimController) RejectGroupChange(c *fiber.Ctx) error {
+	_, span := s.Trace.StartSpan(c.Context(), "controller.ScimRejectGroupChange")
+	defer span.End()
+
+	span.SetAttributes(attribute.Key("http.request.method").String(c.Method()))
+	span.SetStatus(codes.Error, "Groups are read only")
+
+	return scimErrorResponse(c, models.NewScimError(fiber.StatusBadRequest, models.ScimErrorMutability,
+		models.ScimGroupsReadOnly))
+}
+
+// scimPage reads the 1-based startIndex and count query parameters, clamped to what the api serves
+func scimPage(c *fiber.Ctx) (int, int) {
+	startIndex := c.QueryInt("startIndex", 1)
+	if startIndex < 1 {
+		startIndex = 1
+	}
+	count := c.QueryInt("count", scimDefaultCount)
+	if count < 0 {
+		count = 0
+	}
+	if count > scimMaxCount {
+		count = scimMaxCount
+	}
+	return startIndex, count
+}
+
+func scimUserResponse(c *fiber.Ctx, status int, user *models.ScimUser) error {
+	c.Set(fiber.HeaderETag, user.Version())
+	return c.Status(status).JSON(responses.NewScimUserResponse(user, c.BaseURL()+ScimBasePath),
+		models.ScimContentType)
+}
+
+func scimGroupResponse(c *fiber.Ctx, group *models.ScimGroup) error {
+	c.Set(fiber.HeaderETag, group.Version())
+	return c.Status(fiber.StatusOK).JSON(responses.NewScimGroupResponse(group, c.BaseURL()+ScimBasePath),
+		models.ScimContentType)
+}
+
+func scimErrorResponse(c *fiber.Ctx, err error) error {
+	scimError := &models.ScimError{}
+	if !errors.As(err, &scimError) {
+		scimError = models.NewScimError(fiber.StatusInternalServerError, "", err.Error())
+	}
+	return c.Status(scimError.Status).JSON(responses.NewScimErrorResponse(scimError), models.ScimContentType)
+}
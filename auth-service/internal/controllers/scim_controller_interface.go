@@ -0,0 +1,19 @@
+package controllers
+
+import (
+	"github.com/gofiber/fiber/v2"
+)
+
+type ScimController interface {
+	ServiceProviderConfig(c *fiber.Ctx) error
+	ListUsers(c *fiber.Ctx) error
+	GetUser(c *fiber.Ctx) error
+	CreateUser(c *fiber.Ctx) error
+	ReplaceUser(c *fiber.Ctx) error
+	PatchUser(c *fiber.Ctx) error
+	DeleteUser(c *fiber.Ctx) error
+	ListGroups(c *fiber.Ctx) error
+	GetGroup(c *fiber.Ctx) error
+	PatchGroup(c *fiber.Ctx) error
+	RejectGroupChange(c *fiber.Ctx) error
+}
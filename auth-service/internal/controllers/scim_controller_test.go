@@ -0,0 +1,90 @@
+package controllers
+
+import (
+	"encoding/json"
+	"github.com/gofiber/fiber/v2"
+	"github.com/saufiroja/go-otel/auth-service/internal/contracts/responses"
+	"github.com/saufiroja/go-otel/auth-service/internal/models"
+	"github.com/saufiroja/go-otel/auth-service/pkg/observability/tracing"
+	"go.opentelemetry.io/otel/trace/noop"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newScimGroupsApp routes the group writes like app.go does, the service is never reached
+func newScimGroupsApp() *fiber.App {
+	controller := NewScimController(nil, &tracing.Tracer{Trace: noop.NewTracerProvider().Tracer("scim-test")}, nil)
+
+	app := fiber.New()
+	scim := app.Group(ScimBasePath)
+	scim.Get("/ServiceProviderConfig", controller.ServiceProviderConfig)
+	scim.Post("/Groups", controller.RejectGroupChange)
+	scim.Put("/Groups/:id", controller.RejectGroupChange)
+	scim.Delete("/Groups/:id", controller.RejectGroupChange)
+	return app
+}
+
+func TestScimGroupChangesAreRejected(t *testing.T) {
+	tests := []struct {
+		method string
+		path   string
+	}{
+		{method: fiber.MethodPost, path: "/Groups"},
+		{method: fiber.MethodPut, path: "/Groups/admin"},
+		{method: fiber.MethodDelete, path: "/Groups/admin"},
+	}
+
+	app := newScimGroupsApp()
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			request := httptest.NewRequest(tt.method, ScimBasePath+tt.path,
+				strings.NewReader(`{"schemas":["`+models.ScimSchemaGroup+`"],"displayName":"admin"}`))
+			request.Header.Set(fiber.HeaderContentType, models.ScimContentType)
+
+			response, err := app.Test(request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if response.StatusCode != fiber.StatusBadRequest {
+				t.Fatalf("status = %d, want %d", response.StatusCode, fiber.StatusBadRequest)
+			}
+			if contentType := response.Header.Get(fiber.HeaderContentType); contentType != models.ScimContentType {
+				t.Errorf("content type = %q, want %q", contentType, models.ScimContentType)
+			}
+
+			body := &responses.ScimErrorResponse{}
+			if err := json.NewDecoder(response.Body).Decode(body); err != nil {
+				t.Fatal(err)
+			}
+			if body.ScimType != models.ScimErrorMutability || body.Status != "400" ||
+				len(body.Schemas) != 1 || body.Schemas[0] != models.ScimSchemaError {
+				t.Errorf("error = %+v, want a SCIM mutability error", body)
+			}
+		})
+	}
+}
+
+func TestScimServiceProviderConfigGroups(t *testing.T) {
+	response, err := newScimGroupsApp().Test(httptest.NewRequest(fiber.MethodGet,
+		ScimBasePath+"/ServiceProviderConfig", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := &responses.ScimServiceProviderConfigResponse{}
+	if err := json.NewDecoder(response.Body).Decode(body); err != nil {
+		t.Fatal(err)
+	}
+	groups := body.Groups
+	if groups.Create || groups.Replace || groups.Delete || !groups.Patch {
+		t.Errorf("groups = %+v, want only patch supported", groups)
+	}
+	extended := false
+	for _, schema := range body.Schemas {
+		extended = extended || schema == models.ScimSchemaGroupsConfig
+	}
+	if !extended {
+		t.Errorf("schemas = %v, want the groups extension listed", body.Schemas)
+	}
+}
@@ -0,0 +1,80 @@
+package controllers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/saufiroja/go-otel/auth-service/internal/contracts/responses"
+	"github.com/saufiroja/go-otel/auth-service/internal/middlerwares"
+	"github.com/saufiroja/go-otel/auth-service/internal/models"
+	"github.com/saufiroja/go-otel/auth-service/internal/services"
+	"github.com/saufiroja/go-otel/auth-service/pkg/observability/metrics"
+	"github.com/saufiroja/go-otel/auth-service/pkg/observability/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+type sessionController struct {
+	SessionService services.SessionService
+	Trace          *tracing.Tracer
+	Meter          *metrics.Metric
+}
+
+func NewSessionController(sessionService services.SessionService, trace *tracing.Tracer,
+	meter *metrics.Metric) SessionController {
+	return &sessionController{
+		SessionService: sessionService,
+		Trace:          trace,
+		Meter:          meter,
+	}
+}
+
+func (s *sessionController) ListSessions(c *fiber.Ctx) error {
+	ctx, span := s.Trace.StartSpan(c.Context(), "controller.ListSessions")
+	defer span.End()
+
+	principal, _ := c.Locals(middlerwares.PrincipalKey).(*models.Principal)
+	span.SetAttributes(attribute.Key("user_id").String(principal.UserId))
+
+	sessions, err := s.SessionService.ListSessions(ctx, principal.UserId, principal.SessionId)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		response := responses.NewResponse[any](
+			err.Error(), fiber.StatusBadRequest, nil)
+		return c.Status(fiber.StatusBadRequest).JSON(response)
+	}
+
+	span.SetStatus(codes.Ok, "Sessions retrieved successfully")
+
+	responseSuccess := responses.NewResponse[any](
+		"Sessions retrieved successfully", fiber.StatusOK, sessions)
+	return c.Status(fiber.StatusOK).JSON(responseSuccess)
+}
+
+func (s *sessionController) RevokeSession(c *fiber.Ctx) error {
+	ctx, span := s.Trace.StartSpan(c.Context(), "controller.RevokeSession")
+	defer span.End()
+
+	s.Meter.Add(ctx, metrics.SessionRevocations, 1)
+
+	userId, _ := c.Locals(middlerwares.UserIdKey).(string)
+	sessionId := c.Params("id")
+	span.SetAttributes(
+		attribute.Key("user_id").String(userId),
+		attribute.Key("session_id").String(sessionId),
+	)
+
+	err := s.SessionService.RevokeSession(ctx, userId, sessionId)
+	if err != nil {
+		span.AddEvent("Failed to revoke session")
+		span.SetStatus(codes.Error, err.Error())
+		response := responses.NewResponse[any](
+			err.Error(), fiber.StatusNotFound, nil)
+		return c.Status(fiber.StatusNotFound).JSON(response)
+	}
+
+	span.AddEvent("Session revoked")
+	span.SetStatus(codes.Ok, "Session revoked")
+
+	responseSuccess := responses.NewResponse[any](
+		"Session revoked successfully", fiber.StatusOK, nil)
+	return c.Status(fiber.StatusOK).JSON(responseSuccess)
+}
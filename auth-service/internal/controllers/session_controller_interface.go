@@ -0,0 +1,10 @@
+package controllers
+
+import (
+	"github.com/gofiber/fiber/v2"
+)
+
+type SessionController interface {
+	ListSessions(c *fiber.Ctx) error
+	RevokeSession(c *fiber.Ctx) error
+}
@@ -4,7 +4,10 @@ import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/saufiroja/go-otel/auth-service/internal/contracts/requests"
 	"github.com/saufiroja/go-otel/auth-service/internal/contracts/responses"
+	"github.com/saufiroja/go-otel/auth-service/internal/middlerwares"
+	"github.com/saufiroja/go-otel/auth-service/internal/models"
 	"github.com/saufiroja/go-otel/auth-service/internal/services"
+	"github.com/saufiroja/go-otel/auth-service/internal/utils"
 	"github.com/saufiroja/go-otel/auth-service/pkg/observability/metrics"
 	"github.com/saufiroja/go-otel/auth-service/pkg/observability/tracing"
 	"go.opentelemetry.io/otel/attribute"
@@ -12,18 +15,25 @@ import (
 	"go.opentelemetry.io/otel/trace"
 )
 
+// browserMode is the value of the mode query parameter selecting cookie based tokens
+const browserMode = "browser"
+
 type userController struct {
-	UserService services.UserService
-	Trace       *tracing.Tracer
-	Meter       *metrics.Metric
+	UserService    services.UserService
+	SessionService services.SessionService
+	BrowserCookies *utils.BrowserCookies
+	Trace          *tracing.Tracer
+	Meter          *metrics.Metric
 }
 
-func NewUserController(userService services.UserService, trace *tracing.Tracer,
-	meter *metrics.Metric) UserController {
+func NewUserController(userService services.UserService, sessionService services.SessionService,
+	browserCookies *utils.BrowserCookies, trace *tracing.Tracer, meter *metrics.Metric) UserController {
 	return &userController{
-		UserService: userService,
-		Trace:       trace,
-		Meter:       meter,
+		UserService:    userService,
+		SessionService: sessionService,
+		BrowserCookies: browserCookies,
+		Trace:          trace,
+		Meter:          meter,
 	}
 }
 
@@ -31,7 +41,7 @@ func (u *userController) RegisterUser(c *fiber.Ctx) error {
 	ctx, span := u.Trace.StartSpan(c.Context(), "controller.RegisterUser")
 	defer span.End()
 
-	u.Meter.Counter(ctx, "number_of_register_requests", "Number of register requests", "request")
+	u.Meter.Add(ctx, metrics.RegisterRequests, 1)
 
 	request := &requests.RegisterRequest{}
 	err := c.BodyParser(request)
@@ -39,7 +49,6 @@ func (u *userController) RegisterUser(c *fiber.Ctx) error {
 		span.SetAttributes(
 			attribute.Key("error.email").String(request.Email),
 			attribute.Key("error.full_name").String(request.FullName),
-			attribute.Key("error.password").String(request.Password),
 		)
 		span.AddEvent("Failed to parse request body")
 		span.SetStatus(codes.Error, "Bad request body")
@@ -51,7 +60,6 @@ func (u *userController) RegisterUser(c *fiber.Ctx) error {
 	span.SetAttributes(
 		attribute.Key("email").String(request.Email),
 		attribute.Key("full_name").String(request.FullName),
-		attribute.Key("password").String(request.Password),
 	)
 
 	err = u.UserService.RegisterUser(ctx, request)
@@ -76,7 +84,7 @@ func (u *userController) LoginUser(c *fiber.Ctx) error {
 	ctx, span := u.Trace.StartSpan(c.Context(), "controller.LoginUser")
 	defer span.End()
 
-	u.Meter.Counter(ctx, "number_of_login_requests", "Number of login requests", "request")
+	u.Meter.Add(ctx, metrics.LoginRequests, 1)
 
 	request := &requests.LoginRequest{}
 	err := c.BodyParser(request)
@@ -92,6 +100,7 @@ func (u *userController) LoginUser(c *fiber.Ctx) error {
 
 	span.SetAttributes(attribute.Key("email").String(request.Email))
 
+	request.Browser = c.Query("mode") == browserMode
 	token, err := u.UserService.LoginUser(ctx, request)
 	if err != nil {
 		span.AddEvent("Login failed for user",
@@ -106,7 +115,130 @@ func (u *userController) LoginUser(c *fiber.Ctx) error {
 	span.AddEvent("User logged in successfully")
 	span.SetStatus(codes.Ok, "User logged in successfully")
 
+	if request.Browser {
+		return respondWithCookies(c, u.BrowserCookies, token, "User logged in successfully")
+	}
+
 	responseSuccess := responses.NewResponse[any](
 		"User logged in successfully", fiber.StatusOK, token)
 	return c.Status(fiber.StatusOK).JSON(responseSuccess)
 }
+
+func (u *userController) RefreshToken(c *fiber.Ctx) error {
+	ctx, span := u.Trace.StartSpan(c.Context(), "controller.RefreshToken")
+	defer span.End()
+
+	u.Meter.Add(ctx, metrics.RefreshRequests, 1)
+
+	request := &requests.RefreshTokenRequest{}
+	request.Browser = c.Query("mode") == browserMode
+	err := c.BodyParser(request)
+	if request.Browser {
+		request.RefreshToken = c.Cookies(utils.RefreshTokenCookie)
+		err = nil
+	}
+	if err != nil {
+		span.AddEvent("Failed to parse request body")
+		span.SetStatus(codes.Error, "Bad request body")
+
+		response := responses.NewResponse[any](
+			err.Error(), fiber.StatusBadRequest, nil)
+		return c.Status(fiber.StatusBadRequest).JSON(response)
+	}
+
+	token, err := u.UserService.RefreshToken(ctx, request)
+	if err != nil {
+		span.AddEvent("Token refresh failed")
+		span.SetStatus(codes.Error, err.Error())
+
+		response := responses.NewResponse[any](
+			err.Error(), fiber.StatusUnauthorized, nil)
+		return c.Status(fiber.StatusUnauthorized).JSON(response)
+	}
+
+	span.AddEvent("Token refreshed successfully")
+	span.SetStatus(codes.Ok, "Token refreshed successfully")
+
+	if request.Browser {
+		return respondWithCookies(c, u.BrowserCookies, token, "Token refreshed successfully")
+	}
+
+	responseSuccess := responses.NewResponse[any](
+		"Token refreshed successfully", fiber.StatusOK, token)
+	return c.Status(fiber.StatusOK).JSON(responseSuccess)
+}
+
+func (u *userController) Logout(c *fiber.Ctx) error {
+	ctx, span := u.Trace.StartSpan(c.Context(), "controller.Logout")
+	defer span.End()
+
+	principal, _ := c.Locals(middlerwares.PrincipalKey).(*models.Principal)
+	span.SetAttributes(
+		attribute.Key("user_id").String(principal.UserId),
+		attribute.Key("session_id").String(principal.SessionId),
+	)
+
+	err := u.SessionService.RevokeSession(ctx, principal.UserId, principal.SessionId)
+	if err != nil {
+		span.AddEvent("Failed to revoke session")
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	u.BrowserCookies.ClearTokenCookies(c)
+
+	span.AddEvent("User logged out")
+	span.SetStatus(codes.Ok, "User logged out")
+
+	responseSuccess := responses.NewResponse[any](
+		"User logged out successfully", fiber.StatusOK, nil)
+	return c.Status(fiber.StatusOK).JSON(responseSuccess)
+}
+
+// respondWithCookies sets the browser cookies and returns only the csrf token, keeping tokens out of scripts
+func respondWithCookies(c *fiber.Ctx, browserCookies *utils.BrowserCookies, token *models.Token, message string) error {
+	csrfToken, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		response := responses.NewResponse[any](
+			"error generating csrf token", fiber.StatusInternalServerError, nil)
+		return c.Status(fiber.StatusInternalServerError).JSON(response)
+	}
+
+	browserCookies.SetTokenCookies(c, token, csrfToken)
+
+	responseSuccess := responses.NewResponse[any](
+		message, fiber.StatusOK, map[string]string{"csrf_token": csrfToken})
+	return c.Status(fiber.StatusOK).JSON(responseSuccess)
+}
+
+func (u *userController) LinkDirectoryIdentity(c *fiber.Ctx) error {
+	ctx, span := u.Trace.StartSpan(c.Context(), "controller.LinkDirectoryIdentity")
+	defer span.End()
+
+	userId, _ := c.Locals(middlerwares.UserIdKey).(string)
+	span.SetAttributes(attribute.Key("user_id").String(userId))
+
+	request := &requests.LinkDirectoryRequest{}
+	err := c.BodyParser(request)
+	if err != nil {
+		span.AddEvent("Failed to parse request body")
+		span.SetStatus(codes.Error, "Bad request body")
+		response := responses.NewResponse[any](
+			err.Error(), fiber.StatusBadRequest, nil)
+		return c.Status(fiber.StatusBadRequest).JSON(response)
+	}
+
+	identity, err := u.UserService.LinkDirectoryIdentity(ctx, userId, utils.LdapProviderName, request)
+	if err != nil {
+		span.AddEvent("Failed to link directory identity")
+		span.SetStatus(codes.Error, err.Error())
+		response := responses.NewResponse[any](
+			err.Error(), fiber.StatusBadRequest, nil)
+		return c.Status(fiber.StatusBadRequest).JSON(response)
+	}
+
+	span.SetStatus(codes.Ok, "Identity linked")
+
+	responseSuccess := responses.NewResponse[any](
+		"Identity linked successfully", fiber.StatusOK, identity)
+	return c.Status(fiber.StatusOK).JSON(responseSuccess)
+}
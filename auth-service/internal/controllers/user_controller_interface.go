@@ -7,4 +7,7 @@ import (
 type UserController interface {
 	RegisterUser(c *fiber.Ctx) error
 	LoginUser(c *fiber.Ctx) error
+	RefreshToken(c *fiber.Ctx) error
+	Logout(c *fiber.Ctx) error
+	LinkDirectoryIdentity(c *fiber.Ctx) error
 }
@@ -0,0 +1,67 @@
+package middlerwares
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/saufiroja/go-otel/auth-service/internal/contracts/responses"
+	"github.com/saufiroja/go-otel/auth-service/internal/services"
+	"github.com/saufiroja/go-otel/auth-service/pkg/observability/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"strings"
+)
+
+// ApiKeyHeader carries the api key of service integrations
+const ApiKeyHeader = "X-API-Key"
+
+type ApiKeyMiddleware struct {
+	ApiKeyService services.ApiKeyService
+	Trace         *tracing.Tracer
+}
+
+func NewApiKeyMiddleware(apiKeyService services.ApiKeyService, trace *tracing.Tracer) *ApiKeyMiddleware {
+	return &ApiKeyMiddleware{
+		ApiKeyService: apiKeyService,
+		Trace:         trace,
+	}
+}
+
+// Authenticate sets the same locals as AuthMiddleware.Authenticate so RequireRole and RequireScope apply unchanged
+func (a *ApiKeyMiddleware) Authenticate() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctx, span := a.Trace.StartSpan(c.Context(), "middleware.Authenticate")
+		defer span.End()
+
+		// SCIM clients can only send the key as a bearer token
+		key := c.Get(ApiKeyHeader)
+		if key == "" {
+			key, _ = strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+		}
+		if key == "" {
+			span.AddEvent("Missing api key")
+			span.SetStatus(codes.Error, "Missing api key")
+			response := responses.NewResponse[any](
+				"missing api key", fiber.StatusUnauthorized, nil)
+			return c.Status(fiber.StatusUnauthorized).JSON(response)
+		}
+
+		principal, err := a.ApiKeyService.VerifyApiKey(ctx, key)
+		if err != nil {
+			span.AddEvent("Invalid api key")
+			span.SetStatus(codes.Error, err.Error())
+			response := responses.NewResponse[any](
+				err.Error(), fiber.StatusUnauthorized, nil)
+			return c.Status(fiber.StatusUnauthorized).JSON(response)
+		}
+
+		span.SetAttributes(
+			attribute.Key("user_id").String(principal.UserId),
+			attribute.Key("role").String(principal.Role),
+			attribute.Key("auth.method").String(principal.AuthMethod),
+		)
+		span.SetStatus(codes.Ok, "Authenticated")
+
+		c.Locals(UserIdKey, principal.UserId)
+		c.Locals(PrincipalKey, principal)
+		return c.Next()
+	}
+}
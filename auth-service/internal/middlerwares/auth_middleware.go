@@ -0,0 +1,152 @@
+package middlerwares
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/saufiroja/go-otel/auth-service/internal/contracts/responses"
+	"github.com/saufiroja/go-otel/auth-service/internal/models"
+	"github.com/saufiroja/go-otel/auth-service/internal/services"
+	"github.com/saufiroja/go-otel/auth-service/internal/utils"
+	"github.com/saufiroja/go-otel/auth-service/pkg/observability/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"strings"
+)
+
+const (
+	// UserIdKey is the fiber.Ctx locals key holding the authenticated user id
+	UserIdKey = "user_id"
+	// PrincipalKey is the fiber.Ctx locals key holding the authenticated *models.Principal
+	PrincipalKey = "principal"
+)
+
+type AuthMiddleware struct {
+	UserService services.UserService
+	Dpop        *DpopMiddleware
+	Trace       *tracing.Tracer
+}
+
+func NewAuthMiddleware(userService services.UserService, dpop *DpopMiddleware, trace *tracing.Tracer) *AuthMiddleware {
+	return &AuthMiddleware{
+		UserService: userService,
+		Dpop:        dpop,
+		Trace:       trace,
+	}
+}
+
+func (a *AuthMiddleware) Authenticate() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctx, span := a.Trace.StartSpan(c.Context(), "middleware.Authenticate")
+		defer span.End()
+
+		// browser clients send the access token in a cookie, csrf is checked separately by CsrfMiddleware
+		header := c.Get(fiber.HeaderAuthorization)
+		tokenString, found := strings.CutPrefix(header, "Bearer ")
+		dpopToken, dpop := strings.CutPrefix(header, models.TokenTypeDpop+" ")
+		if dpop {
+			tokenString, found = dpopToken, true
+		}
+		if header == "" {
+			tokenString = c.Cookies(utils.AccessTokenCookie)
+			found = true
+		}
+		if !found || tokenString == "" {
+			span.AddEvent("Missing bearer token")
+			span.SetStatus(codes.Error, "Missing bearer token")
+			response := responses.NewResponse[any](
+				"missing bearer token", fiber.StatusUnauthorized, nil)
+			return c.Status(fiber.StatusUnauthorized).JSON(response)
+		}
+
+		// the token is bound to a key the client proves on every request, see checkConfirmation
+		if dpop && tokenString != "" {
+			jkt, ok, err := a.Dpop.resourceProof(c, tokenString)
+			if !ok {
+				span.AddEvent("Invalid DPoP proof")
+				span.SetStatus(codes.Error, "Invalid DPoP proof")
+				return err
+			}
+			meta := utils.RequestMetaFromContext(c.Context())
+			meta.DpopJkt = jkt
+			c.Context().SetUserValue(utils.RequestMetaKey, meta)
+		}
+
+		principal, err := a.UserService.VerifyAccessToken(ctx, tokenString)
+		if err != nil {
+			span.AddEvent("Invalid access token")
+			span.SetStatus(codes.Error, err.Error())
+			response := responses.NewResponse[any](
+				err.Error(), fiber.StatusUnauthorized, nil)
+			return c.Status(fiber.StatusUnauthorized).JSON(response)
+		}
+
+		span.SetAttributes(
+			attribute.Key("user_id").String(principal.UserId),
+			attribute.Key("role").String(principal.Role),
+			attribute.Key("auth.method").String(principal.AuthMethod),
+		)
+		if principal.ActorId != "" {
+			span.SetAttributes(attribute.Key("auth.actor_id").String(principal.ActorId))
+			meta := utils.RequestMetaFromContext(c.Context())
+			meta.ActorId = principal.ActorId
+			c.Context().SetUserValue(utils.RequestMetaKey, meta)
+		}
+		span.SetStatus(codes.Ok, "Authenticated")
+
+		c.Locals(UserIdKey, principal.UserId)
+		c.Locals(PrincipalKey, principal)
+		return c.Next()
+	}
+}
+
+// RequireRole rejects requests whose principal does not have the given role, it must run after Authenticate
+func (a *AuthMiddleware) RequireRole(role string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, ok := c.Locals(PrincipalKey).(*models.Principal)
+		if !ok || principal.Role != role {
+			response := responses.NewResponse[any](
+				"forbidden", fiber.StatusForbidden, nil)
+			return c.Status(fiber.StatusForbidden).JSON(response)
+		}
+		return c.Next()
+	}
+}
+
+// RequirePermission rejects principals whose role was not granted permission, it must run after Authenticate
+func (a *AuthMiddleware) RequirePermission(permission string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, ok := c.Locals(PrincipalKey).(*models.Principal)
+		if !ok || !principal.HasPermission(permission) {
+			response := responses.NewResponse[any](
+				"forbidden", fiber.StatusForbidden, nil)
+			return c.Status(fiber.StatusForbidden).JSON(response)
+		}
+		return c.Next()
+	}
+}
+
+// RequireScope rejects principals that were not granted scope, it must run after Authenticate
+func (a *AuthMiddleware) RequireScope(scope string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, ok := c.Locals(PrincipalKey).(*models.Principal)
+		if !ok || !principal.HasScope(scope) {
+			response := responses.NewResponse[any](
+				"insufficient scope", fiber.StatusForbidden, nil)
+			return c.Status(fiber.StatusForbidden).JSON(response)
+		}
+		return c.Next()
+	}
+}
+
+// RequireSession restricts a route to interactive sign-ins, it guards account management from delegated and
+// impersonation tokens
+func (a *AuthMiddleware) RequireSession() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, ok := c.Locals(PrincipalKey).(*models.Principal)
+		if !ok || principal.AuthMethod != models.AuthMethodSession {
+			response := responses.NewResponse[any](
+				"this operation requires an interactive session", fiber.StatusForbidden, nil)
+			return c.Status(fiber.StatusForbidden).JSON(response)
+		}
+		return c.Next()
+	}
+}
@@ -0,0 +1,112 @@
+package middlerwares
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/saufiroja/go-otel/auth-service/internal/contracts/responses"
+	"github.com/saufiroja/go-otel/auth-service/internal/models"
+	"github.com/saufiroja/go-otel/auth-service/internal/utils"
+	"github.com/saufiroja/go-otel/auth-service/pkg/observability/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+type DpopMiddleware struct {
+	Verifier *utils.DpopVerifier
+	Trace    *tracing.Tracer
+}
+
+func NewDpopMiddleware(verifier *utils.DpopVerifier, trace *tracing.Tracer) *DpopMiddleware {
+	return &DpopMiddleware{
+		Verifier: verifier,
+		Trace:    trace,
+	}
+}
+
+// TokenEndpoint checks the DPoP proof of a request for tokens, the tokens issued to it are then bound to the key of
+// the proof through the request metadata, requests without a proof get bearer tokens
+func (d *DpopMiddleware) TokenEndpoint() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		proofs := c.Request().Header.PeekAll(utils.DpopHeader)
+		if len(proofs) == 0 {
+			return c.Next()
+		}
+
+		ctx, span := d.Trace.StartSpan(c.Context(), "middleware.DpopTokenEndpoint")
+		defer span.End()
+
+		c.Set(utils.DpopNonceHeader, d.Verifier.Nonce())
+
+		if len(proofs) > 1 {
+			span.AddEvent("More than one proof")
+			span.SetStatus(codes.Error, "More than one proof")
+			return c.Status(fiber.StatusBadRequest).JSON(responses.NewOAuthErrorResponse(
+				models.NewOAuthError(models.OAuthErrorInvalidDpopProof, "exactly one DPoP proof is allowed")))
+		}
+
+		jkt, err := d.Verifier.VerifyProof(ctx, string(proofs[0]), c.Method(), dpopRequestUrl(c), "")
+		if err != nil {
+			span.AddEvent("Invalid proof")
+			span.SetStatus(codes.Error, err.Error())
+			code := models.OAuthErrorInvalidDpopProof
+			if errors.Is(err, utils.ErrUseDpopNonce) {
+				code = models.OAuthErrorUseDpopNonce
+			}
+			return c.Status(fiber.StatusBadRequest).JSON(responses.NewOAuthErrorResponse(
+				models.NewOAuthError(code, err.Error())))
+		}
+
+		span.SetAttributes(attribute.Key("dpop.jkt").String(jkt))
+		span.SetStatus(codes.Ok, "Proof verified")
+
+		meta := utils.RequestMetaFromContext(c.Context())
+		meta.DpopJkt = jkt
+		c.Context().SetUserValue(utils.RequestMetaKey, meta)
+		return c.Next()
+	}
+}
+
+// resourceProof checks the proof sent with a DPoP access token, on failure it writes the 401 of RFC 9449 section 7.1
+// and returns ok false
+func (d *DpopMiddleware) resourceProof(c *fiber.Ctx, accessToken string) (string, bool, error) {
+	ctx, span := d.Trace.StartSpan(c.Context(), "middleware.DpopResource")
+	defer span.End()
+
+	c.Set(utils.DpopNonceHeader, d.Verifier.Nonce())
+
+	proofs := c.Request().Header.PeekAll(utils.DpopHeader)
+	if len(proofs) != 1 {
+		span.AddEvent("Missing proof")
+		span.SetStatus(codes.Error, "Missing proof")
+		return "", false, dpopUnauthorized(c, models.OAuthErrorInvalidDpopProof, "exactly one DPoP proof is required")
+	}
+
+	jkt, err := d.Verifier.VerifyProof(ctx, string(proofs[0]), c.Method(), dpopRequestUrl(c),
+		accessToken)
+	if err != nil {
+		span.AddEvent("Invalid proof")
+		span.SetStatus(codes.Error, err.Error())
+		code := models.OAuthErrorInvalidDpopProof
+		if errors.Is(err, utils.ErrUseDpopNonce) {
+			code = models.OAuthErrorUseDpopNonce
+		}
+		return "", false, dpopUnauthorized(c, code, err.Error())
+	}
+
+	span.SetAttributes(attribute.Key("dpop.jkt").String(jkt))
+	span.SetStatus(codes.Ok, "Proof verified")
+
+	return jkt, true, nil
+}
+
+func dpopUnauthorized(c *fiber.Ctx, code, message string) error {
+	c.Set(fiber.HeaderWWWAuthenticate, `DPoP error="`+code+`"`)
+	response := responses.NewResponse[any](
+		message, fiber.StatusUnauthorized, nil)
+	return c.Status(fiber.StatusUnauthorized).JSON(response)
+}
+
+// dpopRequestUrl is the url a proof's htu is compared with, the query is not part of it
+func dpopRequestUrl(c *fiber.Ctx) string {
+	return c.BaseURL() + c.Path()
+}
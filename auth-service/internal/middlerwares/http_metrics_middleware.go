@@ -0,0 +1,65 @@
+package middlerwares
+
+import (
+	"context"
+	"github.com/gofiber/fiber/v2"
+	"github.com/saufiroja/go-otel/auth-service/pkg/observability/metrics"
+	"github.com/saufiroja/go-otel/auth-service/pkg/observability/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"strconv"
+	"time"
+)
+
+type HttpMetricsMiddleware struct {
+	Meter *metrics.Metric
+}
+
+func NewHttpMetricsMiddleware(meter *metrics.Metric) *HttpMetricsMiddleware {
+	return &HttpMetricsMiddleware{
+		Meter: meter,
+	}
+}
+
+// ServerMetrics records the duration of every request, including those a handler or middleware failed, and how
+// many are in flight. Active requests carry only the method and scheme since the route is not matched yet
+func (h *HttpMetricsMiddleware) ServerMetrics() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		startTime := time.Now()
+		ctx := requestContext(c)
+
+		active := []attribute.KeyValue{
+			semconv.HTTPRequestMethodKey.String(c.Method()),
+			semconv.URLScheme(c.Protocol()),
+		}
+		h.Meter.Add(ctx, metrics.HttpServerActiveRequests, 1, active...)
+		defer h.Meter.Add(ctx, metrics.HttpServerActiveRequests, -1, active...)
+
+		err := c.Next()
+
+		status := c.Response().StatusCode()
+		if err != nil {
+			status = errorStatus(err)
+		}
+		attributes := []attribute.KeyValue{
+			semconv.HTTPRoute(c.Route().Path),
+			semconv.HTTPRequestMethodKey.String(c.Method()),
+			semconv.HTTPResponseStatusCode(status),
+		}
+		if status >= fiber.StatusInternalServerError {
+			attributes = append(attributes, semconv.ErrorTypeKey.String(strconv.Itoa(status)))
+		}
+		h.Meter.RecordFloat(ctx, metrics.HttpServerRequestDuration, time.Since(startTime).Seconds(), attributes...)
+
+		return err
+	}
+}
+
+// requestContext is the context of the server span so measurements can link exemplars to the trace, the request
+// context when the request is not traced
+func requestContext(c *fiber.Ctx) context.Context {
+	if ctx, ok := c.Context().Value(tracing.ServerContextKey).(context.Context); ok {
+		return ctx
+	}
+	return c.Context()
+}
@@ -0,0 +1,26 @@
+package middlerwares
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/saufiroja/go-otel/auth-service/internal/utils"
+)
+
+// RequestMetaMiddleware exposes the client ip, user agent and verified client certificate to services through the
+// request context
+func RequestMetaMiddleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		meta := utils.RequestMeta{
+			Ip:        c.IP(),
+			UserAgent: c.Get(fiber.HeaderUserAgent),
+		}
+		// only chains the listener verified against the client CA count, a certificate sent without a CA configured
+		// is ignored
+		if state := c.Context().TLSConnectionState(); state != nil && len(state.VerifiedChains) > 0 {
+			leaf := state.VerifiedChains[0][0]
+			meta.ClientCertSubject = leaf.Subject.String()
+			meta.ClientCertThumbprint = utils.CertificateThumbprint(leaf)
+		}
+		c.Context().SetUserValue(utils.RequestMetaKey, meta)
+		return c.Next()
+	}
+}
@@ -0,0 +1,134 @@
+package middlerwares
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"github.com/saufiroja/go-otel/auth-service/pkg/observability/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type TracingMiddleware struct {
+	Trace *tracing.Tracer
+}
+
+func NewTracingMiddleware(trace *tracing.Tracer) *TracingMiddleware {
+	return &TracingMiddleware{
+		Trace: trace,
+	}
+}
+
+// ServerSpan continues the trace named by the traceparent, tracestate and baggage headers in a SERVER span and
+// writes the trace context of that span back into the response headers
+func (t *TracingMiddleware) ServerSpan() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		propagator := otel.GetTextMapPropagator()
+		parent := propagator.Extract(context.Background(), requestHeaderCarrier{c: c})
+
+		ctx, span := t.Trace.StartSpan(parent, c.Method(),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(httpServerAttributes(c)...),
+		)
+		defer span.End()
+
+		c.Context().SetUserValue(tracing.ServerContextKey, ctx)
+		propagator.Inject(ctx, responseHeaderCarrier{c: c})
+
+		err := c.Next()
+
+		status := c.Response().StatusCode()
+		if err != nil {
+			// the error handler writes the status after the middleware returns
+			status = errorStatus(err)
+			span.RecordError(err)
+		}
+
+		// the route is only known once the router has matched the request
+		route := c.Route().Path
+		span.SetName(fmt.Sprintf("%s %s", c.Method(), route))
+		span.SetAttributes(
+			semconv.HTTPRoute(route),
+			semconv.HTTPResponseStatusCode(status),
+		)
+		if status >= fiber.StatusInternalServerError {
+			span.SetStatus(codes.Error, utils.StatusMessage(status))
+		}
+
+		return err
+	}
+}
+
+// httpServerAttributes are the semantic convention attributes of a request known before it is routed, the query
+// is left out as it carries codes and tokens
+func httpServerAttributes(c *fiber.Ctx) []attribute.KeyValue {
+	attributes := []attribute.KeyValue{
+		semconv.HTTPRequestMethodKey.String(c.Method()),
+		semconv.URLScheme(c.Protocol()),
+		semconv.URLPath(c.Path()),
+		semconv.ServerAddress(c.Hostname()),
+		semconv.ClientAddress(c.IP()),
+	}
+	if userAgent := c.Get(fiber.HeaderUserAgent); userAgent != "" {
+		attributes = append(attributes, semconv.UserAgentOriginal(userAgent))
+	}
+	return attributes
+}
+
+// errorStatus is the status fiber's default error handler answers err with
+func errorStatus(err error) int {
+	var fiberError *fiber.Error
+	if errors.As(err, &fiberError) {
+		return fiberError.Code
+	}
+	return fiber.StatusInternalServerError
+}
+
+// requestHeaderCarrier reads propagation fields from the request headers
+type requestHeaderCarrier struct {
+	c *fiber.Ctx
+}
+
+func (r requestHeaderCarrier) Get(key string) string {
+	return r.c.Get(key)
+}
+
+func (r requestHeaderCarrier) Set(key, value string) {
+	r.c.Request().Header.Set(key, value)
+}
+
+func (r requestHeaderCarrier) Keys() []string {
+	headers := r.c.GetReqHeaders()
+	keys := make([]string, 0, len(headers))
+	for key := range headers {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// responseHeaderCarrier writes propagation fields to the response headers
+type responseHeaderCarrier struct {
+	c *fiber.Ctx
+}
+
+func (r responseHeaderCarrier) Get(key string) string {
+	return r.c.GetRespHeader(key)
+}
+
+func (r responseHeaderCarrier) Set(key, value string) {
+	r.c.Set(key, value)
+}
+
+func (r responseHeaderCarrier) Keys() []string {
+	headers := r.c.GetRespHeaders()
+	keys := make([]string, 0, len(headers))
+	for key := range headers {
+		keys = append(keys, key)
+	}
+	return keys
+}
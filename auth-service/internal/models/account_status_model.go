@@ -0,0 +1,55 @@
+package models
+
+import "time"
+
+const (
+	StatusPending  = "pending"
+	StatusActive   = "active"
+	StatusLocked   = "locked"
+	StatusDisabled = "disabled"
+	StatusDeleted  = "deleted"
+)
+
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+	// RoleSupport is for support staff, it holds PermissionImpersonate but none of the admin routes
+	RoleSupport = "support"
+	// RoleService is carried by api key principals, it is never stored on a users row
+	RoleService = "service"
+)
+
+// statusTransitions lists the statuses each status may move to, deleted is terminal
+var statusTransitions = map[string][]string{
+	StatusPending:  {StatusActive, StatusDisabled, StatusDeleted},
+	StatusActive:   {StatusLocked, StatusDisabled, StatusDeleted},
+	StatusLocked:   {StatusActive, StatusDisabled, StatusDeleted},
+	StatusDisabled: {StatusActive, StatusDeleted},
+	StatusDeleted:  {},
+}
+
+// CanTransitionStatus reports whether an account may move from one status to another
+func CanTransitionStatus(from, to string) bool {
+	for _, allowed := range statusTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// IsValidStatus reports whether status is a known account status
+func IsValidStatus(status string) bool {
+	_, ok := statusTransitions[status]
+	return ok
+}
+
+type StatusChange struct {
+	ChangeId   string    `json:"change_id"`
+	UserId     string    `json:"user_id"`
+	FromStatus string    `json:"from_status"`
+	ToStatus   string    `json:"to_status"`
+	ChangedBy  string    `json:"changed_by"`
+	Reason     string    `json:"reason"`
+	ChangedAt  time.Time `json:"changed_at"`
+}
@@ -0,0 +1,59 @@
+package models
+
+import "time"
+
+const (
+	// ApiKeyLivePrefix and ApiKeyTestPrefix let partners and secret scanners recognise our keys
+	ApiKeyLivePrefix = "ak_live_"
+	ApiKeyTestPrefix = "ak_test_"
+)
+
+const (
+	ScopeUsersRead  = "users:read"
+	ScopeUsersWrite = "users:write"
+	ScopeAuditRead  = "audit:read"
+	// ScopeScimProvision lets an identity provider manage the users of the key's org through SCIM
+	ScopeScimProvision = "scim:provision"
+	// ScopeRolesAdmin lets a SCIM client grant and revoke the admin role, it is never implied by other scopes
+	ScopeRolesAdmin = "roles:admin"
+	// ScopeTokenExchange lets a gateway present the key as the actor_token of a token exchange
+	ScopeTokenExchange = "token:exchange"
+)
+
+// ApiKeyScopes are the scopes that may be granted to an api key
+var ApiKeyScopes = []string{ScopeUsersRead, ScopeUsersWrite, ScopeAuditRead, ScopeScimProvision, ScopeRolesAdmin,
+	ScopeTokenExchange}
+
+type ServiceAccount struct {
+	ServiceAccountId string    `json:"service_account_id"`
+	OrgId            string    `json:"org_id"`
+	Name             string    `json:"name"`
+	CreatedBy        string    `json:"created_by"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+type ApiKey struct {
+	KeyId            string     `json:"key_id"`
+	ServiceAccountId string     `json:"service_account_id"`
+	KeyPrefix        string     `json:"key_prefix"`
+	KeyHash          string     `json:"-"`
+	Scopes           []string   `json:"scopes"`
+	AllowedCidrs     []string   `json:"allowed_cidrs"`
+	ExpiresAt        *time.Time `json:"expires_at"`
+	RotatedTo        *string    `json:"rotated_to"`
+	LastUsedAt       *time.Time `json:"last_used_at"`
+	RevokedAt        *time.Time `json:"revoked_at"`
+	CreatedAt        time.Time  `json:"created_at"`
+}
+
+// ClientCertificate lets a service account authenticate with a certificate issued by the configured client CA,
+// it is the tls_client_auth method of RFC 8705 section 2.1 matched on the subject DN
+type ClientCertificate struct {
+	CertificateId    string     `json:"certificate_id"`
+	ServiceAccountId string     `json:"service_account_id"`
+	SubjectDn        string     `json:"subject_dn"`
+	Scopes           []string   `json:"scopes"`
+	CreatedBy        string     `json:"created_by"`
+	RevokedAt        *time.Time `json:"revoked_at"`
+	CreatedAt        time.Time  `json:"created_at"`
+}
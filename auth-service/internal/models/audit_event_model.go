@@ -0,0 +1,159 @@
+package models
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+const (
+	AuditUserRegister       = "user.register"
+	AuditUserLoginSuccess   = "user.login.success"
+	AuditUserLoginFailure   = "user.login.failure"
+	AuditUserPasswordChange = "user.password.change"
+	AuditUserEmailChange    = "user.email.change"
+	AuditSessionRevoke      = "user.session.revoke"
+	AuditSessionReuse       = "user.session.reuse_detected"
+	AuditUserIdentityLink   = "user.identity.link"
+	AuditUserIdentityUnlink = "user.identity.unlink"
+	AuditUserRoleSync       = "user.role.sync"
+	AuditTokenExchange      = "user.token.exchange"
+	AuditDeviceApprove      = "user.device.approve"
+	AuditDeviceDeny         = "user.device.deny"
+
+	AuditPersonalAccessTokenCreate = "user.pat.create"
+	AuditPersonalAccessTokenRevoke = "user.pat.revoke"
+	AuditAdminStatusChange         = "admin.user.status_change"
+	AuditAdminImpersonate          = "admin.user.impersonate"
+	AuditAdminLogLevelChange       = "admin.log_level.change"
+	AuditServiceAccountCreate      = "admin.service_account.create"
+	AuditApiKeyCreate              = "admin.api_key.create"
+	AuditApiKeyRotate              = "admin.api_key.rotate"
+	AuditApiKeyRevoke              = "admin.api_key.revoke"
+	AuditClientCertificateCreate   = "admin.client_certificate.create"
+	AuditClientCertificateRevoke   = "admin.client_certificate.revoke"
+	AuditScimUserCreate            = "scim.user.create"
+	AuditScimUserUpdate            = "scim.user.update"
+	AuditScimUserDelete            = "scim.user.delete"
+	AuditScimGroupUpdate           = "scim.group.update"
+)
+
+// AuditGenesisHash is the prev_hash of the first event in the chain
+const AuditGenesisHash = "0000000000000000000000000000000000000000000000000000000000000000"
+
+// AuditEvent is a row of the hash chain, Ip, UserAgent and Metadata are its details, stored outside the chain so
+// an erasure can delete them while DetailsHash keeps the chain verifiable
+type AuditEvent struct {
+	Sequence  int64             `json:"sequence"`
+	EventId   string            `json:"event_id"`
+	EventType string            `json:"event_type"`
+	ActorId   string            `json:"actor_id"`
+	TargetId  string            `json:"target_id"`
+	Ip        string            `json:"ip"`
+	UserAgent string            `json:"user_agent"`
+	TraceId   string            `json:"trace_id"`
+	Metadata  map[string]string `json:"metadata"`
+	CreatedAt time.Time         `json:"created_at"`
+	PrevHash  string            `json:"prev_hash"`
+	Hash      string            `json:"hash"`
+	// DetailsSalt is erased with the details, the remaining DetailsHash then no longer matches any guess of them
+	DetailsSalt   string `json:"-"`
+	DetailsHash   string `json:"-"`
+	DetailsErased bool   `json:"details_erased"`
+}
+
+// auditHashPayload is the hashed encoding of an event, JSON quotes every value so no two events encode alike
+type auditHashPayload struct {
+	Sequence    int64  `json:"sequence"`
+	EventId     string `json:"event_id"`
+	EventType   string `json:"event_type"`
+	ActorId     string `json:"actor_id"`
+	TargetId    string `json:"target_id"`
+	TraceId     string `json:"trace_id"`
+	DetailsHash string `json:"details_hash"`
+	CreatedAt   string `json:"created_at"`
+	PrevHash    string `json:"prev_hash"`
+}
+
+type auditDetailsPayload struct {
+	Salt      string            `json:"salt"`
+	Ip        string            `json:"ip"`
+	UserAgent string            `json:"user_agent"`
+	Metadata  map[string]string `json:"metadata"`
+}
+
+// ComputeHash returns the keyed chain hash of the event, covering every column, its details hash and the
+// previous hash
+func (e *AuditEvent) ComputeHash(key []byte) string {
+	payload, _ := json.Marshal(&auditHashPayload{
+		Sequence:    e.Sequence,
+		EventId:     e.EventId,
+		EventType:   e.EventType,
+		ActorId:     e.ActorId,
+		TargetId:    e.TargetId,
+		TraceId:     e.TraceId,
+		DetailsHash: e.DetailsHash,
+		CreatedAt:   e.CreatedAt.UTC().Format(time.RFC3339Nano),
+		PrevHash:    e.PrevHash,
+	})
+	mac := hmac.New(sha256.New, key)
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// ComputeDetailsHash returns the keyed hash of the salted details
+func (e *AuditEvent) ComputeDetailsHash(key []byte) string {
+	// json.Marshal sorts map keys, so the encoding is stable across reads
+	payload, _ := json.Marshal(&auditDetailsPayload{
+		Salt:      e.DetailsSalt,
+		Ip:        e.Ip,
+		UserAgent: e.UserAgent,
+		Metadata:  e.Metadata,
+	})
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("details:"))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// AuditChainHead records the last appended event outside the chain, so dropping events from the end is detected
+type AuditChainHead struct {
+	Sequence int64  `json:"sequence"`
+	Hash     string `json:"hash"`
+	Mac      string `json:"-"`
+}
+
+// ComputeMac returns the keyed mac of the head, a head rewound to an earlier event cannot be forged without the key
+func (h *AuditChainHead) ComputeMac(key []byte) string {
+	payload, _ := json.Marshal(&AuditChainHead{Sequence: h.Sequence, Hash: h.Hash})
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("head:"))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+type AuditFilter struct {
+	ActorId       string
+	TargetId      string
+	EventType     string
+	From          *time.Time
+	To            *time.Time
+	AfterSequence int64
+	Limit         int
+}
+
+type AuditViolation struct {
+	Sequence int64  `json:"sequence"`
+	EventId  string `json:"event_id"`
+	Reason   string `json:"reason"`
+}
+
+type AuditVerification struct {
+	Checked    int64             `json:"checked"`
+	Valid      bool              `json:"valid"`
+	Violations []*AuditViolation `json:"violations"`
+	// Head is the verified end of the chain, kept outside the database it also exposes a rewrite of every row
+	Head *AuditChainHead `json:"head"`
+}
@@ -0,0 +1,18 @@
+package models
+
+// Login outcomes label the login attempt metric, they must stay a small fixed set and never carry user input
+const (
+	LoginOutcomeSuccess      = "success"
+	LoginOutcomeUnknownEmail = "unknown_email"
+	LoginOutcomeBadPassword  = "bad_password"
+	LoginOutcomeLocked       = "locked"
+	LoginOutcomeInactive     = "inactive"
+	LoginOutcomeError        = "error"
+)
+
+// Registration outcomes label the registration metric
+const (
+	RegistrationOutcomeSuccess       = "success"
+	RegistrationOutcomeAlreadyExists = "already_exists"
+	RegistrationOutcomeError         = "error"
+)
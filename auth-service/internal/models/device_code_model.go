@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+const (
+	DeviceCodeStatusPending  = "pending"
+	DeviceCodeStatusApproved = "approved"
+	DeviceCodeStatusDenied   = "denied"
+)
+
+// DeviceCode is an RFC 8628 device authorization, only the hash of the device code is stored
+type DeviceCode struct {
+	DeviceCodeHash string     `json:"-"`
+	UserCode       string     `json:"user_code"`
+	ClientId       string     `json:"client_id"`
+	Status         string     `json:"status"`
+	UserId         string     `json:"user_id,omitempty"`
+	Interval       int        `json:"interval"`
+	LastPolledAt   *time.Time `json:"-"`
+	ExpiresAt      time.Time  `json:"expires_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// DeviceAuthorization is handed to the device, DeviceCode is only ever returned here
+type DeviceAuthorization struct {
+	DeviceCode      string    `json:"device_code"`
+	UserCode        string    `json:"user_code"`
+	VerificationUri string    `json:"verification_uri"`
+	Interval        int       `json:"interval"`
+	ExpiresAt       time.Time `json:"expires_at"`
+}
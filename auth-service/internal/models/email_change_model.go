@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+type EmailChange struct {
+	ChangeId   string     `json:"change_id"`
+	UserId     string     `json:"user_id"`
+	NewEmail   string     `json:"new_email"`
+	TokenHash  string     `json:"-"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	ConsumedAt *time.Time `json:"consumed_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+const (
+	ErasurePending   = "pending"
+	ErasureCancelled = "cancelled"
+	ErasureCompleted = "completed"
+)
+
+type ErasureRequest struct {
+	RequestId   string     `json:"request_id"`
+	UserId      string     `json:"user_id"`
+	Status      string     `json:"status"`
+	RequestedAt time.Time  `json:"requested_at"`
+	ScheduledAt time.Time  `json:"scheduled_at"`
+	CompletedAt *time.Time `json:"completed_at"`
+}
@@ -0,0 +1,11 @@
+package models
+
+// Impersonation is an access token issued to ActorId that authenticates as UserId, it has no refresh token
+type Impersonation struct {
+	ImpersonationId string `json:"impersonation_id"`
+	ActorId         string `json:"actor_id"`
+	UserId          string `json:"user_id"`
+	Reason          string `json:"reason"`
+	AccessToken     string `json:"access_token"`
+	ExpiresAt       int64  `json:"expires_at"`
+}
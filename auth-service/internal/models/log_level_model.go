@@ -0,0 +1,6 @@
+package models
+
+// LogLevel is the lowest level the service currently logs at
+type LogLevel struct {
+	Level string `json:"level"`
+}
@@ -0,0 +1,50 @@
+package models
+
+const (
+	GrantTypeTokenExchange = "urn:ietf:params:oauth:grant-type:token-exchange"
+	GrantTypeDeviceCode    = "urn:ietf:params:oauth:grant-type:device_code"
+
+	TokenTypeAccessToken = "urn:ietf:params:oauth:token-type:access_token"
+	TokenTypeJwt         = "urn:ietf:params:oauth:token-type:jwt"
+)
+
+// error codes of RFC 6749 section 5.2, RFC 8693 section 2.2.2, RFC 8628 section 3.5 and RFC 9449
+const (
+	OAuthErrorInvalidRequest       = "invalid_request"
+	OAuthErrorInvalidClient        = "invalid_client"
+	OAuthErrorInvalidGrant         = "invalid_grant"
+	OAuthErrorInvalidScope         = "invalid_scope"
+	OAuthErrorInvalidTarget        = "invalid_target"
+	OAuthErrorUnsupportedGrantType = "unsupported_grant_type"
+	OAuthErrorServerError          = "server_error"
+	OAuthErrorAuthorizationPending = "authorization_pending"
+	OAuthErrorSlowDown             = "slow_down"
+	OAuthErrorAccessDenied         = "access_denied"
+	OAuthErrorExpiredToken         = "expired_token"
+	OAuthErrorInvalidDpopProof     = "invalid_dpop_proof"
+	OAuthErrorUseDpopNonce         = "use_dpop_nonce"
+)
+
+// OAuthError is an error of the token endpoint, Code is one of the OAuthError* constants
+type OAuthError struct {
+	Code        string
+	Description string
+}
+
+func NewOAuthError(code, description string) *OAuthError {
+	return &OAuthError{Code: code, Description: description}
+}
+
+func (e *OAuthError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+// ExchangedToken is the result of a token exchange
+type ExchangedToken struct {
+	AccessToken     string   `json:"access_token"`
+	TokenType       string   `json:"token_type"`
+	IssuedTokenType string   `json:"issued_token_type"`
+	Audience        string   `json:"audience"`
+	Scopes          []string `json:"scopes"`
+	ExpiresAt       int64    `json:"expires_at"`
+}
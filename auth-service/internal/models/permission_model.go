@@ -0,0 +1,28 @@
+package models
+
+// PermissionImpersonate allows signing in as another user to reproduce what they see
+const PermissionImpersonate = "users:impersonate"
+
+// rolePermissions grants capabilities that are not tied to a route group, roles not listed hold none
+var rolePermissions = map[string][]string{
+	RoleAdmin:   {PermissionImpersonate},
+	RoleSupport: {PermissionImpersonate},
+}
+
+// ImpersonationScopes bound what an impersonation token may do, account management is excluded by RequireSession
+var ImpersonationScopes = []string{ScopeProfileRead, ScopeProfileWrite, ScopeSessionsRead}
+
+// HasPermission reports whether role was granted permission
+func HasPermission(role, permission string) bool {
+	for _, granted := range rolePermissions[role] {
+		if granted == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// IsPrivilegedRole reports whether role holds any permission, such users cannot be impersonated
+func IsPrivilegedRole(role string) bool {
+	return len(rolePermissions[role]) > 0
+}
@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// PersonalAccessTokenPrefix marks opaque personal access tokens so they are told apart from JWTs
+const PersonalAccessTokenPrefix = "pat_"
+
+const (
+	ScopeProfileRead   = "profile:read"
+	ScopeProfileWrite  = "profile:write"
+	ScopeSessionsRead  = "sessions:read"
+	ScopeSessionsWrite = "sessions:write"
+	ScopeAdmin         = "admin"
+)
+
+// PersonalAccessTokenScopes are the scopes a user may grant to a personal access token
+var PersonalAccessTokenScopes = []string{
+	ScopeProfileRead, ScopeProfileWrite, ScopeSessionsRead, ScopeSessionsWrite, ScopeAdmin,
+}
+
+type PersonalAccessToken struct {
+	TokenId    string     `json:"token_id"`
+	UserId     string     `json:"user_id"`
+	Name       string     `json:"name"`
+	TokenHash  string     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
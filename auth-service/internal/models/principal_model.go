@@ -0,0 +1,44 @@
+package models
+
+const (
+	AuthMethodSession             = "session"
+	AuthMethodPersonalAccessToken = "personal_access_token"
+	AuthMethodApiKey              = "api_key"
+	AuthMethodImpersonation       = "impersonation"
+	AuthMethodTokenExchange       = "token_exchange"
+	AuthMethodTlsClient           = "tls_client_auth"
+)
+
+// Principal is the authenticated caller of a request
+type Principal struct {
+	UserId     string   `json:"user_id"`
+	Role       string   `json:"role"`
+	SessionId  string   `json:"session_id"`
+	AuthMethod string   `json:"auth_method"`
+	Scopes     []string `json:"scopes"`
+	// OrgId is only set for api key principals, whose UserId is the service account id
+	OrgId string `json:"org_id,omitempty"`
+	// ActorId is the staff member acting as UserId, it is only set for impersonation tokens
+	ActorId string `json:"actor_id,omitempty"`
+	// Actor is the act chain and Audience the aud of an exchanged token
+	Actor    *Actor `json:"act,omitempty"`
+	Audience string `json:"audience,omitempty"`
+}
+
+// HasPermission reports whether the principal's role was granted permission
+func (p *Principal) HasPermission(permission string) bool {
+	return HasPermission(p.Role, permission)
+}
+
+// HasScope reports whether the principal may act with scope, interactive sessions hold every scope
+func (p *Principal) HasScope(scope string) bool {
+	if p.AuthMethod == AuthMethodSession {
+		return true
+	}
+	for _, granted := range p.Scopes {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
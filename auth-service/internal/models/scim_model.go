@@ -0,0 +1,130 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+const (
+	ScimSchemaUser                  = "urn:ietf:params:scim:schemas:core:2.0:User"
+	ScimSchemaGroup                 = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	ScimSchemaListResponse          = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	ScimSchemaPatchOp               = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	ScimSchemaError                 = "urn:ietf:params:scim:api:messages:2.0:Error"
+	ScimSchemaServiceProviderConfig = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	// ScimSchemaGroupsConfig extends the service provider config with what can be done to groups, the core schema
+	// has no way to say a resource is read only
+	ScimSchemaGroupsConfig = "urn:saufiroja:params:scim:schemas:extension:auth-service:2.0:ServiceProviderConfig"
+)
+
+// ScimGroupsReadOnly is the detail of the error returned to group creates, replaces and deletes
+const ScimGroupsReadOnly = "groups are the fixed role set, only their members can be patched"
+
+// ScimContentType is the media type of every SCIM request and response body
+const ScimContentType = "application/scim+json"
+
+// scimType values of SCIM error responses, RFC 7644 section 3.12
+const (
+	ScimErrorInvalidFilter = "invalidFilter"
+	ScimErrorInvalidSyntax = "invalidSyntax"
+	ScimErrorInvalidPath   = "invalidPath"
+	ScimErrorInvalidValue  = "invalidValue"
+	ScimErrorUniqueness    = "uniqueness"
+	ScimErrorMutability    = "mutability"
+	ScimErrorNoTarget      = "noTarget"
+)
+
+// Logical operators of a ScimFilter, every other Op is an attribute operator such as eq or pr
+const (
+	ScimFilterAnd = "and"
+	ScimFilterOr  = "or"
+	ScimFilterNot = "not"
+)
+
+// ScimFilter is a parsed SCIM filter expression, logical nodes hold Children and attribute nodes hold an
+// Attribute compared to Value, attribute paths are lower cased since SCIM attribute names are case insensitive
+type ScimFilter struct {
+	Op        string
+	Attribute string
+	// Value is a string, bool, float64 or nil
+	Value    any
+	Children []*ScimFilter
+}
+
+// ScimError is raised by the SCIM service and rendered as a SCIM error response by the controller
+type ScimError struct {
+	Status   int
+	ScimType string
+	Detail   string
+}
+
+func (e *ScimError) Error() string {
+	return e.Detail
+}
+
+func NewScimError(status int, scimType, detail string) *ScimError {
+	return &ScimError{Status: status, ScimType: scimType, Detail: detail}
+}
+
+// ScimUser is a user provisioned by a SCIM tenant, the tenant is the org of the api key that created it
+type ScimUser struct {
+	User
+	OrgId      string
+	ExternalId string
+}
+
+// Version is the ETag of the user, it changes whenever the users row is updated
+func (s *ScimUser) Version() string {
+	return fmt.Sprintf(`W/"%d"`, s.UpdatedAt.UnixMicro())
+}
+
+// ScimUserFilter narrows a tenant's users, Filter may be nil
+type ScimUserFilter struct {
+	OrgId      string
+	Filter     *ScimFilter
+	StartIndex int
+	Count      int
+}
+
+// ScimUserUpdate replaces the mutable attributes of a SCIM user, it only applies while the stored updated_at
+// still equals Version
+type ScimUserUpdate struct {
+	UserId     string
+	OrgId      string
+	FullName   string
+	Email      string
+	ExternalId string
+	Version    time.Time
+	UpdatedAt  time.Time
+	// StatusChange is set when the active attribute changed the account status
+	StatusChange *StatusChange
+}
+
+// ScimRoleChange moves a tenant's user between the role groups
+type ScimRoleChange struct {
+	UserId    string
+	Role      string
+	UpdatedAt time.Time
+}
+
+// ScimGroupRoles are the groups exposed over SCIM, each is backed by the role of the same name and every
+// user is a member of exactly one of them
+var ScimGroupRoles = []string{RoleUser, RoleAdmin}
+
+// ScimGroup is one of the role groups of a tenant, its id and display name are the role
+type ScimGroup struct {
+	Id      string
+	Members []*ScimUser
+}
+
+// Version is the ETag of the group, it changes whenever the membership changes
+func (g *ScimGroup) Version() string {
+	hash := sha256.New()
+	hash.Write([]byte(g.Id))
+	for _, member := range g.Members {
+		hash.Write([]byte("|" + member.UserId))
+	}
+	return fmt.Sprintf(`W/"%s"`, hex.EncodeToString(hash.Sum(nil))[:16])
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// MaxDeviceNameLength is the length in runes of sessions.device_name
+const MaxDeviceNameLength = 200
+
+// Session tracks one refresh-token family, the refresh token id rotates on every refresh
+type Session struct {
+	SessionId      string     `json:"session_id"`
+	UserId         string     `json:"user_id"`
+	RefreshTokenId string     `json:"-"`
+	DeviceName     string     `json:"device_name"`
+	UserAgent      string     `json:"user_agent"`
+	Ip             string     `json:"ip"`
+	CreatedAt      time.Time  `json:"created_at"`
+	LastUsedAt     time.Time  `json:"last_used_at"`
+	RevokedAt      *time.Time `json:"revoked_at"`
+	Current        bool       `json:"current"`
+}
@@ -0,0 +1,44 @@
+package models
+
+// MaxActorDepth bounds the act chains accepted from and issued in tokens
+const MaxActorDepth = 8
+
+// Actor is an RFC 8693 act claim, a nested Actor is the party that acted before this one
+type Actor struct {
+	Subject string `json:"sub"`
+	Actor   *Actor `json:"act,omitempty"`
+}
+
+// Confirmation is the cnf claim of RFC 7800, it binds a token to a key the client must prove it holds
+type Confirmation struct {
+	// Jkt is the RFC 7638 thumbprint of a DPoP key, RFC 9449 section 6
+	Jkt string `json:"jkt,omitempty"`
+	// X5tS256 is the SHA-256 thumbprint of a client certificate, RFC 8705 section 3.1
+	X5tS256 string `json:"x5t#S256,omitempty"`
+}
+
+type TokenClaims struct {
+	UserId    string `json:"user_id"`
+	FullName  string `json:"full_name"`
+	TokenType string `json:"token_type"`
+	SessionId string `json:"sid"`
+	TokenId   string `json:"jti"`
+	ExpiresAt int64  `json:"exp"`
+	// ActorId is the sub of the act claim of an impersonation token
+	ActorId string `json:"-"`
+	// Actor is the whole act chain, it is set for impersonation and exchanged tokens
+	Actor    *Actor   `json:"act,omitempty"`
+	Audience string   `json:"aud,omitempty"`
+	Scopes   []string `json:"scope,omitempty"`
+	// Confirmation is set for sender-constrained tokens
+	Confirmation *Confirmation `json:"cnf,omitempty"`
+}
+
+// Subjects lists every subject of the act chain, the current actor first
+func (a *Actor) Subjects() []string {
+	subjects := make([]string, 0)
+	for actor := a; actor != nil; actor = actor.Actor {
+		subjects = append(subjects, actor.Subject)
+	}
+	return subjects
+}
@@ -1,6 +1,15 @@
 package models
 
+const (
+	TokenTypeBearer = "Bearer"
+	// TokenTypeDpop tokens must be sent with a DPoP proof, RFC 9449 section 5
+	TokenTypeDpop = "DPoP"
+)
+
 type Token struct {
-	AccessToken  string `json:"access_token"`
-	RefreshToken string `json:"refresh_token"`
+	AccessToken           string `json:"access_token"`
+	TokenType             string `json:"token_type"`
+	RefreshToken          string `json:"refresh_token"`
+	AccessTokenExpiresAt  int64  `json:"-"`
+	RefreshTokenExpiresAt int64  `json:"-"`
 }
@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// UserExport is the archive returned for a data subject access request, it must never contain secrets
+type UserExport struct {
+	ExportedAt           time.Time              `json:"exported_at"`
+	Profile              *ExportProfile         `json:"profile"`
+	EmailChanges         []*EmailChange         `json:"email_changes"`
+	StatusChanges        []*StatusChange        `json:"status_changes"`
+	ErasureRequests      []*ErasureRequest      `json:"erasure_requests"`
+	AuditEvents          []*AuditEvent          `json:"audit_events"`
+	Sessions             []*Session             `json:"sessions"`
+	PersonalAccessTokens []*PersonalAccessToken `json:"personal_access_tokens"`
+	Identities           []*UserIdentity        `json:"identities"`
+}
+
+type ExportProfile struct {
+	UserId    string    `json:"user_id"`
+	FullName  string    `json:"full_name"`
+	Email     string    `json:"email"`
+	Status    string    `json:"status"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
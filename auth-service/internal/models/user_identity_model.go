@@ -0,0 +1,63 @@
+package models
+
+import "time"
+
+// UserIdentity links a user to the subject of an external identity provider
+type UserIdentity struct {
+	IdentityId  string     `json:"identity_id"`
+	UserId      string     `json:"user_id"`
+	Provider    string     `json:"provider"`
+	Subject     string     `json:"subject"`
+	Email       string     `json:"email"`
+	Provisioned bool       `json:"provisioned"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastLoginAt *time.Time `json:"last_login_at"`
+}
+
+// OidcLoginState is the server side half of an authorization request, keyed by the hash of the state parameter
+type OidcLoginState struct {
+	StateHash    string
+	Provider     string
+	Nonce        string
+	CodeVerifier string
+	LinkUserId   string
+	Browser      bool
+	ExpiresAt    time.Time
+}
+
+// OidcClaims are the validated ID token claims the service relies on
+type OidcClaims struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// ExternalSignInResult holds either the tokens of an external sign-in or the identity linked to a signed-in user
+type ExternalSignInResult struct {
+	Token   *Token
+	Linked  *UserIdentity
+	Browser bool
+}
+
+// ExternalUser is a user authenticated by an external provider such as a directory
+type ExternalUser struct {
+	Provider string
+	Subject  string
+	Email    string
+	// EmailVerified is set when the provider vouches for Email, only then may an account be provisioned with it
+	EmailVerified bool
+	FullName      string
+	// Role is empty when the provider does not manage roles
+	Role string
+	// AutoProvision creates a local account on the first login of an identity whose email no account uses
+	AutoProvision bool
+}
+
+// SamlRequest is an outstanding AuthnRequest, the assertion must be InResponseTo its id
+type SamlRequest struct {
+	RequestId  string
+	LinkUserId string
+	Browser    bool
+	ExpiresAt  time.Time
+}
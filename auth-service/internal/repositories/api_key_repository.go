@@ -0,0 +1,516 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"github.com/saufiroja/go-otel/auth-service/internal/models"
+	"github.com/saufiroja/go-otel/auth-service/pkg/databases"
+	"github.com/saufiroja/go-otel/auth-service/pkg/observability/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"strings"
+	"time"
+)
+
+const apiKeyColumns = `key_id, service_account_id, key_prefix, key_hash, scopes, allowed_cidrs, expires_at,
+				rotated_to, last_used_at, revoked_at, created_at`
+
+const clientCertificateColumns = `certificate_id, service_account_id, subject_dn, scopes, created_by, revoked_at,
+				created_at`
+
+type apiKeyRepository struct {
+	DB    databases.PostgresManager
+	Trace *tracing.Tracer
+}
+
+func NewApiKeyRepository(db databases.PostgresManager, trace *tracing.Tracer) ApiKeyRepository {
+	return &apiKeyRepository{
+		DB:    db,
+		Trace: trace,
+	}
+}
+
+func (a *apiKeyRepository) CreateServiceAccount(ctx context.Context, account *models.ServiceAccount) error {
+	ctx, span := a.Trace.StartSpan(ctx, "repository.CreateServiceAccount")
+	defer span.End()
+	db := a.DB.Connection()
+
+	query := `INSERT INTO service_accounts (service_account_id, org_id, name, created_by, created_at)
+				VALUES ($1, $2, $3, $4, $5)`
+	span.SetAttributes(
+		attribute.Key("service_account_id").String(account.ServiceAccountId),
+		attribute.Key("org_id").String(account.OrgId),
+	)
+
+	span.AddEvent("executing SQL query", trace.WithAttributes(
+		attribute.Key("sql.query").String(query),
+	))
+
+	_, err := db.ExecContext(ctx, query, account.ServiceAccountId, account.OrgId, account.Name, account.CreatedBy,
+		account.CreatedAt)
+	if err != nil {
+		span.AddEvent("Failed to execute query", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error executing query")
+		return err
+	}
+
+	span.AddEvent("Successfully created service account", trace.WithAttributes(attribute.Key("serviceAccountId").String(account.ServiceAccountId)))
+	span.SetStatus(codes.Ok, "Query executed successfully")
+
+	return nil
+}
+
+func (a *apiKeyRepository) GetServiceAccountById(ctx context.Context, serviceAccountId string) (*models.ServiceAccount, error) {
+	ctx, span := a.Trace.StartSpan(ctx, "repository.GetServiceAccountById")
+	defer span.End()
+	db := a.DB.Connection()
+
+	query := `SELECT service_account_id, org_id, name, created_by, created_at
+				FROM service_accounts
+				WHERE service_account_id = $1`
+
+	span.SetAttributes(
+		attribute.Key("service_account_id").String(serviceAccountId),
+	)
+
+	span.AddEvent("executing SQL query", trace.WithAttributes(
+		attribute.Key("sql.query").String(query),
+	))
+
+	account := &models.ServiceAccount{}
+	err := db.QueryRowContext(ctx, query, serviceAccountId).Scan(&account.ServiceAccountId, &account.OrgId,
+		&account.Name, &account.CreatedBy, &account.CreatedAt)
+	if err != nil {
+		span.AddEvent("Failed to execute query", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error executing query")
+		return nil, err
+	}
+
+	span.SetAttributes(attribute.Key("org_id").String(account.OrgId))
+	span.SetStatus(codes.Ok, "Query executed successfully")
+
+	return account, nil
+}
+
+func (a *apiKeyRepository) CreateApiKey(ctx context.Context, key *models.ApiKey) error {
+	ctx, span := a.Trace.StartSpan(ctx, "repository.CreateApiKey")
+	defer span.End()
+	db := a.DB.Connection()
+
+	span.SetAttributes(
+		attribute.Key("key_id").String(key.KeyId),
+		attribute.Key("service_account_id").String(key.ServiceAccountId),
+		attribute.Key("scopes").StringSlice(key.Scopes),
+	)
+
+	err := insertApiKey(ctx, span, db, key)
+	if err != nil {
+		span.AddEvent("Failed to execute query", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error executing query")
+		return err
+	}
+
+	span.AddEvent("Successfully created api key", trace.WithAttributes(attribute.Key("keyId").String(key.KeyId)))
+	span.SetStatus(codes.Ok, "Query executed successfully")
+
+	return nil
+}
+
+func (a *apiKeyRepository) GetApiKeyById(ctx context.Context, keyId string) (*models.ApiKey, error) {
+	ctx, span := a.Trace.StartSpan(ctx, "repository.GetApiKeyById")
+	defer span.End()
+
+	span.SetAttributes(attribute.Key("key_id").String(keyId))
+
+	return a.getApiKey(ctx, span, `WHERE key_id = $1`, keyId)
+}
+
+func (a *apiKeyRepository) GetApiKeyByPrefix(ctx context.Context, keyPrefix string) (*models.ApiKey, error) {
+	ctx, span := a.Trace.StartSpan(ctx, "repository.GetApiKeyByPrefix")
+	defer span.End()
+
+	span.SetAttributes(attribute.Key("key_prefix").String(keyPrefix))
+
+	return a.getApiKey(ctx, span, `WHERE key_prefix = $1`, keyPrefix)
+}
+
+func (a *apiKeyRepository) getApiKey(ctx context.Context, span trace.Span, where string, arg string) (*models.ApiKey, error) {
+	db := a.DB.Connection()
+
+	query := `SELECT ` + apiKeyColumns + `
+				FROM api_keys
+				` + where
+
+	span.AddEvent("executing SQL query", trace.WithAttributes(
+		attribute.Key("sql.query").String(query),
+	))
+
+	rows, err := db.QueryContext(ctx, query, arg)
+	if err != nil {
+		span.AddEvent("Failed to execute query", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error executing query")
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys, err := scanApiKeys(rows)
+	if err != nil {
+		span.AddEvent("Failed to scan row", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error scanning row")
+		return nil, err
+	}
+	if len(keys) == 0 {
+		span.AddEvent("api key not found")
+		return nil, sql.ErrNoRows
+	}
+
+	span.SetAttributes(
+		attribute.Key("key_id").String(keys[0].KeyId),
+		attribute.Key("service_account_id").String(keys[0].ServiceAccountId),
+	)
+	span.AddEvent("Successfully retrieved api key", trace.WithAttributes(attribute.Key("keyId").String(keys[0].KeyId)))
+	span.SetStatus(codes.Ok, "Query executed successfully")
+
+	return keys[0], nil
+}
+
+func (a *apiKeyRepository) GetApiKeysByServiceAccountId(ctx context.Context, serviceAccountId string) ([]*models.ApiKey, error) {
+	ctx, span := a.Trace.StartSpan(ctx, "repository.GetApiKeysByServiceAccountId")
+	defer span.End()
+	db := a.DB.Connection()
+
+	query := `SELECT ` + apiKeyColumns + `
+				FROM api_keys
+				WHERE service_account_id = $1
+				ORDER BY created_at DESC`
+
+	span.SetAttributes(
+		attribute.Key("service_account_id").String(serviceAccountId),
+	)
+
+	span.AddEvent("executing SQL query", trace.WithAttributes(
+		attribute.Key("sql.query").String(query),
+	))
+
+	rows, err := db.QueryContext(ctx, query, serviceAccountId)
+	if err != nil {
+		span.AddEvent("Failed to execute query", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error executing query")
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys, err := scanApiKeys(rows)
+	if err != nil {
+		span.AddEvent("Failed to scan row", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error scanning row")
+		return nil, err
+	}
+
+	span.AddEvent("Successfully retrieved api keys", trace.WithAttributes(attribute.Key("count").Int(len(keys))))
+	span.SetStatus(codes.Ok, "Query executed successfully")
+
+	return keys, nil
+}
+
+func (a *apiKeyRepository) RotateApiKey(ctx context.Context, oldKeyId string, oldExpiresAt time.Time,
+	newKey *models.ApiKey) error {
+	ctx, span := a.Trace.StartSpan(ctx, "repository.RotateApiKey")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.Key("key_id").String(oldKeyId),
+		attribute.Key("new_key_id").String(newKey.KeyId),
+		attribute.Key("service_account_id").String(newKey.ServiceAccountId),
+	)
+
+	tx, err := a.DB.StartTransaction()
+	if err != nil {
+		span.AddEvent("Failed to start transaction", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error starting transaction")
+		return err
+	}
+
+	err = insertApiKey(ctx, span, tx, newKey)
+	if err != nil {
+		_ = a.DB.RollbackTransaction(tx)
+		span.AddEvent("Failed to execute query", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error executing query")
+		return err
+	}
+
+	// only a live, not yet rotated key can be rotated, so two concurrent rotations cannot both succeed
+	updateQuery := `UPDATE api_keys
+				SET rotated_to = $2, expires_at = LEAST(COALESCE(expires_at, $3), $3)
+				WHERE key_id = $1 AND rotated_to IS NULL AND revoked_at IS NULL`
+
+	span.AddEvent("executing SQL query", trace.WithAttributes(
+		attribute.Key("sql.query").String(updateQuery),
+	))
+
+	result, err := tx.ExecContext(ctx, updateQuery, oldKeyId, newKey.KeyId, oldExpiresAt)
+	if err != nil {
+		_ = a.DB.RollbackTransaction(tx)
+		span.AddEvent("Failed to execute query", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error executing query")
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err == nil && rows == 0 {
+		_ = a.DB.RollbackTransaction(tx)
+		span.AddEvent("api key not found, revoked or already rotated")
+		span.SetStatus(codes.Error, "Api key cannot be rotated")
+		return sql.ErrNoRows
+	}
+
+	if err := a.DB.CommitTransaction(tx); err != nil {
+		span.AddEvent("Failed to commit transaction", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error committing transaction")
+		return err
+	}
+
+	span.AddEvent("Successfully rotated api key", trace.WithAttributes(attribute.Key("keyId").String(oldKeyId)))
+	span.SetStatus(codes.Ok, "Query executed successfully")
+
+	return nil
+}
+
+func (a *apiKeyRepository) RevokeApiKey(ctx context.Context, keyId string, revokedAt time.Time) error {
+	ctx, span := a.Trace.StartSpan(ctx, "repository.RevokeApiKey")
+	defer span.End()
+	db := a.DB.Connection()
+
+	query := `UPDATE api_keys
+				SET revoked_at = $2
+				WHERE key_id = $1 AND revoked_at IS NULL`
+
+	span.SetAttributes(
+		attribute.Key("key_id").String(keyId),
+	)
+
+	span.AddEvent("executing SQL query", trace.WithAttributes(
+		attribute.Key("sql.query").String(query),
+	))
+
+	result, err := db.ExecContext(ctx, query, keyId, revokedAt)
+	if err != nil {
+		span.AddEvent("Failed to execute query", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error executing query")
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err == nil && rows == 0 {
+		span.AddEvent("api key not found or already revoked")
+		span.SetStatus(codes.Error, "Api key not found")
+		return sql.ErrNoRows
+	}
+
+	span.AddEvent("Successfully revoked api key", trace.WithAttributes(attribute.Key("keyId").String(keyId)))
+	span.SetStatus(codes.Ok, "Query executed successfully")
+
+	return nil
+}
+
+func (a *apiKeyRepository) TouchApiKey(ctx context.Context, keyId string, usedAt time.Time) error {
+	ctx, span := a.Trace.StartSpan(ctx, "repository.TouchApiKey")
+	defer span.End()
+	db := a.DB.Connection()
+
+	query := `UPDATE api_keys
+				SET last_used_at = $2
+				WHERE key_id = $1`
+
+	span.SetAttributes(
+		attribute.Key("key_id").String(keyId),
+	)
+
+	span.AddEvent("executing SQL query", trace.WithAttributes(
+		attribute.Key("sql.query").String(query),
+	))
+
+	_, err := db.ExecContext(ctx, query, keyId, usedAt)
+	if err != nil {
+		span.AddEvent("Failed to execute query", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error executing query")
+		return err
+	}
+
+	span.SetStatus(codes.Ok, "Query executed successfully")
+
+	return nil
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+func (a *apiKeyRepository) CreateClientCertificate(ctx context.Context, certificate *models.ClientCertificate) error {
+	ctx, span := a.Trace.StartSpan(ctx, "repository.CreateClientCertificate")
+	defer span.End()
+	db := a.DB.Connection()
+
+	query := `INSERT INTO client_certificates (certificate_id, service_account_id, subject_dn, scopes, created_by,
+				created_at)
+				VALUES ($1, $2, $3, $4, $5, $6)`
+	span.SetAttributes(
+		attribute.Key("certificate_id").String(certificate.CertificateId),
+		attribute.Key("service_account_id").String(certificate.ServiceAccountId),
+		attribute.Key("scopes").StringSlice(certificate.Scopes),
+	)
+
+	span.AddEvent("executing SQL query", trace.WithAttributes(
+		attribute.Key("sql.query").String(query),
+	))
+
+	_, err := db.ExecContext(ctx, query, certificate.CertificateId, certificate.ServiceAccountId,
+		certificate.SubjectDn, strings.Join(certificate.Scopes, " "), certificate.CreatedBy, certificate.CreatedAt)
+	if err != nil {
+		span.AddEvent("Failed to execute query", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error executing query")
+		return err
+	}
+
+	span.SetStatus(codes.Ok, "Query executed successfully")
+
+	return nil
+}
+
+func (a *apiKeyRepository) GetClientCertificateById(ctx context.Context,
+	certificateId string) (*models.ClientCertificate, error) {
+	ctx, span := a.Trace.StartSpan(ctx, "repository.GetClientCertificateById")
+	defer span.End()
+
+	span.SetAttributes(attribute.Key("certificate_id").String(certificateId))
+
+	return a.getClientCertificate(ctx, span, `WHERE certificate_id = $1`, certificateId)
+}
+
+// GetClientCertificateBySubject returns the unrevoked certificate registered for a subject DN
+func (a *apiKeyRepository) GetClientCertificateBySubject(ctx context.Context,
+	subjectDn string) (*models.ClientCertificate, error) {
+	ctx, span := a.Trace.StartSpan(ctx, "repository.GetClientCertificateBySubject")
+	defer span.End()
+
+	return a.getClientCertificate(ctx, span, `WHERE subject_dn = $1 AND revoked_at IS NULL`, subjectDn)
+}
+
+func (a *apiKeyRepository) getClientCertificate(ctx context.Context, span trace.Span, where string,
+	arg string) (*models.ClientCertificate, error) {
+	db := a.DB.Connection()
+
+	query := `SELECT ` + clientCertificateColumns + `
+				FROM client_certificates
+				` + where
+
+	span.AddEvent("executing SQL query", trace.WithAttributes(
+		attribute.Key("sql.query").String(query),
+	))
+
+	certificate := &models.ClientCertificate{}
+	var scopes string
+	var revokedAt sql.NullTime
+	err := db.QueryRowContext(ctx, query, arg).Scan(&certificate.CertificateId, &certificate.ServiceAccountId,
+		&certificate.SubjectDn, &scopes, &certificate.CreatedBy, &revokedAt, &certificate.CreatedAt)
+	if err != nil {
+		span.AddEvent("Failed to execute query", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error executing query")
+		return nil, err
+	}
+	certificate.Scopes = strings.Fields(scopes)
+	if revokedAt.Valid {
+		certificate.RevokedAt = &revokedAt.Time
+	}
+
+	span.SetAttributes(
+		attribute.Key("certificate_id").String(certificate.CertificateId),
+		attribute.Key("service_account_id").String(certificate.ServiceAccountId),
+	)
+	span.SetStatus(codes.Ok, "Query executed successfully")
+
+	return certificate, nil
+}
+
+func (a *apiKeyRepository) RevokeClientCertificate(ctx context.Context, certificateId string,
+	revokedAt time.Time) error {
+	ctx, span := a.Trace.StartSpan(ctx, "repository.RevokeClientCertificate")
+	defer span.End()
+	db := a.DB.Connection()
+
+	query := `UPDATE client_certificates
+				SET revoked_at = $2
+				WHERE certificate_id = $1 AND revoked_at IS NULL`
+
+	span.SetAttributes(
+		attribute.Key("certificate_id").String(certificateId),
+	)
+
+	span.AddEvent("executing SQL query", trace.WithAttributes(
+		attribute.Key("sql.query").String(query),
+	))
+
+	result, err := db.ExecContext(ctx, query, certificateId, revokedAt)
+	if err != nil {
+		span.AddEvent("Failed to execute query", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error executing query")
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err == nil && rows == 0 {
+		span.AddEvent("client certificate not found or already revoked")
+		span.SetStatus(codes.Error, "Client certificate not found")
+		return sql.ErrNoRows
+	}
+
+	span.SetStatus(codes.Ok, "Query executed successfully")
+
+	return nil
+}
+
+func insertApiKey(ctx context.Context, span trace.Span, db execer, key *models.ApiKey) error {
+	query := `INSERT INTO api_keys (key_id, service_account_id, key_prefix, key_hash, scopes, allowed_cidrs,
+				expires_at, created_at)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+
+	span.AddEvent("executing SQL query", trace.WithAttributes(
+		attribute.Key("sql.query").String(query),
+	))
+
+	_, err := db.ExecContext(ctx, query, key.KeyId, key.ServiceAccountId, key.KeyPrefix, key.KeyHash,
+		strings.Join(key.Scopes, " "), strings.Join(key.AllowedCidrs, " "), key.ExpiresAt, key.CreatedAt)
+	return err
+}
+
+func scanApiKeys(rows *sql.Rows) ([]*models.ApiKey, error) {
+	keys := make([]*models.ApiKey, 0)
+	for rows.Next() {
+		key := &models.ApiKey{}
+		var scopes, allowedCidrs string
+		var expiresAt, lastUsedAt, revokedAt sql.NullTime
+		var rotatedTo sql.NullString
+		err := rows.Scan(&key.KeyId, &key.ServiceAccountId, &key.KeyPrefix, &key.KeyHash, &scopes, &allowedCidrs,
+			&expiresAt, &rotatedTo, &lastUsedAt, &revokedAt, &key.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		key.Scopes = strings.Fields(scopes)
+		key.AllowedCidrs = strings.Fields(allowedCidrs)
+		if expiresAt.Valid {
+			key.ExpiresAt = &expiresAt.Time
+		}
+		if rotatedTo.Valid {
+			key.RotatedTo = &rotatedTo.String
+		}
+		if lastUsedAt.Valid {
+			key.LastUsedAt = &lastUsedAt.Time
+		}
+		if revokedAt.Valid {
+			key.RevokedAt = &revokedAt.Time
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
@@ -0,0 +1,23 @@
+package repositories
+
+import (
+	"context"
+	"github.com/saufiroja/go-otel/auth-service/internal/models"
+	"time"
+)
+
+type ApiKeyRepository interface {
+	CreateServiceAccount(ctx context.Context, account *models.ServiceAccount) error
+	GetServiceAccountById(ctx context.Context, serviceAccountId string) (*models.ServiceAccount, error)
+	CreateApiKey(ctx context.Context, key *models.ApiKey) error
+	GetApiKeyById(ctx context.Context, keyId string) (*models.ApiKey, error)
+	GetApiKeyByPrefix(ctx context.Context, keyPrefix string) (*models.ApiKey, error)
+	GetApiKeysByServiceAccountId(ctx context.Context, serviceAccountId string) ([]*models.ApiKey, error)
+	RotateApiKey(ctx context.Context, oldKeyId string, oldExpiresAt time.Time, newKey *models.ApiKey) error
+	RevokeApiKey(ctx context.Context, keyId string, revokedAt time.Time) error
+	TouchApiKey(ctx context.Context, keyId string, usedAt time.Time) error
+	CreateClientCertificate(ctx context.Context, certificate *models.ClientCertificate) error
+	GetClientCertificateById(ctx context.Context, certificateId string) (*models.ClientCertificate, error)
+	GetClientCertificateBySubject(ctx context.Context, subjectDn string) (*models.ClientCertificate, error)
+	RevokeClientCertificate(ctx context.Context, certificateId string, revokedAt time.Time) error
+}
@@ -0,0 +1,305 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/saufiroja/go-otel/auth-service/config"
+	"github.com/saufiroja/go-otel/auth-service/internal/models"
+	"github.com/saufiroja/go-otel/auth-service/pkg/databases"
+	"github.com/saufiroja/go-otel/auth-service/pkg/observability/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"strings"
+	"time"
+)
+
+// auditChainLockId is the advisory lock serialising appends so the hash chain never forks
+const auditChainLockId = 7402910
+
+const auditEventColumns = `sequence, event_id, event_type, actor_id, target_id, trace_id, details_hash,
+				created_at, prev_hash, hash`
+
+// auditEventSelect reads events with their details, which are null once an erasure deleted them
+const auditEventSelect = `SELECT e.sequence, e.event_id, e.event_type, e.actor_id, e.target_id, e.trace_id,
+				e.details_hash, e.created_at, e.prev_hash, e.hash, d.salt, d.ip, d.user_agent, d.metadata
+				FROM audit_events e
+				LEFT JOIN audit_event_details d ON d.event_id = e.event_id`
+
+type auditRepository struct {
+	DB      databases.PostgresManager
+	Trace   *tracing.Tracer
+	HashKey []byte
+}
+
+func NewAuditRepository(db databases.PostgresManager, trace *tracing.Tracer, conf *config.AppConfig) AuditRepository {
+	return &auditRepository{
+		DB:      db,
+		Trace:   trace,
+		HashKey: []byte(conf.Audit.HashKey),
+	}
+}
+
+// AppendAuditEvent assigns the next sequence number, links the event to the previous row and stores it, the chain
+// head moves in the same transaction
+func (a *auditRepository) AppendAuditEvent(ctx context.Context, event *models.AuditEvent) error {
+	ctx, span := a.Trace.StartSpan(ctx, "repository.AppendAuditEvent")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.Key("event_id").String(event.EventId),
+		attribute.Key("event_type").String(event.EventType),
+		attribute.Key("actor_id").String(event.ActorId),
+		attribute.Key("target_id").String(event.TargetId),
+	)
+
+	tx, err := a.DB.StartTransaction()
+	if err != nil {
+		span.AddEvent("Failed to start transaction", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error starting transaction")
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, auditChainLockId)
+	if err != nil {
+		_ = a.DB.RollbackTransaction(tx)
+		span.AddEvent("Failed to lock audit chain", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error locking audit chain")
+		return err
+	}
+
+	event.Sequence = 1
+	event.PrevHash = models.AuditGenesisHash
+	var lastSequence int64
+	var lastHash string
+	err = tx.QueryRowContext(ctx, `SELECT sequence, hash FROM audit_events ORDER BY sequence DESC LIMIT 1`).
+		Scan(&lastSequence, &lastHash)
+	switch {
+	case err == nil:
+		event.Sequence = lastSequence + 1
+		event.PrevHash = lastHash
+	case err != sql.ErrNoRows:
+		_ = a.DB.RollbackTransaction(tx)
+		span.AddEvent("Failed to read chain head", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error reading chain head")
+		return err
+	}
+
+	// postgres keeps microseconds, truncate so the hash can be recomputed from the stored row
+	event.CreatedAt = event.CreatedAt.UTC().Truncate(time.Microsecond)
+	if event.Metadata == nil {
+		event.Metadata = map[string]string{}
+	}
+	event.DetailsHash = event.ComputeDetailsHash(a.HashKey)
+	event.Hash = event.ComputeHash(a.HashKey)
+
+	metadata, err := json.Marshal(event.Metadata)
+	if err != nil {
+		_ = a.DB.RollbackTransaction(tx)
+		span.SetStatus(codes.Error, "Error encoding metadata")
+		return err
+	}
+
+	query := `INSERT INTO audit_events (` + auditEventColumns + `)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
+
+	span.AddEvent("executing SQL query", trace.WithAttributes(
+		attribute.Key("sql.query").String(query),
+	))
+
+	_, err = tx.ExecContext(ctx, query, event.Sequence, event.EventId, event.EventType, event.ActorId,
+		event.TargetId, event.TraceId, event.DetailsHash, event.CreatedAt, event.PrevHash, event.Hash)
+	if err != nil {
+		_ = a.DB.RollbackTransaction(tx)
+		span.AddEvent("Failed to execute query", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error executing query")
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO audit_event_details (event_id, salt, ip, user_agent, metadata)
+				VALUES ($1, $2, $3, $4, $5)`,
+		event.EventId, event.DetailsSalt, event.Ip, event.UserAgent, metadata)
+	if err != nil {
+		_ = a.DB.RollbackTransaction(tx)
+		span.AddEvent("Failed to store event details", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error storing event details")
+		return err
+	}
+
+	head := &models.AuditChainHead{Sequence: event.Sequence, Hash: event.Hash}
+	head.Mac = head.ComputeMac(a.HashKey)
+	_, err = tx.ExecContext(ctx, `INSERT INTO audit_chain_head (id, sequence, hash, mac)
+				VALUES (1, $1, $2, $3)
+				ON CONFLICT (id) DO UPDATE SET sequence = $1, hash = $2, mac = $3`,
+		head.Sequence, head.Hash, head.Mac)
+	if err != nil {
+		_ = a.DB.RollbackTransaction(tx)
+		span.AddEvent("Failed to move chain head", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error moving chain head")
+		return err
+	}
+
+	if err := a.DB.CommitTransaction(tx); err != nil {
+		span.AddEvent("Failed to commit transaction", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error committing transaction")
+		return err
+	}
+
+	span.SetAttributes(attribute.Key("sequence").Int64(event.Sequence))
+	span.AddEvent("Successfully appended audit event")
+	span.SetStatus(codes.Ok, "Query executed successfully")
+
+	return nil
+}
+
+// GetAuditChainHead returns the recorded end of the chain, sql.ErrNoRows before the first event
+func (a *auditRepository) GetAuditChainHead(ctx context.Context) (*models.AuditChainHead, error) {
+	ctx, span := a.Trace.StartSpan(ctx, "repository.GetAuditChainHead")
+	defer span.End()
+	db := a.DB.Connection()
+
+	query := `SELECT sequence, hash, mac FROM audit_chain_head WHERE id = 1`
+
+	span.AddEvent("executing SQL query", trace.WithAttributes(
+		attribute.Key("sql.query").String(query),
+	))
+
+	head := &models.AuditChainHead{}
+	err := db.QueryRowContext(ctx, query).Scan(&head.Sequence, &head.Hash, &head.Mac)
+	if err != nil {
+		span.AddEvent("Failed to execute query", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error executing query")
+		return nil, err
+	}
+
+	span.SetStatus(codes.Ok, "Query executed successfully")
+
+	return head, nil
+}
+
+func (a *auditRepository) ListAuditEvents(ctx context.Context, filter *models.AuditFilter) ([]*models.AuditEvent, error) {
+	ctx, span := a.Trace.StartSpan(ctx, "repository.ListAuditEvents")
+	defer span.End()
+	db := a.DB.Connection()
+
+	conditions := []string{"e.sequence > $1"}
+	args := []interface{}{filter.AfterSequence}
+	addCondition := func(column string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf("%s $%d", column, len(args)))
+	}
+	if filter.ActorId != "" {
+		addCondition("e.actor_id =", filter.ActorId)
+	}
+	if filter.TargetId != "" {
+		addCondition("e.target_id =", filter.TargetId)
+	}
+	if filter.EventType != "" {
+		addCondition("e.event_type =", filter.EventType)
+	}
+	if filter.From != nil {
+		addCondition("e.created_at >=", *filter.From)
+	}
+	if filter.To != nil {
+		addCondition("e.created_at <", *filter.To)
+	}
+	args = append(args, filter.Limit)
+
+	query := fmt.Sprintf(`%s
+				WHERE %s
+				ORDER BY e.sequence
+				LIMIT $%d`, auditEventSelect, strings.Join(conditions, " AND "), len(args))
+
+	span.SetAttributes(
+		attribute.Key("after_sequence").Int64(filter.AfterSequence),
+		attribute.Key("limit").Int(filter.Limit),
+	)
+
+	span.AddEvent("executing SQL query", trace.WithAttributes(
+		attribute.Key("sql.query").String(query),
+	))
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		span.AddEvent("Failed to execute query", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error executing query")
+		return nil, err
+	}
+	defer rows.Close()
+
+	events, err := scanAuditEvents(rows)
+	if err != nil {
+		span.AddEvent("Failed to scan row", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error scanning row")
+		return nil, err
+	}
+
+	span.AddEvent("Successfully retrieved audit events", trace.WithAttributes(attribute.Key("count").Int(len(events))))
+	span.SetStatus(codes.Ok, "Query executed successfully")
+
+	return events, nil
+}
+
+func (a *auditRepository) GetAuditEventsByUserId(ctx context.Context, userId string) ([]*models.AuditEvent, error) {
+	ctx, span := a.Trace.StartSpan(ctx, "repository.GetAuditEventsByUserId")
+	defer span.End()
+	db := a.DB.Connection()
+
+	query := auditEventSelect + `
+				WHERE e.actor_id = $1 OR e.target_id = $1
+				ORDER BY e.sequence`
+
+	span.SetAttributes(
+		attribute.Key("user_id").String(userId),
+	)
+
+	span.AddEvent("executing SQL query", trace.WithAttributes(
+		attribute.Key("sql.query").String(query),
+	))
+
+	rows, err := db.QueryContext(ctx, query, userId)
+	if err != nil {
+		span.AddEvent("Failed to execute query", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error executing query")
+		return nil, err
+	}
+	defer rows.Close()
+
+	events, err := scanAuditEvents(rows)
+	if err != nil {
+		span.AddEvent("Failed to scan row", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error scanning row")
+		return nil, err
+	}
+
+	span.AddEvent("Successfully retrieved audit events", trace.WithAttributes(attribute.Key("count").Int(len(events))))
+	span.SetStatus(codes.Ok, "Query executed successfully")
+
+	return events, nil
+}
+
+func scanAuditEvents(rows *sql.Rows) ([]*models.AuditEvent, error) {
+	events := make([]*models.AuditEvent, 0)
+	for rows.Next() {
+		event := &models.AuditEvent{}
+		var salt, ip, userAgent sql.NullString
+		var metadata []byte
+		err := rows.Scan(&event.Sequence, &event.EventId, &event.EventType, &event.ActorId, &event.TargetId,
+			&event.TraceId, &event.DetailsHash, &event.CreatedAt, &event.PrevHash, &event.Hash, &salt, &ip,
+			&userAgent, &metadata)
+		if err != nil {
+			return nil, err
+		}
+		event.DetailsErased = !salt.Valid
+		if salt.Valid {
+			event.DetailsSalt, event.Ip, event.UserAgent = salt.String, ip.String, userAgent.String
+			if err := json.Unmarshal(metadata, &event.Metadata); err != nil {
+				return nil, err
+			}
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
@@ -0,0 +1,13 @@
+package repositories
+
+import (
+	"context"
+	"github.com/saufiroja/go-otel/auth-service/internal/models"
+)
+
+type AuditRepository interface {
+	AppendAuditEvent(ctx context.Context, event *models.AuditEvent) error
+	GetAuditChainHead(ctx context.Context) (*models.AuditChainHead, error)
+	ListAuditEvents(ctx context.Context, filter *models.AuditFilter) ([]*models.AuditEvent, error)
+	GetAuditEventsByUserId(ctx context.Context, userId string) ([]*models.AuditEvent, error)
+}
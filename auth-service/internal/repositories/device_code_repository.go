@@ -0,0 +1,239 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"github.com/saufiroja/go-otel/auth-service/internal/models"
+	"github.com/saufiroja/go-otel/auth-service/pkg/databases"
+	"github.com/saufiroja/go-otel/auth-service/pkg/observability/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"time"
+)
+
+const deviceCodeColumns = `device_code_hash, user_code, client_id, status, user_id, poll_interval, last_polled_at,
+				expires_at, created_at`
+
+type deviceCodeRepository struct {
+	DB    databases.PostgresManager
+	Trace *tracing.Tracer
+}
+
+func NewDeviceCodeRepository(db databases.PostgresManager, trace *tracing.Tracer) DeviceCodeRepository {
+	return &deviceCodeRepository{
+		DB:    db,
+		Trace: trace,
+	}
+}
+
+func (d *deviceCodeRepository) CreateDeviceCode(ctx context.Context, deviceCode *models.DeviceCode) error {
+	ctx, span := d.Trace.StartSpan(ctx, "repository.CreateDeviceCode")
+	defer span.End()
+	db := d.DB.Connection()
+
+	query := `INSERT INTO device_codes (device_code_hash, user_code, client_id, status, poll_interval, expires_at,
+				created_at)
+				VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	span.SetAttributes(
+		attribute.Key("client_id").String(deviceCode.ClientId),
+	)
+
+	span.AddEvent("executing SQL query", trace.WithAttributes(
+		attribute.Key("sql.query").String(query),
+	))
+
+	_, err := db.ExecContext(ctx, query, deviceCode.DeviceCodeHash, deviceCode.UserCode, deviceCode.ClientId,
+		deviceCode.Status, deviceCode.Interval, deviceCode.ExpiresAt, deviceCode.CreatedAt)
+	if err != nil {
+		span.AddEvent("Failed to execute query", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error executing query")
+		return err
+	}
+
+	span.SetStatus(codes.Ok, "Query executed successfully")
+
+	return nil
+}
+
+func (d *deviceCodeRepository) GetDeviceCodeByHash(ctx context.Context,
+	deviceCodeHash string) (*models.DeviceCode, error) {
+	ctx, span := d.Trace.StartSpan(ctx, "repository.GetDeviceCodeByHash")
+	defer span.End()
+	db := d.DB.Connection()
+
+	query := `SELECT ` + deviceCodeColumns + `
+				FROM device_codes
+				WHERE device_code_hash = $1`
+
+	span.AddEvent("executing SQL query", trace.WithAttributes(
+		attribute.Key("sql.query").String(query),
+	))
+
+	deviceCode, err := scanDeviceCode(db.QueryRowContext(ctx, query, deviceCodeHash))
+	if err != nil {
+		span.AddEvent("Failed to execute query", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error executing query")
+		return nil, err
+	}
+
+	span.SetStatus(codes.Ok, "Query executed successfully")
+
+	return deviceCode, nil
+}
+
+// GetPendingDeviceCode returns the unexpired device code a user is about to approve or deny
+func (d *deviceCodeRepository) GetPendingDeviceCode(ctx context.Context, userCode string,
+	now time.Time) (*models.DeviceCode, error) {
+	ctx, span := d.Trace.StartSpan(ctx, "repository.GetPendingDeviceCode")
+	defer span.End()
+	db := d.DB.Connection()
+
+	query := `SELECT ` + deviceCodeColumns + `
+				FROM device_codes
+				WHERE user_code = $1 AND status = $2 AND expires_at > $3`
+
+	span.AddEvent("executing SQL query", trace.WithAttributes(
+		attribute.Key("sql.query").String(query),
+	))
+
+	deviceCode, err := scanDeviceCode(db.QueryRowContext(ctx, query, userCode, models.DeviceCodeStatusPending, now))
+	if err != nil {
+		span.AddEvent("Failed to execute query", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error executing query")
+		return nil, err
+	}
+
+	span.SetStatus(codes.Ok, "Query executed successfully")
+
+	return deviceCode, nil
+}
+
+func (d *deviceCodeRepository) RecordDeviceCodePoll(ctx context.Context, deviceCodeHash string, polledAt time.Time,
+	interval int) error {
+	ctx, span := d.Trace.StartSpan(ctx, "repository.RecordDeviceCodePoll")
+	defer span.End()
+	db := d.DB.Connection()
+
+	query := `UPDATE device_codes SET last_polled_at = $2, poll_interval = $3
+				WHERE device_code_hash = $1`
+	span.SetAttributes(
+		attribute.Key("interval").Int(interval),
+	)
+
+	span.AddEvent("executing SQL query", trace.WithAttributes(
+		attribute.Key("sql.query").String(query),
+	))
+
+	_, err := db.ExecContext(ctx, query, deviceCodeHash, polledAt, interval)
+	if err != nil {
+		span.AddEvent("Failed to execute query", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error executing query")
+		return err
+	}
+
+	span.SetStatus(codes.Ok, "Query executed successfully")
+
+	return nil
+}
+
+// DecideDeviceCode approves or denies a pending device code, it returns sql.ErrNoRows once the code has been decided
+// or has expired so a code cannot be approved twice
+func (d *deviceCodeRepository) DecideDeviceCode(ctx context.Context, userCode, userId, status string,
+	now time.Time) error {
+	ctx, span := d.Trace.StartSpan(ctx, "repository.DecideDeviceCode")
+	defer span.End()
+	db := d.DB.Connection()
+
+	query := `UPDATE device_codes SET status = $3, user_id = $2
+				WHERE user_code = $1 AND status = $4 AND expires_at > $5`
+	span.SetAttributes(
+		attribute.Key("user_id").String(userId),
+		attribute.Key("status").String(status),
+	)
+
+	span.AddEvent("executing SQL query", trace.WithAttributes(
+		attribute.Key("sql.query").String(query),
+	))
+
+	result, err := db.ExecContext(ctx, query, userCode, userId, status, models.DeviceCodeStatusPending, now)
+	if err != nil {
+		span.AddEvent("Failed to execute query", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error executing query")
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err == nil && rows == 0 {
+		span.AddEvent("device code not pending")
+		span.SetStatus(codes.Error, "Device code not found")
+		return sql.ErrNoRows
+	}
+
+	span.SetStatus(codes.Ok, "Query executed successfully")
+
+	return nil
+}
+
+// ConsumeDeviceCode deletes and returns an approved device code, so concurrent polls cannot both receive tokens
+func (d *deviceCodeRepository) ConsumeDeviceCode(ctx context.Context,
+	deviceCodeHash string) (*models.DeviceCode, error) {
+	ctx, span := d.Trace.StartSpan(ctx, "repository.ConsumeDeviceCode")
+	defer span.End()
+	db := d.DB.Connection()
+
+	query := `DELETE FROM device_codes
+				WHERE device_code_hash = $1 AND status = $2
+				RETURNING ` + deviceCodeColumns
+
+	span.AddEvent("executing SQL query", trace.WithAttributes(
+		attribute.Key("sql.query").String(query),
+	))
+
+	deviceCode, err := scanDeviceCode(db.QueryRowContext(ctx, query, deviceCodeHash,
+		models.DeviceCodeStatusApproved))
+	if err != nil {
+		span.AddEvent("Failed to execute query", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error executing query")
+		return nil, err
+	}
+
+	span.SetStatus(codes.Ok, "Query executed successfully")
+
+	return deviceCode, nil
+}
+
+func (d *deviceCodeRepository) DeleteDeviceCode(ctx context.Context, deviceCodeHash string) error {
+	ctx, span := d.Trace.StartSpan(ctx, "repository.DeleteDeviceCode")
+	defer span.End()
+	db := d.DB.Connection()
+
+	query := `DELETE FROM device_codes WHERE device_code_hash = $1`
+
+	span.AddEvent("executing SQL query", trace.WithAttributes(
+		attribute.Key("sql.query").String(query),
+	))
+
+	_, err := db.ExecContext(ctx, query, deviceCodeHash)
+	if err != nil {
+		span.AddEvent("Failed to execute query", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error executing query")
+		return err
+	}
+
+	span.SetStatus(codes.Ok, "Query executed successfully")
+
+	return nil
+}
+
+func scanDeviceCode(row *sql.Row) (*models.DeviceCode, error) {
+	deviceCode := &models.DeviceCode{}
+	var userId sql.NullString
+	err := row.Scan(&deviceCode.DeviceCodeHash, &deviceCode.UserCode, &deviceCode.ClientId, &deviceCode.Status,
+		&userId, &deviceCode.Interval, &deviceCode.LastPolledAt, &deviceCode.ExpiresAt, &deviceCode.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	deviceCode.UserId = userId.String
+	return deviceCode, nil
+}
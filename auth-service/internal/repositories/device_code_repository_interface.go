@@ -0,0 +1,17 @@
+package repositories
+
+import (
+	"context"
+	"github.com/saufiroja/go-otel/auth-service/internal/models"
+	"time"
+)
+
+type DeviceCodeRepository interface {
+	CreateDeviceCode(ctx context.Context, deviceCode *models.DeviceCode) error
+	GetDeviceCodeByHash(ctx context.Context, deviceCodeHash string) (*models.DeviceCode, error)
+	GetPendingDeviceCode(ctx context.Context, userCode string, now time.Time) (*models.DeviceCode, error)
+	RecordDeviceCodePoll(ctx context.Context, deviceCodeHash string, polledAt time.Time, interval int) error
+	DecideDeviceCode(ctx context.Context, userCode, userId, status string, now time.Time) error
+	ConsumeDeviceCode(ctx context.Context, deviceCodeHash string) (*models.DeviceCode, error)
+	DeleteDeviceCode(ctx context.Context, deviceCodeHash string) error
+}
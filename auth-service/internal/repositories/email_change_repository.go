@@ -0,0 +1,252 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/lib/pq"
+	"github.com/saufiroja/go-otel/auth-service/internal/models"
+	"github.com/saufiroja/go-otel/auth-service/pkg/databases"
+	"github.com/saufiroja/go-otel/auth-service/pkg/observability/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"time"
+)
+
+// ErrEmailTaken is returned when the new address of a change belongs to another account
+var ErrEmailTaken = errors.New("email already in use")
+
+type emailChangeRepository struct {
+	DB    databases.PostgresManager
+	Trace *tracing.Tracer
+}
+
+func NewEmailChangeRepository(db databases.PostgresManager, trace *tracing.Tracer) EmailChangeRepository {
+	return &emailChangeRepository{
+		DB:    db,
+		Trace: trace,
+	}
+}
+
+func (e *emailChangeRepository) CreateEmailChange(ctx context.Context, change *models.EmailChange) error {
+	ctx, span := e.Trace.StartSpan(ctx, "repository.CreateEmailChange")
+	defer span.End()
+	db := e.DB.Connection()
+
+	query := `INSERT INTO email_changes (change_id, user_id, new_email, token_hash, expires_at, created_at)
+				VALUES ($1, $2, $3, $4, $5, $6)`
+	span.SetAttributes(
+		attribute.Key("change_id").String(change.ChangeId),
+		attribute.Key("user_id").String(change.UserId),
+		attribute.Key("expires_at").Int64(change.ExpiresAt.Unix()),
+	)
+
+	span.AddEvent("executing SQL query", trace.WithAttributes(
+		attribute.Key("sql.query").String(query),
+	))
+
+	_, err := db.ExecContext(ctx, query,
+		change.ChangeId, change.UserId, change.NewEmail, change.TokenHash, change.ExpiresAt, change.CreatedAt)
+	if err != nil {
+		span.AddEvent("Failed to execute query", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error executing query")
+		return err
+	}
+
+	span.AddEvent("Successfully created email change", trace.WithAttributes(attribute.Key("changeId").String(change.ChangeId)))
+	span.SetStatus(codes.Ok, "Query executed successfully")
+
+	return nil
+}
+
+func (e *emailChangeRepository) GetEmailChangeByTokenHash(ctx context.Context, tokenHash string) (*models.EmailChange, error) {
+	ctx, span := e.Trace.StartSpan(ctx, "repository.GetEmailChangeByTokenHash")
+	defer span.End()
+	db := e.DB.Connection()
+
+	query := `SELECT change_id, user_id, new_email, token_hash, expires_at, consumed_at, created_at
+				FROM email_changes
+				WHERE token_hash = $1`
+
+	row := db.QueryRowContext(ctx, query, tokenHash)
+
+	span.AddEvent("executing SQL query", trace.WithAttributes(
+		attribute.Key("sql.query").String(query),
+	))
+
+	change := &models.EmailChange{}
+	var consumedAt sql.NullTime
+	err := row.Scan(&change.ChangeId, &change.UserId, &change.NewEmail, &change.TokenHash,
+		&change.ExpiresAt, &consumedAt, &change.CreatedAt)
+	if err != nil {
+		span.AddEvent("email change not found", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		return nil, err
+	}
+	if consumedAt.Valid {
+		change.ConsumedAt = &consumedAt.Time
+	}
+
+	span.SetAttributes(
+		attribute.Key("change_id").String(change.ChangeId),
+		attribute.Key("user_id").String(change.UserId),
+	)
+	span.AddEvent("Successfully retrieved email change", trace.WithAttributes(attribute.Key("changeId").String(change.ChangeId)))
+	span.SetStatus(codes.Ok, "Query executed successfully")
+
+	return change, nil
+}
+
+// ConfirmEmailChange consumes the change and moves the user to the new address in a single transaction, it
+// returns ErrEmailTaken when another account holds the address and sql.ErrNoRows when the change was consumed
+func (e *emailChangeRepository) ConfirmEmailChange(ctx context.Context, change *models.EmailChange,
+	now time.Time) error {
+	ctx, span := e.Trace.StartSpan(ctx, "repository.ConfirmEmailChange")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.Key("change_id").String(change.ChangeId),
+		attribute.Key("user_id").String(change.UserId),
+	)
+
+	tx, err := e.DB.StartTransaction()
+	if err != nil {
+		span.AddEvent("Failed to start transaction", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error starting transaction")
+		return err
+	}
+
+	consumeQuery := `UPDATE email_changes
+				SET consumed_at = $2
+				WHERE change_id = $1 AND consumed_at IS NULL`
+
+	span.AddEvent("executing SQL query", trace.WithAttributes(
+		attribute.Key("sql.query").String(consumeQuery),
+	))
+
+	result, err := tx.ExecContext(ctx, consumeQuery, change.ChangeId, now)
+	if err != nil {
+		_ = e.DB.RollbackTransaction(tx)
+		span.AddEvent("Failed to execute query", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error executing query")
+		return err
+	}
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+		_ = e.DB.RollbackTransaction(tx)
+		span.AddEvent("email change already consumed")
+		span.SetStatus(codes.Error, "Email change already consumed")
+		return sql.ErrNoRows
+	}
+
+	// the address may have been taken while the verification was pending, the unique constraint covers a
+	// concurrent confirmation that commits between this check and the update
+	var taken bool
+	err = tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM users WHERE email = $1 AND user_id <> $2)`,
+		change.NewEmail, change.UserId).Scan(&taken)
+	if err != nil {
+		_ = e.DB.RollbackTransaction(tx)
+		span.AddEvent("Failed to check email", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error checking email")
+		return err
+	}
+	if taken {
+		_ = e.DB.RollbackTransaction(tx)
+		span.AddEvent("email already in use")
+		span.SetStatus(codes.Error, "Email already in use")
+		return ErrEmailTaken
+	}
+
+	updateQuery := `UPDATE users SET email = $2, updated_at = $3 WHERE user_id = $1`
+
+	span.AddEvent("executing SQL query", trace.WithAttributes(
+		attribute.Key("sql.query").String(updateQuery),
+	))
+
+	_, err = tx.ExecContext(ctx, updateQuery, change.UserId, change.NewEmail, now)
+	if err != nil {
+		_ = e.DB.RollbackTransaction(tx)
+		if isUniqueViolation(err) {
+			span.AddEvent("email already in use")
+			span.SetStatus(codes.Error, "Email already in use")
+			return ErrEmailTaken
+		}
+		span.AddEvent("Failed to execute query", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error executing query")
+		return err
+	}
+
+	if err := e.DB.CommitTransaction(tx); err != nil {
+		if isUniqueViolation(err) {
+			span.AddEvent("email already in use")
+			span.SetStatus(codes.Error, "Email already in use")
+			return ErrEmailTaken
+		}
+		span.AddEvent("Failed to commit transaction", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error committing transaction")
+		return err
+	}
+
+	span.AddEvent("Successfully confirmed email change", trace.WithAttributes(attribute.Key("changeId").String(change.ChangeId)))
+	span.SetStatus(codes.Ok, "Query executed successfully")
+
+	return nil
+}
+
+func (e *emailChangeRepository) GetEmailChangesByUserId(ctx context.Context, userId string) ([]*models.EmailChange, error) {
+	ctx, span := e.Trace.StartSpan(ctx, "repository.GetEmailChangesByUserId")
+	defer span.End()
+	db := e.DB.Connection()
+
+	query := `SELECT change_id, user_id, new_email, token_hash, expires_at, consumed_at, created_at
+				FROM email_changes
+				WHERE user_id = $1
+				ORDER BY created_at`
+
+	span.SetAttributes(
+		attribute.Key("user_id").String(userId),
+	)
+
+	span.AddEvent("executing SQL query", trace.WithAttributes(
+		attribute.Key("sql.query").String(query),
+	))
+
+	rows, err := db.QueryContext(ctx, query, userId)
+	if err != nil {
+		span.AddEvent("Failed to execute query", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error executing query")
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := make([]*models.EmailChange, 0)
+	for rows.Next() {
+		change := &models.EmailChange{}
+		var consumedAt sql.NullTime
+		err := rows.Scan(&change.ChangeId, &change.UserId, &change.NewEmail, &change.TokenHash,
+			&change.ExpiresAt, &consumedAt, &change.CreatedAt)
+		if err != nil {
+			span.AddEvent("Failed to scan row", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+			span.SetStatus(codes.Error, "Error scanning row")
+			return nil, err
+		}
+		if consumedAt.Valid {
+			change.ConsumedAt = &consumedAt.Time
+		}
+		changes = append(changes, change)
+	}
+	if err := rows.Err(); err != nil {
+		span.SetStatus(codes.Error, "Error iterating rows")
+		return nil, err
+	}
+
+	span.AddEvent("Successfully retrieved email changes", trace.WithAttributes(attribute.Key("count").Int(len(changes))))
+	span.SetStatus(codes.Ok, "Query executed successfully")
+
+	return changes, nil
+}
+
+// isUniqueViolation reports whether err is postgres rejecting a duplicate value of a unique constraint
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
@@ -0,0 +1,14 @@
+package repositories
+
+import (
+	"context"
+	"github.com/saufiroja/go-otel/auth-service/internal/models"
+	"time"
+)
+
+type EmailChangeRepository interface {
+	CreateEmailChange(ctx context.Context, change *models.EmailChange) error
+	GetEmailChangeByTokenHash(ctx context.Context, tokenHash string) (*models.EmailChange, error)
+	ConfirmEmailChange(ctx context.Context, change *models.EmailChange, now time.Time) error
+	GetEmailChangesByUserId(ctx context.Context, userId string) ([]*models.EmailChange, error)
+}
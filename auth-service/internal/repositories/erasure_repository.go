@@ -0,0 +1,309 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/saufiroja/go-otel/auth-service/internal/models"
+	"github.com/saufiroja/go-otel/auth-service/pkg/databases"
+	"github.com/saufiroja/go-otel/auth-service/pkg/observability/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"time"
+)
+
+// erasureSystemActor is recorded as changed_by when the erasure worker deletes an account
+const erasureSystemActor = "system:erasure"
+
+// erasureDeleteQueries hard-delete personal data held outside the users row, $1 is the user id.
+//
+// What is retained: the anonymised users row, the audit chain rows naming the user id as actor or target with their
+// event type, trace id and time, the final deleted status change, and the user id in created_by and changed_by of
+// what the user did to other accounts and service accounts. The user id is random and after erasure resolves to
+// nothing but the anonymised row. The ip, user agent and metadata of the user's audit events are deleted, the
+// salted hash left in the chain cannot be matched against them.
+var erasureDeleteQueries = []string{
+	`DELETE FROM audit_event_details WHERE event_id IN
+		(SELECT event_id FROM audit_events WHERE actor_id = $1 OR target_id = $1)`,
+	`DELETE FROM user_status_changes WHERE user_id = $1`,
+	`DELETE FROM email_changes WHERE user_id = $1`,
+	`DELETE FROM sessions WHERE user_id = $1`,
+	`DELETE FROM personal_access_tokens WHERE user_id = $1`,
+	`DELETE FROM user_identities WHERE user_id = $1`,
+	`DELETE FROM oidc_login_states WHERE link_user_id = $1`,
+	`DELETE FROM saml_requests WHERE link_user_id = $1`,
+	`DELETE FROM scim_users WHERE user_id = $1`,
+	`DELETE FROM device_codes WHERE user_id = $1`,
+}
+
+type erasureRepository struct {
+	DB    databases.PostgresManager
+	Trace *tracing.Tracer
+}
+
+func NewErasureRepository(db databases.PostgresManager, trace *tracing.Tracer) ErasureRepository {
+	return &erasureRepository{
+		DB:    db,
+		Trace: trace,
+	}
+}
+
+func (e *erasureRepository) CreateErasureRequest(ctx context.Context, request *models.ErasureRequest) error {
+	ctx, span := e.Trace.StartSpan(ctx, "repository.CreateErasureRequest")
+	defer span.End()
+	db := e.DB.Connection()
+
+	query := `INSERT INTO erasure_requests (request_id, user_id, status, requested_at, scheduled_at)
+				VALUES ($1, $2, $3, $4, $5)`
+	span.SetAttributes(
+		attribute.Key("request_id").String(request.RequestId),
+		attribute.Key("user_id").String(request.UserId),
+		attribute.Key("scheduled_at").Int64(request.ScheduledAt.Unix()),
+	)
+
+	span.AddEvent("executing SQL query", trace.WithAttributes(
+		attribute.Key("sql.query").String(query),
+	))
+
+	_, err := db.ExecContext(ctx, query,
+		request.RequestId, request.UserId, request.Status, request.RequestedAt, request.ScheduledAt)
+	if err != nil {
+		span.AddEvent("Failed to execute query", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error executing query")
+		return err
+	}
+
+	span.AddEvent("Successfully created erasure request", trace.WithAttributes(attribute.Key("requestId").String(request.RequestId)))
+	span.SetStatus(codes.Ok, "Query executed successfully")
+
+	return nil
+}
+
+func (e *erasureRepository) GetErasureRequestsByUserId(ctx context.Context, userId string) ([]*models.ErasureRequest, error) {
+	ctx, span := e.Trace.StartSpan(ctx, "repository.GetErasureRequestsByUserId")
+	defer span.End()
+	db := e.DB.Connection()
+
+	query := `SELECT request_id, user_id, status, requested_at, scheduled_at, completed_at
+				FROM erasure_requests
+				WHERE user_id = $1
+				ORDER BY requested_at`
+
+	span.SetAttributes(
+		attribute.Key("user_id").String(userId),
+	)
+
+	span.AddEvent("executing SQL query", trace.WithAttributes(
+		attribute.Key("sql.query").String(query),
+	))
+
+	rows, err := db.QueryContext(ctx, query, userId)
+	if err != nil {
+		span.AddEvent("Failed to execute query", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error executing query")
+		return nil, err
+	}
+	defer rows.Close()
+
+	requests, err := scanErasureRequests(rows)
+	if err != nil {
+		span.AddEvent("Failed to scan row", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error scanning row")
+		return nil, err
+	}
+
+	span.AddEvent("Successfully retrieved erasure requests", trace.WithAttributes(attribute.Key("count").Int(len(requests))))
+	span.SetStatus(codes.Ok, "Query executed successfully")
+
+	return requests, nil
+}
+
+func (e *erasureRepository) CancelErasureRequest(ctx context.Context, userId string) error {
+	ctx, span := e.Trace.StartSpan(ctx, "repository.CancelErasureRequest")
+	defer span.End()
+	db := e.DB.Connection()
+
+	query := `UPDATE erasure_requests
+				SET status = $2
+				WHERE user_id = $1 AND status = $3`
+
+	span.SetAttributes(
+		attribute.Key("user_id").String(userId),
+	)
+
+	span.AddEvent("executing SQL query", trace.WithAttributes(
+		attribute.Key("sql.query").String(query),
+	))
+
+	result, err := db.ExecContext(ctx, query, userId, models.ErasureCancelled, models.ErasurePending)
+	if err != nil {
+		span.AddEvent("Failed to execute query", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error executing query")
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err == nil && rows == 0 {
+		span.AddEvent("no pending erasure request")
+		span.SetStatus(codes.Error, "No pending erasure request")
+		return sql.ErrNoRows
+	}
+
+	span.AddEvent("Successfully cancelled erasure request", trace.WithAttributes(attribute.Key("userId").String(userId)))
+	span.SetStatus(codes.Ok, "Query executed successfully")
+
+	return nil
+}
+
+func (e *erasureRepository) GetDueErasureRequests(ctx context.Context, now time.Time,
+	limit int) ([]*models.ErasureRequest, error) {
+	ctx, span := e.Trace.StartSpan(ctx, "repository.GetDueErasureRequests")
+	defer span.End()
+	db := e.DB.Connection()
+
+	query := `SELECT request_id, user_id, status, requested_at, scheduled_at, completed_at
+				FROM erasure_requests
+				WHERE status = $1 AND scheduled_at <= $2
+				ORDER BY scheduled_at
+				LIMIT $3`
+
+	span.SetAttributes(
+		attribute.Key("limit").Int(limit),
+	)
+
+	span.AddEvent("executing SQL query", trace.WithAttributes(
+		attribute.Key("sql.query").String(query),
+	))
+
+	rows, err := db.QueryContext(ctx, query, models.ErasurePending, now, limit)
+	if err != nil {
+		span.AddEvent("Failed to execute query", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error executing query")
+		return nil, err
+	}
+	defer rows.Close()
+
+	requests, err := scanErasureRequests(rows)
+	if err != nil {
+		span.AddEvent("Failed to scan row", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error scanning row")
+		return nil, err
+	}
+
+	span.AddEvent("Successfully retrieved due erasure requests", trace.WithAttributes(attribute.Key("count").Int(len(requests))))
+	span.SetStatus(codes.Ok, "Query executed successfully")
+
+	return requests, nil
+}
+
+// EraseUser anonymises the users row, hard-deletes the rest of the user's personal data and completes
+// the request in a single transaction
+func (e *erasureRepository) EraseUser(ctx context.Context, request *models.ErasureRequest, now time.Time) error {
+	ctx, span := e.Trace.StartSpan(ctx, "repository.EraseUser")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.Key("request_id").String(request.RequestId),
+		attribute.Key("user_id").String(request.UserId),
+	)
+
+	tx, err := e.DB.StartTransaction()
+	if err != nil {
+		span.AddEvent("Failed to start transaction", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error starting transaction")
+		return err
+	}
+
+	var fromStatus string
+	err = tx.QueryRowContext(ctx, `SELECT status FROM users WHERE user_id = $1 FOR UPDATE`,
+		request.UserId).Scan(&fromStatus)
+	if err != nil {
+		_ = e.DB.RollbackTransaction(tx)
+		span.AddEvent("user not found", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "User not found")
+		return err
+	}
+
+	anonymiseQuery := `UPDATE users
+				SET full_name = $2, email = $3, password = '', status = $4, updated_at = $5
+				WHERE user_id = $1`
+	_, err = tx.ExecContext(ctx, anonymiseQuery, request.UserId, "Deleted User",
+		fmt.Sprintf("deleted+%s@invalid", request.UserId), models.StatusDeleted, now)
+	if err != nil {
+		_ = e.DB.RollbackTransaction(tx)
+		span.AddEvent("Failed to anonymise user", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error anonymising user")
+		return err
+	}
+
+	deleted := int64(0)
+	for _, query := range erasureDeleteQueries {
+		result, err := tx.ExecContext(ctx, query, request.UserId)
+		if err != nil {
+			_ = e.DB.RollbackTransaction(tx)
+			span.AddEvent("Failed to delete personal data", trace.WithAttributes(
+				attribute.Key("sql.query").String(query),
+				attribute.Key("error").String(err.Error()),
+			))
+			span.SetStatus(codes.Error, "Error deleting personal data")
+			return err
+		}
+		if rows, err := result.RowsAffected(); err == nil {
+			deleted += rows
+		}
+	}
+
+	if fromStatus != models.StatusDeleted {
+		_, err = tx.ExecContext(ctx, `INSERT INTO user_status_changes
+				(change_id, user_id, from_status, to_status, changed_by, reason, changed_at)
+				VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+			uuid.New().String(), request.UserId, fromStatus, models.StatusDeleted, erasureSystemActor,
+			fmt.Sprintf("erasure request %s", request.RequestId), now)
+		if err != nil {
+			_ = e.DB.RollbackTransaction(tx)
+			span.AddEvent("Failed to record status change", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+			span.SetStatus(codes.Error, "Error recording status change")
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE erasure_requests SET status = $2, completed_at = $3 WHERE request_id = $1`,
+		request.RequestId, models.ErasureCompleted, now)
+	if err != nil {
+		_ = e.DB.RollbackTransaction(tx)
+		span.AddEvent("Failed to complete erasure request", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error completing erasure request")
+		return err
+	}
+
+	if err := e.DB.CommitTransaction(tx); err != nil {
+		span.AddEvent("Failed to commit transaction", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error committing transaction")
+		return err
+	}
+
+	span.AddEvent("Successfully erased user", trace.WithAttributes(attribute.Key("deleted_rows").Int64(deleted)))
+	span.SetStatus(codes.Ok, "User erased successfully")
+
+	return nil
+}
+
+func scanErasureRequests(rows *sql.Rows) ([]*models.ErasureRequest, error) {
+	requests := make([]*models.ErasureRequest, 0)
+	for rows.Next() {
+		request := &models.ErasureRequest{}
+		var completedAt sql.NullTime
+		err := rows.Scan(&request.RequestId, &request.UserId, &request.Status, &request.RequestedAt,
+			&request.ScheduledAt, &completedAt)
+		if err != nil {
+			return nil, err
+		}
+		if completedAt.Valid {
+			request.CompletedAt = &completedAt.Time
+		}
+		requests = append(requests, request)
+	}
+	return requests, rows.Err()
+}
@@ -0,0 +1,15 @@
+package repositories
+
+import (
+	"context"
+	"github.com/saufiroja/go-otel/auth-service/internal/models"
+	"time"
+)
+
+type ErasureRepository interface {
+	CreateErasureRequest(ctx context.Context, request *models.ErasureRequest) error
+	GetErasureRequestsByUserId(ctx context.Context, userId string) ([]*models.ErasureRequest, error)
+	CancelErasureRequest(ctx context.Context, userId string) error
+	GetDueErasureRequests(ctx context.Context, now time.Time, limit int) ([]*models.ErasureRequest, error)
+	EraseUser(ctx context.Context, request *models.ErasureRequest, now time.Time) error
+}
@@ -0,0 +1,83 @@
+package repositories
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// erasureRetainedColumns hold a user id that erasure keeps on purpose, see erasureDeleteQueries
+var erasureRetainedColumns = map[string]bool{
+	"users.user_id":                  true,
+	"erasure_requests.user_id":       true,
+	"user_status_changes.changed_by": true,
+	"audit_events.actor_id":          true,
+	"audit_events.target_id":         true,
+	"service_accounts.created_by":    true,
+	"client_certificates.created_by": true,
+}
+
+var (
+	createTablePattern = regexp.MustCompile(`(?s)CREATE TABLE (\w+) \((.*?)\n\);`)
+	columnPattern      = regexp.MustCompile(`^\s*(\w+) `)
+)
+
+// userIdColumns lists table.column of every column in the migrations that holds a user id, either by referencing
+// users or by its name
+func userIdColumns(t *testing.T) []string {
+	t.Helper()
+
+	files, err := filepath.Glob(filepath.Join("..", "..", "..", "migrations", "*.sql"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no migrations found: %v", err)
+	}
+
+	var columns []string
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, table := range createTablePattern.FindAllStringSubmatch(string(content), -1) {
+			for _, line := range strings.Split(table[2], "\n") {
+				column := columnPattern.FindStringSubmatch(line)
+				if column == nil {
+					continue
+				}
+				name := column[1]
+				if strings.HasSuffix(name, "user_id") || strings.HasSuffix(name, "_by") || name == "actor_id" ||
+					name == "target_id" || strings.Contains(line, "REFERENCES users(") {
+					columns = append(columns, table[1]+"."+name)
+				}
+			}
+		}
+	}
+	return columns
+}
+
+func TestErasureCoversUserIdColumns(t *testing.T) {
+	columns := userIdColumns(t)
+	if len(columns) == 0 {
+		t.Fatal("no user id columns found in the migrations")
+	}
+
+	for _, column := range columns {
+		if erasureRetainedColumns[column] {
+			continue
+		}
+		table, name, _ := strings.Cut(column, ".")
+		want := "DELETE FROM " + table + " WHERE " + name + " = $1"
+
+		found := false
+		for _, query := range erasureDeleteQueries {
+			if query == want {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("%s holds a user id but erasure neither deletes it (%q) nor retains it", column, want)
+		}
+	}
+}
@@ -0,0 +1,287 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"github.com/saufiroja/go-otel/auth-service/internal/models"
+	"github.com/saufiroja/go-otel/auth-service/pkg/databases"
+	"github.com/saufiroja/go-otel/auth-service/pkg/observability/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"time"
+)
+
+const identityColumns = `identity_id, user_id, provider, subject, email, provisioned, created_at, last_login_at`
+
+type identityRepository struct {
+	DB    databases.PostgresManager
+	Trace *tracing.Tracer
+}
+
+func NewIdentityRepository(db databases.PostgresManager, trace *tracing.Tracer) IdentityRepository {
+	return &identityRepository{
+		DB:    db,
+		Trace: trace,
+	}
+}
+
+func (i *identityRepository) CreateIdentity(ctx context.Context, identity *models.UserIdentity) error {
+	ctx, span := i.Trace.StartSpan(ctx, "repository.CreateIdentity")
+	defer span.End()
+	db := i.DB.Connection()
+
+	query := `INSERT INTO user_identities (identity_id, user_id, provider, subject, email, provisioned, created_at,
+				last_login_at)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+	span.SetAttributes(
+		attribute.Key("identity_id").String(identity.IdentityId),
+		attribute.Key("user_id").String(identity.UserId),
+		attribute.Key("provider").String(identity.Provider),
+	)
+
+	span.AddEvent("executing SQL query", trace.WithAttributes(
+		attribute.Key("sql.query").String(query),
+	))
+
+	_, err := db.ExecContext(ctx, query, identity.IdentityId, identity.UserId, identity.Provider, identity.Subject,
+		identity.Email, identity.Provisioned, identity.CreatedAt, identity.LastLoginAt)
+	if err != nil {
+		span.AddEvent("Failed to execute query", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error executing query")
+		return err
+	}
+
+	span.AddEvent("Successfully created identity", trace.WithAttributes(attribute.Key("identityId").String(identity.IdentityId)))
+	span.SetStatus(codes.Ok, "Query executed successfully")
+
+	return nil
+}
+
+func (i *identityRepository) GetIdentity(ctx context.Context, provider, subject string) (*models.UserIdentity, error) {
+	ctx, span := i.Trace.StartSpan(ctx, "repository.GetIdentity")
+	defer span.End()
+	db := i.DB.Connection()
+
+	query := `SELECT ` + identityColumns + `
+				FROM user_identities
+				WHERE provider = $1 AND subject = $2`
+
+	span.SetAttributes(
+		attribute.Key("provider").String(provider),
+	)
+
+	span.AddEvent("executing SQL query", trace.WithAttributes(
+		attribute.Key("sql.query").String(query),
+	))
+
+	rows, err := db.QueryContext(ctx, query, provider, subject)
+	if err != nil {
+		span.AddEvent("Failed to execute query", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error executing query")
+		return nil, err
+	}
+	defer rows.Close()
+
+	identities, err := scanIdentities(rows)
+	if err != nil {
+		span.AddEvent("Failed to scan row", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error scanning row")
+		return nil, err
+	}
+	if len(identities) == 0 {
+		span.AddEvent("identity not found")
+		return nil, sql.ErrNoRows
+	}
+
+	span.SetAttributes(
+		attribute.Key("identity_id").String(identities[0].IdentityId),
+		attribute.Key("user_id").String(identities[0].UserId),
+	)
+	span.SetStatus(codes.Ok, "Query executed successfully")
+
+	return identities[0], nil
+}
+
+func (i *identityRepository) GetIdentitiesByUserId(ctx context.Context, userId string) ([]*models.UserIdentity, error) {
+	ctx, span := i.Trace.StartSpan(ctx, "repository.GetIdentitiesByUserId")
+	defer span.End()
+	db := i.DB.Connection()
+
+	query := `SELECT ` + identityColumns + `
+				FROM user_identities
+				WHERE user_id = $1
+				ORDER BY created_at`
+
+	span.SetAttributes(
+		attribute.Key("user_id").String(userId),
+	)
+
+	span.AddEvent("executing SQL query", trace.WithAttributes(
+		attribute.Key("sql.query").String(query),
+	))
+
+	rows, err := db.QueryContext(ctx, query, userId)
+	if err != nil {
+		span.AddEvent("Failed to execute query", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error executing query")
+		return nil, err
+	}
+	defer rows.Close()
+
+	identities, err := scanIdentities(rows)
+	if err != nil {
+		span.AddEvent("Failed to scan row", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error scanning row")
+		return nil, err
+	}
+
+	span.AddEvent("Successfully retrieved identities", trace.WithAttributes(attribute.Key("count").Int(len(identities))))
+	span.SetStatus(codes.Ok, "Query executed successfully")
+
+	return identities, nil
+}
+
+func (i *identityRepository) DeleteIdentity(ctx context.Context, userId, identityId string) error {
+	ctx, span := i.Trace.StartSpan(ctx, "repository.DeleteIdentity")
+	defer span.End()
+	db := i.DB.Connection()
+
+	query := `DELETE FROM user_identities
+				WHERE identity_id = $1 AND user_id = $2`
+
+	span.SetAttributes(
+		attribute.Key("identity_id").String(identityId),
+		attribute.Key("user_id").String(userId),
+	)
+
+	span.AddEvent("executing SQL query", trace.WithAttributes(
+		attribute.Key("sql.query").String(query),
+	))
+
+	result, err := db.ExecContext(ctx, query, identityId, userId)
+	if err != nil {
+		span.AddEvent("Failed to execute query", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error executing query")
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err == nil && rows == 0 {
+		span.AddEvent("identity not found")
+		span.SetStatus(codes.Error, "Identity not found")
+		return sql.ErrNoRows
+	}
+
+	span.AddEvent("Successfully deleted identity", trace.WithAttributes(attribute.Key("identityId").String(identityId)))
+	span.SetStatus(codes.Ok, "Query executed successfully")
+
+	return nil
+}
+
+func (i *identityRepository) TouchIdentity(ctx context.Context, identityId string, loginAt time.Time) error {
+	ctx, span := i.Trace.StartSpan(ctx, "repository.TouchIdentity")
+	defer span.End()
+	db := i.DB.Connection()
+
+	query := `UPDATE user_identities
+				SET last_login_at = $2
+				WHERE identity_id = $1`
+
+	span.SetAttributes(
+		attribute.Key("identity_id").String(identityId),
+	)
+
+	span.AddEvent("executing SQL query", trace.WithAttributes(
+		attribute.Key("sql.query").String(query),
+	))
+
+	_, err := db.ExecContext(ctx, query, identityId, loginAt)
+	if err != nil {
+		span.AddEvent("Failed to execute query", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error executing query")
+		return err
+	}
+
+	span.SetStatus(codes.Ok, "Query executed successfully")
+
+	return nil
+}
+
+func (i *identityRepository) CreateLoginState(ctx context.Context, state *models.OidcLoginState) error {
+	ctx, span := i.Trace.StartSpan(ctx, "repository.CreateLoginState")
+	defer span.End()
+	db := i.DB.Connection()
+
+	query := `INSERT INTO oidc_login_states (state_hash, provider, nonce, code_verifier, link_user_id, browser,
+				expires_at)
+				VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $7)`
+	span.SetAttributes(
+		attribute.Key("provider").String(state.Provider),
+		attribute.Key("link_user_id").String(state.LinkUserId),
+	)
+
+	span.AddEvent("executing SQL query", trace.WithAttributes(
+		attribute.Key("sql.query").String(query),
+	))
+
+	_, err := db.ExecContext(ctx, query, state.StateHash, state.Provider, state.Nonce, state.CodeVerifier,
+		state.LinkUserId, state.Browser, state.ExpiresAt)
+	if err != nil {
+		span.AddEvent("Failed to execute query", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error executing query")
+		return err
+	}
+
+	span.SetStatus(codes.Ok, "Query executed successfully")
+
+	return nil
+}
+
+// ConsumeLoginState deletes and returns an unexpired state, so every state can complete at most one callback
+func (i *identityRepository) ConsumeLoginState(ctx context.Context, stateHash string,
+	now time.Time) (*models.OidcLoginState, error) {
+	ctx, span := i.Trace.StartSpan(ctx, "repository.ConsumeLoginState")
+	defer span.End()
+	db := i.DB.Connection()
+
+	query := `DELETE FROM oidc_login_states
+				WHERE state_hash = $1 AND expires_at > $2
+				RETURNING state_hash, provider, nonce, code_verifier, COALESCE(link_user_id, ''), browser, expires_at`
+
+	span.AddEvent("executing SQL query", trace.WithAttributes(
+		attribute.Key("sql.query").String(query),
+	))
+
+	state := &models.OidcLoginState{}
+	err := db.QueryRowContext(ctx, query, stateHash, now).Scan(&state.StateHash, &state.Provider, &state.Nonce,
+		&state.CodeVerifier, &state.LinkUserId, &state.Browser, &state.ExpiresAt)
+	if err != nil {
+		span.AddEvent("Failed to execute query", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error executing query")
+		return nil, err
+	}
+
+	span.SetAttributes(attribute.Key("provider").String(state.Provider))
+	span.SetStatus(codes.Ok, "Query executed successfully")
+
+	return state, nil
+}
+
+func scanIdentities(rows *sql.Rows) ([]*models.UserIdentity, error) {
+	identities := make([]*models.UserIdentity, 0)
+	for rows.Next() {
+		identity := &models.UserIdentity{}
+		var lastLoginAt sql.NullTime
+		err := rows.Scan(&identity.IdentityId, &identity.UserId, &identity.Provider, &identity.Subject,
+			&identity.Email, &identity.Provisioned, &identity.CreatedAt, &lastLoginAt)
+		if err != nil {
+			return nil, err
+		}
+		if lastLoginAt.Valid {
+			identity.LastLoginAt = &lastLoginAt.Time
+		}
+		identities = append(identities, identity)
+	}
+	return identities, rows.Err()
+}
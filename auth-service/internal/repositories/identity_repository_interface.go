@@ -0,0 +1,17 @@
+package repositories
+
+import (
+	"context"
+	"github.com/saufiroja/go-otel/auth-service/internal/models"
+	"time"
+)
+
+type IdentityRepository interface {
+	CreateIdentity(ctx context.Context, identity *models.UserIdentity) error
+	GetIdentity(ctx context.Context, provider, subject string) (*models.UserIdentity, error)
+	GetIdentitiesByUserId(ctx context.Context, userId string) ([]*models.UserIdentity, error)
+	DeleteIdentity(ctx context.Context, userId, identityId string) error
+	TouchIdentity(ctx context.Context, identityId string, loginAt time.Time) error
+	CreateLoginState(ctx context.Context, state *models.OidcLoginState) error
+	ConsumeLoginState(ctx context.Context, stateHash string, now time.Time) (*models.OidcLoginState, error)
+}
@@ -0,0 +1,237 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"github.com/saufiroja/go-otel/auth-service/internal/models"
+	"github.com/saufiroja/go-otel/auth-service/pkg/databases"
+	"github.com/saufiroja/go-otel/auth-service/pkg/observability/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"strings"
+	"time"
+)
+
+const personalAccessTokenColumns = `token_id, user_id, name, token_hash, scopes, expires_at, last_used_at,
+				revoked_at, created_at`
+
+type personalAccessTokenRepository struct {
+	DB    databases.PostgresManager
+	Trace *tracing.Tracer
+}
+
+func NewPersonalAccessTokenRepository(db databases.PostgresManager, trace *tracing.Tracer) PersonalAccessTokenRepository {
+	return &personalAccessTokenRepository{
+		DB:    db,
+		Trace: trace,
+	}
+}
+
+func (p *personalAccessTokenRepository) CreatePersonalAccessToken(ctx context.Context,
+	token *models.PersonalAccessToken) error {
+	ctx, span := p.Trace.StartSpan(ctx, "repository.CreatePersonalAccessToken")
+	defer span.End()
+	db := p.DB.Connection()
+
+	query := `INSERT INTO personal_access_tokens (token_id, user_id, name, token_hash, scopes, expires_at, created_at)
+				VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	span.SetAttributes(
+		attribute.Key("token_id").String(token.TokenId),
+		attribute.Key("user_id").String(token.UserId),
+		attribute.Key("scopes").StringSlice(token.Scopes),
+		attribute.Key("expires_at").Int64(token.ExpiresAt.Unix()),
+	)
+
+	span.AddEvent("executing SQL query", trace.WithAttributes(
+		attribute.Key("sql.query").String(query),
+	))
+
+	_, err := db.ExecContext(ctx, query, token.TokenId, token.UserId, token.Name, token.TokenHash,
+		strings.Join(token.Scopes, " "), token.ExpiresAt, token.CreatedAt)
+	if err != nil {
+		span.AddEvent("Failed to execute query", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error executing query")
+		return err
+	}
+
+	span.AddEvent("Successfully created personal access token", trace.WithAttributes(attribute.Key("tokenId").String(token.TokenId)))
+	span.SetStatus(codes.Ok, "Query executed successfully")
+
+	return nil
+}
+
+func (p *personalAccessTokenRepository) GetPersonalAccessTokenByHash(ctx context.Context,
+	tokenHash string) (*models.PersonalAccessToken, error) {
+	ctx, span := p.Trace.StartSpan(ctx, "repository.GetPersonalAccessTokenByHash")
+	defer span.End()
+	db := p.DB.Connection()
+
+	query := `SELECT ` + personalAccessTokenColumns + `
+				FROM personal_access_tokens
+				WHERE token_hash = $1`
+
+	span.AddEvent("executing SQL query", trace.WithAttributes(
+		attribute.Key("sql.query").String(query),
+	))
+
+	rows, err := db.QueryContext(ctx, query, tokenHash)
+	if err != nil {
+		span.AddEvent("Failed to execute query", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error executing query")
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens, err := scanPersonalAccessTokens(rows)
+	if err != nil {
+		span.AddEvent("Failed to scan row", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error scanning row")
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		span.AddEvent("personal access token not found")
+		return nil, sql.ErrNoRows
+	}
+
+	span.SetAttributes(
+		attribute.Key("token_id").String(tokens[0].TokenId),
+		attribute.Key("user_id").String(tokens[0].UserId),
+	)
+	span.AddEvent("Successfully retrieved personal access token", trace.WithAttributes(attribute.Key("tokenId").String(tokens[0].TokenId)))
+	span.SetStatus(codes.Ok, "Query executed successfully")
+
+	return tokens[0], nil
+}
+
+func (p *personalAccessTokenRepository) GetPersonalAccessTokensByUserId(ctx context.Context,
+	userId string) ([]*models.PersonalAccessToken, error) {
+	ctx, span := p.Trace.StartSpan(ctx, "repository.GetPersonalAccessTokensByUserId")
+	defer span.End()
+	db := p.DB.Connection()
+
+	query := `SELECT ` + personalAccessTokenColumns + `
+				FROM personal_access_tokens
+				WHERE user_id = $1
+				ORDER BY created_at DESC`
+
+	span.SetAttributes(
+		attribute.Key("user_id").String(userId),
+	)
+
+	span.AddEvent("executing SQL query", trace.WithAttributes(
+		attribute.Key("sql.query").String(query),
+	))
+
+	rows, err := db.QueryContext(ctx, query, userId)
+	if err != nil {
+		span.AddEvent("Failed to execute query", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error executing query")
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens, err := scanPersonalAccessTokens(rows)
+	if err != nil {
+		span.AddEvent("Failed to scan row", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error scanning row")
+		return nil, err
+	}
+
+	span.AddEvent("Successfully retrieved personal access tokens", trace.WithAttributes(attribute.Key("count").Int(len(tokens))))
+	span.SetStatus(codes.Ok, "Query executed successfully")
+
+	return tokens, nil
+}
+
+func (p *personalAccessTokenRepository) RevokePersonalAccessToken(ctx context.Context, userId, tokenId string,
+	revokedAt time.Time) error {
+	ctx, span := p.Trace.StartSpan(ctx, "repository.RevokePersonalAccessToken")
+	defer span.End()
+	db := p.DB.Connection()
+
+	query := `UPDATE personal_access_tokens
+				SET revoked_at = $3
+				WHERE token_id = $1 AND user_id = $2 AND revoked_at IS NULL`
+
+	span.SetAttributes(
+		attribute.Key("token_id").String(tokenId),
+		attribute.Key("user_id").String(userId),
+	)
+
+	span.AddEvent("executing SQL query", trace.WithAttributes(
+		attribute.Key("sql.query").String(query),
+	))
+
+	result, err := db.ExecContext(ctx, query, tokenId, userId, revokedAt)
+	if err != nil {
+		span.AddEvent("Failed to execute query", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error executing query")
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err == nil && rows == 0 {
+		span.AddEvent("personal access token not found or already revoked")
+		span.SetStatus(codes.Error, "Personal access token not found")
+		return sql.ErrNoRows
+	}
+
+	span.AddEvent("Successfully revoked personal access token", trace.WithAttributes(attribute.Key("tokenId").String(tokenId)))
+	span.SetStatus(codes.Ok, "Query executed successfully")
+
+	return nil
+}
+
+func (p *personalAccessTokenRepository) TouchPersonalAccessToken(ctx context.Context, tokenId string,
+	usedAt time.Time) error {
+	ctx, span := p.Trace.StartSpan(ctx, "repository.TouchPersonalAccessToken")
+	defer span.End()
+	db := p.DB.Connection()
+
+	query := `UPDATE personal_access_tokens
+				SET last_used_at = $2
+				WHERE token_id = $1`
+
+	span.SetAttributes(
+		attribute.Key("token_id").String(tokenId),
+	)
+
+	span.AddEvent("executing SQL query", trace.WithAttributes(
+		attribute.Key("sql.query").String(query),
+	))
+
+	_, err := db.ExecContext(ctx, query, tokenId, usedAt)
+	if err != nil {
+		span.AddEvent("Failed to execute query", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error executing query")
+		return err
+	}
+
+	span.SetStatus(codes.Ok, "Query executed successfully")
+
+	return nil
+}
+
+func scanPersonalAccessTokens(rows *sql.Rows) ([]*models.PersonalAccessToken, error) {
+	tokens := make([]*models.PersonalAccessToken, 0)
+	for rows.Next() {
+		token := &models.PersonalAccessToken{}
+		var scopes string
+		var lastUsedAt, revokedAt sql.NullTime
+		err := rows.Scan(&token.TokenId, &token.UserId, &token.Name, &token.TokenHash, &scopes,
+			&token.ExpiresAt, &lastUsedAt, &revokedAt, &token.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		token.Scopes = strings.Fields(scopes)
+		if lastUsedAt.Valid {
+			token.LastUsedAt = &lastUsedAt.Time
+		}
+		if revokedAt.Valid {
+			token.RevokedAt = &revokedAt.Time
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
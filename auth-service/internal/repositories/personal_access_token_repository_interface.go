@@ -0,0 +1,15 @@
+package repositories
+
+import (
+	"context"
+	"github.com/saufiroja/go-otel/auth-service/internal/models"
+	"time"
+)
+
+type PersonalAccessTokenRepository interface {
+	CreatePersonalAccessToken(ctx context.Context, token *models.PersonalAccessToken) error
+	GetPersonalAccessTokenByHash(ctx context.Context, tokenHash string) (*models.PersonalAccessToken, error)
+	GetPersonalAccessTokensByUserId(ctx context.Context, userId string) ([]*models.PersonalAccessToken, error)
+	RevokePersonalAccessToken(ctx context.Context, userId, tokenId string, revokedAt time.Time) error
+	TouchPersonalAccessToken(ctx context.Context, tokenId string, usedAt time.Time) error
+}
@@ -0,0 +1,86 @@
+package repositories
+
+import (
+	"context"
+	"github.com/saufiroja/go-otel/auth-service/internal/models"
+	"github.com/saufiroja/go-otel/auth-service/pkg/databases"
+	"github.com/saufiroja/go-otel/auth-service/pkg/observability/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"time"
+)
+
+type samlRequestRepository struct {
+	DB    databases.PostgresManager
+	Trace *tracing.Tracer
+}
+
+func NewSamlRequestRepository(db databases.PostgresManager, trace *tracing.Tracer) SamlRequestRepository {
+	return &samlRequestRepository{
+		DB:    db,
+		Trace: trace,
+	}
+}
+
+func (s *samlRequestRepository) CreateSamlRequest(ctx context.Context, request *models.SamlRequest) error {
+	ctx, span := s.Trace.StartSpan(ctx, "repository.CreateSamlRequest")
+	defer span.End()
+	db := s.DB.Connection()
+
+	query := `INSERT INTO saml_requests (request_id, link_user_id, browser, expires_at)
+				VALUES ($1, $2, $3, $4)`
+	span.SetAttributes(
+		attribute.Key("request_id").String(request.RequestId),
+		attribute.Key("link_user_id").String(request.LinkUserId),
+	)
+
+	span.AddEvent("executing SQL query", trace.WithAttributes(
+		attribute.Key("sql.query").String(query),
+	))
+
+	_, err := db.ExecContext(ctx, query, request.RequestId, request.LinkUserId, request.Browser,
+		request.ExpiresAt)
+	if err != nil {
+		span.AddEvent("Failed to execute query", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error executing query")
+		return err
+	}
+
+	span.SetStatus(codes.Ok, "Query executed successfully")
+
+	return nil
+}
+
+// ConsumeSamlRequest deletes and returns an unexpired request, so an assertion cannot be replayed against it
+func (s *samlRequestRepository) ConsumeSamlRequest(ctx context.Context, requestId string,
+	now time.Time) (*models.SamlRequest, error) {
+	ctx, span := s.Trace.StartSpan(ctx, "repository.ConsumeSamlRequest")
+	defer span.End()
+	db := s.DB.Connection()
+
+	query := `DELETE FROM saml_requests
+				WHERE request_id = $1 AND expires_at > $2
+				RETURNING request_id, COALESCE(link_user_id, ''), browser, expires_at`
+
+	span.SetAttributes(
+		attribute.Key("request_id").String(requestId),
+	)
+
+	span.AddEvent("executing SQL query", trace.WithAttributes(
+		attribute.Key("sql.query").String(query),
+	))
+
+	request := &models.SamlRequest{}
+	err := db.QueryRowContext(ctx, query, requestId, now).Scan(&request.RequestId, &request.LinkUserId,
+		&request.Browser, &request.ExpiresAt)
+	if err != nil {
+		span.AddEvent("Failed to execute query", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error executing query")
+		return nil, err
+	}
+
+	span.SetStatus(codes.Ok, "Query executed successfully")
+
+	return request, nil
+}
@@ -0,0 +1,12 @@
+package repositories
+
+import (
+	"context"
+	"github.com/saufiroja/go-otel/auth-service/internal/models"
+	"time"
+)
+
+type SamlRequestRepository interface {
+	CreateSamlRequest(ctx context.Context, request *models.SamlRequest) error
+	ConsumeSamlRequest(ctx context.Context, requestId string, now time.Time) (*models.SamlRequest, error)
+}
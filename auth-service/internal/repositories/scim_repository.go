@@ -0,0 +1,648 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/saufiroja/go-otel/auth-service/internal/models"
+	"github.com/saufiroja/go-otel/auth-service/pkg/databases"
+	"github.com/saufiroja/go-otel/auth-service/pkg/observability/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"strings"
+	"time"
+)
+
+// ErrUnsupportedScimFilter is returned when a filter names an attribute or operator that cannot be queried
+var ErrUnsupportedScimFilter = errors.New("unsupported filter")
+
+const scimUserColumns = `u.user_id, u.full_name, u.email, u.password, u.status, u.role, u.created_at, u.updated_at,
+				s.org_id, COALESCE(s.external_id, '')`
+
+const (
+	scimColumnString = iota
+	scimColumnCaseExact
+	scimColumnTimestamp
+)
+
+type scimColumn struct {
+	Name string
+	Kind int
+}
+
+// scimUserAttributes maps the filterable SCIM attributes of a user onto columns, active is handled separately
+var scimUserAttributes = map[string]scimColumn{
+	"id":                {Name: "u.user_id", Kind: scimColumnCaseExact},
+	"username":          {Name: "u.email", Kind: scimColumnString},
+	"emails":            {Name: "u.email", Kind: scimColumnString},
+	"emails.value":      {Name: "u.email", Kind: scimColumnString},
+	"externalid":        {Name: "s.external_id", Kind: scimColumnCaseExact},
+	"displayname":       {Name: "u.full_name", Kind: scimColumnString},
+	"name.formatted":    {Name: "u.full_name", Kind: scimColumnString},
+	"meta.created":      {Name: "u.created_at", Kind: scimColumnTimestamp},
+	"meta.lastmodified": {Name: "u.updated_at", Kind: scimColumnTimestamp},
+}
+
+var scimComparisonSql = map[string]string{
+	"eq": "=", "ne": "IS DISTINCT FROM", "gt": ">", "ge": ">=", "lt": "<", "le": "<=",
+}
+
+type scimRepository struct {
+	DB    databases.PostgresManager
+	Trace *tracing.Tracer
+}
+
+func NewScimRepository(db databases.PostgresManager, trace *tracing.Tracer) ScimRepository {
+	return &scimRepository{
+		DB:    db,
+		Trace: trace,
+	}
+}
+
+func (s *scimRepository) CreateScimUser(ctx context.Context, user *models.ScimUser) error {
+	ctx, span := s.Trace.StartSpan(ctx, "repository.CreateScimUser")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.Key("user_id").String(user.UserId),
+		attribute.Key("org_id").String(user.OrgId),
+	)
+
+	tx, err := s.DB.StartTransaction()
+	if err != nil {
+		span.AddEvent("Failed to start transaction", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error starting transaction")
+		return err
+	}
+
+	userQuery := `INSERT INTO users (user_id, full_name, email, password, status, role, created_at, updated_at)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+
+	span.AddEvent("executing SQL query", trace.WithAttributes(
+		attribute.Key("sql.query").String(userQuery),
+	))
+
+	_, err = tx.ExecContext(ctx, userQuery, user.UserId, user.FullName, user.Email, user.Password, user.Status,
+		user.Role, user.CreatedAt, user.UpdatedAt)
+	if err != nil {
+		_ = s.DB.RollbackTransaction(tx)
+		span.AddEvent("Failed to execute query", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error executing query")
+		return err
+	}
+
+	scimQuery := `INSERT INTO scim_users (user_id, org_id, external_id, created_at) VALUES ($1, $2, $3, $4)`
+
+	span.AddEvent("executing SQL query", trace.WithAttributes(
+		attribute.Key("sql.query").String(scimQuery),
+	))
+
+	_, err = tx.ExecContext(ctx, scimQuery, user.UserId, user.OrgId, nullableString(user.ExternalId), user.CreatedAt)
+	if err != nil {
+		_ = s.DB.RollbackTransaction(tx)
+		span.AddEvent("Failed to execute query", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error executing query")
+		return err
+	}
+
+	if err := s.DB.CommitTransaction(tx); err != nil {
+		span.AddEvent("Failed to commit transaction", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error committing transaction")
+		return err
+	}
+
+	span.AddEvent("Successfully created scim user", trace.WithAttributes(attribute.Key("userId").String(user.UserId)))
+	span.SetStatus(codes.Ok, "Query executed successfully")
+
+	return nil
+}
+
+func (s *scimRepository) GetScimUser(ctx context.Context, orgId, userId string) (*models.ScimUser, error) {
+	ctx, span := s.Trace.StartSpan(ctx, "repository.GetScimUser")
+	defer span.End()
+	db := s.DB.Connection()
+
+	query := `SELECT ` + scimUserColumns + `
+				FROM users u JOIN scim_users s ON s.user_id = u.user_id
+				WHERE s.org_id = $1 AND u.user_id = $2 AND u.status <> $3`
+
+	span.SetAttributes(
+		attribute.Key("org_id").String(orgId),
+		attribute.Key("user_id").String(userId),
+	)
+
+	span.AddEvent("executing SQL query", trace.WithAttributes(
+		attribute.Key("sql.query").String(query),
+	))
+
+	rows, err := db.QueryContext(ctx, query, orgId, userId, models.StatusDeleted)
+	if err != nil {
+		span.AddEvent("Failed to execute query", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error executing query")
+		return nil, err
+	}
+	defer rows.Close()
+
+	users, err := scanScimUsers(rows)
+	if err != nil {
+		span.AddEvent("Failed to scan row", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error scanning row")
+		return nil, err
+	}
+	if len(users) == 0 {
+		span.AddEvent("scim user not found")
+		return nil, sql.ErrNoRows
+	}
+
+	span.AddEvent("Successfully retrieved scim user", trace.WithAttributes(attribute.Key("userId").String(userId)))
+	span.SetStatus(codes.Ok, "Query executed successfully")
+
+	return users[0], nil
+}
+
+// GetScimUsers returns one page of the tenant's users matching the filter and the total number of matches
+func (s *scimRepository) GetScimUsers(ctx context.Context,
+	filter *models.ScimUserFilter) ([]*models.ScimUser, int, error) {
+	ctx, span := s.Trace.StartSpan(ctx, "repository.GetScimUsers")
+	defer span.End()
+	db := s.DB.Connection()
+
+	args := []any{filter.OrgId, models.StatusDeleted}
+	where := `s.org_id = $1 AND u.status <> $2`
+	if filter.Filter != nil {
+		condition, err := scimFilterSql(filter.Filter, &args)
+		if err != nil {
+			span.AddEvent("Unsupported filter", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+			span.SetStatus(codes.Error, "Unsupported filter")
+			return nil, 0, err
+		}
+		where += ` AND ` + condition
+	}
+
+	span.SetAttributes(
+		attribute.Key("org_id").String(filter.OrgId),
+		attribute.Key("start_index").Int(filter.StartIndex),
+		attribute.Key("count").Int(filter.Count),
+	)
+
+	countQuery := `SELECT COUNT(*) FROM users u JOIN scim_users s ON s.user_id = u.user_id WHERE ` + where
+
+	span.AddEvent("executing SQL query", trace.WithAttributes(
+		attribute.Key("sql.query").String(countQuery),
+	))
+
+	total := 0
+	err := db.QueryRowContext(ctx, countQuery, args...).Scan(&total)
+	if err != nil {
+		span.AddEvent("Failed to execute query", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error executing query")
+		return nil, 0, err
+	}
+
+	query := fmt.Sprintf(`SELECT %s
+				FROM users u JOIN scim_users s ON s.user_id = u.user_id
+				WHERE %s
+				ORDER BY u.created_at, u.user_id
+				OFFSET $%d LIMIT $%d`, scimUserColumns, where, len(args)+1, len(args)+2)
+
+	span.AddEvent("executing SQL query", trace.WithAttributes(
+		attribute.Key("sql.query").String(query),
+	))
+
+	rows, err := db.QueryContext(ctx, query, append(args, filter.StartIndex-1, filter.Count)...)
+	if err != nil {
+		span.AddEvent("Failed to execute query", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error executing query")
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	users, err := scanScimUsers(rows)
+	if err != nil {
+		span.AddEvent("Failed to scan row", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error scanning row")
+		return nil, 0, err
+	}
+
+	span.AddEvent("Successfully retrieved scim users", trace.WithAttributes(
+		attribute.Key("count").Int(len(users)),
+		attribute.Key("total").Int(total),
+	))
+	span.SetStatus(codes.Ok, "Query executed successfully")
+
+	return users, total, nil
+}
+
+func (s *scimRepository) GetScimUsersByRole(ctx context.Context, orgId, role string) ([]*models.ScimUser, error) {
+	ctx, span := s.Trace.StartSpan(ctx, "repository.GetScimUsersByRole")
+	defer span.End()
+	db := s.DB.Connection()
+
+	query := `SELECT ` + scimUserColumns + `
+				FROM users u JOIN scim_users s ON s.user_id = u.user_id
+				WHERE s.org_id = $1 AND u.role = $2 AND u.status <> $3
+				ORDER BY u.created_at, u.user_id`
+
+	span.SetAttributes(
+		attribute.Key("org_id").String(orgId),
+		attribute.Key("role").String(role),
+	)
+
+	span.AddEvent("executing SQL query", trace.WithAttributes(
+		attribute.Key("sql.query").String(query),
+	))
+
+	rows, err := db.QueryContext(ctx, query, orgId, role, models.StatusDeleted)
+	if err != nil {
+		span.AddEvent("Failed to execute query", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error executing query")
+		return nil, err
+	}
+	defer rows.Close()
+
+	users, err := scanScimUsers(rows)
+	if err != nil {
+		span.AddEvent("Failed to scan row", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error scanning row")
+		return nil, err
+	}
+
+	span.AddEvent("Successfully retrieved scim users", trace.WithAttributes(attribute.Key("count").Int(len(users))))
+	span.SetStatus(codes.Ok, "Query executed successfully")
+
+	return users, nil
+}
+
+// UpdateScimUser applies the update only while updated_at still equals update.Version, a concurrent change
+// makes it return sql.ErrNoRows
+func (s *scimRepository) UpdateScimUser(ctx context.Context, update *models.ScimUserUpdate) error {
+	ctx, span := s.Trace.StartSpan(ctx, "repository.UpdateScimUser")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.Key("user_id").String(update.UserId),
+		attribute.Key("org_id").String(update.OrgId),
+	)
+
+	tx, err := s.DB.StartTransaction()
+	if err != nil {
+		span.AddEvent("Failed to start transaction", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error starting transaction")
+		return err
+	}
+
+	status := sql.NullString{}
+	if update.StatusChange != nil {
+		status = sql.NullString{String: update.StatusChange.ToStatus, Valid: true}
+	}
+
+	userQuery := `UPDATE users
+				SET full_name = $3, email = $4, status = COALESCE($5, status), updated_at = $6
+				WHERE user_id = $1 AND updated_at = $2
+				AND EXISTS (SELECT 1 FROM scim_users WHERE user_id = $1 AND org_id = $7)`
+
+	span.AddEvent("executing SQL query", trace.WithAttributes(
+		attribute.Key("sql.query").String(userQuery),
+	))
+
+	result, err := tx.ExecContext(ctx, userQuery, update.UserId, update.Version, update.FullName, update.Email,
+		status, update.UpdatedAt, update.OrgId)
+	if err != nil {
+		_ = s.DB.RollbackTransaction(tx)
+		span.AddEvent("Failed to execute query", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error executing query")
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err == nil && rows == 0 {
+		_ = s.DB.RollbackTransaction(tx)
+		span.AddEvent("scim user changed concurrently")
+		span.SetStatus(codes.Error, "Scim user changed concurrently")
+		return sql.ErrNoRows
+	}
+
+	scimQuery := `UPDATE scim_users SET external_id = $2 WHERE user_id = $1`
+
+	span.AddEvent("executing SQL query", trace.WithAttributes(
+		attribute.Key("sql.query").String(scimQuery),
+	))
+
+	_, err = tx.ExecContext(ctx, scimQuery, update.UserId, nullableString(update.ExternalId))
+	if err != nil {
+		_ = s.DB.RollbackTransaction(tx)
+		span.AddEvent("Failed to execute query", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error executing query")
+		return err
+	}
+
+	if change := update.StatusChange; change != nil {
+		err = insertStatusChange(ctx, tx, change)
+		if err != nil {
+			_ = s.DB.RollbackTransaction(tx)
+			span.AddEvent("Failed to record status change", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+			span.SetStatus(codes.Error, "Error recording status change")
+			return err
+		}
+	}
+
+	if err := s.DB.CommitTransaction(tx); err != nil {
+		span.AddEvent("Failed to commit transaction", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error committing transaction")
+		return err
+	}
+
+	span.AddEvent("Successfully updated scim user", trace.WithAttributes(attribute.Key("userId").String(update.UserId)))
+	span.SetStatus(codes.Ok, "Query executed successfully")
+
+	return nil
+}
+
+// UpdateScimUserRoles applies every role change or none, a user outside the org makes it return sql.ErrNoRows
+func (s *scimRepository) UpdateScimUserRoles(ctx context.Context, orgId string,
+	changes []*models.ScimRoleChange) error {
+	ctx, span := s.Trace.StartSpan(ctx, "repository.UpdateScimUserRoles")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.Key("org_id").String(orgId),
+		attribute.Key("changes").Int(len(changes)),
+	)
+
+	tx, err := s.DB.StartTransaction()
+	if err != nil {
+		span.AddEvent("Failed to start transaction", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error starting transaction")
+		return err
+	}
+
+	query := `UPDATE users
+				SET role = $2, updated_at = $3
+				WHERE user_id = $1 AND status <> $5
+				AND EXISTS (SELECT 1 FROM scim_users WHERE user_id = $1 AND org_id = $4)`
+
+	span.AddEvent("executing SQL query", trace.WithAttributes(
+		attribute.Key("sql.query").String(query),
+	))
+
+	for _, change := range changes {
+		result, err := tx.ExecContext(ctx, query, change.UserId, change.Role, change.UpdatedAt, orgId,
+			models.StatusDeleted)
+		if err != nil {
+			_ = s.DB.RollbackTransaction(tx)
+			span.AddEvent("Failed to execute query", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+			span.SetStatus(codes.Error, "Error executing query")
+			return err
+		}
+
+		rows, err := result.RowsAffected()
+		if err == nil && rows == 0 {
+			_ = s.DB.RollbackTransaction(tx)
+			span.AddEvent("scim user not found", trace.WithAttributes(attribute.Key("userId").String(change.UserId)))
+			span.SetStatus(codes.Error, "Scim user not found")
+			return sql.ErrNoRows
+		}
+	}
+
+	if err := s.DB.CommitTransaction(tx); err != nil {
+		span.AddEvent("Failed to commit transaction", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error committing transaction")
+		return err
+	}
+
+	span.AddEvent("Successfully updated scim user roles")
+	span.SetStatus(codes.Ok, "Query executed successfully")
+
+	return nil
+}
+
+// DeleteScimUser deprovisions the user the way an erasure does, so the email may be provisioned again
+func (s *scimRepository) DeleteScimUser(ctx context.Context, user *models.ScimUser, changedBy string,
+	now time.Time) error {
+	ctx, span := s.Trace.StartSpan(ctx, "repository.DeleteScimUser")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.Key("user_id").String(user.UserId),
+		attribute.Key("org_id").String(user.OrgId),
+	)
+
+	tx, err := s.DB.StartTransaction()
+	if err != nil {
+		span.AddEvent("Failed to start transaction", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error starting transaction")
+		return err
+	}
+
+	anonymiseQuery := `UPDATE users
+				SET full_name = $3, email = $4, password = '', status = $5, updated_at = $6
+				WHERE user_id = $1 AND updated_at = $2`
+
+	span.AddEvent("executing SQL query", trace.WithAttributes(
+		attribute.Key("sql.query").String(anonymiseQuery),
+	))
+
+	result, err := tx.ExecContext(ctx, anonymiseQuery, user.UserId, user.UpdatedAt, "Deleted User",
+		fmt.Sprintf("deleted+%s@invalid", user.UserId), models.StatusDeleted, now)
+	if err != nil {
+		_ = s.DB.RollbackTransaction(tx)
+		span.AddEvent("Failed to execute query", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error executing query")
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err == nil && rows == 0 {
+		_ = s.DB.RollbackTransaction(tx)
+		span.AddEvent("scim user changed concurrently")
+		span.SetStatus(codes.Error, "Scim user changed concurrently")
+		return sql.ErrNoRows
+	}
+
+	for _, query := range erasureDeleteQueries {
+		_, err := tx.ExecContext(ctx, query, user.UserId)
+		if err != nil {
+			_ = s.DB.RollbackTransaction(tx)
+			span.AddEvent("Failed to delete personal data", trace.WithAttributes(
+				attribute.Key("sql.query").String(query),
+				attribute.Key("error").String(err.Error()),
+			))
+			span.SetStatus(codes.Error, "Error deleting personal data")
+			return err
+		}
+	}
+
+	err = insertStatusChange(ctx, tx, &models.StatusChange{
+		ChangeId:   uuid.New().String(),
+		UserId:     user.UserId,
+		FromStatus: user.Status,
+		ToStatus:   models.StatusDeleted,
+		ChangedBy:  changedBy,
+		Reason:     "deprovisioned through scim",
+		ChangedAt:  now,
+	})
+	if err != nil {
+		_ = s.DB.RollbackTransaction(tx)
+		span.AddEvent("Failed to record status change", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error recording status change")
+		return err
+	}
+
+	if err := s.DB.CommitTransaction(tx); err != nil {
+		span.AddEvent("Failed to commit transaction", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error committing transaction")
+		return err
+	}
+
+	span.AddEvent("Successfully deleted scim user", trace.WithAttributes(attribute.Key("userId").String(user.UserId)))
+	span.SetStatus(codes.Ok, "Query executed successfully")
+
+	return nil
+}
+
+func insertStatusChange(ctx context.Context, tx *sql.Tx, change *models.StatusChange) error {
+	_, err := tx.ExecContext(ctx, `INSERT INTO user_status_changes
+				(change_id, user_id, from_status, to_status, changed_by, reason, changed_at)
+				VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		change.ChangeId, change.UserId, change.FromStatus, change.ToStatus, change.ChangedBy, change.Reason,
+		change.ChangedAt)
+	return err
+}
+
+// scimFilterSql translates a parsed filter into a parameterized condition, appending its values to args
+func scimFilterSql(filter *models.ScimFilter, args *[]any) (string, error) {
+	switch filter.Op {
+	case models.ScimFilterAnd, models.ScimFilterOr:
+		left, err := scimFilterSql(filter.Children[0], args)
+		if err != nil {
+			return "", err
+		}
+		right, err := scimFilterSql(filter.Children[1], args)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("(%s %s %s)", left, strings.ToUpper(filter.Op), right), nil
+	case models.ScimFilterNot:
+		inner, err := scimFilterSql(filter.Children[0], args)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("(NOT COALESCE(%s, FALSE))", inner), nil
+	}
+
+	if filter.Attribute == "active" {
+		return scimActiveSql(filter, args)
+	}
+
+	column, ok := scimUserAttributes[filter.Attribute]
+	if !ok {
+		return "", fmt.Errorf("%w: attribute %s", ErrUnsupportedScimFilter, filter.Attribute)
+	}
+
+	if filter.Op == "pr" {
+		if column.Kind == scimColumnTimestamp {
+			return fmt.Sprintf("(%s IS NOT NULL)", column.Name), nil
+		}
+		return fmt.Sprintf("(%s IS NOT NULL AND %s <> '')", column.Name, column.Name), nil
+	}
+
+	if filter.Value == nil {
+		switch filter.Op {
+		case "eq":
+			return fmt.Sprintf("(%s IS NULL)", column.Name), nil
+		case "ne":
+			return fmt.Sprintf("(%s IS NOT NULL)", column.Name), nil
+		}
+		return "", fmt.Errorf("%w: null only supports eq and ne", ErrUnsupportedScimFilter)
+	}
+
+	value, ok := filter.Value.(string)
+	if !ok {
+		return "", fmt.Errorf("%w: %s expects a string", ErrUnsupportedScimFilter, filter.Attribute)
+	}
+
+	if column.Kind == scimColumnTimestamp {
+		operator, ok := scimComparisonSql[filter.Op]
+		if !ok {
+			return "", fmt.Errorf("%w: %s on %s", ErrUnsupportedScimFilter, filter.Op, filter.Attribute)
+		}
+		timestamp, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return "", fmt.Errorf("%w: %s expects a date time", ErrUnsupportedScimFilter, filter.Attribute)
+		}
+		*args = append(*args, timestamp.UTC())
+		return fmt.Sprintf("(%s %s $%d)", column.Name, operator, len(*args)), nil
+	}
+
+	name := column.Name
+	placeholder := "$%d"
+	like := "LIKE"
+	if column.Kind == scimColumnString {
+		name = "LOWER(" + name + ")"
+		placeholder = "LOWER($%d)"
+		like = "ILIKE"
+	}
+
+	switch filter.Op {
+	case "co", "sw", "ew":
+		pattern := escapeLike(value)
+		switch filter.Op {
+		case "co":
+			pattern = "%" + pattern + "%"
+		case "sw":
+			pattern = pattern + "%"
+		case "ew":
+			pattern = "%" + pattern
+		}
+		*args = append(*args, pattern)
+		return fmt.Sprintf("(%s %s $%d)", column.Name, like, len(*args)), nil
+	default:
+		*args = append(*args, value)
+		return fmt.Sprintf("(%s %s "+placeholder+")", name, scimComparisonSql[filter.Op], len(*args)), nil
+	}
+}
+
+// scimActiveSql maps the boolean active attribute onto the account status
+func scimActiveSql(filter *models.ScimFilter, args *[]any) (string, error) {
+	if filter.Op == "pr" {
+		return "TRUE", nil
+	}
+	active, ok := filter.Value.(bool)
+	if !ok || (filter.Op != "eq" && filter.Op != "ne") {
+		return "", fmt.Errorf("%w: active only supports eq and ne with a boolean", ErrUnsupportedScimFilter)
+	}
+	if filter.Op == "ne" {
+		active = !active
+	}
+	*args = append(*args, models.StatusActive)
+	if active {
+		return fmt.Sprintf("(u.status = $%d)", len(*args)), nil
+	}
+	return fmt.Sprintf("(u.status <> $%d)", len(*args)), nil
+}
+
+// escapeLike escapes the LIKE wildcards of a user supplied value, backslash is the default escape character
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
+
+func nullableString(value string) sql.NullString {
+	return sql.NullString{String: value, Valid: value != ""}
+}
+
+func scanScimUsers(rows *sql.Rows) ([]*models.ScimUser, error) {
+	users := make([]*models.ScimUser, 0)
+	for rows.Next() {
+		user := &models.ScimUser{}
+		err := rows.Scan(&user.UserId, &user.FullName, &user.Email, &user.Password, &user.Status, &user.Role,
+			&user.CreatedAt, &user.UpdatedAt, &user.OrgId, &user.ExternalId)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
@@ -0,0 +1,17 @@
+package repositories
+
+import (
+	"context"
+	"github.com/saufiroja/go-otel/auth-service/internal/models"
+	"time"
+)
+
+type ScimRepository interface {
+	CreateScimUser(ctx context.Context, user *models.ScimUser) error
+	GetScimUser(ctx context.Context, orgId, userId string) (*models.ScimUser, error)
+	GetScimUsers(ctx context.Context, filter *models.ScimUserFilter) ([]*models.ScimUser, int, error)
+	GetScimUsersByRole(ctx context.Context, orgId, role string) ([]*models.ScimUser, error)
+	UpdateScimUser(ctx context.Context, update *models.ScimUserUpdate) error
+	UpdateScimUserRoles(ctx context.Context, orgId string, changes []*models.ScimRoleChange) error
+	DeleteScimUser(ctx context.Context, user *models.ScimUser, changedBy string, now time.Time) error
+}
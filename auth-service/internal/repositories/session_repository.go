@@ -0,0 +1,265 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"github.com/saufiroja/go-otel/auth-service/internal/models"
+	"github.com/saufiroja/go-otel/auth-service/pkg/databases"
+	"github.com/saufiroja/go-otel/auth-service/pkg/observability/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"time"
+)
+
+const sessionColumns = `session_id, user_id, refresh_token_id, device_name, user_agent, ip, created_at,
+				last_used_at, revoked_at`
+
+type sessionRepository struct {
+	DB    databases.PostgresManager
+	Trace *tracing.Tracer
+}
+
+func NewSessionRepository(db databases.PostgresManager, trace *tracing.Tracer) SessionRepository {
+	return &sessionRepository{
+		DB:    db,
+		Trace: trace,
+	}
+}
+
+func (s *sessionRepository) CreateSession(ctx context.Context, session *models.Session) error {
+	ctx, span := s.Trace.StartSpan(ctx, "repository.CreateSession")
+	defer span.End()
+	db := s.DB.Connection()
+
+	query := `INSERT INTO sessions (` + sessionColumns + `)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULL)`
+	span.SetAttributes(
+		attribute.Key("session_id").String(session.SessionId),
+		attribute.Key("user_id").String(session.UserId),
+		attribute.Key("created_at").Int64(session.CreatedAt.Unix()),
+	)
+
+	span.AddEvent("executing SQL query", trace.WithAttributes(
+		attribute.Key("sql.query").String(query),
+	))
+
+	_, err := db.ExecContext(ctx, query, session.SessionId, session.UserId, session.RefreshTokenId,
+		session.DeviceName, session.UserAgent, session.Ip, session.CreatedAt, session.LastUsedAt)
+	if err != nil {
+		span.AddEvent("Failed to execute query", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error executing query")
+		return err
+	}
+
+	span.AddEvent("Successfully created session", trace.WithAttributes(attribute.Key("sessionId").String(session.SessionId)))
+	span.SetStatus(codes.Ok, "Query executed successfully")
+
+	return nil
+}
+
+func (s *sessionRepository) GetSessionById(ctx context.Context, sessionId string) (*models.Session, error) {
+	ctx, span := s.Trace.StartSpan(ctx, "repository.GetSessionById")
+	defer span.End()
+	db := s.DB.Connection()
+
+	query := `SELECT ` + sessionColumns + `
+				FROM sessions
+				WHERE session_id = $1`
+
+	rows, err := db.QueryContext(ctx, query, sessionId)
+
+	span.SetAttributes(
+		attribute.Key("session_id").String(sessionId),
+	)
+
+	span.AddEvent("executing SQL query", trace.WithAttributes(
+		attribute.Key("sql.query").String(query),
+	))
+
+	if err != nil {
+		span.AddEvent("Failed to execute query", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error executing query")
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions, err := scanSessions(rows)
+	if err != nil {
+		span.AddEvent("Failed to scan row", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error scanning row")
+		return nil, err
+	}
+	if len(sessions) == 0 {
+		span.AddEvent("session not found")
+		return nil, sql.ErrNoRows
+	}
+
+	span.AddEvent("Successfully retrieved session", trace.WithAttributes(attribute.Key("sessionId").String(sessionId)))
+	span.SetStatus(codes.Ok, "Query executed successfully")
+
+	return sessions[0], nil
+}
+
+func (s *sessionRepository) GetSessionsByUserId(ctx context.Context, userId string) ([]*models.Session, error) {
+	ctx, span := s.Trace.StartSpan(ctx, "repository.GetSessionsByUserId")
+	defer span.End()
+	db := s.DB.Connection()
+
+	query := `SELECT ` + sessionColumns + `
+				FROM sessions
+				WHERE user_id = $1
+				ORDER BY last_used_at DESC`
+
+	span.SetAttributes(
+		attribute.Key("user_id").String(userId),
+	)
+
+	span.AddEvent("executing SQL query", trace.WithAttributes(
+		attribute.Key("sql.query").String(query),
+	))
+
+	rows, err := db.QueryContext(ctx, query, userId)
+	if err != nil {
+		span.AddEvent("Failed to execute query", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error executing query")
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions, err := scanSessions(rows)
+	if err != nil {
+		span.AddEvent("Failed to scan row", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error scanning row")
+		return nil, err
+	}
+
+	span.AddEvent("Successfully retrieved sessions", trace.WithAttributes(attribute.Key("count").Int(len(sessions))))
+	span.SetStatus(codes.Ok, "Query executed successfully")
+
+	return sessions, nil
+}
+
+// RotateSession moves the session to a new refresh token id, it fails if previousTokenId is no longer
+// current so a refresh token can only be redeemed once
+func (s *sessionRepository) RotateSession(ctx context.Context, session *models.Session, previousTokenId string) error {
+	ctx, span := s.Trace.StartSpan(ctx, "repository.RotateSession")
+	defer span.End()
+	db := s.DB.Connection()
+
+	query := `UPDATE sessions
+				SET refresh_token_id = $3, user_agent = $4, ip = $5, last_used_at = $6
+				WHERE session_id = $1 AND refresh_token_id = $2 AND revoked_at IS NULL`
+
+	span.SetAttributes(
+		attribute.Key("session_id").String(session.SessionId),
+		attribute.Key("last_used_at").Int64(session.LastUsedAt.Unix()),
+	)
+
+	span.AddEvent("executing SQL query", trace.WithAttributes(
+		attribute.Key("sql.query").String(query),
+	))
+
+	result, err := db.ExecContext(ctx, query, session.SessionId, previousTokenId, session.RefreshTokenId,
+		session.UserAgent, session.Ip, session.LastUsedAt)
+	if err != nil {
+		span.AddEvent("Failed to execute query", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error executing query")
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err == nil && rows == 0 {
+		span.AddEvent("refresh token already rotated or session revoked")
+		span.SetStatus(codes.Error, "Session not rotated")
+		return sql.ErrNoRows
+	}
+
+	span.AddEvent("Successfully rotated session", trace.WithAttributes(attribute.Key("sessionId").String(session.SessionId)))
+	span.SetStatus(codes.Ok, "Query executed successfully")
+
+	return nil
+}
+
+func (s *sessionRepository) RevokeSession(ctx context.Context, userId, sessionId string, revokedAt time.Time) error {
+	ctx, span := s.Trace.StartSpan(ctx, "repository.RevokeSession")
+	defer span.End()
+	db := s.DB.Connection()
+
+	query := `UPDATE sessions
+				SET revoked_at = $3
+				WHERE session_id = $1 AND user_id = $2 AND revoked_at IS NULL`
+
+	span.SetAttributes(
+		attribute.Key("session_id").String(sessionId),
+		attribute.Key("user_id").String(userId),
+	)
+
+	span.AddEvent("executing SQL query", trace.WithAttributes(
+		attribute.Key("sql.query").String(query),
+	))
+
+	result, err := db.ExecContext(ctx, query, sessionId, userId, revokedAt)
+	if err != nil {
+		span.AddEvent("Failed to execute query", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error executing query")
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err == nil && rows == 0 {
+		span.AddEvent("session not found or already revoked")
+		span.SetStatus(codes.Error, "Session not found")
+		return sql.ErrNoRows
+	}
+
+	span.AddEvent("Successfully revoked session", trace.WithAttributes(attribute.Key("sessionId").String(sessionId)))
+	span.SetStatus(codes.Ok, "Query executed successfully")
+
+	return nil
+}
+
+// CountActiveSessions counts the sessions not revoked and used since usedSince
+func (s *sessionRepository) CountActiveSessions(ctx context.Context, usedSince time.Time) (int64, error) {
+	ctx, span := s.Trace.StartSpan(ctx, "repository.CountActiveSessions")
+	defer span.End()
+	db := s.DB.Connection()
+
+	query := `SELECT COUNT(*)
+				FROM sessions
+				WHERE revoked_at IS NULL AND last_used_at >= $1`
+
+	span.AddEvent("executing SQL query", trace.WithAttributes(
+		attribute.Key("sql.query").String(query),
+	))
+
+	var count int64
+	err := db.QueryRowContext(ctx, query, usedSince).Scan(&count)
+	if err != nil {
+		span.AddEvent("Failed to execute query", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error executing query")
+		return 0, err
+	}
+
+	span.SetStatus(codes.Ok, "Query executed successfully")
+
+	return count, nil
+}
+
+func scanSessions(rows *sql.Rows) ([]*models.Session, error) {
+	sessions := make([]*models.Session, 0)
+	for rows.Next() {
+		session := &models.Session{}
+		var revokedAt sql.NullTime
+		err := rows.Scan(&session.SessionId, &session.UserId, &session.RefreshTokenId, &session.DeviceName,
+			&session.UserAgent, &session.Ip, &session.CreatedAt, &session.LastUsedAt, &revokedAt)
+		if err != nil {
+			return nil, err
+		}
+		if revokedAt.Valid {
+			session.RevokedAt = &revokedAt.Time
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
@@ -0,0 +1,16 @@
+package repositories
+
+import (
+	"context"
+	"github.com/saufiroja/go-otel/auth-service/internal/models"
+	"time"
+)
+
+type SessionRepository interface {
+	CreateSession(ctx context.Context, session *models.Session) error
+	GetSessionById(ctx context.Context, sessionId string) (*models.Session, error)
+	GetSessionsByUserId(ctx context.Context, userId string) ([]*models.Session, error)
+	RotateSession(ctx context.Context, session *models.Session, previousTokenId string) error
+	RevokeSession(ctx context.Context, userId, sessionId string, revokedAt time.Time) error
+	CountActiveSessions(ctx context.Context, usedSince time.Time) (int64, error)
+}
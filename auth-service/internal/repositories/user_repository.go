@@ -2,12 +2,14 @@ package repositories
 
 import (
 	"context"
+	"database/sql"
 	"github.com/saufiroja/go-otel/auth-service/internal/models"
 	"github.com/saufiroja/go-otel/auth-service/pkg/databases"
 	"github.com/saufiroja/go-otel/auth-service/pkg/observability/tracing"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
+	"time"
 )
 
 type userRepository struct {
@@ -27,12 +29,14 @@ func (u *userRepository) CreateUser(ctx context.Context, user *models.User) erro
 	defer span.End()
 	db := u.DB.Connection()
 
-	query := `INSERT INTO users (user_id, full_name, email, password, created_at, updated_at) 
-				VALUES ($1, $2, $3, $4, $5, $6)`
+	query := `INSERT INTO users (user_id, full_name, email, password, status, role, created_at, updated_at) 
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
 	span.SetAttributes(
 		attribute.Key("user_id").String(user.UserId),
 		attribute.Key("full_name").String(user.FullName),
 		attribute.Key("email").String(user.Email),
+		attribute.Key("status").String(user.Status),
+		attribute.Key("role").String(user.Role),
 		attribute.Key("created_at").Int64(user.CreatedAt.Unix()),
 		attribute.Key("updated_at").Int64(user.UpdatedAt.Unix()),
 	)
@@ -42,7 +46,7 @@ func (u *userRepository) CreateUser(ctx context.Context, user *models.User) erro
 	))
 
 	_, err := db.ExecContext(ctx, query,
-		user.UserId, user.FullName, user.Email, user.Password, user.CreatedAt, user.UpdatedAt)
+		user.UserId, user.FullName, user.Email, user.Password, user.Status, user.Role, user.CreatedAt, user.UpdatedAt)
 	if err != nil {
 		span.AddEvent("Failed to execute query", trace.WithAttributes(attribute.Key("error").String(err.Error())))
 		span.SetStatus(codes.Error, "Error executing query")
@@ -60,7 +64,7 @@ func (u *userRepository) GetUserByEmail(ctx context.Context, email string) (*mod
 	defer span.End()
 	db := u.DB.Connection()
 
-	query := `SELECT user_id, full_name, email, password, created_at, updated_at
+	query := `SELECT user_id, full_name, email, password, status, role, created_at, updated_at
 				FROM users
 				WHERE email = $1`
 
@@ -75,7 +79,8 @@ func (u *userRepository) GetUserByEmail(ctx context.Context, email string) (*mod
 	))
 
 	user := &models.User{}
-	err := row.Scan(&user.UserId, &user.FullName, &user.Email, &user.Password, &user.CreatedAt, &user.UpdatedAt)
+	err := row.Scan(&user.UserId, &user.FullName, &user.Email, &user.Password, &user.Status, &user.Role,
+		&user.CreatedAt, &user.UpdatedAt)
 	if err != nil {
 		span.AddEvent("user not found", trace.WithAttributes(attribute.Key("error").String(err.Error())))
 		return nil, err
@@ -86,3 +91,235 @@ func (u *userRepository) GetUserByEmail(ctx context.Context, email string) (*mod
 
 	return user, nil
 }
+
+func (u *userRepository) GetUserById(ctx context.Context, userId string) (*models.User, error) {
+	ctx, span := u.Trace.StartSpan(ctx, "repository.GetUserById")
+	defer span.End()
+	db := u.DB.Connection()
+
+	query := `SELECT user_id, full_name, email, password, status, role, created_at, updated_at
+				FROM users
+				WHERE user_id = $1`
+
+	row := db.QueryRowContext(ctx, query, userId)
+
+	span.SetAttributes(
+		attribute.Key("user_id").String(userId),
+	)
+
+	span.AddEvent("executing SQL query", trace.WithAttributes(
+		attribute.Key("sql.query").String(query),
+	))
+
+	user := &models.User{}
+	err := row.Scan(&user.UserId, &user.FullName, &user.Email, &user.Password, &user.Status, &user.Role,
+		&user.CreatedAt, &user.UpdatedAt)
+	if err != nil {
+		span.AddEvent("user not found", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		return nil, err
+	}
+
+	span.AddEvent("Successfully retrieved user data", trace.WithAttributes(attribute.Key("userId").String(user.UserId)))
+	span.SetStatus(codes.Ok, "Query executed successfully")
+
+	return user, nil
+}
+
+func (u *userRepository) UpdateUser(ctx context.Context, user *models.User) error {
+	ctx, span := u.Trace.StartSpan(ctx, "repository.UpdateUser")
+	defer span.End()
+	db := u.DB.Connection()
+
+	query := `UPDATE users
+				SET full_name = $2, email = $3, password = $4, updated_at = $5
+				WHERE user_id = $1`
+
+	span.SetAttributes(
+		attribute.Key("user_id").String(user.UserId),
+		attribute.Key("full_name").String(user.FullName),
+		attribute.Key("email").String(user.Email),
+		attribute.Key("updated_at").Int64(user.UpdatedAt.Unix()),
+	)
+
+	span.AddEvent("executing SQL query", trace.WithAttributes(
+		attribute.Key("sql.query").String(query),
+	))
+
+	result, err := db.ExecContext(ctx, query,
+		user.UserId, user.FullName, user.Email, user.Password, user.UpdatedAt)
+	if err != nil {
+		span.AddEvent("Failed to execute query", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error executing query")
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err == nil && rows == 0 {
+		span.AddEvent("user not found", trace.WithAttributes(attribute.Key("userId").String(user.UserId)))
+		span.SetStatus(codes.Error, "User not found")
+		return sql.ErrNoRows
+	}
+
+	span.AddEvent("Successfully updated user", trace.WithAttributes(attribute.Key("userId").String(user.UserId)))
+	span.SetStatus(codes.Ok, "Query executed successfully")
+
+	return nil
+}
+
+func (u *userRepository) UpdateUserRole(ctx context.Context, userId, role string, updatedAt time.Time) error {
+	ctx, span := u.Trace.StartSpan(ctx, "repository.UpdateUserRole")
+	defer span.End()
+	db := u.DB.Connection()
+
+	query := `UPDATE users
+				SET role = $2, updated_at = $3
+				WHERE user_id = $1`
+
+	span.SetAttributes(
+		attribute.Key("user_id").String(userId),
+		attribute.Key("role").String(role),
+	)
+
+	span.AddEvent("executing SQL query", trace.WithAttributes(
+		attribute.Key("sql.query").String(query),
+	))
+
+	result, err := db.ExecContext(ctx, query, userId, role, updatedAt)
+	if err != nil {
+		span.AddEvent("Failed to execute query", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error executing query")
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err == nil && rows == 0 {
+		span.AddEvent("user not found", trace.WithAttributes(attribute.Key("userId").String(userId)))
+		span.SetStatus(codes.Error, "User not found")
+		return sql.ErrNoRows
+	}
+
+	span.AddEvent("Successfully updated user role", trace.WithAttributes(attribute.Key("userId").String(userId)))
+	span.SetStatus(codes.Ok, "Query executed successfully")
+
+	return nil
+}
+
+func (u *userRepository) ChangeUserStatus(ctx context.Context, change *models.StatusChange) error {
+	ctx, span := u.Trace.StartSpan(ctx, "repository.ChangeUserStatus")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.Key("user_id").String(change.UserId),
+		attribute.Key("from_status").String(change.FromStatus),
+		attribute.Key("to_status").String(change.ToStatus),
+		attribute.Key("changed_by").String(change.ChangedBy),
+	)
+
+	tx, err := u.DB.StartTransaction()
+	if err != nil {
+		span.AddEvent("Failed to start transaction", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error starting transaction")
+		return err
+	}
+
+	// the status guard makes concurrent changes from the same starting status fail instead of overwriting
+	updateQuery := `UPDATE users
+				SET status = $3, updated_at = $4
+				WHERE user_id = $1 AND status = $2`
+
+	span.AddEvent("executing SQL query", trace.WithAttributes(
+		attribute.Key("sql.query").String(updateQuery),
+	))
+
+	result, err := tx.ExecContext(ctx, updateQuery, change.UserId, change.FromStatus, change.ToStatus, change.ChangedAt)
+	if err != nil {
+		_ = u.DB.RollbackTransaction(tx)
+		span.AddEvent("Failed to execute query", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error executing query")
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err == nil && rows == 0 {
+		_ = u.DB.RollbackTransaction(tx)
+		span.AddEvent("user status changed concurrently")
+		span.SetStatus(codes.Error, "User status changed concurrently")
+		return sql.ErrNoRows
+	}
+
+	insertQuery := `INSERT INTO user_status_changes (change_id, user_id, from_status, to_status, changed_by, reason, changed_at)
+				VALUES ($1, $2, $3, $4, $5, $6, $7)`
+
+	span.AddEvent("executing SQL query", trace.WithAttributes(
+		attribute.Key("sql.query").String(insertQuery),
+	))
+
+	_, err = tx.ExecContext(ctx, insertQuery, change.ChangeId, change.UserId, change.FromStatus, change.ToStatus,
+		change.ChangedBy, change.Reason, change.ChangedAt)
+	if err != nil {
+		_ = u.DB.RollbackTransaction(tx)
+		span.AddEvent("Failed to execute query", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error executing query")
+		return err
+	}
+
+	if err := u.DB.CommitTransaction(tx); err != nil {
+		span.AddEvent("Failed to commit transaction", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error committing transaction")
+		return err
+	}
+
+	span.AddEvent("Successfully changed user status", trace.WithAttributes(attribute.Key("userId").String(change.UserId)))
+	span.SetStatus(codes.Ok, "Query executed successfully")
+
+	return nil
+}
+
+func (u *userRepository) GetStatusChanges(ctx context.Context, userId string) ([]*models.StatusChange, error) {
+	ctx, span := u.Trace.StartSpan(ctx, "repository.GetStatusChanges")
+	defer span.End()
+	db := u.DB.Connection()
+
+	query := `SELECT change_id, user_id, from_status, to_status, changed_by, reason, changed_at
+				FROM user_status_changes
+				WHERE user_id = $1
+				ORDER BY changed_at`
+
+	span.SetAttributes(
+		attribute.Key("user_id").String(userId),
+	)
+
+	span.AddEvent("executing SQL query", trace.WithAttributes(
+		attribute.Key("sql.query").String(query),
+	))
+
+	rows, err := db.QueryContext(ctx, query, userId)
+	if err != nil {
+		span.AddEvent("Failed to execute query", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.SetStatus(codes.Error, "Error executing query")
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := make([]*models.StatusChange, 0)
+	for rows.Next() {
+		change := &models.StatusChange{}
+		err := rows.Scan(&change.ChangeId, &change.UserId, &change.FromStatus, &change.ToStatus,
+			&change.ChangedBy, &change.Reason, &change.ChangedAt)
+		if err != nil {
+			span.AddEvent("Failed to scan row", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+			span.SetStatus(codes.Error, "Error scanning row")
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+	if err := rows.Err(); err != nil {
+		span.SetStatus(codes.Error, "Error iterating rows")
+		return nil, err
+	}
+
+	span.AddEvent("Successfully retrieved status changes", trace.WithAttributes(attribute.Key("count").Int(len(changes))))
+	span.SetStatus(codes.Ok, "Query executed successfully")
+
+	return changes, nil
+}
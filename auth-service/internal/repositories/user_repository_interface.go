@@ -3,9 +3,15 @@ package repositories
 import (
 	"context"
 	"github.com/saufiroja/go-otel/auth-service/internal/models"
+	"time"
 )
 
 type UserRepository interface {
 	CreateUser(ctx context.Context, user *models.User) error
 	GetUserByEmail(ctx context.Context, email string) (*models.User, error)
+	GetUserById(ctx context.Context, userId string) (*models.User, error)
+	UpdateUser(ctx context.Context, user *models.User) error
+	UpdateUserRole(ctx context.Context, userId, role string, updatedAt time.Time) error
+	ChangeUserStatus(ctx context.Context, change *models.StatusChange) error
+	GetStatusChanges(ctx context.Context, userId string) ([]*models.StatusChange, error)
 }
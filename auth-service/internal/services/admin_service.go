@@ -0,0 +1,271 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/saufiroja/go-otel/auth-service/internal/contracts/requests"
+	"github.com/saufiroja/go-otel/auth-service/internal/models"
+	"github.com/saufiroja/go-otel/auth-service/internal/repositories"
+	"github.com/saufiroja/go-otel/auth-service/internal/utils"
+	"github.com/saufiroja/go-otel/auth-service/pkg/logging"
+	"github.com/saufiroja/go-otel/auth-service/pkg/observability/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"strings"
+	"time"
+)
+
+type adminService struct {
+	UserRepository repositories.UserRepository
+	Logger         logging.Logger
+	GenerateToken  *utils.GenerateToken
+	Trace          *tracing.Tracer
+	AuditService   AuditService
+}
+
+func NewAdminService(userRepository repositories.UserRepository, logger logging.Logger,
+	generateToken *utils.GenerateToken, trace *tracing.Tracer, auditService AuditService) AdminService {
+	return &adminService{
+		UserRepository: userRepository,
+		Logger:         logger,
+		GenerateToken:  generateToken,
+		Trace:          trace,
+		AuditService:   auditService,
+	}
+}
+
+func (a *adminService) ChangeUserStatus(ctx context.Context, actorId, userId string,
+	request *requests.ChangeStatusRequest) error {
+	ctx, span := a.Trace.StartSpan(ctx, "service.ChangeUserStatus")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.Key("actor_id").String(actorId),
+		attribute.Key("user_id").String(userId),
+		attribute.Key("to_status").String(request.Status),
+	)
+
+	reason := strings.TrimSpace(request.Reason)
+	if reason == "" {
+		span.AddEvent("Empty reason")
+		span.SetStatus(codes.Error, "Reason is required")
+		return errors.New("reason is required")
+	}
+
+	if !models.IsValidStatus(request.Status) {
+		span.AddEvent("Unknown status")
+		span.SetStatus(codes.Error, "Unknown status")
+		return errors.New("unknown status")
+	}
+
+	user, err := a.UserRepository.GetUserById(ctx, userId)
+	if err != nil {
+		span.AddEvent("Failed to get user by id")
+		span.SetStatus(codes.Error, "Error getting user by id")
+		a.Logger.LogErrorContext(ctx, "Error getting user by id", logging.Err(err))
+		return errors.New("user not found")
+	}
+
+	span.SetAttributes(attribute.Key("from_status").String(user.Status))
+
+	if !models.CanTransitionStatus(user.Status, request.Status) {
+		span.AddEvent("Status transition not allowed")
+		span.SetStatus(codes.Error, "Status transition not allowed")
+		return fmt.Errorf("cannot change status from %s to %s", user.Status, request.Status)
+	}
+
+	change := &models.StatusChange{
+		ChangeId:   uuid.New().String(),
+		UserId:     user.UserId,
+		FromStatus: user.Status,
+		ToStatus:   request.Status,
+		ChangedBy:  actorId,
+		Reason:     reason,
+		ChangedAt:  time.Now().UTC(),
+	}
+
+	err = a.UserRepository.ChangeUserStatus(ctx, change)
+	if err != nil {
+		span.AddEvent("Failed to change user status")
+		span.SetStatus(codes.Error, "Error changing user status")
+		a.Logger.LogErrorContext(ctx, "Error changing user status", logging.Err(err))
+		return errors.New("error changing user status")
+	}
+
+	a.AuditService.Record(ctx, models.AuditAdminStatusChange, actorId, user.UserId, map[string]string{
+		"from_status": change.FromStatus,
+		"to_status":   change.ToStatus,
+		"reason":      reason,
+	})
+
+	a.Logger.LogInfoContext(ctx, "User status changed", logging.String("user_id", user.UserId),
+		logging.String("from_status", change.FromStatus), logging.String("to_status", change.ToStatus),
+		logging.String("actor_id", actorId))
+
+	span.AddEvent("User status changed successfully")
+	span.SetStatus(codes.Ok, "User status changed successfully")
+
+	return nil
+}
+
+func (a *adminService) GetStatusChanges(ctx context.Context, userId string) ([]*models.StatusChange, error) {
+	ctx, span := a.Trace.StartSpan(ctx, "service.GetStatusChanges")
+	defer span.End()
+
+	span.SetAttributes(attribute.Key("user_id").String(userId))
+
+	changes, err := a.UserRepository.GetStatusChanges(ctx, userId)
+	if err != nil {
+		span.AddEvent("Failed to get status changes")
+		span.SetStatus(codes.Error, "Error getting status changes")
+		a.Logger.LogErrorContext(ctx, "Error getting status changes", logging.Err(err))
+		return nil, errors.New("error getting status changes")
+	}
+
+	span.SetStatus(codes.Ok, "Status changes retrieved")
+
+	return changes, nil
+}
+
+// Impersonate issues a token that authenticates as userId on behalf of actor, the actor must be signed in
+// interactively and privileged accounts cannot be impersonated
+func (a *adminService) Impersonate(ctx context.Context, actor *models.Principal, userId string,
+	request *requests.ImpersonateRequest) (*models.Impersonation, error) {
+	ctx, span := a.Trace.StartSpan(ctx, "service.Impersonate")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.Key("actor_id").String(actor.UserId),
+		attribute.Key("user_id").String(userId),
+	)
+
+	reason := strings.TrimSpace(request.Reason)
+	if reason == "" {
+		span.AddEvent("Empty reason")
+		span.SetStatus(codes.Error, "Reason is required")
+		return nil, errors.New("reason is required")
+	}
+
+	if actor.AuthMethod != models.AuthMethodSession || !actor.HasPermission(models.PermissionImpersonate) {
+		span.AddEvent("Actor may not impersonate")
+		span.SetStatus(codes.Error, "Forbidden")
+		return nil, errors.New("forbidden")
+	}
+
+	if actor.UserId == userId {
+		span.AddEvent("Self impersonation")
+		span.SetStatus(codes.Error, "Cannot impersonate yourself")
+		return nil, errors.New("cannot impersonate yourself")
+	}
+
+	user, err := a.UserRepository.GetUserById(ctx, userId)
+	if err != nil {
+		span.AddEvent("Failed to get user by id")
+		span.SetStatus(codes.Error, "Error getting user by id")
+		a.Logger.LogErrorContext(ctx, "Error getting user by id", logging.Err(err))
+		return nil, errors.New("user not found")
+	}
+
+	if models.IsPrivilegedRole(user.Role) {
+		span.AddEvent("Privileged target")
+		span.SetStatus(codes.Error, "Cannot impersonate privileged users")
+		return nil, errors.New("privileged users cannot be impersonated")
+	}
+
+	if user.Status != models.StatusActive {
+		span.SetAttributes(attribute.Key("status").String(user.Status))
+		span.AddEvent("Target not active")
+		span.SetStatus(codes.Error, "User is not active")
+		return nil, errors.New("user is not active")
+	}
+
+	impersonationId := uuid.New().String()
+	token, expiresAt, err := a.GenerateToken.GenerateImpersonationToken(ctx, &requests.GenerateTokenRequest{
+		UserId:    user.UserId,
+		FullName:  user.FullName,
+		SessionId: actor.SessionId,
+		TokenId:   impersonationId,
+		Actor:     &models.Actor{Subject: actor.UserId},
+		// a sender-constrained staff session yields an impersonation token bound to the same key
+		Confirmation: utils.RequestMetaFromContext(ctx).Confirmation(),
+	})
+	if err != nil {
+		span.AddEvent("Failed to generate impersonation token")
+		span.SetStatus(codes.Error, "Error generating impersonation token")
+		a.Logger.LogErrorContext(ctx, "Error generating impersonation token", logging.Err(err))
+		return nil, errors.New("error generating impersonation token")
+	}
+
+	a.AuditService.Record(ctx, models.AuditAdminImpersonate, actor.UserId, user.UserId, map[string]string{
+		"impersonation_id": impersonationId,
+		"session_id":       actor.SessionId,
+		"reason":           reason,
+		"expires_at":       time.Unix(expiresAt, 0).UTC().Format(time.RFC3339),
+	})
+
+	a.Logger.LogInfoContext(ctx, "User impersonated", logging.String("user_id", user.UserId),
+		logging.String("actor_id", actor.UserId), logging.String("reason", reason))
+
+	span.SetAttributes(attribute.Key("impersonation_id").String(impersonationId))
+	span.AddEvent("Impersonation token issued")
+	span.SetStatus(codes.Ok, "Impersonation token issued")
+
+	return &models.Impersonation{
+		ImpersonationId: impersonationId,
+		ActorId:         actor.UserId,
+		UserId:          user.UserId,
+		Reason:          reason,
+		AccessToken:     token,
+		ExpiresAt:       expiresAt,
+	}, nil
+}
+
+func (a *adminService) GetLogLevel(ctx context.Context) *models.LogLevel {
+	_, span := a.Trace.StartSpan(ctx, "service.GetLogLevel")
+	defer span.End()
+
+	level := a.Logger.Level().String()
+	span.SetAttributes(attribute.Key("log_level").String(level))
+	span.SetStatus(codes.Ok, "Log level retrieved successfully")
+
+	return &models.LogLevel{Level: level}
+}
+
+// ChangeLogLevel changes the level until the next change or restart, the configured level applies again after one
+func (a *adminService) ChangeLogLevel(ctx context.Context, actorId string,
+	request *requests.ChangeLogLevelRequest) (*models.LogLevel, error) {
+	ctx, span := a.Trace.StartSpan(ctx, "service.ChangeLogLevel")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.Key("actor_id").String(actorId),
+		attribute.Key("to_level").String(request.Level),
+	)
+
+	level, err := logging.ParseLevel(request.Level)
+	if err != nil {
+		span.AddEvent("Unknown log level")
+		span.SetStatus(codes.Error, "Unknown log level")
+		return nil, errors.New("unknown log level")
+	}
+
+	previous := a.Logger.Level()
+	span.SetAttributes(attribute.Key("from_level").String(previous.String()))
+	a.Logger.SetLevel(level)
+
+	a.AuditService.Record(ctx, models.AuditAdminLogLevelChange, actorId, "", map[string]string{
+		"from_level": previous.String(),
+		"to_level":   level.String(),
+	})
+
+	// logged at warn so the change shows up whatever the new level is
+	a.Logger.LogWarnContext(ctx, "Log level changed", logging.String("from_level", previous.String()),
+		logging.String("to_level", level.String()), logging.String("actor_id", actorId))
+
+	span.AddEvent("Log level changed")
+	span.SetStatus(codes.Ok, "Log level changed successfully")
+
+	return &models.LogLevel{Level: level.String()}, nil
+}
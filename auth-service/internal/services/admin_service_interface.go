@@ -0,0 +1,16 @@
+package services
+
+import (
+	"context"
+	"github.com/saufiroja/go-otel/auth-service/internal/contracts/requests"
+	"github.com/saufiroja/go-otel/auth-service/internal/models"
+)
+
+type AdminService interface {
+	ChangeUserStatus(ctx context.Context, actorId, userId string, request *requests.ChangeStatusRequest) error
+	GetStatusChanges(ctx context.Context, userId string) ([]*models.StatusChange, error)
+	Impersonate(ctx context.Context, actor *models.Principal, userId string,
+		request *requests.ImpersonateRequest) (*models.Impersonation, error)
+	GetLogLevel(ctx context.Context) *models.LogLevel
+	ChangeLogLevel(ctx context.Context, actorId string, request *requests.ChangeLogLevelRequest) (*models.LogLevel, error)
+}
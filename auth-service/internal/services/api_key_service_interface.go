@@ -0,0 +1,22 @@
+package services
+
+import (
+	"context"
+	"github.com/saufiroja/go-otel/auth-service/internal/contracts/requests"
+	"github.com/saufiroja/go-otel/auth-service/internal/models"
+)
+
+type ApiKeyService interface {
+	CreateServiceAccount(ctx context.Context, actorId string,
+		request *requests.CreateServiceAccountRequest) (*models.ServiceAccount, error)
+	CreateApiKey(ctx context.Context, actorId, serviceAccountId string,
+		request *requests.CreateApiKeyRequest) (*models.ApiKey, string, error)
+	ListApiKeys(ctx context.Context, serviceAccountId string) ([]*models.ApiKey, error)
+	RotateApiKey(ctx context.Context, actorId, keyId string) (*models.ApiKey, string, error)
+	RevokeApiKey(ctx context.Context, actorId, keyId string) error
+	VerifyApiKey(ctx context.Context, key string) (*models.Principal, error)
+	CreateClientCertificate(ctx context.Context, actorId, serviceAccountId string,
+		request *requests.CreateClientCertificateRequest) (*models.ClientCertificate, error)
+	RevokeClientCertificate(ctx context.Context, actorId, certificateId string) error
+	VerifyClientCertificate(ctx context.Context, serviceAccountId string) (*models.Principal, error)
+}
@@ -0,0 +1,88 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"github.com/saufiroja/go-otel/auth-service/config"
+	"github.com/saufiroja/go-otel/auth-service/internal/models"
+	"github.com/saufiroja/go-otel/auth-service/internal/repositories"
+	"github.com/saufiroja/go-otel/auth-service/internal/utils"
+	"github.com/saufiroja/go-otel/auth-service/pkg/logging"
+	"testing"
+	"time"
+)
+
+// fakeApiKeyRepository serves client certificates and service accounts from memory, other methods are not used
+type fakeApiKeyRepository struct {
+	repositories.ApiKeyRepository
+	certificates map[string]*models.ClientCertificate
+	accounts     map[string]*models.ServiceAccount
+}
+
+func (f *fakeApiKeyRepository) GetClientCertificateBySubject(_ context.Context,
+	subjectDn string) (*models.ClientCertificate, error) {
+	certificate, ok := f.certificates[subjectDn]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return certificate, nil
+}
+
+func (f *fakeApiKeyRepository) GetServiceAccountById(_ context.Context,
+	serviceAccountId string) (*models.ServiceAccount, error) {
+	account, ok := f.accounts[serviceAccountId]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return account, nil
+}
+
+func TestVerifyClientCertificate(t *testing.T) {
+	revokedAt := time.Now().Add(-time.Hour)
+	repository := &fakeApiKeyRepository{
+		certificates: map[string]*models.ClientCertificate{
+			"CN=svc-1,O=Test": {CertificateId: "cert-1", ServiceAccountId: "svc-1", SubjectDn: "CN=svc-1,O=Test",
+				Scopes: []string{"read"}},
+			"CN=svc-2,O=Test": {CertificateId: "cert-2", ServiceAccountId: "svc-2", SubjectDn: "CN=svc-2,O=Test"},
+			"CN=revoked,O=Test": {CertificateId: "cert-3", ServiceAccountId: "svc-1", SubjectDn: "CN=revoked,O=Test",
+				RevokedAt: &revokedAt},
+		},
+		accounts: map[string]*models.ServiceAccount{
+			"svc-1": {ServiceAccountId: "svc-1", OrgId: "org-1"},
+			"svc-2": {ServiceAccountId: "svc-2", OrgId: "org-2"},
+		},
+	}
+	service := NewApiKeyService(repository, logging.NewLogrusAdapter(), newTestTracer(), nil, &config.AppConfig{})
+
+	tests := []struct {
+		name     string
+		subject  string
+		clientId string
+		wantErr  bool
+	}{
+		{name: "registered certificate", subject: "CN=svc-1,O=Test", clientId: "svc-1"},
+		{name: "no certificate", clientId: "svc-1", wantErr: true},
+		{name: "certificate of another client", subject: "CN=svc-2,O=Test", clientId: "svc-1", wantErr: true},
+		{name: "unregistered certificate", subject: "CN=unknown,O=Test", clientId: "svc-1", wantErr: true},
+		{name: "revoked certificate", subject: "CN=revoked,O=Test", clientId: "svc-1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.WithValue(context.Background(), utils.RequestMetaKey,
+				utils.RequestMeta{ClientCertSubject: tt.subject})
+
+			principal, err := service.VerifyClientCertificate(ctx, tt.clientId)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("VerifyClientCertificate() error = %v, wantErr %t", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if principal.UserId != tt.clientId || principal.AuthMethod != models.AuthMethodTlsClient ||
+				principal.OrgId != "org-1" || len(principal.Scopes) != 1 {
+				t.Errorf("principal = %+v", principal)
+			}
+		})
+	}
+}
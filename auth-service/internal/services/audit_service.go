@@ -0,0 +1,223 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/saufiroja/go-otel/auth-service/config"
+	"github.com/saufiroja/go-otel/auth-service/internal/models"
+	"github.com/saufiroja/go-otel/auth-service/internal/repositories"
+	"github.com/saufiroja/go-otel/auth-service/internal/utils"
+	"github.com/saufiroja/go-otel/auth-service/pkg/logging"
+	"github.com/saufiroja/go-otel/auth-service/pkg/observability/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"time"
+)
+
+const (
+	auditDefaultLimit = 100
+	auditMaxLimit     = 1000
+	auditVerifyBatch  = 1000
+)
+
+type auditService struct {
+	AuditRepository repositories.AuditRepository
+	Logger          logging.Logger
+	Trace           *tracing.Tracer
+	HashKey         []byte
+}
+
+func NewAuditService(auditRepository repositories.AuditRepository, logger logging.Logger,
+	trace *tracing.Tracer, conf *config.AppConfig) AuditService {
+	return &auditService{
+		AuditRepository: auditRepository,
+		Logger:          logger,
+		Trace:           trace,
+		HashKey:         []byte(conf.Audit.HashKey),
+	}
+}
+
+// Record appends an audit event, failures are logged rather than failing the audited operation
+func (a *auditService) Record(ctx context.Context, eventType, actorId, targetId string, metadata map[string]string) {
+	ctx, span := a.Trace.StartSpan(ctx, "service.RecordAuditEvent")
+	defer span.End()
+
+	meta := utils.RequestMetaFromContext(ctx)
+	// whatever is done while impersonating is attributed to the staff member as well
+	if meta.ActorId != "" {
+		impersonated := make(map[string]string, len(metadata)+1)
+		for key, value := range metadata {
+			impersonated[key] = value
+		}
+		impersonated["impersonator_id"] = meta.ActorId
+		metadata = impersonated
+	}
+	traceId := ""
+	if sc := trace.SpanContextFromContext(ctx); sc.HasTraceID() {
+		traceId = sc.TraceID().String()
+	}
+	salt, err := utils.GenerateRandomToken(16)
+	if err != nil {
+		span.SetStatus(codes.Error, "Error generating details salt")
+		a.Logger.LogErrorContext(ctx, "Error generating audit details salt", logging.String("event_type", eventType),
+			logging.Err(err))
+		return
+	}
+
+	event := &models.AuditEvent{
+		EventId:     uuid.New().String(),
+		EventType:   eventType,
+		ActorId:     actorId,
+		TargetId:    targetId,
+		Ip:          meta.Ip,
+		UserAgent:   meta.UserAgent,
+		TraceId:     traceId,
+		Metadata:    metadata,
+		CreatedAt:   time.Now().UTC(),
+		DetailsSalt: salt,
+	}
+
+	span.SetAttributes(attribute.Key("event_type").String(eventType))
+
+	err = a.AuditRepository.AppendAuditEvent(ctx, event)
+	if err != nil {
+		span.AddEvent("Failed to append audit event")
+		span.SetStatus(codes.Error, "Error appending audit event")
+		a.Logger.LogErrorContext(ctx, "Error appending audit event", logging.String("event_type", eventType),
+			logging.Err(err))
+		return
+	}
+
+	span.SetStatus(codes.Ok, "Audit event recorded")
+}
+
+func (a *auditService) ListEvents(ctx context.Context, filter *models.AuditFilter) ([]*models.AuditEvent, error) {
+	ctx, span := a.Trace.StartSpan(ctx, "service.ListAuditEvents")
+	defer span.End()
+
+	if filter.Limit <= 0 {
+		filter.Limit = auditDefaultLimit
+	}
+	if filter.Limit > auditMaxLimit {
+		filter.Limit = auditMaxLimit
+	}
+
+	events, err := a.AuditRepository.ListAuditEvents(ctx, filter)
+	if err != nil {
+		span.AddEvent("Failed to list audit events")
+		span.SetStatus(codes.Error, "Error listing audit events")
+		a.Logger.LogErrorContext(ctx, "Error listing audit events", logging.Err(err))
+		return nil, errors.New("error listing audit events")
+	}
+
+	span.SetStatus(codes.Ok, "Audit events listed")
+
+	return events, nil
+}
+
+// VerifyChain walks the whole log and reports rows whose hash, link or sequence does not match, and a chain that
+// ends before its recorded head
+func (a *auditService) VerifyChain(ctx context.Context) (*models.AuditVerification, error) {
+	ctx, span := a.Trace.StartSpan(ctx, "service.VerifyAuditChain")
+	defer span.End()
+
+	result := &models.AuditVerification{Violations: make([]*models.AuditViolation, 0)}
+	prevSequence := int64(0)
+	prevHash := models.AuditGenesisHash
+
+	for {
+		events, err := a.AuditRepository.ListAuditEvents(ctx, &models.AuditFilter{
+			AfterSequence: prevSequence,
+			Limit:         auditVerifyBatch,
+		})
+		if err != nil {
+			span.AddEvent("Failed to list audit events")
+			span.SetStatus(codes.Error, "Error listing audit events")
+			return nil, err
+		}
+
+		for _, event := range events {
+			result.Checked++
+			if event.Sequence != prevSequence+1 {
+				result.Violations = append(result.Violations, &models.AuditViolation{
+					Sequence: event.Sequence,
+					EventId:  event.EventId,
+					Reason:   fmt.Sprintf("sequence gap after %d", prevSequence),
+				})
+			}
+			if event.PrevHash != prevHash {
+				result.Violations = append(result.Violations, &models.AuditViolation{
+					Sequence: event.Sequence,
+					EventId:  event.EventId,
+					Reason:   "prev_hash does not match the previous row",
+				})
+			}
+			if event.ComputeHash(a.HashKey) != event.Hash {
+				result.Violations = append(result.Violations, &models.AuditViolation{
+					Sequence: event.Sequence,
+					EventId:  event.EventId,
+					Reason:   "hash does not match row contents",
+				})
+			}
+			// erased details cannot be checked, the details hash they leave behind is still covered by the chain
+			if !event.DetailsErased && event.ComputeDetailsHash(a.HashKey) != event.DetailsHash {
+				result.Violations = append(result.Violations, &models.AuditViolation{
+					Sequence: event.Sequence,
+					EventId:  event.EventId,
+					Reason:   "details do not match the details hash",
+				})
+			}
+			prevSequence = event.Sequence
+			prevHash = event.Hash
+		}
+
+		if len(events) < auditVerifyBatch {
+			break
+		}
+	}
+
+	head, err := a.AuditRepository.GetAuditChainHead(ctx)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		if result.Checked > 0 {
+			result.Violations = append(result.Violations, &models.AuditViolation{
+				Sequence: prevSequence,
+				Reason:   "chain head is missing",
+			})
+		}
+	case err != nil:
+		span.AddEvent("Failed to read chain head")
+		span.SetStatus(codes.Error, "Error reading chain head")
+		return nil, err
+	case head.ComputeMac(a.HashKey) != head.Mac:
+		result.Violations = append(result.Violations, &models.AuditViolation{
+			Sequence: head.Sequence,
+			Reason:   "chain head mac does not match",
+		})
+	case head.Sequence != prevSequence || head.Hash != prevHash:
+		result.Violations = append(result.Violations, &models.AuditViolation{
+			Sequence: head.Sequence,
+			Reason:   fmt.Sprintf("chain ends at %d but its head is %d", prevSequence, head.Sequence),
+		})
+	default:
+		result.Head = head
+	}
+
+	result.Valid = len(result.Violations) == 0
+
+	span.SetAttributes(
+		attribute.Key("audit.checked").Int64(result.Checked),
+		attribute.Key("audit.violations").Int(len(result.Violations)),
+	)
+	if !result.Valid {
+		span.SetStatus(codes.Error, "Audit chain verification failed")
+		return result, nil
+	}
+	span.SetStatus(codes.Ok, "Audit chain verified")
+
+	return result, nil
+}
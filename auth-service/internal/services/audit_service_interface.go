@@ -0,0 +1,12 @@
+package services
+
+import (
+	"context"
+	"github.com/saufiroja/go-otel/auth-service/internal/models"
+)
+
+type AuditService interface {
+	Record(ctx context.Context, eventType, actorId, targetId string, metadata map[string]string)
+	ListEvents(ctx context.Context, filter *models.AuditFilter) ([]*models.AuditEvent, error)
+	VerifyChain(ctx context.Context) (*models.AuditVerification, error)
+}
@@ -0,0 +1,491 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/saufiroja/go-otel/auth-service/config"
+	"github.com/saufiroja/go-otel/auth-service/internal/contracts/requests"
+	"github.com/saufiroja/go-otel/auth-service/internal/models"
+	"github.com/saufiroja/go-otel/auth-service/internal/repositories"
+	"github.com/saufiroja/go-otel/auth-service/internal/utils"
+	"github.com/saufiroja/go-otel/auth-service/pkg/logging"
+	"github.com/saufiroja/go-otel/auth-service/pkg/observability/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"slices"
+	"strings"
+	"time"
+)
+
+// deviceSlowDownStep is how much the poll interval grows each time a device polls too fast, RFC 8628 section 3.5
+const deviceSlowDownStep = 5
+
+// deviceAuthMethod is the session method of tokens issued to devices
+const deviceAuthMethod = "device"
+
+type oauthService struct {
+	DeviceCodeRepository repositories.DeviceCodeRepository
+	UserRepository       repositories.UserRepository
+	UserService          UserService
+	ApiKeyService        ApiKeyService
+	GenerateToken        *utils.GenerateToken
+	Logger               logging.Logger
+	Trace                *tracing.Tracer
+	AuditService         AuditService
+	Conf                 *config.AppConfig
+}
+
+func NewOAuthService(deviceCodeRepository repositories.DeviceCodeRepository,
+	userRepository repositories.UserRepository, userService UserService, apiKeyService ApiKeyService,
+	generateToken *utils.GenerateToken, logger logging.Logger, trace *tracing.Tracer, auditService AuditService,
+	conf *config.AppConfig) OAuthService {
+	return &oauthService{
+		DeviceCodeRepository: deviceCodeRepository,
+		UserRepository:       userRepository,
+		UserService:          userService,
+		ApiKeyService:        apiKeyService,
+		GenerateToken:        generateToken,
+		Logger:               logger,
+		Trace:                trace,
+		AuditService:         auditService,
+		Conf:                 conf,
+	}
+}
+
+// ExchangeToken implements RFC 8693, the subject token is swapped for a token that is only valid for one audience
+// with at most the subject's scopes, an actor_token adds the caller to the act chain of the issued token
+func (o *oauthService) ExchangeToken(ctx context.Context,
+	request *requests.OAuthTokenRequest) (*models.ExchangedToken, error) {
+	ctx, span := o.Trace.StartSpan(ctx, "service.ExchangeToken")
+	defer span.End()
+
+	if request.SubjectToken == "" || !isAccessTokenType(request.SubjectTokenType) {
+		span.AddEvent("Invalid subject token type")
+		span.SetStatus(codes.Error, "Invalid request")
+		return nil, models.NewOAuthError(models.OAuthErrorInvalidRequest,
+			"subject_token and an access_token or jwt subject_token_type are required")
+	}
+
+	if request.RequestedTokenType != "" && !isAccessTokenType(request.RequestedTokenType) {
+		span.AddEvent("Unsupported requested token type")
+		span.SetStatus(codes.Error, "Invalid request")
+		return nil, models.NewOAuthError(models.OAuthErrorInvalidRequest, "unsupported requested_token_type")
+	}
+
+	// resource is accepted as the audience since gateways often name downstream services by url
+	audience := request.Audience
+	if audience == "" {
+		audience = request.Resource
+	}
+	span.SetAttributes(attribute.Key("audience").String(audience))
+
+	if !slices.Contains(o.Conf.TokenExchange.Audiences, audience) {
+		span.AddEvent("Audience not allowed")
+		span.SetStatus(codes.Error, "Invalid target")
+		return nil, models.NewOAuthError(models.OAuthErrorInvalidTarget, "audience is not allowed")
+	}
+
+	subject, claims, err := o.UserService.VerifySubjectToken(ctx, request.SubjectToken)
+	if err != nil {
+		span.AddEvent("Invalid subject token")
+		span.SetStatus(codes.Error, "Invalid grant")
+		return nil, models.NewOAuthError(models.OAuthErrorInvalidGrant, "subject_token is invalid")
+	}
+
+	span.SetAttributes(attribute.Key("user_id").String(subject.UserId))
+
+	scopes, err := exchangeScopes(subject, strings.Fields(request.Scope))
+	if err != nil {
+		span.AddEvent("Scope not allowed")
+		span.SetStatus(codes.Error, "Invalid scope")
+		return nil, err
+	}
+
+	actor := claims.Actor
+	actorPrincipal, err := o.authenticateActor(ctx, request)
+	if err != nil {
+		span.AddEvent("Invalid actor")
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	if actorPrincipal != nil {
+		actor = &models.Actor{Subject: actorPrincipal.UserId, Actor: claims.Actor}
+		span.SetAttributes(attribute.Key("actor_id").String(actorPrincipal.UserId))
+	}
+
+	if actor != nil && len(actor.Subjects()) > models.MaxActorDepth {
+		span.AddEvent("Act chain too long")
+		span.SetStatus(codes.Error, "Invalid grant")
+		return nil, models.NewOAuthError(models.OAuthErrorInvalidGrant, "act chain is too long")
+	}
+
+	tokenId := uuid.New().String()
+	token, expiresAt, err := o.GenerateToken.GenerateExchangedToken(ctx, &requests.GenerateTokenRequest{
+		UserId:    subject.UserId,
+		FullName:  claims.FullName,
+		SessionId: subject.SessionId,
+		TokenId:   tokenId,
+		Actor:     actor,
+		Audience:  audience,
+		Scopes:    scopes,
+		NotAfter:  claims.ExpiresAt,
+		// the exchanged token is bound to the key of the client that exchanged it
+		Confirmation: utils.RequestMetaFromContext(ctx).Confirmation(),
+	})
+	if err != nil {
+		span.AddEvent("Failed to generate exchanged token")
+		span.SetStatus(codes.Error, "Error generating exchanged token")
+		o.Logger.LogErrorContext(ctx, "Error generating exchanged token", logging.Err(err))
+		return nil, models.NewOAuthError(models.OAuthErrorServerError, "error generating token")
+	}
+
+	actorId := subject.UserId
+	if actor != nil {
+		actorId = actor.Subject
+	}
+	o.AuditService.Record(ctx, models.AuditTokenExchange, actorId, subject.UserId, map[string]string{
+		"token_id":   tokenId,
+		"session_id": subject.SessionId,
+		"audience":   audience,
+		"scope":      strings.Join(scopes, " "),
+		"act":        strings.Join(actorSubjects(actor), " "),
+		"expires_at": time.Unix(expiresAt, 0).UTC().Format(time.RFC3339),
+	})
+
+	span.SetAttributes(attribute.Key("token_id").String(tokenId))
+	span.SetStatus(codes.Ok, "Token exchanged")
+
+	tokenType := models.TokenTypeBearer
+	if utils.RequestMetaFromContext(ctx).DpopJkt != "" {
+		tokenType = models.TokenTypeDpop
+	}
+
+	return &models.ExchangedToken{
+		AccessToken:     token,
+		TokenType:       tokenType,
+		IssuedTokenType: models.TokenTypeAccessToken,
+		Audience:        audience,
+		Scopes:          scopes,
+		ExpiresAt:       expiresAt,
+	}, nil
+}
+
+// AuthorizeDevice starts the device flow, the device shows UserCode to the user and polls with DeviceCode
+func (o *oauthService) AuthorizeDevice(ctx context.Context,
+	request *requests.DeviceAuthorizationRequest) (*models.DeviceAuthorization, error) {
+	ctx, span := o.Trace.StartSpan(ctx, "service.AuthorizeDevice")
+	defer span.End()
+
+	clientId := strings.TrimSpace(request.ClientId)
+	if clientId == "" {
+		span.AddEvent("Missing client id")
+		span.SetStatus(codes.Error, "Invalid request")
+		return nil, models.NewOAuthError(models.OAuthErrorInvalidRequest, "client_id is required")
+	}
+
+	span.SetAttributes(attribute.Key("client_id").String(clientId))
+
+	deviceCode, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		span.AddEvent("Failed to generate device code")
+		span.SetStatus(codes.Error, "Error generating device code")
+		o.Logger.LogErrorContext(ctx, "Error generating device code", logging.Err(err))
+		return nil, models.NewOAuthError(models.OAuthErrorServerError, "error generating device code")
+	}
+
+	userCode, err := utils.GenerateUserCode()
+	if err != nil {
+		span.AddEvent("Failed to generate user code")
+		span.SetStatus(codes.Error, "Error generating user code")
+		o.Logger.LogErrorContext(ctx, "Error generating user code", logging.Err(err))
+		return nil, models.NewOAuthError(models.OAuthErrorServerError, "error generating user code")
+	}
+
+	now := time.Now().UTC()
+	code := &models.DeviceCode{
+		DeviceCodeHash: utils.HashToken(deviceCode),
+		UserCode:       userCode,
+		ClientId:       clientId,
+		Status:         models.DeviceCodeStatusPending,
+		Interval:       int(o.Conf.DeviceAuthorization.PollInterval.Seconds()),
+		ExpiresAt:      now.Add(o.Conf.DeviceAuthorization.CodeTTL),
+		CreatedAt:      now,
+	}
+
+	err = o.DeviceCodeRepository.CreateDeviceCode(ctx, code)
+	if err != nil {
+		span.AddEvent("Failed to create device code")
+		span.SetStatus(codes.Error, "Error creating device code")
+		o.Logger.LogErrorContext(ctx, "Error creating device code", logging.Err(err))
+		return nil, models.NewOAuthError(models.OAuthErrorServerError, "error creating device code")
+	}
+
+	span.SetStatus(codes.Ok, "Device code issued")
+
+	return &models.DeviceAuthorization{
+		DeviceCode:      deviceCode,
+		UserCode:        userCode,
+		VerificationUri: o.Conf.DeviceAuthorization.VerificationUri,
+		Interval:        code.Interval,
+		ExpiresAt:       code.ExpiresAt,
+	}, nil
+}
+
+// PollDeviceCode answers a device's poll, it issues the token pair once the user approved the code and otherwise
+// returns authorization_pending, slow_down, access_denied or expired_token as in RFC 8628 section 3.5
+func (o *oauthService) PollDeviceCode(ctx context.Context, request *requests.OAuthTokenRequest) (*models.Token, error) {
+	ctx, span := o.Trace.StartSpan(ctx, "service.PollDeviceCode")
+	defer span.End()
+
+	if request.DeviceCode == "" {
+		span.AddEvent("Missing device code")
+		span.SetStatus(codes.Error, "Invalid request")
+		return nil, models.NewOAuthError(models.OAuthErrorInvalidRequest, "device_code is required")
+	}
+
+	deviceCodeHash := utils.HashToken(request.DeviceCode)
+	code, err := o.DeviceCodeRepository.GetDeviceCodeByHash(ctx, deviceCodeHash)
+	if err != nil || code.ClientId != request.ClientId {
+		span.AddEvent("Device code not found")
+		span.SetStatus(codes.Error, "Invalid grant")
+		return nil, models.NewOAuthError(models.OAuthErrorInvalidGrant, "device_code is invalid")
+	}
+
+	span.SetAttributes(
+		attribute.Key("client_id").String(code.ClientId),
+		attribute.Key("status").String(code.Status),
+	)
+
+	now := time.Now().UTC()
+	if !now.Before(code.ExpiresAt) {
+		_ = o.DeviceCodeRepository.DeleteDeviceCode(ctx, deviceCodeHash)
+		span.AddEvent("Device code expired")
+		span.SetStatus(codes.Error, "Expired token")
+		return nil, models.NewOAuthError(models.OAuthErrorExpiredToken, "device_code has expired")
+	}
+
+	// a device polling faster than its interval is told to slow down and must wait longer from then on
+	interval := code.Interval
+	tooFast := code.LastPolledAt != nil && now.Sub(*code.LastPolledAt) < time.Duration(code.Interval)*time.Second
+	if tooFast {
+		interval += deviceSlowDownStep
+	}
+
+	err = o.DeviceCodeRepository.RecordDeviceCodePoll(ctx, deviceCodeHash, now, interval)
+	if err != nil {
+		span.AddEvent("Failed to record poll")
+		span.SetStatus(codes.Error, "Error recording poll")
+		o.Logger.LogErrorContext(ctx, "Error recording device code poll", logging.Err(err))
+		return nil, models.NewOAuthError(models.OAuthErrorServerError, "error polling device code")
+	}
+
+	if tooFast {
+		span.SetAttributes(attribute.Key("interval").Int(interval))
+		span.AddEvent("Device polling too fast")
+		span.SetStatus(codes.Error, "Slow down")
+		return nil, models.NewOAuthError(models.OAuthErrorSlowDown,
+			fmt.Sprintf("poll at most every %d seconds", interval))
+	}
+
+	switch code.Status {
+	case models.DeviceCodeStatusPending:
+		span.AddEvent("Authorization pending")
+		span.SetStatus(codes.Error, "Authorization pending")
+		return nil, models.NewOAuthError(models.OAuthErrorAuthorizationPending, "the user has not answered yet")
+	case models.DeviceCodeStatusDenied:
+		_ = o.DeviceCodeRepository.DeleteDeviceCode(ctx, deviceCodeHash)
+		span.AddEvent("Authorization denied")
+		span.SetStatus(codes.Error, "Access denied")
+		return nil, models.NewOAuthError(models.OAuthErrorAccessDenied, "the user denied the request")
+	}
+
+	// consuming the code makes the token pair single use even if the device polls concurrently
+	code, err = o.DeviceCodeRepository.ConsumeDeviceCode(ctx, deviceCodeHash)
+	if err != nil {
+		span.AddEvent("Device code already used")
+		span.SetStatus(codes.Error, "Invalid grant")
+		return nil, models.NewOAuthError(models.OAuthErrorInvalidGrant, "device_code is invalid")
+	}
+
+	span.SetAttributes(attribute.Key("user_id").String(code.UserId))
+
+	user, err := o.UserRepository.GetUserById(ctx, code.UserId)
+	if err != nil {
+		span.AddEvent("Failed to get user by id")
+		span.SetStatus(codes.Error, "Error getting user by id")
+		return nil, models.NewOAuthError(models.OAuthErrorInvalidGrant, "device_code is invalid")
+	}
+
+	token, err := o.UserService.StartSession(ctx, user, deviceAuthMethod, false)
+	if err != nil {
+		span.AddEvent("Failed to start session")
+		span.SetStatus(codes.Error, err.Error())
+		return nil, models.NewOAuthError(models.OAuthErrorInvalidGrant, err.Error())
+	}
+
+	span.SetStatus(codes.Ok, "Device authorized")
+
+	return token, nil
+}
+
+// GetDeviceCode looks up a pending code so the verification page can show which client is asking
+func (o *oauthService) GetDeviceCode(ctx context.Context, userCode string) (*models.DeviceCode, error) {
+	ctx, span := o.Trace.StartSpan(ctx, "service.GetDeviceCode")
+	defer span.End()
+
+	code, err := o.DeviceCodeRepository.GetPendingDeviceCode(ctx, utils.NormalizeUserCode(userCode),
+		time.Now().UTC())
+	if err != nil {
+		span.AddEvent("Device code not found")
+		span.SetStatus(codes.Error, "Device code not found")
+		return nil, errors.New("code is invalid or has expired")
+	}
+
+	span.SetAttributes(attribute.Key("client_id").String(code.ClientId))
+	span.SetStatus(codes.Ok, "Device code found")
+
+	return code, nil
+}
+
+// DecideDeviceCode records a signed in user's approval or denial of the code shown on their device
+func (o *oauthService) DecideDeviceCode(ctx context.Context, userId string,
+	request *requests.DeviceVerificationRequest) error {
+	ctx, span := o.Trace.StartSpan(ctx, "service.DecideDeviceCode")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.Key("user_id").String(userId),
+		attribute.Key("approve").Bool(request.Approve),
+	)
+
+	userCode := utils.NormalizeUserCode(request.UserCode)
+	code, err := o.DeviceCodeRepository.GetPendingDeviceCode(ctx, userCode, time.Now().UTC())
+	if err != nil {
+		span.AddEvent("Device code not found")
+		span.SetStatus(codes.Error, "Device code not found")
+		return errors.New("code is invalid or has expired")
+	}
+
+	status, eventType := models.DeviceCodeStatusDenied, models.AuditDeviceDeny
+	if request.Approve {
+		status, eventType = models.DeviceCodeStatusApproved, models.AuditDeviceApprove
+	}
+
+	err = o.DeviceCodeRepository.DecideDeviceCode(ctx, userCode, userId, status, time.Now().UTC())
+	if err != nil {
+		span.AddEvent("Failed to decide device code")
+		span.SetStatus(codes.Error, "Device code not pending")
+		return errors.New("code is invalid or has expired")
+	}
+
+	o.AuditService.Record(ctx, eventType, userId, userId, map[string]string{
+		"client_id": code.ClientId,
+		"user_code": userCode,
+	})
+
+	span.SetStatus(codes.Ok, "Device code decided")
+
+	return nil
+}
+
+// authenticateActor returns the party exchanging the token, named by an actor_token or by a client_id whose
+// certificate the TLS connection presented as in RFC 8705 section 2, nil when the subject exchanges its own token
+func (o *oauthService) authenticateActor(ctx context.Context,
+	request *requests.OAuthTokenRequest) (*models.Principal, error) {
+	if request.ActorToken != "" {
+		return o.verifyActorToken(ctx, request)
+	}
+	if request.ClientId == "" {
+		return nil, nil
+	}
+
+	principal, err := o.ApiKeyService.VerifyClientCertificate(ctx, request.ClientId)
+	if err != nil {
+		return nil, models.NewOAuthError(models.OAuthErrorInvalidClient, err.Error())
+	}
+	if !principal.HasScope(models.ScopeTokenExchange) {
+		return nil, models.NewOAuthError(models.OAuthErrorInvalidGrant, "actor may not exchange tokens")
+	}
+
+	return principal, nil
+}
+
+// verifyActorToken accepts an api key or a user's access token, either must hold the token exchange scope
+func (o *oauthService) verifyActorToken(ctx context.Context,
+	request *requests.OAuthTokenRequest) (*models.Principal, error) {
+	if !isAccessTokenType(request.ActorTokenType) {
+		return nil, models.NewOAuthError(models.OAuthErrorInvalidRequest,
+			"actor_token_type must be access_token or jwt")
+	}
+
+	var principal *models.Principal
+	var err error
+	if strings.HasPrefix(request.ActorToken, models.ApiKeyLivePrefix) ||
+		strings.HasPrefix(request.ActorToken, models.ApiKeyTestPrefix) {
+		principal, err = o.ApiKeyService.VerifyApiKey(ctx, request.ActorToken)
+	} else {
+		principal, err = o.UserService.VerifyAccessToken(ctx, request.ActorToken)
+	}
+	if err != nil {
+		return nil, models.NewOAuthError(models.OAuthErrorInvalidGrant, "actor_token is invalid")
+	}
+
+	if !principal.HasScope(models.ScopeTokenExchange) {
+		return nil, models.NewOAuthError(models.OAuthErrorInvalidGrant, "actor may not exchange tokens")
+	}
+
+	return principal, nil
+}
+
+// exchangeScopes narrows the subject's scopes to those requested, without a request every scope is kept apart from
+// admin, interactive sessions may ask for any scope a personal access token could hold
+func exchangeScopes(subject *models.Principal, requested []string) ([]string, error) {
+	allowed := subject.Scopes
+	if subject.AuthMethod == models.AuthMethodSession {
+		allowed = make([]string, 0, len(models.PersonalAccessTokenScopes))
+		for _, scope := range models.PersonalAccessTokenScopes {
+			if scope != models.ScopeAdmin || subject.Role == models.RoleAdmin {
+				allowed = append(allowed, scope)
+			}
+		}
+	}
+
+	if len(requested) == 0 {
+		requested = make([]string, 0, len(allowed))
+		for _, scope := range allowed {
+			if scope != models.ScopeAdmin {
+				requested = append(requested, scope)
+			}
+		}
+	}
+
+	scopes := make([]string, 0, len(requested))
+	for _, scope := range requested {
+		if !slices.Contains(allowed, scope) {
+			return nil, models.NewOAuthError(models.OAuthErrorInvalidScope,
+				fmt.Sprintf("scope %s exceeds the subject token", scope))
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	if len(scopes) == 0 {
+		return nil, models.NewOAuthError(models.OAuthErrorInvalidScope, "no scope could be granted")
+	}
+
+	return scopes, nil
+}
+
+func isAccessTokenType(tokenType string) bool {
+	return tokenType == models.TokenTypeAccessToken || tokenType == models.TokenTypeJwt
+}
+
+func actorSubjects(actor *models.Actor) []string {
+	if actor == nil {
+		return nil
+	}
+	return actor.Subjects()
+}
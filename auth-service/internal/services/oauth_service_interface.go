@@ -0,0 +1,17 @@
+package services
+
+import (
+	"context"
+	"github.com/saufiroja/go-otel/auth-service/internal/contracts/requests"
+	"github.com/saufiroja/go-otel/auth-service/internal/models"
+)
+
+// OAuthService implements the grants of the token endpoint, errors are *models.OAuthError
+type OAuthService interface {
+	ExchangeToken(ctx context.Context, request *requests.OAuthTokenRequest) (*models.ExchangedToken, error)
+	AuthorizeDevice(ctx context.Context,
+		request *requests.DeviceAuthorizationRequest) (*models.DeviceAuthorization, error)
+	PollDeviceCode(ctx context.Context, request *requests.OAuthTokenRequest) (*models.Token, error)
+	GetDeviceCode(ctx context.Context, userCode string) (*models.DeviceCode, error)
+	DecideDeviceCode(ctx context.Context, userId string, request *requests.DeviceVerificationRequest) error
+}
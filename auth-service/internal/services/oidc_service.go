@@ -0,0 +1,258 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/saufiroja/go-otel/auth-service/config"
+	"github.com/saufiroja/go-otel/auth-service/internal/models"
+	"github.com/saufiroja/go-otel/auth-service/internal/repositories"
+	"github.com/saufiroja/go-otel/auth-service/internal/utils"
+	"github.com/saufiroja/go-otel/auth-service/pkg/logging"
+	"github.com/saufiroja/go-otel/auth-service/pkg/observability/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"time"
+)
+
+type oidcService struct {
+	Clients            map[string]*utils.OidcClient
+	IdentityRepository repositories.IdentityRepository
+	UserService        UserService
+	Logger             logging.Logger
+	Trace              *tracing.Tracer
+	AuditService       AuditService
+	AutoProvision      bool
+	StateTTL           time.Duration
+}
+
+func NewOidcService(clients map[string]*utils.OidcClient, identityRepository repositories.IdentityRepository,
+	userService UserService, logger logging.Logger, trace *tracing.Tracer, auditService AuditService,
+	conf *config.AppConfig) OidcService {
+	return &oidcService{
+		Clients:            clients,
+		IdentityRepository: identityRepository,
+		UserService:        userService,
+		Logger:             logger,
+		Trace:              trace,
+		AuditService:       auditService,
+		AutoProvision:      conf.Oidc.AutoProvision,
+		StateTTL:           conf.Oidc.StateTTL,
+	}
+}
+
+// Authorize starts a sign-in, or links the provider to linkUserId when it is set, and returns the redirect url
+func (o *oidcService) Authorize(ctx context.Context, provider, linkUserId string, browser bool) (string, error) {
+	ctx, span := o.Trace.StartSpan(ctx, "service.OidcAuthorize")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.Key("provider").String(provider),
+		attribute.Key("link_user_id").String(linkUserId),
+	)
+
+	client, ok := o.Clients[provider]
+	if !ok {
+		span.AddEvent("Unknown provider")
+		span.SetStatus(codes.Error, "Unknown provider")
+		return "", fmt.Errorf("unknown provider %s", provider)
+	}
+
+	state, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		span.SetStatus(codes.Error, "Error generating state")
+		o.Logger.LogErrorContext(ctx, "Error generating oidc state", logging.Err(err))
+		return "", errors.New("error starting sign-in")
+	}
+	nonce, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		span.SetStatus(codes.Error, "Error generating nonce")
+		o.Logger.LogErrorContext(ctx, "Error generating oidc nonce", logging.Err(err))
+		return "", errors.New("error starting sign-in")
+	}
+	codeVerifier, err := utils.GenerateRandomToken(48)
+	if err != nil {
+		span.SetStatus(codes.Error, "Error generating code verifier")
+		o.Logger.LogErrorContext(ctx, "Error generating oidc code verifier", logging.Err(err))
+		return "", errors.New("error starting sign-in")
+	}
+
+	authorizationUrl, err := client.AuthCodeURL(ctx, state, nonce, codeVerifier)
+	if err != nil {
+		span.AddEvent("Failed to build authorization url")
+		span.SetStatus(codes.Error, "Error building authorization url")
+		o.Logger.LogErrorContext(ctx, "Error building authorization url", logging.String("provider", provider),
+			logging.Err(err))
+		return "", errors.New("provider unavailable")
+	}
+
+	err = o.IdentityRepository.CreateLoginState(ctx, &models.OidcLoginState{
+		StateHash:    utils.HashToken(state),
+		Provider:     provider,
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+		LinkUserId:   linkUserId,
+		Browser:      browser,
+		ExpiresAt:    time.Now().UTC().Add(o.StateTTL),
+	})
+	if err != nil {
+		span.AddEvent("Failed to store login state")
+		span.SetStatus(codes.Error, "Error storing login state")
+		o.Logger.LogErrorContext(ctx, "Error storing oidc login state", logging.Err(err))
+		return "", errors.New("error starting sign-in")
+	}
+
+	span.SetStatus(codes.Ok, "Authorization started")
+
+	return authorizationUrl, nil
+}
+
+func (o *oidcService) Callback(ctx context.Context, provider, code, state string) (*models.ExternalSignInResult, error) {
+	ctx, span := o.Trace.StartSpan(ctx, "service.OidcCallback")
+	defer span.End()
+
+	span.SetAttributes(attribute.Key("provider").String(provider))
+
+	client, ok := o.Clients[provider]
+	if !ok {
+		span.AddEvent("Unknown provider")
+		span.SetStatus(codes.Error, "Unknown provider")
+		return nil, fmt.Errorf("unknown provider %s", provider)
+	}
+
+	loginState, err := o.IdentityRepository.ConsumeLoginState(ctx, utils.HashToken(state), time.Now().UTC())
+	if err != nil || loginState.Provider != provider {
+		span.AddEvent("Unknown or expired state")
+		span.SetStatus(codes.Error, "Invalid state")
+		return nil, errors.New("invalid or expired state")
+	}
+
+	rawIdToken, err := client.Exchange(ctx, code, loginState.CodeVerifier)
+	if err != nil {
+		span.AddEvent("Failed to exchange code")
+		span.SetStatus(codes.Error, "Error exchanging code")
+		o.Logger.LogErrorContext(ctx, "Error exchanging authorization code", logging.String("provider", provider),
+			logging.Err(err))
+		return nil, errors.New("sign-in with provider failed")
+	}
+
+	claims, err := client.VerifyIdToken(ctx, rawIdToken, loginState.Nonce)
+	if err != nil {
+		span.AddEvent("Invalid id token")
+		span.SetStatus(codes.Error, "Invalid id token")
+		o.Logger.LogErrorContext(ctx, "Invalid id token", logging.String("provider", provider), logging.Err(err))
+		return nil, errors.New("sign-in with provider failed")
+	}
+
+	external := &models.ExternalUser{
+		Provider:      provider,
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+		FullName:      claims.Name,
+		AutoProvision: o.AutoProvision,
+	}
+
+	if loginState.LinkUserId != "" {
+		identity, err := o.UserService.LinkExternalUser(ctx, loginState.LinkUserId, external)
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			return nil, err
+		}
+		return &models.ExternalSignInResult{Linked: identity, Browser: loginState.Browser}, nil
+	}
+
+	user, err := o.UserService.ResolveExternalUser(ctx, external)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	token, err := o.UserService.StartSession(ctx, user, "oidc:"+provider, loginState.Browser)
+	if err != nil {
+		span.AddEvent("Failed to start session")
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	span.SetStatus(codes.Ok, "Signed in with provider")
+
+	return &models.ExternalSignInResult{Token: token, Browser: loginState.Browser}, nil
+}
+
+func (o *oidcService) ListIdentities(ctx context.Context, userId string) ([]*models.UserIdentity, error) {
+	ctx, span := o.Trace.StartSpan(ctx, "service.ListIdentities")
+	defer span.End()
+
+	span.SetAttributes(attribute.Key("user_id").String(userId))
+
+	identities, err := o.IdentityRepository.GetIdentitiesByUserId(ctx, userId)
+	if err != nil {
+		span.AddEvent("Failed to get identities")
+		span.SetStatus(codes.Error, "Error getting identities")
+		o.Logger.LogErrorContext(ctx, "Error getting identities", logging.Err(err))
+		return nil, errors.New("error getting identities")
+	}
+
+	span.SetStatus(codes.Ok, "Identities listed")
+
+	return identities, nil
+}
+
+func (o *oidcService) UnlinkIdentity(ctx context.Context, userId, identityId string) error {
+	ctx, span := o.Trace.StartSpan(ctx, "service.UnlinkIdentity")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.Key("user_id").String(userId),
+		attribute.Key("identity_id").String(identityId),
+	)
+
+	identities, err := o.IdentityRepository.GetIdentitiesByUserId(ctx, userId)
+	if err != nil {
+		span.AddEvent("Failed to get identities")
+		span.SetStatus(codes.Error, "Error getting identities")
+		o.Logger.LogErrorContext(ctx, "Error getting identities", logging.Err(err))
+		return errors.New("error unlinking identity")
+	}
+
+	// a provisioned account has no password the user knows, its only identity is its only way in
+	var target *models.UserIdentity
+	for _, identity := range identities {
+		if identity.IdentityId == identityId {
+			target = identity
+		}
+	}
+	if target == nil {
+		span.AddEvent("Identity not found")
+		span.SetStatus(codes.Error, "Identity not found")
+		return errors.New("identity not found")
+	}
+	// directory links are managed by the directory, removing one would re-enable a stale local password
+	if _, ok := o.Clients[target.Provider]; !ok {
+		span.AddEvent("Identity not managed by an oidc provider")
+		span.SetStatus(codes.Error, "Cannot unlink identity")
+		return errors.New("this identity cannot be unlinked")
+	}
+	if target.Provisioned && len(identities) == 1 {
+		span.AddEvent("Last identity of provisioned account")
+		span.SetStatus(codes.Error, "Cannot unlink last identity")
+		return errors.New("cannot unlink the only sign-in method of this account")
+	}
+
+	err = o.IdentityRepository.DeleteIdentity(ctx, userId, identityId)
+	if err != nil {
+		span.AddEvent("Failed to delete identity")
+		span.SetStatus(codes.Error, "Error deleting identity")
+		o.Logger.LogErrorContext(ctx, "Error deleting identity", logging.String("identity_id", identityId),
+			logging.Err(err))
+		return errors.New("identity not found")
+	}
+
+	o.AuditService.Record(ctx, models.AuditUserIdentityUnlink, userId, userId,
+		map[string]string{"identity_id": identityId, "provider": target.Provider})
+
+	span.SetStatus(codes.Ok, "Identity unlinked")
+
+	return nil
+}
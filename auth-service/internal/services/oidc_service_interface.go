@@ -0,0 +1,13 @@
+package services
+
+import (
+	"context"
+	"github.com/saufiroja/go-otel/auth-service/internal/models"
+)
+
+type OidcService interface {
+	Authorize(ctx context.Context, provider, linkUserId string, browser bool) (string, error)
+	Callback(ctx context.Context, provider, code, state string) (*models.ExternalSignInResult, error)
+	ListIdentities(ctx context.Context, userId string) ([]*models.UserIdentity, error)
+	UnlinkIdentity(ctx context.Context, userId, identityId string) error
+}
@@ -0,0 +1,88 @@
+package services
+
+import (
+	"context"
+	"github.com/saufiroja/go-otel/auth-service/config"
+	"github.com/saufiroja/go-otel/auth-service/internal/models"
+	"github.com/saufiroja/go-otel/auth-service/internal/utils"
+	"github.com/saufiroja/go-otel/auth-service/pkg/logging"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestOidcCallbackState(t *testing.T) {
+	// the provider is down, a callback that gets past the state check fails at the code exchange
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(provider.Close)
+
+	tests := []struct {
+		name     string
+		provider string
+		state    *models.OidcLoginState
+		replay   bool
+		wantErr  string
+	}{
+		{
+			name:     "unknown state",
+			provider: "google",
+			wantErr:  "invalid or expired state",
+		},
+		{
+			name:     "expired state",
+			provider: "google",
+			state:    &models.OidcLoginState{Provider: "google", ExpiresAt: time.Now().Add(-time.Minute)},
+			wantErr:  "invalid or expired state",
+		},
+		{
+			name:     "state of another provider",
+			provider: "google",
+			state:    &models.OidcLoginState{Provider: "github", ExpiresAt: time.Now().Add(time.Minute)},
+			wantErr:  "invalid or expired state",
+		},
+		{
+			name:     "replayed state",
+			provider: "google",
+			state:    &models.OidcLoginState{Provider: "google", ExpiresAt: time.Now().Add(time.Minute)},
+			replay:   true,
+			wantErr:  "invalid or expired state",
+		},
+		{
+			name:     "valid state",
+			provider: "google",
+			state:    &models.OidcLoginState{Provider: "google", ExpiresAt: time.Now().Add(time.Minute)},
+			wantErr:  "sign-in with provider failed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolver, _, identities, audit := newExternalUserService()
+			clients := map[string]*utils.OidcClient{}
+			for _, name := range []string{"google", "github"} {
+				clients[name] = &utils.OidcClient{
+					Provider:   config.OidcProvider{Name: name, Issuer: provider.URL},
+					HttpClient: provider.Client(),
+					Trace:      newTestTracer(),
+				}
+			}
+			service := NewOidcService(clients, identities, resolver, logging.NewLogrusAdapter(), newTestTracer(), audit,
+				&config.AppConfig{})
+
+			if tt.state != nil {
+				identities.states[utils.HashToken("state-1")] = tt.state
+			}
+			if tt.replay {
+				_, _ = service.Callback(context.Background(), tt.provider, "code-1", "state-1")
+			}
+
+			_, err := service.Callback(context.Background(), tt.provider, "code-1", "state-1")
+			if err == nil || err.Error() != tt.wantErr {
+				t.Fatalf("Callback() error = %v, want %s", err, tt.wantErr)
+			}
+		})
+	}
+}
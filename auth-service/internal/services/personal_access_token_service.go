@@ -0,0 +1,185 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/saufiroja/go-otel/auth-service/internal/contracts/requests"
+	"github.com/saufiroja/go-otel/auth-service/internal/models"
+	"github.com/saufiroja/go-otel/auth-service/internal/repositories"
+	"github.com/saufiroja/go-otel/auth-service/internal/utils"
+	"github.com/saufiroja/go-otel/auth-service/pkg/logging"
+	"github.com/saufiroja/go-otel/auth-service/pkg/observability/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	personalAccessTokenDefaultDays = 30
+	personalAccessTokenMaxDays     = 365
+)
+
+type personalAccessTokenService struct {
+	PersonalAccessTokenRepository repositories.PersonalAccessTokenRepository
+	UserRepository                repositories.UserRepository
+	Logger                        logging.Logger
+	Trace                         *tracing.Tracer
+	AuditService                  AuditService
+}
+
+func NewPersonalAccessTokenService(personalAccessTokenRepository repositories.PersonalAccessTokenRepository,
+	userRepository repositories.UserRepository, logger logging.Logger, trace *tracing.Tracer,
+	auditService AuditService) PersonalAccessTokenService {
+	return &personalAccessTokenService{
+		PersonalAccessTokenRepository: personalAccessTokenRepository,
+		UserRepository:                userRepository,
+		Logger:                        logger,
+		Trace:                         trace,
+		AuditService:                  auditService,
+	}
+}
+
+func (p *personalAccessTokenService) CreateToken(ctx context.Context, userId string,
+	request *requests.CreatePersonalAccessTokenRequest) (*models.PersonalAccessToken, string, error) {
+	ctx, span := p.Trace.StartSpan(ctx, "service.CreatePersonalAccessToken")
+	defer span.End()
+
+	span.SetAttributes(attribute.Key("user_id").String(userId))
+
+	name := strings.TrimSpace(request.Name)
+	if name == "" {
+		span.AddEvent("Empty name")
+		span.SetStatus(codes.Error, "Name is required")
+		return nil, "", errors.New("name is required")
+	}
+
+	if len(request.Scopes) == 0 {
+		span.AddEvent("No scopes")
+		span.SetStatus(codes.Error, "At least one scope is required")
+		return nil, "", errors.New("at least one scope is required")
+	}
+
+	user, err := p.UserRepository.GetUserById(ctx, userId)
+	if err != nil {
+		span.AddEvent("Failed to get user by id")
+		span.SetStatus(codes.Error, "Error getting user by id")
+		p.Logger.LogErrorContext(ctx, "Error getting user by id", logging.Err(err))
+		return nil, "", errors.New("user not found")
+	}
+
+	scopes := make([]string, 0, len(request.Scopes))
+	for _, scope := range request.Scopes {
+		if !slices.Contains(models.PersonalAccessTokenScopes, scope) {
+			span.AddEvent("Unknown scope")
+			span.SetStatus(codes.Error, "Unknown scope")
+			return nil, "", fmt.Errorf("unknown scope %s", scope)
+		}
+		if scope == models.ScopeAdmin && user.Role != models.RoleAdmin {
+			span.AddEvent("Scope not permitted")
+			span.SetStatus(codes.Error, "Scope not permitted")
+			return nil, "", fmt.Errorf("scope %s not permitted", scope)
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	days := request.ExpiresInDays
+	if days <= 0 {
+		days = personalAccessTokenDefaultDays
+	}
+	if days > personalAccessTokenMaxDays {
+		span.AddEvent("Expiry too long")
+		span.SetStatus(codes.Error, "Expiry too long")
+		return nil, "", fmt.Errorf("expires_in_days must not exceed %d", personalAccessTokenMaxDays)
+	}
+
+	secret, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		span.AddEvent("Failed to generate token")
+		span.SetStatus(codes.Error, "Error generating token")
+		p.Logger.LogErrorContext(ctx, "Error generating personal access token", logging.Err(err))
+		return nil, "", errors.New("error generating token")
+	}
+	plaintext := models.PersonalAccessTokenPrefix + secret
+
+	now := time.Now().UTC()
+	token := &models.PersonalAccessToken{
+		TokenId:   uuid.New().String(),
+		UserId:    userId,
+		Name:      name,
+		TokenHash: utils.HashToken(plaintext),
+		Scopes:    scopes,
+		ExpiresAt: now.AddDate(0, 0, days),
+		CreatedAt: now,
+	}
+
+	err = p.PersonalAccessTokenRepository.CreatePersonalAccessToken(ctx, token)
+	if err != nil {
+		span.AddEvent("Failed to create personal access token")
+		span.SetStatus(codes.Error, "Error creating personal access token")
+		p.Logger.LogErrorContext(ctx, "Error creating personal access token", logging.Err(err))
+		return nil, "", errors.New("error creating token")
+	}
+
+	p.AuditService.Record(ctx, models.AuditPersonalAccessTokenCreate, userId, userId, map[string]string{
+		"token_id": token.TokenId,
+		"scopes":   strings.Join(scopes, " "),
+	})
+
+	span.SetAttributes(attribute.Key("token_id").String(token.TokenId))
+	span.AddEvent("Personal access token created")
+	span.SetStatus(codes.Ok, "Personal access token created")
+
+	return token, plaintext, nil
+}
+
+func (p *personalAccessTokenService) ListTokens(ctx context.Context, userId string) ([]*models.PersonalAccessToken, error) {
+	ctx, span := p.Trace.StartSpan(ctx, "service.ListPersonalAccessTokens")
+	defer span.End()
+
+	span.SetAttributes(attribute.Key("user_id").String(userId))
+
+	tokens, err := p.PersonalAccessTokenRepository.GetPersonalAccessTokensByUserId(ctx, userId)
+	if err != nil {
+		span.AddEvent("Failed to get personal access tokens")
+		span.SetStatus(codes.Error, "Error getting personal access tokens")
+		p.Logger.LogErrorContext(ctx, "Error getting personal access tokens", logging.Err(err))
+		return nil, errors.New("error getting tokens")
+	}
+
+	span.SetStatus(codes.Ok, "Personal access tokens listed")
+
+	return tokens, nil
+}
+
+func (p *personalAccessTokenService) RevokeToken(ctx context.Context, userId, tokenId string) error {
+	ctx, span := p.Trace.StartSpan(ctx, "service.RevokePersonalAccessToken")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.Key("user_id").String(userId),
+		attribute.Key("token_id").String(tokenId),
+	)
+
+	err := p.PersonalAccessTokenRepository.RevokePersonalAccessToken(ctx, userId, tokenId, time.Now().UTC())
+	if err != nil {
+		span.AddEvent("Failed to revoke personal access token")
+		span.SetStatus(codes.Error, "Error revoking personal access token")
+		p.Logger.LogErrorContext(ctx, "Error revoking personal access token", logging.String("token_id", tokenId),
+			logging.Err(err))
+		return errors.New("token not found")
+	}
+
+	p.AuditService.Record(ctx, models.AuditPersonalAccessTokenRevoke, userId, userId,
+		map[string]string{"token_id": tokenId})
+
+	span.AddEvent("Personal access token revoked")
+	span.SetStatus(codes.Ok, "Personal access token revoked")
+
+	return nil
+}
@@ -0,0 +1,14 @@
+package services
+
+import (
+	"context"
+	"github.com/saufiroja/go-otel/auth-service/internal/contracts/requests"
+	"github.com/saufiroja/go-otel/auth-service/internal/models"
+)
+
+type PersonalAccessTokenService interface {
+	CreateToken(ctx context.Context, userId string,
+		request *requests.CreatePersonalAccessTokenRequest) (*models.PersonalAccessToken, string, error)
+	ListTokens(ctx context.Context, userId string) ([]*models.PersonalAccessToken, error)
+	RevokeToken(ctx context.Context, userId, tokenId string) error
+}
@@ -0,0 +1,259 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/saufiroja/go-otel/auth-service/config"
+	"github.com/saufiroja/go-otel/auth-service/internal/contracts/requests"
+	"github.com/saufiroja/go-otel/auth-service/internal/models"
+	"github.com/saufiroja/go-otel/auth-service/internal/repositories"
+	"github.com/saufiroja/go-otel/auth-service/internal/utils"
+	"github.com/saufiroja/go-otel/auth-service/pkg/logging"
+	"github.com/saufiroja/go-otel/auth-service/pkg/observability/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"time"
+)
+
+type privacyService struct {
+	UserRepository        repositories.UserRepository
+	EmailChangeRepository repositories.EmailChangeRepository
+	ErasureRepository     repositories.ErasureRepository
+	AuditRepository       repositories.AuditRepository
+	SessionRepository     repositories.SessionRepository
+	PatRepository         repositories.PersonalAccessTokenRepository
+	IdentityRepository    repositories.IdentityRepository
+	Logger                logging.Logger
+	Trace                 *tracing.Tracer
+	PasswordHasher        utils.PasswordHasher
+	GracePeriod           time.Duration
+}
+
+func NewPrivacyService(userRepository repositories.UserRepository,
+	emailChangeRepository repositories.EmailChangeRepository, erasureRepository repositories.ErasureRepository,
+	auditRepository repositories.AuditRepository, sessionRepository repositories.SessionRepository,
+	patRepository repositories.PersonalAccessTokenRepository, identityRepository repositories.IdentityRepository,
+	logger logging.Logger, trace *tracing.Tracer, passwordHasher utils.PasswordHasher,
+	conf *config.AppConfig) PrivacyService {
+	return &privacyService{
+		UserRepository:        userRepository,
+		EmailChangeRepository: emailChangeRepository,
+		ErasureRepository:     erasureRepository,
+		AuditRepository:       auditRepository,
+		SessionRepository:     sessionRepository,
+		PatRepository:         patRepository,
+		IdentityRepository:    identityRepository,
+		Logger:                logger,
+		Trace:                 trace,
+		PasswordHasher:        passwordHasher,
+		GracePeriod:           conf.Gdpr.ErasureGracePeriod,
+	}
+}
+
+func (p *privacyService) ExportUserData(ctx context.Context, userId string) (*models.UserExport, error) {
+	ctx, span := p.Trace.StartSpan(ctx, "service.ExportUserData")
+	defer span.End()
+
+	span.SetAttributes(attribute.Key("user_id").String(userId))
+
+	user, err := p.UserRepository.GetUserById(ctx, userId)
+	if err != nil {
+		span.AddEvent("Failed to get user by id")
+		span.SetStatus(codes.Error, "Error getting user by id")
+		p.Logger.LogErrorContext(ctx, "Error getting user by id", logging.Err(err))
+		return nil, errors.New("user not found")
+	}
+
+	emailChanges, err := p.EmailChangeRepository.GetEmailChangesByUserId(ctx, userId)
+	if err != nil {
+		span.AddEvent("Failed to get email changes")
+		span.SetStatus(codes.Error, "Error getting email changes")
+		p.Logger.LogErrorContext(ctx, "Error getting email changes", logging.Err(err))
+		return nil, errors.New("error exporting user data")
+	}
+
+	statusChanges, err := p.UserRepository.GetStatusChanges(ctx, userId)
+	if err != nil {
+		span.AddEvent("Failed to get status changes")
+		span.SetStatus(codes.Error, "Error getting status changes")
+		p.Logger.LogErrorContext(ctx, "Error getting status changes", logging.Err(err))
+		return nil, errors.New("error exporting user data")
+	}
+
+	erasureRequests, err := p.ErasureRepository.GetErasureRequestsByUserId(ctx, userId)
+	if err != nil {
+		span.AddEvent("Failed to get erasure requests")
+		span.SetStatus(codes.Error, "Error getting erasure requests")
+		p.Logger.LogErrorContext(ctx, "Error getting erasure requests", logging.Err(err))
+		return nil, errors.New("error exporting user data")
+	}
+
+	auditEvents, err := p.AuditRepository.GetAuditEventsByUserId(ctx, userId)
+	if err != nil {
+		span.AddEvent("Failed to get audit events")
+		span.SetStatus(codes.Error, "Error getting audit events")
+		p.Logger.LogErrorContext(ctx, "Error getting audit events", logging.Err(err))
+		return nil, errors.New("error exporting user data")
+	}
+
+	sessions, err := p.SessionRepository.GetSessionsByUserId(ctx, userId)
+	if err != nil {
+		span.AddEvent("Failed to get sessions")
+		span.SetStatus(codes.Error, "Error getting sessions")
+		p.Logger.LogErrorContext(ctx, "Error getting sessions", logging.Err(err))
+		return nil, errors.New("error exporting user data")
+	}
+
+	personalAccessTokens, err := p.PatRepository.GetPersonalAccessTokensByUserId(ctx, userId)
+	if err != nil {
+		span.AddEvent("Failed to get personal access tokens")
+		span.SetStatus(codes.Error, "Error getting personal access tokens")
+		p.Logger.LogErrorContext(ctx, "Error getting personal access tokens", logging.Err(err))
+		return nil, errors.New("error exporting user data")
+	}
+
+	identities, err := p.IdentityRepository.GetIdentitiesByUserId(ctx, userId)
+	if err != nil {
+		span.AddEvent("Failed to get identities")
+		span.SetStatus(codes.Error, "Error getting identities")
+		p.Logger.LogErrorContext(ctx, "Error getting identities", logging.Err(err))
+		return nil, errors.New("error exporting user data")
+	}
+
+	export := &models.UserExport{
+		ExportedAt: time.Now().UTC(),
+		Profile: &models.ExportProfile{
+			UserId:    user.UserId,
+			FullName:  user.FullName,
+			Email:     user.Email,
+			Status:    user.Status,
+			Role:      user.Role,
+			CreatedAt: user.CreatedAt,
+			UpdatedAt: user.UpdatedAt,
+		},
+		EmailChanges:         emailChanges,
+		StatusChanges:        statusChanges,
+		ErasureRequests:      erasureRequests,
+		AuditEvents:          auditEvents,
+		Sessions:             sessions,
+		PersonalAccessTokens: personalAccessTokens,
+		Identities:           identities,
+	}
+
+	span.AddEvent("User data exported")
+	span.SetStatus(codes.Ok, "User data exported")
+
+	return export, nil
+}
+
+func (p *privacyService) RequestErasure(ctx context.Context, userId string,
+	request *requests.ErasureRequest) (*models.ErasureRequest, error) {
+	ctx, span := p.Trace.StartSpan(ctx, "service.RequestErasure")
+	defer span.End()
+
+	span.SetAttributes(attribute.Key("user_id").String(userId))
+
+	user, err := p.UserRepository.GetUserById(ctx, userId)
+	if err != nil {
+		span.AddEvent("Failed to get user by id")
+		span.SetStatus(codes.Error, "Error getting user by id")
+		p.Logger.LogErrorContext(ctx, "Error getting user by id", logging.Err(err))
+		return nil, errors.New("user not found")
+	}
+
+	err = p.PasswordHasher.Compare(ctx, user.Password, request.Password)
+	if err != nil {
+		span.AddEvent("password mismatch")
+		span.SetStatus(codes.Error, "Password mismatch")
+		p.Logger.LogErrorContext(ctx, "password mismatch", logging.Err(err))
+		return nil, errors.New("password mismatch")
+	}
+
+	now := time.Now().UTC()
+	erasure := &models.ErasureRequest{
+		RequestId:   uuid.New().String(),
+		UserId:      userId,
+		Status:      models.ErasurePending,
+		RequestedAt: now,
+		ScheduledAt: now.Add(p.GracePeriod),
+	}
+
+	err = p.ErasureRepository.CreateErasureRequest(ctx, erasure)
+	if err != nil {
+		span.AddEvent("Failed to create erasure request")
+		span.SetStatus(codes.Error, "Error creating erasure request")
+		p.Logger.LogErrorContext(ctx, "Error creating erasure request", logging.Err(err))
+		return nil, errors.New("erasure already requested")
+	}
+
+	p.Logger.LogInfoContext(ctx, "Erasure scheduled", logging.String("user_id", userId),
+		logging.String("scheduled_at", erasure.ScheduledAt.Format(time.RFC3339)))
+
+	span.SetAttributes(attribute.Key("scheduled_at").Int64(erasure.ScheduledAt.Unix()))
+	span.AddEvent("Erasure requested")
+	span.SetStatus(codes.Ok, "Erasure requested")
+
+	return erasure, nil
+}
+
+func (p *privacyService) CancelErasure(ctx context.Context, userId string) error {
+	ctx, span := p.Trace.StartSpan(ctx, "service.CancelErasure")
+	defer span.End()
+
+	span.SetAttributes(attribute.Key("user_id").String(userId))
+
+	err := p.ErasureRepository.CancelErasureRequest(ctx, userId)
+	if err != nil {
+		span.AddEvent("Failed to cancel erasure request")
+		span.SetStatus(codes.Error, "Error cancelling erasure request")
+		p.Logger.LogErrorContext(ctx, "Error cancelling erasure request", logging.Err(err))
+		return errors.New("no pending erasure request")
+	}
+
+	span.AddEvent("Erasure cancelled")
+	span.SetStatus(codes.Ok, "Erasure cancelled")
+
+	return nil
+}
+
+func (p *privacyService) ProcessDueErasures(ctx context.Context, limit int) (int, int, error) {
+	ctx, span := p.Trace.StartSpan(ctx, "service.ProcessDueErasures")
+	defer span.End()
+
+	now := time.Now().UTC()
+	due, err := p.ErasureRepository.GetDueErasureRequests(ctx, now, limit)
+	if err != nil {
+		span.AddEvent("Failed to get due erasure requests")
+		span.SetStatus(codes.Error, "Error getting due erasure requests")
+		p.Logger.LogErrorContext(ctx, "Error getting due erasure requests", logging.Err(err))
+		return 0, 0, err
+	}
+
+	processed, failed := 0, 0
+	for _, request := range due {
+		err := p.ErasureRepository.EraseUser(ctx, request, now)
+		if err != nil {
+			failed++
+			p.Logger.LogErrorContext(ctx, "Error erasing user", logging.String("user_id", request.UserId),
+				logging.String("request_id", request.RequestId), logging.Err(err))
+			continue
+		}
+		processed++
+		p.Logger.LogInfoContext(ctx, "Erased user", logging.String("user_id", request.UserId),
+			logging.String("request_id", request.RequestId))
+	}
+
+	span.SetAttributes(
+		attribute.Key("erasure.due").Int(len(due)),
+		attribute.Key("erasure.processed").Int(processed),
+		attribute.Key("erasure.failed").Int(failed),
+	)
+	if failed > 0 {
+		span.SetStatus(codes.Error, "Some erasures failed")
+	} else {
+		span.SetStatus(codes.Ok, "Erasures processed")
+	}
+
+	return processed, failed, nil
+}
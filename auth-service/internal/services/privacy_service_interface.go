@@ -0,0 +1,14 @@
+package services
+
+import (
+	"context"
+	"github.com/saufiroja/go-otel/auth-service/internal/contracts/requests"
+	"github.com/saufiroja/go-otel/auth-service/internal/models"
+)
+
+type PrivacyService interface {
+	ExportUserData(ctx context.Context, userId string) (*models.UserExport, error)
+	RequestErasure(ctx context.Context, userId string, request *requests.ErasureRequest) (*models.ErasureRequest, error)
+	CancelErasure(ctx context.Context, userId string) error
+	ProcessDueErasures(ctx context.Context, limit int) (processed int, failed int, err error)
+}
@@ -0,0 +1,314 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/saufiroja/go-otel/auth-service/internal/contracts/requests"
+	"github.com/saufiroja/go-otel/auth-service/internal/models"
+	"github.com/saufiroja/go-otel/auth-service/internal/repositories"
+	"github.com/saufiroja/go-otel/auth-service/internal/utils"
+	"github.com/saufiroja/go-otel/auth-service/pkg/logging"
+	"github.com/saufiroja/go-otel/auth-service/pkg/observability/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"strings"
+	"time"
+)
+
+const emailChangeTTL = time.Hour * 24
+
+// ErrEmailInUse refuses an email change to an address another account holds, it is answered with a conflict
+var ErrEmailInUse = errors.New("email already in use")
+
+type profileService struct {
+	UserRepository        repositories.UserRepository
+	EmailChangeRepository repositories.EmailChangeRepository
+	Logger                logging.Logger
+	Trace                 *tracing.Tracer
+	PasswordHasher        utils.PasswordHasher
+	Notifier              utils.Notifier
+	AuditService          AuditService
+}
+
+func NewProfileService(userRepository repositories.UserRepository,
+	emailChangeRepository repositories.EmailChangeRepository, logger logging.Logger, trace *tracing.Tracer,
+	passwordHasher utils.PasswordHasher, notifier utils.Notifier, auditService AuditService) ProfileService {
+	return &profileService{
+		UserRepository:        userRepository,
+		EmailChangeRepository: emailChangeRepository,
+		Logger:                logger,
+		Trace:                 trace,
+		PasswordHasher:        passwordHasher,
+		Notifier:              notifier,
+		AuditService:          auditService,
+	}
+}
+
+func (p *profileService) GetProfile(ctx context.Context, userId string) (*models.User, error) {
+	ctx, span := p.Trace.StartSpan(ctx, "service.GetProfile")
+	defer span.End()
+
+	span.SetAttributes(attribute.Key("user_id").String(userId))
+
+	user, err := p.UserRepository.GetUserById(ctx, userId)
+	if err != nil {
+		span.AddEvent("Failed to get user by id")
+		span.SetStatus(codes.Error, "Error getting user by id")
+		p.Logger.LogErrorContext(ctx, "Error getting user by id", logging.Err(err))
+		return nil, errors.New("user not found")
+	}
+
+	span.SetStatus(codes.Ok, "Profile retrieved")
+
+	return user, nil
+}
+
+func (p *profileService) UpdateProfile(ctx context.Context, userId string,
+	request *requests.UpdateProfileRequest) (*models.User, error) {
+	ctx, span := p.Trace.StartSpan(ctx, "service.UpdateProfile")
+	defer span.End()
+
+	span.SetAttributes(attribute.Key("user_id").String(userId))
+
+	fullName := strings.TrimSpace(request.FullName)
+	if fullName == "" {
+		span.AddEvent("Empty full name")
+		span.SetStatus(codes.Error, "Full name is required")
+		return nil, errors.New("full name is required")
+	}
+
+	user, err := p.UserRepository.GetUserById(ctx, userId)
+	if err != nil {
+		span.AddEvent("Failed to get user by id")
+		span.SetStatus(codes.Error, "Error getting user by id")
+		p.Logger.LogErrorContext(ctx, "Error getting user by id", logging.Err(err))
+		return nil, errors.New("user not found")
+	}
+
+	user.FullName = fullName
+	user.UpdatedAt = time.Now().UTC()
+
+	err = p.UserRepository.UpdateUser(ctx, user)
+	if err != nil {
+		span.AddEvent("Failed to update user")
+		span.SetStatus(codes.Error, "Error updating user")
+		p.Logger.LogErrorContext(ctx, "Error updating user", logging.Err(err))
+		return nil, errors.New("error updating user")
+	}
+
+	span.AddEvent("Profile updated successfully")
+	span.SetStatus(codes.Ok, "Profile updated successfully")
+
+	return user, nil
+}
+
+func (p *profileService) RequestEmailChange(ctx context.Context, userId string,
+	request *requests.ChangeEmailRequest) error {
+	ctx, span := p.Trace.StartSpan(ctx, "service.RequestEmailChange")
+	defer span.End()
+
+	span.SetAttributes(attribute.Key("user_id").String(userId))
+
+	newEmail := strings.TrimSpace(request.Email)
+	if newEmail == "" {
+		span.AddEvent("Empty email")
+		span.SetStatus(codes.Error, "Email is required")
+		return errors.New("email is required")
+	}
+
+	user, err := p.UserRepository.GetUserById(ctx, userId)
+	if err != nil {
+		span.AddEvent("Failed to get user by id")
+		span.SetStatus(codes.Error, "Error getting user by id")
+		p.Logger.LogErrorContext(ctx, "Error getting user by id", logging.Err(err))
+		return errors.New("user not found")
+	}
+
+	// the current password is required so a stolen access token cannot take over the account
+	err = p.PasswordHasher.Compare(ctx, user.Password, request.Password)
+	if err != nil {
+		span.AddEvent("password mismatch")
+		span.SetStatus(codes.Error, "Password mismatch")
+		p.Logger.LogErrorContext(ctx, "password mismatch", logging.Err(err))
+		return errors.New("password mismatch")
+	}
+
+	if strings.EqualFold(newEmail, user.Email) {
+		span.AddEvent("Email unchanged")
+		span.SetStatus(codes.Error, "Email unchanged")
+		return errors.New("new email is the same as the current email")
+	}
+
+	_, err = p.UserRepository.GetUserByEmail(ctx, newEmail)
+	if err == nil {
+		span.AddEvent("Email already in use")
+		span.SetStatus(codes.Error, "Email already in use")
+		p.Logger.LogErrorContext(ctx, "Email change rejected: email already in use", logging.String("user_id", userId))
+		return ErrEmailInUse
+	}
+
+	token, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		span.AddEvent("Failed to generate verification token")
+		span.SetStatus(codes.Error, "Error generating verification token")
+		p.Logger.LogErrorContext(ctx, "Error generating verification token", logging.Err(err))
+		return errors.New("error generating verification token")
+	}
+
+	now := time.Now().UTC()
+	change := &models.EmailChange{
+		ChangeId:  uuid.New().String(),
+		UserId:    userId,
+		NewEmail:  newEmail,
+		TokenHash: utils.HashToken(token),
+		ExpiresAt: now.Add(emailChangeTTL),
+		CreatedAt: now,
+	}
+
+	err = p.EmailChangeRepository.CreateEmailChange(ctx, change)
+	if err != nil {
+		span.AddEvent("Failed to create email change")
+		span.SetStatus(codes.Error, "Error creating email change")
+		p.Logger.LogErrorContext(ctx, "Error creating email change", logging.Err(err))
+		return errors.New("error creating email change")
+	}
+
+	err = p.Notifier.SendEmailChangeVerification(ctx, userId, newEmail, token)
+	if err != nil {
+		span.AddEvent("Failed to send verification")
+		span.SetStatus(codes.Error, "Error sending verification")
+		p.Logger.LogErrorContext(ctx, "Error sending email change verification", logging.Err(err))
+		return errors.New("error sending verification")
+	}
+
+	span.AddEvent("Email change requested")
+	span.SetStatus(codes.Ok, "Email change requested")
+
+	return nil
+}
+
+func (p *profileService) ConfirmEmailChange(ctx context.Context, userId string,
+	request *requests.ConfirmEmailChangeRequest) (*models.User, error) {
+	ctx, span := p.Trace.StartSpan(ctx, "service.ConfirmEmailChange")
+	defer span.End()
+
+	span.SetAttributes(attribute.Key("user_id").String(userId))
+
+	change, err := p.EmailChangeRepository.GetEmailChangeByTokenHash(ctx, utils.HashToken(request.Token))
+	if err != nil || change.UserId != userId {
+		span.AddEvent("Email change not found")
+		span.SetStatus(codes.Error, "Invalid verification token")
+		return nil, errors.New("invalid verification token")
+	}
+
+	if change.ConsumedAt != nil || time.Now().UTC().After(change.ExpiresAt) {
+		span.AddEvent("Email change expired or consumed")
+		span.SetStatus(codes.Error, "Verification token expired")
+		return nil, errors.New("verification token expired")
+	}
+
+	user, err := p.UserRepository.GetUserById(ctx, userId)
+	if err != nil {
+		span.AddEvent("Failed to get user by id")
+		span.SetStatus(codes.Error, "Error getting user by id")
+		p.Logger.LogErrorContext(ctx, "Error getting user by id", logging.Err(err))
+		return nil, errors.New("user not found")
+	}
+
+	// the address may have been taken while the verification was pending
+	existing, err := p.UserRepository.GetUserByEmail(ctx, change.NewEmail)
+	if err == nil && existing.UserId != userId {
+		span.AddEvent("Email already in use")
+		span.SetStatus(codes.Error, "Email already in use")
+		return nil, ErrEmailInUse
+	}
+
+	// consuming the token and changing the address commit together, a failed update leaves the token usable
+	now := time.Now().UTC()
+	err = p.EmailChangeRepository.ConfirmEmailChange(ctx, change, now)
+	if errors.Is(err, repositories.ErrEmailTaken) {
+		span.AddEvent("Email already in use")
+		span.SetStatus(codes.Error, "Email already in use")
+		return nil, ErrEmailInUse
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		span.AddEvent("Email change already consumed")
+		span.SetStatus(codes.Error, "Verification token expired")
+		return nil, errors.New("verification token expired")
+	}
+	if err != nil {
+		span.AddEvent("Failed to confirm email change")
+		span.SetStatus(codes.Error, "Error confirming email change")
+		p.Logger.LogErrorContext(ctx, "Error confirming email change", logging.Err(err))
+		return nil, errors.New("error updating user")
+	}
+
+	user.Email = change.NewEmail
+	user.UpdatedAt = now
+
+	p.AuditService.Record(ctx, models.AuditUserEmailChange, userId, userId,
+		map[string]string{"change_id": change.ChangeId})
+
+	span.AddEvent("Email changed successfully")
+	span.SetStatus(codes.Ok, "Email changed successfully")
+
+	return user, nil
+}
+
+func (p *profileService) ChangePassword(ctx context.Context, userId string,
+	request *requests.ChangePasswordRequest) error {
+	ctx, span := p.Trace.StartSpan(ctx, "service.ChangePassword")
+	defer span.End()
+
+	span.SetAttributes(attribute.Key("user_id").String(userId))
+
+	if request.NewPassword == "" {
+		span.AddEvent("Empty new password")
+		span.SetStatus(codes.Error, "New password is required")
+		return errors.New("new password is required")
+	}
+
+	user, err := p.UserRepository.GetUserById(ctx, userId)
+	if err != nil {
+		span.AddEvent("Failed to get user by id")
+		span.SetStatus(codes.Error, "Error getting user by id")
+		p.Logger.LogErrorContext(ctx, "Error getting user by id", logging.Err(err))
+		return errors.New("user not found")
+	}
+
+	err = p.PasswordHasher.Compare(ctx, user.Password, request.CurrentPassword)
+	if err != nil {
+		span.AddEvent("password mismatch")
+		span.SetStatus(codes.Error, "Password mismatch")
+		p.Logger.LogErrorContext(ctx, "password mismatch", logging.Err(err))
+		return errors.New("password mismatch")
+	}
+
+	password, err := p.PasswordHasher.Hash(ctx, request.NewPassword)
+	if err != nil {
+		span.AddEvent("Failed to hash password")
+		span.SetStatus(codes.Error, "Error hashing password")
+		p.Logger.LogErrorContext(ctx, "Error hashing password", logging.Err(err))
+		return errors.New("error hashing password")
+	}
+
+	user.Password = password
+	user.UpdatedAt = time.Now().UTC()
+
+	err = p.UserRepository.UpdateUser(ctx, user)
+	if err != nil {
+		span.AddEvent("Failed to update user")
+		span.SetStatus(codes.Error, "Error updating user")
+		p.Logger.LogErrorContext(ctx, "Error updating user", logging.Err(err))
+		return errors.New("error updating user")
+	}
+
+	p.AuditService.Record(ctx, models.AuditUserPasswordChange, userId, userId, nil)
+
+	span.AddEvent("Password changed successfully")
+	span.SetStatus(codes.Ok, "Password changed successfully")
+
+	return nil
+}
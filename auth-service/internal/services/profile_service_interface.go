@@ -0,0 +1,15 @@
+package services
+
+import (
+	"context"
+	"github.com/saufiroja/go-otel/auth-service/internal/contracts/requests"
+	"github.com/saufiroja/go-otel/auth-service/internal/models"
+)
+
+type ProfileService interface {
+	GetProfile(ctx context.Context, userId string) (*models.User, error)
+	UpdateProfile(ctx context.Context, userId string, request *requests.UpdateProfileRequest) (*models.User, error)
+	RequestEmailChange(ctx context.Context, userId string, request *requests.ChangeEmailRequest) error
+	ConfirmEmailChange(ctx context.Context, userId string, request *requests.ConfirmEmailChangeRequest) (*models.User, error)
+	ChangePassword(ctx context.Context, userId string, request *requests.ChangePasswordRequest) error
+}
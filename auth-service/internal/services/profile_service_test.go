@@ -0,0 +1,97 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/saufiroja/go-otel/auth-service/internal/contracts/requests"
+	"github.com/saufiroja/go-otel/auth-service/internal/models"
+	"github.com/saufiroja/go-otel/auth-service/internal/repositories"
+	"github.com/saufiroja/go-otel/auth-service/internal/utils"
+	"github.com/saufiroja/go-otel/auth-service/pkg/logging"
+	"testing"
+	"time"
+)
+
+// fakeEmailChangeRepository confirms changes like the transaction does, nothing is consumed when the address is
+// taken at commit time
+type fakeEmailChangeRepository struct {
+	repositories.EmailChangeRepository
+	changes map[string]*models.EmailChange
+	users   *fakeUserRepository
+	// takenAtCommit is another account claiming the address between the service check and the commit
+	takenAtCommit bool
+}
+
+func (f *fakeEmailChangeRepository) GetEmailChangeByTokenHash(_ context.Context,
+	tokenHash string) (*models.EmailChange, error) {
+	change, ok := f.changes[tokenHash]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return change, nil
+}
+
+func (f *fakeEmailChangeRepository) ConfirmEmailChange(_ context.Context, change *models.EmailChange,
+	now time.Time) error {
+	if change.ConsumedAt != nil {
+		return sql.ErrNoRows
+	}
+	if f.takenAtCommit {
+		return repositories.ErrEmailTaken
+	}
+	change.ConsumedAt = &now
+	f.users.users[change.UserId].Email = change.NewEmail
+	return nil
+}
+
+func TestConfirmEmailChange(t *testing.T) {
+	tests := []struct {
+		name          string
+		takenBefore   bool
+		takenAtCommit bool
+		wantErr       error
+	}{
+		{name: "address free"},
+		{name: "address taken while pending", takenBefore: true, wantErr: ErrEmailInUse},
+		{name: "address taken at commit", takenAtCommit: true, wantErr: ErrEmailInUse},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users := &fakeUserRepository{users: map[string]*models.User{
+				"user-1": {UserId: "user-1", Email: "jane@example.com"},
+			}}
+			if tt.takenBefore {
+				users.users["user-2"] = &models.User{UserId: "user-2", Email: "new@example.com"}
+			}
+			change := &models.EmailChange{ChangeId: "change-1", UserId: "user-1", NewEmail: "new@example.com",
+				ExpiresAt: time.Now().Add(time.Hour)}
+			changes := &fakeEmailChangeRepository{
+				changes:       map[string]*models.EmailChange{utils.HashToken("token-1"): change},
+				users:         users,
+				takenAtCommit: tt.takenAtCommit,
+			}
+			service := NewProfileService(users, changes, logging.NewLogrusAdapter(), newTestTracer(), nil, nil,
+				&fakeAuditService{})
+
+			user, err := service.ConfirmEmailChange(context.Background(), "user-1",
+				&requests.ConfirmEmailChangeRequest{Token: "token-1"})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ConfirmEmailChange() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				if change.ConsumedAt != nil {
+					t.Errorf("a refused change consumed the token")
+				}
+				if users.users["user-1"].Email != "jane@example.com" {
+					t.Errorf("a refused change updated the email")
+				}
+				return
+			}
+			if user.Email != "new@example.com" || change.ConsumedAt == nil {
+				t.Errorf("email = %s consumed %v, want the change applied", user.Email, change.ConsumedAt)
+			}
+		})
+	}
+}
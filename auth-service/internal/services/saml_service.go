@@ -0,0 +1,217 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"github.com/crewjam/saml"
+	"github.com/saufiroja/go-otel/auth-service/config"
+	"github.com/saufiroja/go-otel/auth-service/internal/models"
+	"github.com/saufiroja/go-otel/auth-service/internal/repositories"
+	"github.com/saufiroja/go-otel/auth-service/internal/utils"
+	"github.com/saufiroja/go-otel/auth-service/pkg/logging"
+	"github.com/saufiroja/go-otel/auth-service/pkg/observability/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"time"
+)
+
+type samlService struct {
+	ServiceProvider       *saml.ServiceProvider
+	SamlRequestRepository repositories.SamlRequestRepository
+	UserService           UserService
+	Logger                logging.Logger
+	Trace                 *tracing.Tracer
+	Conf                  *config.AppConfig
+}
+
+func NewSamlService(serviceProvider *saml.ServiceProvider, samlRequestRepository repositories.SamlRequestRepository,
+	userService UserService, logger logging.Logger, trace *tracing.Tracer, conf *config.AppConfig) SamlService {
+	return &samlService{
+		ServiceProvider:       serviceProvider,
+		SamlRequestRepository: samlRequestRepository,
+		UserService:           userService,
+		Logger:                logger,
+		Trace:                 trace,
+		Conf:                  conf,
+	}
+}
+
+func (s *samlService) Metadata(ctx context.Context) ([]byte, error) {
+	_, span := s.Trace.StartSpan(ctx, "service.SamlMetadata")
+	defer span.End()
+
+	metadata, err := xml.MarshalIndent(s.ServiceProvider.Metadata(), "", "  ")
+	if err != nil {
+		span.SetStatus(codes.Error, "Error marshalling metadata")
+		s.Logger.LogErrorContext(ctx, "Error marshalling SAML metadata", logging.Err(err))
+		return nil, errors.New("error generating metadata")
+	}
+
+	span.SetStatus(codes.Ok, "Metadata generated")
+
+	return metadata, nil
+}
+
+// Login creates a signed AuthnRequest and returns the IdP redirect url, the request id travels as RelayState.
+// A non empty linkUserId links the asserted identity to that signed-in user instead of signing in.
+func (s *samlService) Login(ctx context.Context, linkUserId string, browser bool) (string, error) {
+	ctx, span := s.Trace.StartSpan(ctx, "service.SamlLogin")
+	defer span.End()
+
+	span.SetAttributes(attribute.Key("link_user_id").String(linkUserId))
+
+	request, err := s.ServiceProvider.MakeAuthenticationRequest(
+		s.ServiceProvider.GetSSOBindingLocation(saml.HTTPRedirectBinding), saml.HTTPRedirectBinding,
+		saml.HTTPPostBinding)
+	if err != nil {
+		span.AddEvent("Failed to create AuthnRequest")
+		span.SetStatus(codes.Error, "Error creating AuthnRequest")
+		s.Logger.LogErrorContext(ctx, "Error creating SAML AuthnRequest", logging.Err(err))
+		return "", errors.New("error starting sign-in")
+	}
+
+	span.SetAttributes(attribute.Key("request_id").String(request.ID))
+
+	err = s.SamlRequestRepository.CreateSamlRequest(ctx, &models.SamlRequest{
+		RequestId:  request.ID,
+		LinkUserId: linkUserId,
+		Browser:    browser,
+		ExpiresAt:  time.Now().UTC().Add(s.Conf.Saml.RequestTTL),
+	})
+	if err != nil {
+		span.AddEvent("Failed to store AuthnRequest")
+		span.SetStatus(codes.Error, "Error storing AuthnRequest")
+		s.Logger.LogErrorContext(ctx, "Error storing SAML request", logging.Err(err))
+		return "", errors.New("error starting sign-in")
+	}
+
+	redirectUrl, err := request.Redirect(request.ID, s.ServiceProvider)
+	if err != nil {
+		span.AddEvent("Failed to build redirect")
+		span.SetStatus(codes.Error, "Error building redirect")
+		s.Logger.LogErrorContext(ctx, "Error building SAML redirect", logging.Err(err))
+		return "", errors.New("error starting sign-in")
+	}
+
+	span.SetStatus(codes.Ok, "AuthnRequest created")
+
+	return redirectUrl.String(), nil
+}
+
+// AssertionConsumer verifies the IdP response and either signs the user in or links the identity to the user
+// who started the request
+func (s *samlService) AssertionConsumer(ctx context.Context, samlResponse,
+	relayState string) (*models.ExternalSignInResult, error) {
+	ctx, span := s.Trace.StartSpan(ctx, "service.SamlAssertionConsumer")
+	defer span.End()
+
+	span.SetAttributes(attribute.Key("request_id").String(relayState))
+
+	request, err := s.SamlRequestRepository.ConsumeSamlRequest(ctx, relayState, time.Now().UTC())
+	if err != nil {
+		span.AddEvent("Unknown or expired request")
+		span.SetStatus(codes.Error, "Invalid request")
+		return nil, errors.New("invalid or expired sign-in request")
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(samlResponse)
+	if err != nil {
+		span.AddEvent("Malformed response")
+		span.SetStatus(codes.Error, "Malformed response")
+		return nil, errors.New("malformed SAML response")
+	}
+
+	// checks the signature, issuer, audience, recipient, validity window and InResponseTo
+	assertion, err := s.ServiceProvider.ParseXMLResponse(decoded, []string{request.RequestId})
+	if err != nil {
+		reason := err
+		var invalid *saml.InvalidResponseError
+		if errors.As(err, &invalid) {
+			reason = invalid.PrivateErr
+		}
+		span.AddEvent("Invalid assertion")
+		span.SetStatus(codes.Error, "Invalid assertion")
+		s.Logger.LogErrorContext(ctx, "Invalid SAML response", logging.Err(reason))
+		return nil, errors.New("invalid SAML response")
+	}
+
+	// the library accepts assertions without any audience restriction, we require one naming us
+	if assertion.Conditions == nil || len(assertion.Conditions.AudienceRestrictions) == 0 {
+		span.AddEvent("Assertion has no audience restriction")
+		span.SetStatus(codes.Error, "Invalid assertion")
+		return nil, errors.New("invalid SAML response")
+	}
+
+	if assertion.Subject == nil || assertion.Subject.NameID == nil || assertion.Subject.NameID.Value == "" {
+		span.AddEvent("Assertion has no subject")
+		span.SetStatus(codes.Error, "Invalid assertion")
+		return nil, errors.New("invalid SAML response")
+	}
+
+	external := s.mapAssertion(assertion)
+	if request.LinkUserId != "" {
+		identity, err := s.UserService.LinkExternalUser(ctx, request.LinkUserId, external)
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			return nil, err
+		}
+		span.SetStatus(codes.Ok, "Identity linked")
+		return &models.ExternalSignInResult{Linked: identity, Browser: request.Browser}, nil
+	}
+
+	if external.Email == "" {
+		span.AddEvent("Assertion has no email")
+		span.SetStatus(codes.Error, "Missing email attribute")
+		return nil, errors.New("identity provider did not send an email")
+	}
+
+	token, err := s.UserService.LoginExternalUser(ctx, external, request.Browser)
+	if err != nil {
+		span.AddEvent("Failed to sign in")
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	span.SetStatus(codes.Ok, "Signed in with SAML")
+
+	return &models.ExternalSignInResult{Token: token, Browser: request.Browser}, nil
+}
+
+func (s *samlService) mapAssertion(assertion *saml.Assertion) *models.ExternalUser {
+	values := make(map[string][]string)
+	for _, statement := range assertion.AttributeStatements {
+		for _, attr := range statement.Attributes {
+			for _, value := range attr.Values {
+				values[attr.Name] = append(values[attr.Name], value.Value)
+				if attr.FriendlyName != "" && attr.FriendlyName != attr.Name {
+					values[attr.FriendlyName] = append(values[attr.FriendlyName], value.Value)
+				}
+			}
+		}
+	}
+
+	first := func(name string) string {
+		if len(values[name]) == 0 {
+			return ""
+		}
+		return values[name][0]
+	}
+
+	email := first(s.Conf.Saml.EmailAttribute)
+	if email == "" && assertion.Subject.NameID.Format == string(saml.EmailAddressNameIDFormat) {
+		email = assertion.Subject.NameID.Value
+	}
+
+	// the IdP is configured by the operator, an address it asserts is trusted for provisioning but never for linking
+	return &models.ExternalUser{
+		Provider:      utils.SamlProviderName,
+		Subject:       assertion.Subject.NameID.Value,
+		Email:         email,
+		EmailVerified: email != "",
+		FullName:      first(s.Conf.Saml.NameAttribute),
+		Role:          utils.MapGroupsToRole(s.Conf.Saml.GroupRoles, values[s.Conf.Saml.GroupAttribute]),
+		AutoProvision: true,
+	}
+}
@@ -0,0 +1,12 @@
+package services
+
+import (
+	"context"
+	"github.com/saufiroja/go-otel/auth-service/internal/models"
+)
+
+type SamlService interface {
+	Metadata(ctx context.Context) ([]byte, error)
+	Login(ctx context.Context, linkUserId string, browser bool) (string, error)
+	AssertionConsumer(ctx context.Context, samlResponse, relayState string) (*models.ExternalSignInResult, error)
+}
@@ -0,0 +1,380 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"database/sql"
+	"encoding/pem"
+	"encoding/xml"
+	"github.com/crewjam/saml"
+	"github.com/saufiroja/go-otel/auth-service/config"
+	"github.com/saufiroja/go-otel/auth-service/internal/models"
+	"github.com/saufiroja/go-otel/auth-service/internal/utils"
+	"github.com/saufiroja/go-otel/auth-service/pkg/logging"
+	"math/big"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testSamlRootUrl = "https://auth.example.com"
+
+// fakeSamlRequestRepository keeps pending AuthnRequests in memory, a request can be consumed once
+type fakeSamlRequestRepository struct {
+	requests map[string]*models.SamlRequest
+}
+
+func (f *fakeSamlRequestRepository) CreateSamlRequest(_ context.Context, request *models.SamlRequest) error {
+	f.requests[request.RequestId] = request
+	return nil
+}
+
+func (f *fakeSamlRequestRepository) ConsumeSamlRequest(_ context.Context, requestId string,
+	now time.Time) (*models.SamlRequest, error) {
+	request, ok := f.requests[requestId]
+	if !ok || now.After(request.ExpiresAt) {
+		return nil, sql.ErrNoRows
+	}
+	delete(f.requests, requestId)
+	return request, nil
+}
+
+// fakeExternalUserService records the identities it is asked to sign in or link
+type fakeExternalUserService struct {
+	UserService
+	signedIn []*models.ExternalUser
+	linked   []*models.ExternalUser
+}
+
+func (f *fakeExternalUserService) LoginExternalUser(_ context.Context, external *models.ExternalUser,
+	_ bool) (*models.Token, error) {
+	f.signedIn = append(f.signedIn, external)
+	return &models.Token{AccessToken: "access-token", TokenType: "Bearer"}, nil
+}
+
+func (f *fakeExternalUserService) LinkExternalUser(_ context.Context, userId string,
+	external *models.ExternalUser) (*models.UserIdentity, error) {
+	f.linked = append(f.linked, external)
+	return &models.UserIdentity{IdentityId: "identity-1", UserId: userId, Provider: external.Provider,
+		Subject: external.Subject}, nil
+}
+
+func newSamlKeyPair(t *testing.T, commonName string) (*rsa.PrivateKey, *x509.Certificate) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, certificate
+}
+
+func newTestIdentityProvider(t *testing.T) *saml.IdentityProvider {
+	key, certificate := newSamlKeyPair(t, "idp.example.com")
+	metadataUrl, _ := url.Parse("https://idp.example.com/saml/metadata")
+	ssoUrl, _ := url.Parse("https://idp.example.com/saml/sso")
+	return &saml.IdentityProvider{
+		Key:         key,
+		Certificate: certificate,
+		MetadataURL: *metadataUrl,
+		SSOURL:      *ssoUrl,
+	}
+}
+
+func writeSamlFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// samlFixture is the service under test, the IdP it trusts and the fakes behind it
+type samlFixture struct {
+	service  SamlService
+	sp       *saml.ServiceProvider
+	idp      *saml.IdentityProvider
+	requests *fakeSamlRequestRepository
+	users    *fakeExternalUserService
+}
+
+func newSamlFixture(t *testing.T) *samlFixture {
+	t.Helper()
+	dir := t.TempDir()
+	idp := newTestIdentityProvider(t)
+
+	conf := &config.AppConfig{}
+	conf.Saml.RootUrl = testSamlRootUrl
+	conf.Saml.EntityId = testSamlRootUrl + "/saml/metadata"
+	conf.Saml.CertFile = filepath.Join(dir, "sp.crt")
+	conf.Saml.KeyFile = filepath.Join(dir, "sp.key")
+	conf.Saml.IdpMetadataFile = filepath.Join(dir, "idp-metadata.xml")
+	conf.Saml.EmailAttribute = "eduPersonPrincipalName"
+	conf.Saml.NameAttribute = "cn"
+	conf.Saml.GroupAttribute = "eduPersonAffiliation"
+	conf.Saml.GroupRoles = map[string]string{"admins": models.RoleAdmin}
+	conf.Saml.RequestTTL = 5 * time.Minute
+
+	key, certificate := newSamlKeyPair(t, "auth.example.com")
+	writeSamlFile(t, conf.Saml.CertFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE",
+		Bytes: certificate.Raw}))
+	writeSamlFile(t, conf.Saml.KeyFile, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+	metadata, err := xml.Marshal(idp.Metadata())
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeSamlFile(t, conf.Saml.IdpMetadataFile, metadata)
+
+	logger := logging.NewLogrusAdapter()
+	sp := utils.NewSamlServiceProvider(conf, logger)
+	requests := &fakeSamlRequestRepository{requests: map[string]*models.SamlRequest{}}
+	users := &fakeExternalUserService{}
+
+	return &samlFixture{
+		service:  NewSamlService(sp, requests, users, logger, newTestTracer(), conf),
+		sp:       sp,
+		idp:      idp,
+		requests: requests,
+		users:    users,
+	}
+}
+
+// login starts a sign-in and returns the RelayState the IdP will echo back
+func (f *samlFixture) login(t *testing.T, linkUserId string) string {
+	t.Helper()
+
+	redirectUrl, err := f.service.Login(context.Background(), linkUserId, false)
+	if err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+	parsed, err := url.Parse(redirectUrl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	relayState := parsed.Query().Get("RelayState")
+	if _, ok := f.requests.requests[relayState]; !ok {
+		t.Fatalf("RelayState %q is not a stored request", relayState)
+	}
+	return relayState
+}
+
+// respond builds the base64 SAMLResponse idp sends for requestId, an empty requestId is an IdP initiated login
+func (f *samlFixture) respond(t *testing.T, idp *saml.IdentityProvider, requestId string,
+	edit func(assertion *saml.Assertion)) string {
+	t.Helper()
+
+	metadata := f.sp.Metadata()
+	request := &saml.IdpAuthnRequest{
+		IDP:                     idp,
+		HTTPRequest:             httptest.NewRequest("POST", f.sp.AcsURL.String(), nil),
+		Request:                 saml.AuthnRequest{ID: requestId, IssueInstant: time.Now()},
+		ServiceProviderMetadata: metadata,
+		SPSSODescriptor:         &metadata.SPSSODescriptors[0],
+		ACSEndpoint:             &saml.IndexedEndpoint{Binding: saml.HTTPPostBinding, Location: f.sp.AcsURL.String()},
+		Now:                     time.Now(),
+	}
+	err := saml.DefaultAssertionMaker{}.MakeAssertion(request, &saml.Session{
+		ID:             "session-1",
+		CreateTime:     time.Now(),
+		ExpireTime:     time.Now().Add(time.Hour),
+		Index:          "index-1",
+		NameID:         "jane-1",
+		NameIDFormat:   string(saml.PersistentNameIDFormat),
+		UserEmail:      "jane@example.com",
+		UserCommonName: "Jane Doe",
+		Groups:         []string{"admins"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if edit != nil {
+		edit(request.Assertion)
+	}
+
+	form, err := request.PostBinding()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return form.SAMLResponse
+}
+
+func TestSamlAssertionConsumerSignsIn(t *testing.T) {
+	fixture := newSamlFixture(t)
+	relayState := fixture.login(t, "")
+
+	result, err := fixture.service.AssertionConsumer(context.Background(),
+		fixture.respond(t, fixture.idp, relayState, nil), relayState)
+	if err != nil {
+		t.Fatalf("AssertionConsumer() error = %v", err)
+	}
+	if result.Token == nil || result.Linked != nil {
+		t.Fatalf("result = %+v, want a sign-in", result)
+	}
+
+	if len(fixture.users.signedIn) != 1 {
+		t.Fatalf("signed in %d identities, want 1", len(fixture.users.signedIn))
+	}
+	external := fixture.users.signedIn[0]
+	if external.Provider != utils.SamlProviderName || external.Subject != "jane-1" {
+		t.Errorf("identity = %s %s", external.Provider, external.Subject)
+	}
+	if external.Email != "jane@example.com" || external.FullName != "Jane Doe" || external.Role != models.RoleAdmin {
+		t.Errorf("attributes = %+v", external)
+	}
+}
+
+func TestSamlAssertionConsumerLinks(t *testing.T) {
+	fixture := newSamlFixture(t)
+	relayState := fixture.login(t, "user-1")
+
+	result, err := fixture.service.AssertionConsumer(context.Background(),
+		fixture.respond(t, fixture.idp, relayState, nil), relayState)
+	if err != nil {
+		t.Fatalf("AssertionConsumer() error = %v", err)
+	}
+	if result.Linked == nil || result.Linked.UserId != "user-1" || result.Token != nil {
+		t.Fatalf("result = %+v, want the identity linked to user-1", result)
+	}
+	if len(fixture.users.signedIn) != 0 {
+		t.Errorf("a link request signed in")
+	}
+}
+
+func TestSamlAssertionConsumerRejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		respond func(t *testing.T, fixture *samlFixture) (string, string)
+		wantErr string
+	}{
+		{
+			name: "signed by another IdP key",
+			respond: func(t *testing.T, fixture *samlFixture) (string, string) {
+				relayState := fixture.login(t, "")
+				impostor := newTestIdentityProvider(t)
+				return fixture.respond(t, impostor, relayState, nil), relayState
+			},
+			wantErr: "invalid SAML response",
+		},
+		{
+			name: "replayed response",
+			respond: func(t *testing.T, fixture *samlFixture) (string, string) {
+				relayState := fixture.login(t, "")
+				response := fixture.respond(t, fixture.idp, relayState, nil)
+				if _, err := fixture.service.AssertionConsumer(context.Background(), response,
+					relayState); err != nil {
+					t.Fatalf("first AssertionConsumer() error = %v", err)
+				}
+				return response, relayState
+			},
+			wantErr: "invalid or expired sign-in request",
+		},
+		{
+			name: "unknown RelayState",
+			respond: func(t *testing.T, fixture *samlFixture) (string, string) {
+				relayState := fixture.login(t, "")
+				return fixture.respond(t, fixture.idp, relayState, nil), "id-unknown"
+			},
+			wantErr: "invalid or expired sign-in request",
+		},
+		{
+			name: "expired request",
+			respond: func(t *testing.T, fixture *samlFixture) (string, string) {
+				relayState := fixture.login(t, "")
+				fixture.requests.requests[relayState].ExpiresAt = time.Now().Add(-time.Second)
+				return fixture.respond(t, fixture.idp, relayState, nil), relayState
+			},
+			wantErr: "invalid or expired sign-in request",
+		},
+		{
+			name: "InResponseTo another request",
+			respond: func(t *testing.T, fixture *samlFixture) (string, string) {
+				answered := fixture.login(t, "")
+				relayState := fixture.login(t, "")
+				return fixture.respond(t, fixture.idp, answered, nil), relayState
+			},
+			wantErr: "invalid SAML response",
+		},
+		{
+			name: "unknown InResponseTo",
+			respond: func(t *testing.T, fixture *samlFixture) (string, string) {
+				relayState := fixture.login(t, "")
+				return fixture.respond(t, fixture.idp, "id-unknown", nil), relayState
+			},
+			wantErr: "invalid SAML response",
+		},
+		{
+			name: "missing AudienceRestriction",
+			respond: func(t *testing.T, fixture *samlFixture) (string, string) {
+				relayState := fixture.login(t, "")
+				return fixture.respond(t, fixture.idp, relayState, func(assertion *saml.Assertion) {
+					assertion.Conditions.AudienceRestrictions = nil
+				}), relayState
+			},
+			wantErr: "invalid SAML response",
+		},
+		{
+			name: "audience of another service provider",
+			respond: func(t *testing.T, fixture *samlFixture) (string, string) {
+				relayState := fixture.login(t, "")
+				return fixture.respond(t, fixture.idp, relayState, func(assertion *saml.Assertion) {
+					assertion.Conditions.AudienceRestrictions = []saml.AudienceRestriction{
+						{Audience: saml.Audience{Value: "https://other.example.com/saml/metadata"}},
+					}
+				}), relayState
+			},
+			wantErr: "invalid SAML response",
+		},
+		{
+			name: "IdP initiated",
+			respond: func(t *testing.T, fixture *samlFixture) (string, string) {
+				return fixture.respond(t, fixture.idp, "", nil), ""
+			},
+			wantErr: "invalid or expired sign-in request",
+		},
+		{
+			name: "IdP initiated with a pending RelayState",
+			respond: func(t *testing.T, fixture *samlFixture) (string, string) {
+				relayState := fixture.login(t, "")
+				return fixture.respond(t, fixture.idp, "", nil), relayState
+			},
+			wantErr: "invalid SAML response",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fixture := newSamlFixture(t)
+			response, relayState := tt.respond(t, fixture)
+			signedIn := len(fixture.users.signedIn)
+
+			_, err := fixture.service.AssertionConsumer(context.Background(), response, relayState)
+			if err == nil || err.Error() != tt.wantErr {
+				t.Fatalf("AssertionConsumer() error = %v, want %s", err, tt.wantErr)
+			}
+			if len(fixture.users.signedIn) != signedIn || len(fixture.users.linked) != 0 {
+				t.Errorf("a rejected response signed in or linked an identity")
+			}
+		})
+	}
+}
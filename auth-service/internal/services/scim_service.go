@@ -0,0 +1,961 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/saufiroja/go-otel/auth-service/internal/contracts/requests"
+	"github.com/saufiroja/go-otel/auth-service/internal/models"
+	"github.com/saufiroja/go-otel/auth-service/internal/repositories"
+	"github.com/saufiroja/go-otel/auth-service/internal/utils"
+	"github.com/saufiroja/go-otel/auth-service/pkg/logging"
+	"github.com/saufiroja/go-otel/auth-service/pkg/observability/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// scimMaxLength is the width of the full_name and email columns
+const scimMaxLength = 100
+
+// scimUserState is the mutable part of a SCIM user that PUT and PATCH operate on, Active is nil unless the
+// request set it
+type scimUserState struct {
+	FullName   string
+	Email      string
+	ExternalId string
+	Active     *bool
+}
+
+type scimService struct {
+	ScimRepository repositories.ScimRepository
+	UserRepository repositories.UserRepository
+	Logger         logging.Logger
+	Trace          *tracing.Tracer
+	PasswordHasher utils.PasswordHasher
+	AuditService   AuditService
+}
+
+func NewScimService(scimRepository repositories.ScimRepository, userRepository repositories.UserRepository,
+	logger logging.Logger, trace *tracing.Tracer, passwordHasher utils.PasswordHasher,
+	auditService AuditService) ScimService {
+	return &scimService{
+		ScimRepository: scimRepository,
+		UserRepository: userRepository,
+		Logger:         logger,
+		Trace:          trace,
+		PasswordHasher: passwordHasher,
+		AuditService:   auditService,
+	}
+}
+
+func (s *scimService) GetUser(ctx context.Context, principal *models.Principal,
+	userId string) (*models.ScimUser, error) {
+	ctx, span := s.Trace.StartSpan(ctx, "service.ScimGetUser")
+	defer span.End()
+
+	orgId, err := scimTenant(principal)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	span.SetAttributes(
+		attribute.Key("org_id").String(orgId),
+		attribute.Key("user_id").String(userId),
+	)
+
+	user, err := s.lookupUser(ctx, orgId, userId)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	span.SetStatus(codes.Ok, "Scim user retrieved")
+
+	return user, nil
+}
+
+func (s *scimService) ListUsers(ctx context.Context, principal *models.Principal, filter string,
+	startIndex, count int) ([]*models.ScimUser, int, error) {
+	ctx, span := s.Trace.StartSpan(ctx, "service.ScimListUsers")
+	defer span.End()
+
+	orgId, err := scimTenant(principal)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, 0, err
+	}
+	span.SetAttributes(attribute.Key("org_id").String(orgId))
+
+	userFilter := &models.ScimUserFilter{OrgId: orgId, StartIndex: startIndex, Count: count}
+	if strings.TrimSpace(filter) != "" {
+		userFilter.Filter, err = utils.ParseScimFilter(filter)
+		if err != nil {
+			span.AddEvent("Invalid filter")
+			span.SetStatus(codes.Error, err.Error())
+			return nil, 0, models.NewScimError(http.StatusBadRequest, models.ScimErrorInvalidFilter, err.Error())
+		}
+	}
+
+	users, total, err := s.ScimRepository.GetScimUsers(ctx, userFilter)
+	if errors.Is(err, repositories.ErrUnsupportedScimFilter) {
+		span.AddEvent("Unsupported filter")
+		span.SetStatus(codes.Error, err.Error())
+		return nil, 0, models.NewScimError(http.StatusBadRequest, models.ScimErrorInvalidFilter, err.Error())
+	}
+	if err != nil {
+		span.AddEvent("Failed to get scim users")
+		span.SetStatus(codes.Error, "Error getting scim users")
+		s.Logger.LogErrorContext(ctx, "Error getting scim users", logging.Err(err))
+		return nil, 0, models.NewScimError(http.StatusInternalServerError, "", "error listing users")
+	}
+
+	span.SetAttributes(attribute.Key("total").Int(total))
+	span.SetStatus(codes.Ok, "Scim users retrieved")
+
+	return users, total, nil
+}
+
+func (s *scimService) CreateUser(ctx context.Context, principal *models.Principal,
+	request *requests.ScimUserRequest) (*models.ScimUser, error) {
+	ctx, span := s.Trace.StartSpan(ctx, "service.ScimCreateUser")
+	defer span.End()
+
+	orgId, err := scimTenant(principal)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	span.SetAttributes(attribute.Key("org_id").String(orgId))
+
+	state := scimStateFromRequest(request)
+	if err := validateScimState(state); err != nil {
+		span.AddEvent("Invalid user")
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	if err := s.ensureUnique(ctx, orgId, "", state); err != nil {
+		span.AddEvent("User already exists")
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	// provisioned users sign in through their identity provider, the password only has to be unguessable
+	secret, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		span.SetStatus(codes.Error, "Error generating password")
+		s.Logger.LogErrorContext(ctx, "Error generating password", logging.Err(err))
+		return nil, models.NewScimError(http.StatusInternalServerError, "", "error creating user")
+	}
+	password, err := s.PasswordHasher.Hash(ctx, secret)
+	if err != nil {
+		span.SetStatus(codes.Error, "Error hashing password")
+		s.Logger.LogErrorContext(ctx, "Error hashing password", logging.Err(err))
+		return nil, models.NewScimError(http.StatusInternalServerError, "", "error creating user")
+	}
+
+	status := models.StatusActive
+	if state.Active != nil && !*state.Active {
+		status = models.StatusDisabled
+	}
+
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	user := &models.ScimUser{
+		User: models.User{
+			UserId:    uuid.New().String(),
+			FullName:  state.FullName,
+			Email:     state.Email,
+			Password:  password,
+			Status:    status,
+			Role:      models.RoleUser,
+			CreatedAt: now,
+			UpdatedAt: now,
+		},
+		OrgId:      orgId,
+		ExternalId: state.ExternalId,
+	}
+
+	err = s.ScimRepository.CreateScimUser(ctx, user)
+	if err != nil {
+		span.AddEvent("Failed to create scim user")
+		span.SetStatus(codes.Error, "Error creating scim user")
+		s.Logger.LogErrorContext(ctx, "Error creating scim user", logging.Err(err))
+		return nil, models.NewScimError(http.StatusInternalServerError, "", "error creating user")
+	}
+
+	s.AuditService.Record(ctx, models.AuditScimUserCreate, principal.UserId, user.UserId, map[string]string{
+		"org_id": orgId,
+		"status": status,
+	})
+
+	span.SetAttributes(attribute.Key("user_id").String(user.UserId))
+	span.SetStatus(codes.Ok, "Scim user created")
+
+	return user, nil
+}
+
+func (s *scimService) ReplaceUser(ctx context.Context, principal *models.Principal, userId, ifMatch string,
+	request *requests.ScimUserRequest) (*models.ScimUser, error) {
+	ctx, span := s.Trace.StartSpan(ctx, "service.ScimReplaceUser")
+	defer span.End()
+
+	orgId, err := scimTenant(principal)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	span.SetAttributes(
+		attribute.Key("org_id").String(orgId),
+		attribute.Key("user_id").String(userId),
+	)
+
+	user, err := s.lookupUser(ctx, orgId, userId)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	if err := checkScimVersion(ifMatch, user.Version()); err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	updated, err := s.saveUser(ctx, principal, user, scimStateFromRequest(request))
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	span.SetStatus(codes.Ok, "Scim user replaced")
+
+	return updated, nil
+}
+
+func (s *scimService) PatchUser(ctx context.Context, principal *models.Principal, userId, ifMatch string,
+	request *requests.ScimPatchRequest) (*models.ScimUser, error) {
+	ctx, span := s.Trace.StartSpan(ctx, "service.ScimPatchUser")
+	defer span.End()
+
+	orgId, err := scimTenant(principal)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	span.SetAttributes(
+		attribute.Key("org_id").String(orgId),
+		attribute.Key("user_id").String(userId),
+		attribute.Key("operations").Int(len(request.Operations)),
+	)
+
+	user, err := s.lookupUser(ctx, orgId, userId)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	if err := checkScimVersion(ifMatch, user.Version()); err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	state := &scimUserState{FullName: user.FullName, Email: user.Email, ExternalId: user.ExternalId}
+	for _, operation := range request.Operations {
+		if err := applyScimUserOperation(state, operation); err != nil {
+			span.AddEvent("Invalid patch operation")
+			span.SetStatus(codes.Error, err.Error())
+			return nil, err
+		}
+	}
+
+	updated, err := s.saveUser(ctx, principal, user, state)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	span.SetStatus(codes.Ok, "Scim user patched")
+
+	return updated, nil
+}
+
+func (s *scimService) DeleteUser(ctx context.Context, principal *models.Principal, userId, ifMatch string) error {
+	ctx, span := s.Trace.StartSpan(ctx, "service.ScimDeleteUser")
+	defer span.End()
+
+	orgId, err := scimTenant(principal)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+	span.SetAttributes(
+		attribute.Key("org_id").String(orgId),
+		attribute.Key("user_id").String(userId),
+	)
+
+	user, err := s.lookupUser(ctx, orgId, userId)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+	if err := checkScimVersion(ifMatch, user.Version()); err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	err = s.ScimRepository.DeleteScimUser(ctx, user, principal.UserId, time.Now().UTC())
+	if errors.Is(err, sql.ErrNoRows) {
+		span.AddEvent("Scim user changed concurrently")
+		span.SetStatus(codes.Error, "Scim user changed concurrently")
+		return models.NewScimError(http.StatusPreconditionFailed, "", "user was modified concurrently")
+	}
+	if err != nil {
+		span.AddEvent("Failed to delete scim user")
+		span.SetStatus(codes.Error, "Error deleting scim user")
+		s.Logger.LogErrorContext(ctx, "Error deleting scim user", logging.Err(err))
+		return models.NewScimError(http.StatusInternalServerError, "", "error deleting user")
+	}
+
+	s.AuditService.Record(ctx, models.AuditScimUserDelete, principal.UserId, userId, map[string]string{
+		"org_id": orgId,
+	})
+
+	span.SetStatus(codes.Ok, "Scim user deleted")
+
+	return nil
+}
+
+func (s *scimService) GetGroup(ctx context.Context, principal *models.Principal,
+	groupId string) (*models.ScimGroup, error) {
+	ctx, span := s.Trace.StartSpan(ctx, "service.ScimGetGroup")
+	defer span.End()
+
+	orgId, err := scimTenant(principal)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	span.SetAttributes(
+		attribute.Key("org_id").String(orgId),
+		attribute.Key("group_id").String(groupId),
+	)
+
+	if !isScimGroup(groupId) {
+		span.SetStatus(codes.Error, "Group not found")
+		return nil, models.NewScimError(http.StatusNotFound, "", "group not found")
+	}
+
+	group, err := s.loadGroup(ctx, orgId, groupId)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	span.SetStatus(codes.Ok, "Scim group retrieved")
+
+	return group, nil
+}
+
+func (s *scimService) ListGroups(ctx context.Context, principal *models.Principal,
+	filter string) ([]*models.ScimGroup, error) {
+	ctx, span := s.Trace.StartSpan(ctx, "service.ScimListGroups")
+	defer span.End()
+
+	orgId, err := scimTenant(principal)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	span.SetAttributes(attribute.Key("org_id").String(orgId))
+
+	var parsed *models.ScimFilter
+	if strings.TrimSpace(filter) != "" {
+		parsed, err = utils.ParseScimFilter(filter)
+		if err != nil {
+			span.AddEvent("Invalid filter")
+			span.SetStatus(codes.Error, err.Error())
+			return nil, models.NewScimError(http.StatusBadRequest, models.ScimErrorInvalidFilter, err.Error())
+		}
+	}
+
+	groups := make([]*models.ScimGroup, 0, len(models.ScimGroupRoles))
+	for _, groupId := range models.ScimGroupRoles {
+		if parsed != nil {
+			matched, err := matchScimGroup(parsed, groupId)
+			if err != nil {
+				span.AddEvent("Unsupported filter")
+				span.SetStatus(codes.Error, err.Error())
+				return nil, err
+			}
+			if !matched {
+				continue
+			}
+		}
+		group, err := s.loadGroup(ctx, orgId, groupId)
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+
+	span.SetAttributes(attribute.Key("count").Int(len(groups)))
+	span.SetStatus(codes.Ok, "Scim groups retrieved")
+
+	return groups, nil
+}
+
+// PatchGroup moves users between the role groups, removing a user from the admin group makes them a plain user
+// again and any change granting or revoking admin needs ScopeRolesAdmin
+func (s *scimService) PatchGroup(ctx context.Context, principal *models.Principal, groupId, ifMatch string,
+	request *requests.ScimPatchRequest) (*models.ScimGroup, error) {
+	ctx, span := s.Trace.StartSpan(ctx, "service.ScimPatchGroup")
+	defer span.End()
+
+	orgId, err := scimTenant(principal)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	span.SetAttributes(
+		attribute.Key("org_id").String(orgId),
+		attribute.Key("group_id").String(groupId),
+		attribute.Key("operations").Int(len(request.Operations)),
+	)
+
+	if !isScimGroup(groupId) {
+		span.SetStatus(codes.Error, "Group not found")
+		return nil, models.NewScimError(http.StatusNotFound, "", "group not found")
+	}
+
+	group, err := s.loadGroup(ctx, orgId, groupId)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	if err := checkScimVersion(ifMatch, group.Version()); err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	members := make(map[string]bool, len(group.Members))
+	for _, member := range group.Members {
+		members[member.UserId] = true
+	}
+	for _, operation := range request.Operations {
+		if err := applyScimGroupOperation(members, operation); err != nil {
+			span.AddEvent("Invalid patch operation")
+			span.SetStatus(codes.Error, err.Error())
+			return nil, err
+		}
+	}
+
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	changes := make([]*models.ScimRoleChange, 0)
+	for userId, member := range members {
+		if !member {
+			// the user group is the default, leaving it does not change the role
+			if groupId == models.RoleAdmin {
+				changes = append(changes, &models.ScimRoleChange{UserId: userId, Role: models.RoleUser, UpdatedAt: now})
+			}
+			continue
+		}
+		user, err := s.lookupUser(ctx, orgId, userId)
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			return nil, models.NewScimError(http.StatusBadRequest, models.ScimErrorInvalidValue,
+				fmt.Sprintf("member %s not found", userId))
+		}
+		if user.Role != groupId {
+			changes = append(changes, &models.ScimRoleChange{UserId: userId, Role: groupId, UpdatedAt: now})
+		}
+	}
+
+	if len(changes) == 0 {
+		span.SetStatus(codes.Ok, "Scim group unchanged")
+		return group, nil
+	}
+
+	// with only two roles every membership change grants or revokes admin
+	if !principal.HasScope(models.ScopeRolesAdmin) {
+		span.AddEvent("Missing roles:admin scope")
+		span.SetStatus(codes.Error, "Insufficient scope")
+		return nil, models.NewScimError(http.StatusForbidden, "",
+			fmt.Sprintf("changing admin membership requires the %s scope", models.ScopeRolesAdmin))
+	}
+
+	err = s.ScimRepository.UpdateScimUserRoles(ctx, orgId, changes)
+	if errors.Is(err, sql.ErrNoRows) {
+		span.AddEvent("Member not found")
+		span.SetStatus(codes.Error, "Member not found")
+		return nil, models.NewScimError(http.StatusBadRequest, models.ScimErrorInvalidValue, "member not found")
+	}
+	if err != nil {
+		span.AddEvent("Failed to update roles")
+		span.SetStatus(codes.Error, "Error updating roles")
+		s.Logger.LogErrorContext(ctx, "Error updating scim user roles", logging.Err(err))
+		return nil, models.NewScimError(http.StatusInternalServerError, "", "error updating group")
+	}
+
+	s.AuditService.Record(ctx, models.AuditScimGroupUpdate, principal.UserId, groupId, map[string]string{
+		"org_id":  orgId,
+		"changes": fmt.Sprintf("%d", len(changes)),
+	})
+
+	group, err = s.loadGroup(ctx, orgId, groupId)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	span.SetAttributes(attribute.Key("changes").Int(len(changes)))
+	span.SetStatus(codes.Ok, "Scim group patched")
+
+	return group, nil
+}
+
+// saveUser validates state and writes it over user, the account status only follows an explicit active value
+func (s *scimService) saveUser(ctx context.Context, principal *models.Principal, user *models.ScimUser,
+	state *scimUserState) (*models.ScimUser, error) {
+	if err := validateScimState(state); err != nil {
+		return nil, err
+	}
+	if err := s.ensureUnique(ctx, user.OrgId, user.UserId, state); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	update := &models.ScimUserUpdate{
+		UserId:     user.UserId,
+		OrgId:      user.OrgId,
+		FullName:   state.FullName,
+		Email:      state.Email,
+		ExternalId: state.ExternalId,
+		Version:    user.UpdatedAt,
+		UpdatedAt:  now,
+	}
+
+	toStatus := user.Status
+	if state.Active != nil {
+		switch {
+		// a lockout is a security control of this service, the identity provider cannot lift it
+		case *state.Active && user.Status != models.StatusActive && user.Status != models.StatusLocked:
+			toStatus = models.StatusActive
+		case !*state.Active && user.Status != models.StatusDisabled:
+			toStatus = models.StatusDisabled
+		}
+	}
+	if toStatus != user.Status {
+		if !models.CanTransitionStatus(user.Status, toStatus) {
+			return nil, models.NewScimError(http.StatusBadRequest, models.ScimErrorMutability,
+				fmt.Sprintf("cannot change status from %s to %s", user.Status, toStatus))
+		}
+		update.StatusChange = &models.StatusChange{
+			ChangeId:   uuid.New().String(),
+			UserId:     user.UserId,
+			FromStatus: user.Status,
+			ToStatus:   toStatus,
+			ChangedBy:  principal.UserId,
+			Reason:     "provisioned through scim",
+			ChangedAt:  now,
+		}
+	}
+
+	err := s.ScimRepository.UpdateScimUser(ctx, update)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, models.NewScimError(http.StatusPreconditionFailed, "", "user was modified concurrently")
+	}
+	if err != nil {
+		s.Logger.LogErrorContext(ctx, "Error updating scim user", logging.Err(err))
+		return nil, models.NewScimError(http.StatusInternalServerError, "", "error updating user")
+	}
+
+	metadata := map[string]string{"org_id": user.OrgId}
+	if update.StatusChange != nil {
+		metadata["from_status"] = update.StatusChange.FromStatus
+		metadata["to_status"] = update.StatusChange.ToStatus
+	}
+	s.AuditService.Record(ctx, models.AuditScimUserUpdate, principal.UserId, user.UserId, metadata)
+
+	return s.lookupUser(ctx, user.OrgId, user.UserId)
+}
+
+// ensureUnique rejects a userName or externalId already taken by another user, userId is empty on create
+func (s *scimService) ensureUnique(ctx context.Context, orgId, userId string, state *scimUserState) error {
+	existing, err := s.UserRepository.GetUserByEmail(ctx, state.Email)
+	if err == nil && existing.UserId != userId {
+		return models.NewScimError(http.StatusConflict, models.ScimErrorUniqueness, "userName is already taken")
+	}
+
+	if state.ExternalId == "" {
+		return nil
+	}
+	users, _, err := s.ScimRepository.GetScimUsers(ctx, &models.ScimUserFilter{
+		OrgId:      orgId,
+		Filter:     &models.ScimFilter{Op: "eq", Attribute: "externalid", Value: state.ExternalId},
+		StartIndex: 1,
+		Count:      1,
+	})
+	if err != nil {
+		s.Logger.LogErrorContext(ctx, "Error checking external id", logging.Err(err))
+		return models.NewScimError(http.StatusInternalServerError, "", "error checking externalId")
+	}
+	if len(users) > 0 && users[0].UserId != userId {
+		return models.NewScimError(http.StatusConflict, models.ScimErrorUniqueness, "externalId is already taken")
+	}
+	return nil
+}
+
+func (s *scimService) lookupUser(ctx context.Context, orgId, userId string) (*models.ScimUser, error) {
+	user, err := s.ScimRepository.GetScimUser(ctx, orgId, userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, models.NewScimError(http.StatusNotFound, "", "user not found")
+	}
+	if err != nil {
+		s.Logger.LogErrorContext(ctx, "Error getting scim user", logging.Err(err))
+		return nil, models.NewScimError(http.StatusInternalServerError, "", "error getting user")
+	}
+	return user, nil
+}
+
+func (s *scimService) loadGroup(ctx context.Context, orgId, groupId string) (*models.ScimGroup, error) {
+	members, err := s.ScimRepository.GetScimUsersByRole(ctx, orgId, groupId)
+	if err != nil {
+		s.Logger.LogErrorContext(ctx, "Error getting scim group members", logging.Err(err))
+		return nil, models.NewScimError(http.StatusInternalServerError, "", "error getting group")
+	}
+	return &models.ScimGroup{Id: groupId, Members: members}, nil
+}
+
+// scimTenant returns the org the caller provisions, only api keys of a service account carry one
+func scimTenant(principal *models.Principal) (string, error) {
+	if principal == nil || principal.OrgId == "" {
+		return "", models.NewScimError(http.StatusForbidden, "", "the caller does not belong to an organization")
+	}
+	return principal.OrgId, nil
+}
+
+// checkScimVersion enforces an If-Match precondition, an empty header always matches
+func checkScimVersion(ifMatch, version string) error {
+	ifMatch = strings.TrimSpace(ifMatch)
+	if ifMatch == "" || ifMatch == "*" {
+		return nil
+	}
+	for _, candidate := range strings.Split(ifMatch, ",") {
+		if strings.TrimSpace(candidate) == version {
+			return nil
+		}
+	}
+	return models.NewScimError(http.StatusPreconditionFailed, "", "resource version does not match If-Match")
+}
+
+func isScimGroup(groupId string) bool {
+	for _, role := range models.ScimGroupRoles {
+		if role == groupId {
+			return true
+		}
+	}
+	return false
+}
+
+func scimStateFromRequest(request *requests.ScimUserRequest) *scimUserState {
+	state := &scimUserState{
+		Email:      strings.TrimSpace(request.UserName),
+		ExternalId: strings.TrimSpace(request.ExternalId),
+		Active:     request.Active,
+	}
+	if state.Email == "" {
+		state.Email = primaryScimEmail(request.Emails)
+	}
+
+	switch {
+	case request.Name != nil && strings.TrimSpace(request.Name.Formatted) != "":
+		state.FullName = strings.TrimSpace(request.Name.Formatted)
+	case strings.TrimSpace(request.DisplayName) != "":
+		state.FullName = strings.TrimSpace(request.DisplayName)
+	case request.Name != nil:
+		state.FullName = strings.TrimSpace(request.Name.GivenName + " " + request.Name.FamilyName)
+	}
+	if state.FullName == "" {
+		state.FullName = state.Email
+	}
+	return state
+}
+
+func validateScimState(state *scimUserState) error {
+	if state.Email == "" || !strings.Contains(state.Email, "@") || len(state.Email) > scimMaxLength {
+		return models.NewScimError(http.StatusBadRequest, models.ScimErrorInvalidValue,
+			"userName must be an email address")
+	}
+	if state.FullName == "" || len(state.FullName) > scimMaxLength {
+		return models.NewScimError(http.StatusBadRequest, models.ScimErrorInvalidValue,
+			fmt.Sprintf("name must be between 1 and %d characters", scimMaxLength))
+	}
+	if len(state.ExternalId) > 255 {
+		return models.NewScimError(http.StatusBadRequest, models.ScimErrorInvalidValue, "externalId is too long")
+	}
+	return nil
+}
+
+func primaryScimEmail(emails []requests.ScimEmail) string {
+	for _, email := range emails {
+		if email.Primary {
+			return strings.TrimSpace(email.Value)
+		}
+	}
+	if len(emails) > 0 {
+		return strings.TrimSpace(emails[0].Value)
+	}
+	return ""
+}
+
+// applyScimUserOperation applies one PATCH operation, a pathless add or replace carries an object of attributes
+func applyScimUserOperation(state *scimUserState, operation requests.ScimPatchOperation) error {
+	op := strings.ToLower(operation.Op)
+	if op != "add" && op != "replace" && op != "remove" {
+		return models.NewScimError(http.StatusBadRequest, models.ScimErrorInvalidSyntax,
+			fmt.Sprintf("unknown operation %q", operation.Op))
+	}
+
+	if operation.Path == "" {
+		if op == "remove" {
+			return models.NewScimError(http.StatusBadRequest, models.ScimErrorNoTarget, "remove requires a path")
+		}
+		attributes := map[string]json.RawMessage{}
+		if err := json.Unmarshal(operation.Value, &attributes); err != nil {
+			return models.NewScimError(http.StatusBadRequest, models.ScimErrorInvalidValue,
+				"a patch without a path needs an object value")
+		}
+		for path, value := range attributes {
+			if err := applyScimUserAttribute(state, op, utils.NormalizeScimPath(path), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return applyScimUserAttribute(state, op, utils.NormalizeScimPath(operation.Path), operation.Value)
+}
+
+func applyScimUserAttribute(state *scimUserState, op, path string, value json.RawMessage) error {
+	if op == "remove" {
+		switch path {
+		case "externalid":
+			state.ExternalId = ""
+			return nil
+		case "schemas":
+			return nil
+		}
+		return models.NewScimError(http.StatusBadRequest, models.ScimErrorMutability,
+			fmt.Sprintf("%s cannot be removed", path))
+	}
+
+	switch {
+	case path == "active":
+		active, err := parseScimBool(value)
+		if err != nil {
+			return err
+		}
+		state.Active = &active
+	case path == "username":
+		return decodeScimString(value, &state.Email)
+	case path == "displayname" || path == "name.formatted":
+		return decodeScimString(value, &state.FullName)
+	case path == "externalid":
+		return decodeScimString(value, &state.ExternalId)
+	case path == "name":
+		name := requests.ScimName{}
+		if err := json.Unmarshal(value, &name); err != nil {
+			return models.NewScimError(http.StatusBadRequest, models.ScimErrorInvalidValue, "name must be an object")
+		}
+		if fullName := strings.TrimSpace(name.Formatted); fullName != "" {
+			state.FullName = fullName
+		} else if fullName := strings.TrimSpace(name.GivenName + " " + name.FamilyName); fullName != "" {
+			state.FullName = fullName
+		}
+	case path == "emails":
+		emails := make([]requests.ScimEmail, 0)
+		if err := json.Unmarshal(value, &emails); err != nil {
+			return models.NewScimError(http.StatusBadRequest, models.ScimErrorInvalidValue, "emails must be a list")
+		}
+		if email := primaryScimEmail(emails); email != "" {
+			state.Email = email
+		}
+	case strings.HasPrefix(path, "emails[") && strings.HasSuffix(path, "].value"):
+		// only one email is stored, so any email value path addresses it
+		return decodeScimString(value, &state.Email)
+	case path == "schemas":
+	default:
+		return models.NewScimError(http.StatusBadRequest, models.ScimErrorInvalidPath,
+			fmt.Sprintf("unsupported path %q", path))
+	}
+	return nil
+}
+
+// applyScimGroupOperation updates the membership set, members mapped to false leave the group
+func applyScimGroupOperation(members map[string]bool, operation requests.ScimPatchOperation) error {
+	op := strings.ToLower(operation.Op)
+	path := utils.NormalizeScimPath(operation.Path)
+	value := operation.Value
+
+	if path == "" && op != "remove" {
+		attributes := map[string]json.RawMessage{}
+		if err := json.Unmarshal(operation.Value, &attributes); err != nil {
+			return models.NewScimError(http.StatusBadRequest, models.ScimErrorInvalidValue,
+				"a patch without a path needs an object value")
+		}
+		for key, raw := range attributes {
+			key = utils.NormalizeScimPath(key)
+			if key == "members" {
+				path, value = key, raw
+				continue
+			}
+			if key != "id" && key != "schemas" {
+				return models.NewScimError(http.StatusBadRequest, models.ScimErrorMutability,
+					fmt.Sprintf("%s cannot be changed", key))
+			}
+		}
+		if path == "" {
+			return nil
+		}
+	}
+
+	// members[value eq "<id>"] addresses a single member
+	if strings.HasPrefix(path, "members[") && strings.HasSuffix(path, "]") && op == "remove" {
+		expression := operation.Path[strings.Index(operation.Path, "[")+1 : len(operation.Path)-1]
+		filter, err := utils.ParseScimFilter(expression)
+		if err != nil || filter.Op != "eq" || filter.Attribute != "value" {
+			return models.NewScimError(http.StatusBadRequest, models.ScimErrorInvalidPath,
+				`only members[value eq "<id>"] is supported`)
+		}
+		userId, _ := filter.Value.(string)
+		leaveScimGroup(members, userId)
+		return nil
+	}
+	if path != "members" {
+		return models.NewScimError(http.StatusBadRequest, models.ScimErrorMutability,
+			fmt.Sprintf("%s cannot be changed", path))
+	}
+
+	listed := make([]requests.ScimMember, 0)
+	if len(value) > 0 && string(value) != "null" {
+		if err := json.Unmarshal(value, &listed); err != nil {
+			return models.NewScimError(http.StatusBadRequest, models.ScimErrorInvalidValue, "members must be a list")
+		}
+	}
+
+	switch op {
+	case "add":
+		for _, member := range listed {
+			members[member.Value] = true
+		}
+	case "replace":
+		for userId := range members {
+			members[userId] = false
+		}
+		for _, member := range listed {
+			members[member.Value] = true
+		}
+	case "remove":
+		if len(listed) == 0 {
+			for userId := range members {
+				members[userId] = false
+			}
+		}
+		for _, member := range listed {
+			leaveScimGroup(members, member.Value)
+		}
+	default:
+		return models.NewScimError(http.StatusBadRequest, models.ScimErrorInvalidSyntax,
+			fmt.Sprintf("unknown operation %q", operation.Op))
+	}
+	return nil
+}
+
+// leaveScimGroup removes a current member, removing a user who is not a member changes nothing
+func leaveScimGroup(members map[string]bool, userId string) {
+	if _, ok := members[userId]; ok {
+		members[userId] = false
+	}
+}
+
+// matchScimGroup evaluates a filter against a role group, only id and displayName can be filtered on
+func matchScimGroup(filter *models.ScimFilter, groupId string) (bool, error) {
+	switch filter.Op {
+	case models.ScimFilterAnd, models.ScimFilterOr:
+		left, err := matchScimGroup(filter.Children[0], groupId)
+		if err != nil {
+			return false, err
+		}
+		right, err := matchScimGroup(filter.Children[1], groupId)
+		if err != nil {
+			return false, err
+		}
+		if filter.Op == models.ScimFilterAnd {
+			return left && right, nil
+		}
+		return left || right, nil
+	case models.ScimFilterNot:
+		inner, err := matchScimGroup(filter.Children[0], groupId)
+		return !inner, err
+	}
+
+	if filter.Attribute != "id" && filter.Attribute != "displayname" {
+		return false, models.NewScimError(http.StatusBadRequest, models.ScimErrorInvalidFilter,
+			fmt.Sprintf("groups cannot be filtered by %s", filter.Attribute))
+	}
+	if filter.Op == "pr" {
+		return true, nil
+	}
+	value, ok := filter.Value.(string)
+	if !ok {
+		return false, models.NewScimError(http.StatusBadRequest, models.ScimErrorInvalidFilter,
+			fmt.Sprintf("%s expects a string", filter.Attribute))
+	}
+
+	subject, value := strings.ToLower(groupId), strings.ToLower(value)
+	switch filter.Op {
+	case "eq":
+		return subject == value, nil
+	case "ne":
+		return subject != value, nil
+	case "co":
+		return strings.Contains(subject, value), nil
+	case "sw":
+		return strings.HasPrefix(subject, value), nil
+	case "ew":
+		return strings.HasSuffix(subject, value), nil
+	}
+	return false, models.NewScimError(http.StatusBadRequest, models.ScimErrorInvalidFilter,
+		fmt.Sprintf("groups cannot be filtered with %s", filter.Op))
+}
+
+// parseScimBool also accepts "True" and "False" strings, which some identity providers send for active
+func parseScimBool(value json.RawMessage) (bool, error) {
+	var result bool
+	if err := json.Unmarshal(value, &result); err == nil {
+		return result, nil
+	}
+	var text string
+	if err := json.Unmarshal(value, &text); err == nil {
+		switch strings.ToLower(text) {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+	}
+	return false, models.NewScimError(http.StatusBadRequest, models.ScimErrorInvalidValue, "active must be a boolean")
+}
+
+func decodeScimString(value json.RawMessage, target *string) error {
+	var text string
+	if err := json.Unmarshal(value, &text); err != nil {
+		return models.NewScimError(http.StatusBadRequest, models.ScimErrorInvalidValue, "expected a string value")
+	}
+	*target = strings.TrimSpace(text)
+	return nil
+}
@@ -0,0 +1,25 @@
+package services
+
+import (
+	"context"
+	"github.com/saufiroja/go-otel/auth-service/internal/contracts/requests"
+	"github.com/saufiroja/go-otel/auth-service/internal/models"
+)
+
+// ScimService provisions the users of the caller's org, errors are *models.ScimError
+type ScimService interface {
+	GetUser(ctx context.Context, principal *models.Principal, userId string) (*models.ScimUser, error)
+	ListUsers(ctx context.Context, principal *models.Principal, filter string,
+		startIndex, count int) ([]*models.ScimUser, int, error)
+	CreateUser(ctx context.Context, principal *models.Principal,
+		request *requests.ScimUserRequest) (*models.ScimUser, error)
+	ReplaceUser(ctx context.Context, principal *models.Principal, userId, ifMatch string,
+		request *requests.ScimUserRequest) (*models.ScimUser, error)
+	PatchUser(ctx context.Context, principal *models.Principal, userId, ifMatch string,
+		request *requests.ScimPatchRequest) (*models.ScimUser, error)
+	DeleteUser(ctx context.Context, principal *models.Principal, userId, ifMatch string) error
+	GetGroup(ctx context.Context, principal *models.Principal, groupId string) (*models.ScimGroup, error)
+	ListGroups(ctx context.Context, principal *models.Principal, filter string) ([]*models.ScimGroup, error)
+	PatchGroup(ctx context.Context, principal *models.Principal, groupId, ifMatch string,
+		request *requests.ScimPatchRequest) (*models.ScimGroup, error)
+}
@@ -0,0 +1,105 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/saufiroja/go-otel/auth-service/internal/models"
+	"github.com/saufiroja/go-otel/auth-service/internal/repositories"
+	"github.com/saufiroja/go-otel/auth-service/pkg/logging"
+	"github.com/saufiroja/go-otel/auth-service/pkg/observability/metrics"
+	"github.com/saufiroja/go-otel/auth-service/pkg/observability/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"time"
+)
+
+// activeSessionWindow is the refresh token lifetime, a session unused for longer can no longer be resumed
+const activeSessionWindow = time.Hour * 24 * 7
+
+type sessionService struct {
+	SessionRepository repositories.SessionRepository
+	Logger            logging.Logger
+	Trace             *tracing.Tracer
+	AuditService      AuditService
+}
+
+func NewSessionService(sessionRepository repositories.SessionRepository, logger logging.Logger,
+	trace *tracing.Tracer, meter *metrics.Metric, auditService AuditService) SessionService {
+	s := &sessionService{
+		SessionRepository: sessionRepository,
+		Logger:            logger,
+		Trace:             trace,
+		AuditService:      auditService,
+	}
+
+	_, err := meter.Observe(metrics.ActiveSessions, s.observeActiveSessions)
+	if err != nil {
+		logger.LogError("Error observing active sessions", logging.Err(err))
+	}
+
+	return s
+}
+
+// observeActiveSessions reports the active session count at each metric collection
+func (s *sessionService) observeActiveSessions(ctx context.Context) ([]metrics.Observation, error) {
+	count, err := s.SessionRepository.CountActiveSessions(ctx, time.Now().UTC().Add(-activeSessionWindow))
+	if err != nil {
+		return nil, err
+	}
+	return []metrics.Observation{{Value: float64(count)}}, nil
+}
+
+func (s *sessionService) ListSessions(ctx context.Context, userId, currentSessionId string) ([]*models.Session, error) {
+	ctx, span := s.Trace.StartSpan(ctx, "service.ListSessions")
+	defer span.End()
+
+	span.SetAttributes(attribute.Key("user_id").String(userId))
+
+	sessions, err := s.SessionRepository.GetSessionsByUserId(ctx, userId)
+	if err != nil {
+		span.AddEvent("Failed to get sessions")
+		span.SetStatus(codes.Error, "Error getting sessions")
+		s.Logger.LogErrorContext(ctx, "Error getting sessions", logging.Err(err))
+		return nil, errors.New("error getting sessions")
+	}
+
+	active := make([]*models.Session, 0, len(sessions))
+	for _, session := range sessions {
+		if session.RevokedAt != nil {
+			continue
+		}
+		session.Current = session.SessionId == currentSessionId
+		active = append(active, session)
+	}
+
+	span.SetAttributes(attribute.Key("session.count").Int(len(active)))
+	span.SetStatus(codes.Ok, "Sessions listed")
+
+	return active, nil
+}
+
+func (s *sessionService) RevokeSession(ctx context.Context, userId, sessionId string) error {
+	ctx, span := s.Trace.StartSpan(ctx, "service.RevokeSession")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.Key("user_id").String(userId),
+		attribute.Key("session_id").String(sessionId),
+	)
+
+	err := s.SessionRepository.RevokeSession(ctx, userId, sessionId, time.Now().UTC())
+	if err != nil {
+		span.AddEvent("Failed to revoke session")
+		span.SetStatus(codes.Error, "Error revoking session")
+		s.Logger.LogErrorContext(ctx, "Error revoking session", logging.String("session_id", sessionId), logging.Err(err))
+		return errors.New("session not found")
+	}
+
+	s.AuditService.Record(ctx, models.AuditSessionRevoke, userId, userId,
+		map[string]string{"session_id": sessionId})
+
+	span.AddEvent("Session revoked")
+	span.SetStatus(codes.Ok, "Session revoked")
+
+	return nil
+}
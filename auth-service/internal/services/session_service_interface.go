@@ -0,0 +1,11 @@
+package services
+
+import (
+	"context"
+	"github.com/saufiroja/go-otel/auth-service/internal/models"
+)
+
+type SessionService interface {
+	ListSessions(ctx context.Context, userId, currentSessionId string) ([]*models.Session, error)
+	RevokeSession(ctx context.Context, userId, sessionId string) error
+}
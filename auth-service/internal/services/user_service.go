@@ -10,28 +10,60 @@ import (
 	"github.com/saufiroja/go-otel/auth-service/internal/repositories"
 	"github.com/saufiroja/go-otel/auth-service/internal/utils"
 	"github.com/saufiroja/go-otel/auth-service/pkg/logging"
+	"github.com/saufiroja/go-otel/auth-service/pkg/observability/metrics"
 	"github.com/saufiroja/go-otel/auth-service/pkg/observability/tracing"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"slices"
+	"strings"
 	"time"
 )
 
 type userService struct {
-	UserRepository repositories.UserRepository
-	Logger         logging.Logger
-	GenerateToken  *utils.GenerateToken
-	Trace          *tracing.Tracer
-	PasswordHasher utils.PasswordHasher
+	UserRepository                repositories.UserRepository
+	SessionRepository             repositories.SessionRepository
+	PersonalAccessTokenRepository repositories.PersonalAccessTokenRepository
+	IdentityRepository            repositories.IdentityRepository
+	AuthProviders                 []utils.AuthProvider
+	Logger                        logging.Logger
+	GenerateToken                 *utils.GenerateToken
+	Trace                         *tracing.Tracer
+	Meter                         *metrics.Metric
+	PasswordHasher                utils.PasswordHasher
+	AuditService                  AuditService
 }
 
-func NewUserService(userRepository repositories.UserRepository, logger logging.Logger,
-	generateToken *utils.GenerateToken, trace *tracing.Tracer, passwordHasher utils.PasswordHasher) UserService {
+// the login errors are compared to label the login attempt metric, their text is what clients see
+var (
+	errEmailNotFound    = errors.New("email not found")
+	errPasswordMismatch = errors.New("password mismatch")
+	errAccountPending   = errors.New("account pending activation")
+	errAccountLocked    = errors.New("account locked")
+	errAccountDisabled  = errors.New("account disabled")
+	errAccountNotFound  = errors.New("account not found")
+	// errExternalAccountExists refuses an external sign-in whose email belongs to an account it is not linked to
+	errExternalAccountExists = errors.New(
+		"an account with this email already exists, sign in and link the provider instead")
+)
+
+func NewUserService(userRepository repositories.UserRepository, sessionRepository repositories.SessionRepository,
+	personalAccessTokenRepository repositories.PersonalAccessTokenRepository,
+	identityRepository repositories.IdentityRepository, authProviders []utils.AuthProvider, logger logging.Logger,
+	generateToken *utils.GenerateToken, trace *tracing.Tracer, meter *metrics.Metric,
+	passwordHasher utils.PasswordHasher, auditService AuditService) UserService {
 	return &userService{
-		UserRepository: userRepository,
-		Logger:         logger,
-		GenerateToken:  generateToken,
-		Trace:          trace,
-		PasswordHasher: passwordHasher,
+		UserRepository:                userRepository,
+		SessionRepository:             sessionRepository,
+		PersonalAccessTokenRepository: personalAccessTokenRepository,
+		IdentityRepository:            identityRepository,
+		AuthProviders:                 authProviders,
+		Logger:                        logger,
+		GenerateToken:                 generateToken,
+		Trace:                         trace,
+		Meter:                         meter,
+		PasswordHasher:                passwordHasher,
+		AuditService:                  auditService,
 	}
 }
 
@@ -39,8 +71,7 @@ func (u *userService) RegisterUser(ctx context.Context, request *requests.Regist
 	ctx, span := u.Trace.StartSpan(ctx, "service.RegisterUser")
 	defer span.End()
 
-	u.Logger.LogInfo(fmt.Sprintf(
-		"Registering user with email %s, full name %s", request.Email, request.FullName))
+	u.Logger.LogInfoContext(ctx, "Registering user")
 
 	// Check if user already exists
 	_, err := u.UserRepository.GetUserByEmail(ctx, request.Email)
@@ -48,14 +79,14 @@ func (u *userService) RegisterUser(ctx context.Context, request *requests.Regist
 		span.SetAttributes(attribute.Key("error.email").String(request.Email))
 		span.AddEvent("User already exists")
 		span.SetStatus(codes.Error, "User already exists")
-		u.Logger.LogError(fmt.Sprintf("User with email: %s already exists", request.Email))
+		u.Logger.LogErrorContext(ctx, "User already exists")
+		u.recordRegistration(ctx, models.RegistrationOutcomeAlreadyExists)
 		return errors.New("user already exists")
 	}
 
 	span.SetAttributes(
 		attribute.Key("email").String(request.Email),
 		attribute.Key("full_name").String(request.FullName),
-		attribute.Key("password").String(request.Password),
 	)
 
 	// hash password
@@ -63,7 +94,8 @@ func (u *userService) RegisterUser(ctx context.Context, request *requests.Regist
 	if err != nil {
 		span.AddEvent("Failed to hash password")
 		span.SetStatus(codes.Error, "Error hashing password")
-		u.Logger.LogError(fmt.Sprintf("Error hashing password: %v", err))
+		u.Logger.LogErrorContext(ctx, "Error hashing password", logging.Err(err))
+		u.recordRegistration(ctx, models.RegistrationOutcomeError)
 		return errors.New("error hashing password")
 	}
 
@@ -73,6 +105,8 @@ func (u *userService) RegisterUser(ctx context.Context, request *requests.Regist
 		FullName:  request.FullName,
 		Email:     request.Email,
 		Password:  password,
+		Status:    models.StatusActive,
+		Role:      models.RoleUser,
 		CreatedAt: time.Now().UTC(),
 		UpdatedAt: time.Now().UTC(),
 	}
@@ -81,10 +115,14 @@ func (u *userService) RegisterUser(ctx context.Context, request *requests.Regist
 	if err != nil {
 		span.AddEvent("Failed to create user")
 		span.SetStatus(codes.Error, "Error creating user")
-		u.Logger.LogError(fmt.Sprintf("Error creating user: %v", err))
+		u.Logger.LogErrorContext(ctx, "Error creating user", logging.Err(err))
+		u.recordRegistration(ctx, models.RegistrationOutcomeError)
 		return errors.New("error creating user")
 	}
 
+	u.AuditService.Record(ctx, models.AuditUserRegister, userModel.UserId, userModel.UserId, nil)
+	u.recordRegistration(ctx, models.RegistrationOutcomeSuccess)
+
 	span.AddEvent("User created successfully")
 	span.SetStatus(codes.Ok, "User created successfully")
 
@@ -95,15 +133,93 @@ func (u *userService) LoginUser(ctx context.Context, request *requests.LoginRequ
 	ctx, span := u.Trace.StartSpan(ctx, "service.LoginUser")
 	defer span.End()
 
-	u.Logger.LogInfo(fmt.Sprintf("login user with email %s", request.Email))
+	u.Logger.LogInfoContext(ctx, "login user")
 
-	user, err := u.UserRepository.GetUserByEmail(ctx, request.Email)
+	token, method, err := u.login(ctx, span, request)
+	u.recordLoginAttempt(ctx, method, err)
+
+	return token, err
+}
+
+func (u *userService) login(ctx context.Context, span trace.Span,
+	request *requests.LoginRequest) (*models.Token, string, error) {
+	user, method, err := u.authenticateWithProviders(ctx, span, request)
 	if err != nil {
+		return nil, method, err
+	}
+	if user == nil {
+		method = "password"
+		user, err = u.authenticateLocally(ctx, span, request)
+		if err != nil {
+			return nil, method, err
+		}
+	}
+
+	// status is checked after the password so the account state is not disclosed to guessers
+	err = checkAccountStatus(user.Status)
+	if err != nil {
+		span.SetAttributes(attribute.Key("status").String(user.Status))
+		span.AddEvent("Account not active")
+		span.SetStatus(codes.Error, err.Error())
+		u.Logger.LogErrorContext(ctx, "Login rejected", logging.String("user_id", user.UserId), logging.Err(err))
+		u.AuditService.Record(ctx, models.AuditUserLoginFailure, user.UserId, user.UserId,
+			map[string]string{"reason": "account_" + user.Status})
+		return nil, method, err
+	}
+
+	token, err := u.startSession(ctx, span, user, request.DeviceName, method, request.Browser)
+	return token, method, err
+}
+
+// authenticateWithProviders consults the external providers in order, it returns no user when none knows the login
+func (u *userService) authenticateWithProviders(ctx context.Context, span trace.Span,
+	request *requests.LoginRequest) (*models.User, string, error) {
+	for _, provider := range u.AuthProviders {
+		external, err := provider.Authenticate(ctx, request.Email, request.Password)
+		if errors.Is(err, utils.ErrUnknownUser) {
+			continue
+		}
+		if errors.Is(err, utils.ErrInvalidCredentials) {
+			// a local account the directory is not linked to signs in with its own password, which is how its
+			// owner gets a session to link the directory from, the local check refuses accounts that are linked
+			if _, err := u.UserRepository.GetUserByEmail(ctx, request.Email); err == nil {
+				continue
+			}
+			span.AddEvent("password mismatch", trace.WithAttributes(attribute.Key("provider").String(provider.Name())))
+			span.SetStatus(codes.Error, "Password mismatch")
+			u.AuditService.Record(ctx, models.AuditUserLoginFailure, "", "",
+				map[string]string{"reason": "bad_password", "method": provider.Name()})
+			return nil, provider.Name(), errPasswordMismatch
+		}
+		if err != nil {
+			// users linked to this provider are refused by the local check, so skipping it cannot bypass it
+			span.AddEvent("Authentication provider unavailable",
+				trace.WithAttributes(attribute.Key("provider").String(provider.Name())))
+			u.Logger.LogErrorContext(ctx, "Authentication provider failed", logging.String("provider", provider.Name()),
+				logging.Err(err))
+			continue
+		}
+
+		user, err := u.ResolveExternalUser(ctx, external)
+		if err != nil {
+			return nil, provider.Name(), err
+		}
+		return user, provider.Name(), nil
+	}
+	return nil, "", nil
+}
+
+func (u *userService) authenticateLocally(ctx context.Context, span trace.Span,
+	request *requests.LoginRequest) (*models.User, error) {
+	user, err := u.UserRepository.GetUserByEmail(ctx, request.Email)
+	if err != nil || user.Status == models.StatusDeleted {
 		span.SetAttributes(attribute.Key("error.email").String(request.Email))
 		span.AddEvent("Failed to get user by email")
 		span.SetStatus(codes.Error, "Error getting user by email")
-		u.Logger.LogError(fmt.Sprintf("Error getting user by email: %v", err))
-		return nil, errors.New("email not found")
+		u.Logger.LogErrorContext(ctx, "Error getting user by email", logging.Err(err))
+		u.AuditService.Record(ctx, models.AuditUserLoginFailure, "", "",
+			map[string]string{"reason": "unknown_email"})
+		return nil, errEmailNotFound
 	}
 
 	span.SetAttributes(attribute.Key("email").String(user.Email))
@@ -114,39 +230,773 @@ func (u *userService) LoginUser(ctx context.Context, request *requests.LoginRequ
 	if err != nil {
 		span.AddEvent("password mismatch")
 		span.SetStatus(codes.Error, "Password mismatch")
-		u.Logger.LogError(fmt.Sprintf("password mismatch: %v", err))
-		return nil, errors.New("password mismatch")
+		u.Logger.LogErrorContext(ctx, "password mismatch", logging.Err(err))
+		u.AuditService.Record(ctx, models.AuditUserLoginFailure, user.UserId, user.UserId,
+			map[string]string{"reason": "bad_password"})
+		return nil, errPasswordMismatch
+	}
+
+	// a stale local password must not outlive the directory account it was linked to
+	identities, err := u.IdentityRepository.GetIdentitiesByUserId(ctx, user.UserId)
+	if err != nil {
+		span.AddEvent("Failed to get identities")
+		span.SetStatus(codes.Error, "Error getting identities")
+		u.Logger.LogErrorContext(ctx, "Error getting identities", logging.Err(err))
+		return nil, errors.New("error logging in")
+	}
+	for _, identity := range identities {
+		for _, provider := range u.AuthProviders {
+			if identity.Provider == provider.Name() {
+				span.AddEvent("Local password disabled by external provider")
+				span.SetStatus(codes.Error, "Password mismatch")
+				u.AuditService.Record(ctx, models.AuditUserLoginFailure, user.UserId, user.UserId,
+					map[string]string{"reason": "external_authority", "method": provider.Name()})
+				return nil, errPasswordMismatch
+			}
+		}
+	}
+
+	return user, nil
+}
+
+// ResolveExternalUser finds the user an external identity is linked to, provisioning one on first login when allowed.
+// An identity is never linked to an existing account by email, an address asserted by a provider does not prove
+// control of the local account, its owner links the provider while signed in instead
+func (u *userService) ResolveExternalUser(ctx context.Context, external *models.ExternalUser) (*models.User, error) {
+	ctx, span := u.Trace.StartSpan(ctx, "service.ResolveExternalUser")
+	defer span.End()
+
+	span.SetAttributes(attribute.Key("provider").String(external.Provider))
+
+	identity, err := u.IdentityRepository.GetIdentity(ctx, external.Provider, external.Subject)
+	if err == nil {
+		span.SetAttributes(attribute.Key("user_id").String(identity.UserId))
+		user, err := u.UserRepository.GetUserById(ctx, identity.UserId)
+		if err != nil {
+			span.AddEvent("Failed to get user by id")
+			span.SetStatus(codes.Error, "Error getting user by id")
+			u.Logger.LogErrorContext(ctx, "Error getting user by id", logging.Err(err))
+			return nil, errors.New("error logging in")
+		}
+		if err := u.IdentityRepository.TouchIdentity(ctx, identity.IdentityId, time.Now().UTC()); err != nil {
+			u.Logger.LogErrorContext(ctx, "Error recording identity login", logging.Err(err))
+		}
+		u.syncRole(ctx, span, user, external)
+		span.SetStatus(codes.Ok, "Identity resolved")
+		return user, nil
+	}
+
+	if _, err := u.UserRepository.GetUserByEmail(ctx, external.Email); external.Email != "" && err == nil {
+		span.AddEvent("Email belongs to an existing account")
+		span.SetStatus(codes.Error, "Account exists")
+		return nil, errExternalAccountExists
+	}
+
+	// an unverified email would let anyone claim an address at the provider and squat it locally
+	if external.Email == "" || !external.EmailVerified {
+		span.AddEvent("Email missing or unverified")
+		span.SetStatus(codes.Error, "Email not verified")
+		return nil, errors.New("provider did not return a verified email")
+	}
+
+	if !external.AutoProvision {
+		span.AddEvent("Auto provisioning disabled")
+		span.SetStatus(codes.Error, "Auto provisioning disabled")
+		return nil, errors.New("no account is linked to this identity")
+	}
+
+	user, err := u.provisionExternalUser(ctx, span, external)
+	if err != nil {
+		return nil, err
+	}
+
+	span.SetStatus(codes.Ok, "User provisioned")
+
+	return user, nil
+}
+
+func (u *userService) provisionExternalUser(ctx context.Context, span trace.Span,
+	external *models.ExternalUser) (*models.User, error) {
+	// provisioned users sign in through the provider, the random password is never disclosed
+	secret, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		span.SetStatus(codes.Error, "Error generating password")
+		u.Logger.LogErrorContext(ctx, "Error generating password", logging.Err(err))
+		return nil, errors.New("error creating user")
+	}
+	password, err := u.PasswordHasher.Hash(ctx, secret)
+	if err != nil {
+		span.SetStatus(codes.Error, "Error hashing password")
+		u.Logger.LogErrorContext(ctx, "Error hashing password", logging.Err(err))
+		return nil, errors.New("error creating user")
+	}
+
+	fullName := strings.TrimSpace(external.FullName)
+	if fullName == "" {
+		fullName, _, _ = strings.Cut(external.Email, "@")
+	}
+	role := external.Role
+	if role == "" {
+		role = models.RoleUser
+	}
+
+	now := time.Now().UTC()
+	user := &models.User{
+		UserId:    uuid.New().String(),
+		FullName:  fullName,
+		Email:     external.Email,
+		Password:  password,
+		Status:    models.StatusActive,
+		Role:      role,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	err = u.UserRepository.CreateUser(ctx, user)
+	if err != nil {
+		span.AddEvent("Failed to create user")
+		span.SetStatus(codes.Error, "Error creating user")
+		u.Logger.LogErrorContext(ctx, "Error creating user", logging.Err(err))
+		return nil, errors.New("error creating user")
+	}
+
+	identity := &models.UserIdentity{
+		IdentityId:  uuid.New().String(),
+		UserId:      user.UserId,
+		Provider:    external.Provider,
+		Subject:     external.Subject,
+		Email:       external.Email,
+		Provisioned: true,
+		CreatedAt:   now,
+		LastLoginAt: &now,
+	}
+	err = u.IdentityRepository.CreateIdentity(ctx, identity)
+	if err != nil {
+		span.AddEvent("Failed to create identity")
+		span.SetStatus(codes.Error, "Error creating identity")
+		u.Logger.LogErrorContext(ctx, "Error creating identity", logging.Err(err))
+		return nil, errors.New("error creating user")
+	}
+
+	u.AuditService.Record(ctx, models.AuditUserRegister, user.UserId, user.UserId,
+		map[string]string{"provider": external.Provider})
+	u.AuditService.Record(ctx, models.AuditUserIdentityLink, user.UserId, user.UserId,
+		map[string]string{"identity_id": identity.IdentityId, "provider": external.Provider})
+
+	span.SetAttributes(attribute.Key("user_id").String(user.UserId))
+	span.AddEvent("User provisioned")
+
+	return user, nil
+}
+
+// LinkExternalUser links an external identity to userId, the caller has authenticated userId in this request
+func (u *userService) LinkExternalUser(ctx context.Context, userId string,
+	external *models.ExternalUser) (*models.UserIdentity, error) {
+	ctx, span := u.Trace.StartSpan(ctx, "service.LinkExternalUser")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.Key("user_id").String(userId),
+		attribute.Key("provider").String(external.Provider),
+	)
+
+	if existing, err := u.IdentityRepository.GetIdentity(ctx, external.Provider, external.Subject); err == nil {
+		if existing.UserId == userId {
+			span.SetStatus(codes.Ok, "Identity already linked")
+			return existing, nil
+		}
+		span.AddEvent("Identity linked to another account")
+		span.SetStatus(codes.Error, "Identity already linked")
+		return nil, errors.New("this identity is already linked to another account")
+	}
+
+	identity := &models.UserIdentity{
+		IdentityId: uuid.New().String(),
+		UserId:     userId,
+		Provider:   external.Provider,
+		Subject:    external.Subject,
+		Email:      external.Email,
+		CreatedAt:  time.Now().UTC(),
+	}
+	err := u.IdentityRepository.CreateIdentity(ctx, identity)
+	if err != nil {
+		span.AddEvent("Failed to create identity")
+		span.SetStatus(codes.Error, "Error creating identity")
+		u.Logger.LogErrorContext(ctx, "Error creating identity", logging.Err(err))
+		return nil, errors.New("error linking identity")
+	}
+
+	u.AuditService.Record(ctx, models.AuditUserIdentityLink, userId, userId,
+		map[string]string{"identity_id": identity.IdentityId, "provider": external.Provider})
+
+	span.SetStatus(codes.Ok, "Identity linked")
+
+	return identity, nil
+}
+
+// LinkDirectoryIdentity links the directory account of username to userId after binding with its password
+func (u *userService) LinkDirectoryIdentity(ctx context.Context, userId, providerName string,
+	request *requests.LinkDirectoryRequest) (*models.UserIdentity, error) {
+	ctx, span := u.Trace.StartSpan(ctx, "service.LinkDirectoryIdentity")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.Key("user_id").String(userId),
+		attribute.Key("provider").String(providerName),
+	)
+
+	for _, provider := range u.AuthProviders {
+		if provider.Name() != providerName {
+			continue
+		}
+
+		external, err := provider.Authenticate(ctx, request.Username, request.Password)
+		if err != nil {
+			span.AddEvent("Directory authentication failed")
+			span.SetStatus(codes.Error, "Directory authentication failed")
+			if errors.Is(err, utils.ErrUnknownUser) || errors.Is(err, utils.ErrInvalidCredentials) {
+				return nil, errors.New("invalid directory credentials")
+			}
+			u.Logger.LogErrorContext(ctx, "Authentication provider failed", logging.String("provider", providerName),
+				logging.Err(err))
+			return nil, errors.New("directory unavailable")
+		}
+
+		identity, err := u.LinkExternalUser(ctx, userId, external)
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			return nil, err
+		}
+
+		span.SetStatus(codes.Ok, "Directory identity linked")
+		return identity, nil
+	}
+
+	span.AddEvent("Unknown provider")
+	span.SetStatus(codes.Error, "Unknown provider")
+	return nil, fmt.Errorf("unknown provider %s", providerName)
+}
+
+// syncRole applies the role the provider maps the user to, the directory stays the authority on group membership
+func (u *userService) syncRole(ctx context.Context, span trace.Span, user *models.User, external *models.ExternalUser) {
+	if external.Role == "" || external.Role == user.Role {
+		return
+	}
+
+	err := u.UserRepository.UpdateUserRole(ctx, user.UserId, external.Role, time.Now().UTC())
+	if err != nil {
+		span.AddEvent("Failed to sync role")
+		u.Logger.LogErrorContext(ctx, "Error syncing role", logging.String("user_id", user.UserId), logging.Err(err))
+		return
+	}
+
+	u.AuditService.Record(ctx, models.AuditUserRoleSync, "system:"+external.Provider, user.UserId,
+		map[string]string{"from_role": user.Role, "to_role": external.Role})
+	user.Role = external.Role
+}
+
+// StartSession signs in a user already authenticated by an external provider, method is recorded in the audit log
+func (u *userService) StartSession(ctx context.Context, user *models.User, method string,
+	browser bool) (*models.Token, error) {
+	ctx, span := u.Trace.StartSpan(ctx, "service.StartSession")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.Key("user_id").String(user.UserId),
+		attribute.Key("auth.method").String(method),
+	)
+
+	err := checkAccountStatus(user.Status)
+	if err != nil {
+		span.SetAttributes(attribute.Key("status").String(user.Status))
+		span.AddEvent("Account not active")
+		span.SetStatus(codes.Error, err.Error())
+		u.AuditService.Record(ctx, models.AuditUserLoginFailure, user.UserId, user.UserId,
+			map[string]string{"reason": "account_" + user.Status, "method": method})
+		u.recordLoginAttempt(ctx, method, err)
+		return nil, err
+	}
+
+	token, err := u.startSession(ctx, span, user, "", method, browser)
+	u.recordLoginAttempt(ctx, method, err)
+
+	return token, err
+}
+
+// LoginExternalUser signs in a user asserted by an external identity provider, provisioning them on first login
+func (u *userService) LoginExternalUser(ctx context.Context, external *models.ExternalUser,
+	browser bool) (*models.Token, error) {
+	ctx, span := u.Trace.StartSpan(ctx, "service.LoginExternalUser")
+	defer span.End()
+
+	span.SetAttributes(attribute.Key("provider").String(external.Provider))
+
+	user, err := u.ResolveExternalUser(ctx, external)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		u.recordLoginAttempt(ctx, external.Provider, err)
+		return nil, err
+	}
+
+	span.SetAttributes(attribute.Key("user_id").String(user.UserId))
+
+	return u.StartSession(ctx, user, external.Provider, browser)
+}
+
+func (u *userService) startSession(ctx context.Context, span trace.Span, user *models.User, deviceName,
+	method string, browser bool) (*models.Token, error) {
+	meta := utils.RequestMetaFromContext(ctx)
+	deviceName = strings.TrimSpace(deviceName)
+	if deviceName == "" {
+		deviceName = meta.UserAgent
+	}
+	// both the client supplied name and the user agent are unbounded, a long one must not fail the login
+	deviceName = utils.TruncateRunes(deviceName, models.MaxDeviceNameLength)
+
+	now := time.Now().UTC()
+	session := &models.Session{
+		SessionId:      uuid.New().String(),
+		UserId:         user.UserId,
+		RefreshTokenId: uuid.New().String(),
+		DeviceName:     deviceName,
+		UserAgent:      meta.UserAgent,
+		Ip:             meta.Ip,
+		CreatedAt:      now,
+		LastUsedAt:     now,
+	}
+
+	err := u.SessionRepository.CreateSession(ctx, session)
+	if err != nil {
+		span.AddEvent("Failed to create session")
+		span.SetStatus(codes.Error, "Error creating session")
+		u.Logger.LogErrorContext(ctx, "Error creating session", logging.Err(err))
+		return nil, errors.New("error creating session")
+	}
+
+	span.SetAttributes(attribute.Key("session_id").String(session.SessionId))
+
+	res, err := u.issueTokens(ctx, span, user, session, browser)
+	if err != nil {
+		return nil, err
+	}
+
+	u.AuditService.Record(ctx, models.AuditUserLoginSuccess, user.UserId, user.UserId,
+		map[string]string{"session_id": session.SessionId, "method": method})
+
+	return res, nil
+}
+
+func (u *userService) RefreshToken(ctx context.Context, request *requests.RefreshTokenRequest) (*models.Token, error) {
+	ctx, span := u.Trace.StartSpan(ctx, "service.RefreshToken")
+	defer span.End()
+
+	claims, err := u.GenerateToken.VerifyToken(ctx, request.RefreshToken, utils.RefreshTokenType)
+	if err != nil {
+		span.AddEvent("Invalid refresh token")
+		span.SetStatus(codes.Error, "Invalid refresh token")
+		u.Logger.LogErrorContext(ctx, "Invalid refresh token", logging.Err(err))
+		return nil, errors.New("invalid refresh token")
+	}
+
+	err = checkConfirmation(ctx, claims.Confirmation, false)
+	if err != nil {
+		span.AddEvent("Refresh token presented without its key")
+		span.SetStatus(codes.Error, err.Error())
+		return nil, errors.New("invalid refresh token")
+	}
+
+	span.SetAttributes(attribute.Key("user_id").String(claims.UserId))
+
+	user, err := u.UserRepository.GetUserById(ctx, claims.UserId)
+	if err != nil {
+		span.AddEvent("Failed to get user by id")
+		span.SetStatus(codes.Error, "Error getting user by id")
+		u.Logger.LogErrorContext(ctx, "Error getting user by id", logging.Err(err))
+		return nil, errors.New("invalid refresh token")
+	}
+
+	err = checkAccountStatus(user.Status)
+	if err != nil {
+		span.SetAttributes(attribute.Key("status").String(user.Status))
+		span.AddEvent("Account not active")
+		span.SetStatus(codes.Error, err.Error())
+		u.Logger.LogErrorContext(ctx, "Token refresh rejected", logging.String("user_id", user.UserId), logging.Err(err))
+		return nil, err
+	}
+
+	span.SetAttributes(attribute.Key("session_id").String(claims.SessionId))
+
+	session, err := u.SessionRepository.GetSessionById(ctx, claims.SessionId)
+	if err != nil || session.UserId != user.UserId || session.RevokedAt != nil {
+		span.AddEvent("Session not found or revoked")
+		span.SetStatus(codes.Error, "Session revoked")
+		return nil, errors.New("session revoked")
+	}
+
+	// a refresh token that is no longer current has been used before, treat the family as compromised
+	if session.RefreshTokenId != claims.TokenId {
+		span.AddEvent("Refresh token reuse detected")
+		span.SetStatus(codes.Error, "Refresh token reuse detected")
+		u.Logger.LogWarnContext(ctx, "Refresh token reuse detected, revoking",
+			logging.String("session_id", session.SessionId))
+		_ = u.SessionRepository.RevokeSession(ctx, user.UserId, session.SessionId, time.Now().UTC())
+		u.AuditService.Record(ctx, models.AuditSessionReuse, user.UserId, user.UserId,
+			map[string]string{"session_id": session.SessionId})
+		return nil, errors.New("session revoked")
+	}
+
+	meta := utils.RequestMetaFromContext(ctx)
+	session.RefreshTokenId = uuid.New().String()
+	session.UserAgent = meta.UserAgent
+	session.Ip = meta.Ip
+	session.LastUsedAt = time.Now().UTC()
+
+	err = u.SessionRepository.RotateSession(ctx, session, claims.TokenId)
+	if err != nil {
+		span.AddEvent("Failed to rotate session")
+		span.SetStatus(codes.Error, "Error rotating session")
+		u.Logger.LogErrorContext(ctx, "Error rotating session", logging.String("session_id", session.SessionId),
+			logging.Err(err))
+		return nil, errors.New("session revoked")
+	}
+
+	return u.issueTokens(ctx, span, user, session, request.Browser)
+}
+
+func (u *userService) VerifyAccessToken(ctx context.Context, accessToken string) (*models.Principal, error) {
+	ctx, span := u.Trace.StartSpan(ctx, "service.VerifyAccessToken")
+	defer span.End()
+
+	if strings.HasPrefix(accessToken, models.PersonalAccessTokenPrefix) {
+		return u.verifyPersonalAccessToken(ctx, span, accessToken)
+	}
+
+	claims, err := u.GenerateToken.VerifyToken(ctx, accessToken, utils.AccessTokenType)
+	if err != nil {
+		span.AddEvent("Invalid access token")
+		span.SetStatus(codes.Error, "Invalid access token")
+		return nil, errors.New("invalid access token")
+	}
+
+	return u.verifyClaims(ctx, span, claims, true)
+}
+
+// VerifySubjectToken checks the subject_token of a token exchange, it accepts access tokens and the tokens of
+// earlier exchanges so a chain of services can narrow a token further
+func (u *userService) VerifySubjectToken(ctx context.Context,
+	subjectToken string) (*models.Principal, *models.TokenClaims, error) {
+	ctx, span := u.Trace.StartSpan(ctx, "service.VerifySubjectToken")
+	defer span.End()
+
+	claims, err := u.GenerateToken.VerifyToken(ctx, subjectToken, utils.AccessTokenType, utils.ExchangedTokenType)
+	if err != nil {
+		span.AddEvent("Invalid subject token")
+		span.SetStatus(codes.Error, "Invalid subject token")
+		return nil, nil, errors.New("invalid subject token")
+	}
+
+	principal, err := u.verifyClaims(ctx, span, claims, false)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return principal, claims, nil
+}
+
+// verifyClaims checks the account and session behind verified token claims, strictBinding is set for resource
+// requests, see checkConfirmation
+func (u *userService) verifyClaims(ctx context.Context, span trace.Span, claims *models.TokenClaims,
+	strictBinding bool) (*models.Principal, error) {
+	span.SetAttributes(attribute.Key("user_id").String(claims.UserId))
+
+	err := checkConfirmation(ctx, claims.Confirmation, strictBinding)
+	if err != nil {
+		span.AddEvent("Token presented without its key")
+		span.SetStatus(codes.Error, err.Error())
+		return nil, errors.New("invalid access token")
+	}
+
+	// the account is looked up on every request so disabling a user revokes their outstanding tokens
+	user, err := u.UserRepository.GetUserById(ctx, claims.UserId)
+	if err != nil {
+		span.AddEvent("Failed to get user by id")
+		span.SetStatus(codes.Error, "Error getting user by id")
+		return nil, errors.New("invalid access token")
+	}
+
+	err = checkAccountStatus(user.Status)
+	if err != nil {
+		span.SetAttributes(attribute.Key("status").String(user.Status))
+		span.AddEvent("Account not active")
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	// signing out a device revokes its session, which must also invalidate its access tokens
+	session, err := u.SessionRepository.GetSessionById(ctx, claims.SessionId)
+	if err != nil || session.RevokedAt != nil {
+		span.AddEvent("Session not found or revoked")
+		span.SetStatus(codes.Error, "Session revoked")
+		return nil, errors.New("session revoked")
+	}
+
+	if claims.TokenType == utils.ExchangedTokenType {
+		return u.verifyExchangedToken(ctx, span, claims, user, session)
+	}
+
+	// impersonation tokens live on the actor's session
+	sessionOwner := user.UserId
+	if claims.ActorId != "" {
+		sessionOwner = claims.ActorId
 	}
+	if session.UserId != sessionOwner {
+		span.AddEvent("Session belongs to someone else")
+		span.SetStatus(codes.Error, "Session revoked")
+		return nil, errors.New("session revoked")
+	}
+
+	if claims.ActorId != "" {
+		return u.verifyImpersonation(ctx, span, claims.ActorId, user, session)
+	}
+
+	span.SetStatus(codes.Ok, "Access token verified")
+
+	return &models.Principal{
+		UserId:     user.UserId,
+		Role:       user.Role,
+		SessionId:  session.SessionId,
+		AuthMethod: models.AuthMethodSession,
+	}, nil
+}
+
+// verifyExchangedToken checks an exchanged token, its session belongs to the user unless the exchange started from
+// an impersonation token, in which case the impersonator is somewhere in the act chain and is re-checked
+func (u *userService) verifyExchangedToken(ctx context.Context, span trace.Span, claims *models.TokenClaims,
+	user *models.User, session *models.Session) (*models.Principal, error) {
+	span.SetAttributes(
+		attribute.Key("auth.method").String(models.AuthMethodTokenExchange),
+		attribute.Key("audience").String(claims.Audience),
+	)
+
+	if session.UserId != user.UserId {
+		if claims.Actor == nil || !slices.Contains(claims.Actor.Subjects(), session.UserId) {
+			span.AddEvent("Session belongs to someone else")
+			span.SetStatus(codes.Error, "Session revoked")
+			return nil, errors.New("session revoked")
+		}
+		if _, err := u.verifyImpersonation(ctx, span, session.UserId, user, session); err != nil {
+			return nil, err
+		}
+	}
+
+	span.SetStatus(codes.Ok, "Exchanged token verified")
+
+	principal := &models.Principal{
+		UserId:     user.UserId,
+		Role:       user.Role,
+		SessionId:  session.SessionId,
+		AuthMethod: models.AuthMethodTokenExchange,
+		Scopes:     claims.Scopes,
+		Actor:      claims.Actor,
+		Audience:   claims.Audience,
+	}
+	if claims.Actor != nil {
+		principal.ActorId = claims.Actor.Subject
+	}
+	return principal, nil
+}
+
+// verifyImpersonation re-checks the actor on every request, so disabling them or taking away their permission ends
+// impersonations already in progress
+func (u *userService) verifyImpersonation(ctx context.Context, span trace.Span, actorId string,
+	user *models.User, session *models.Session) (*models.Principal, error) {
+	span.SetAttributes(
+		attribute.Key("auth.method").String(models.AuthMethodImpersonation),
+		attribute.Key("actor_id").String(actorId),
+	)
+
+	actor, err := u.UserRepository.GetUserById(ctx, actorId)
+	if err != nil {
+		span.AddEvent("Failed to get actor by id")
+		span.SetStatus(codes.Error, "Error getting actor by id")
+		return nil, errors.New("invalid access token")
+	}
+
+	if checkAccountStatus(actor.Status) != nil || !models.HasPermission(actor.Role, models.PermissionImpersonate) ||
+		models.IsPrivilegedRole(user.Role) {
+		span.AddEvent("Actor may no longer impersonate")
+		span.SetStatus(codes.Error, "Impersonation no longer allowed")
+		return nil, errors.New("invalid access token")
+	}
+
+	span.SetStatus(codes.Ok, "Impersonation token verified")
+
+	return &models.Principal{
+		UserId:     user.UserId,
+		Role:       user.Role,
+		SessionId:  session.SessionId,
+		AuthMethod: models.AuthMethodImpersonation,
+		Scopes:     models.ImpersonationScopes,
+		ActorId:    actor.UserId,
+	}, nil
+}
+
+func (u *userService) verifyPersonalAccessToken(ctx context.Context, span trace.Span,
+	accessToken string) (*models.Principal, error) {
+	span.SetAttributes(attribute.Key("auth.method").String(models.AuthMethodPersonalAccessToken))
+
+	token, err := u.PersonalAccessTokenRepository.GetPersonalAccessTokenByHash(ctx, utils.HashToken(accessToken))
+	if err != nil {
+		span.AddEvent("Personal access token not found")
+		span.SetStatus(codes.Error, "Invalid access token")
+		return nil, errors.New("invalid access token")
+	}
+
+	span.SetAttributes(
+		attribute.Key("user_id").String(token.UserId),
+		attribute.Key("token_id").String(token.TokenId),
+	)
 
-	// Generate token
+	now := time.Now().UTC()
+	if token.RevokedAt != nil || now.After(token.ExpiresAt) {
+		span.AddEvent("Personal access token revoked or expired")
+		span.SetStatus(codes.Error, "Invalid access token")
+		return nil, errors.New("invalid access token")
+	}
+
+	user, err := u.UserRepository.GetUserById(ctx, token.UserId)
+	if err != nil {
+		span.AddEvent("Failed to get user by id")
+		span.SetStatus(codes.Error, "Error getting user by id")
+		return nil, errors.New("invalid access token")
+	}
+
+	err = checkAccountStatus(user.Status)
+	if err != nil {
+		span.SetAttributes(attribute.Key("status").String(user.Status))
+		span.AddEvent("Account not active")
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	err = u.PersonalAccessTokenRepository.TouchPersonalAccessToken(ctx, token.TokenId, now)
+	if err != nil {
+		u.Logger.LogErrorContext(ctx, "Error recording personal access token use", logging.Err(err))
+	}
+
+	span.SetStatus(codes.Ok, "Personal access token verified")
+
+	return &models.Principal{
+		UserId:     user.UserId,
+		Role:       user.Role,
+		AuthMethod: models.AuthMethodPersonalAccessToken,
+		Scopes:     token.Scopes,
+	}, nil
+}
+
+func (u *userService) issueTokens(ctx context.Context, span trace.Span, user *models.User,
+	session *models.Session, browser bool) (*models.Token, error) {
+	// Generate token, both tokens are bound to the key the client proved while asking for them
 	token := &requests.GenerateTokenRequest{
-		UserId:   user.UserId,
-		FullName: user.FullName,
+		UserId:       user.UserId,
+		FullName:     user.FullName,
+		SessionId:    session.SessionId,
+		TokenId:      session.RefreshTokenId,
+		Confirmation: utils.RequestMetaFromContext(ctx).Confirmation(),
+		Browser:      browser,
 	}
 
-	accessToken, _, err := u.GenerateToken.GenerateAccessToken(ctx, token)
+	accessToken, accessExpiresAt, err := u.GenerateToken.GenerateAccessToken(ctx, token)
 	if err != nil {
 		span.AddEvent("Failed to generate access token")
 		span.SetStatus(codes.Error, "Error generating access token")
-		u.Logger.LogError(fmt.Sprintf("Error generating access token: %v", err))
+		u.Logger.LogErrorContext(ctx, "Error generating access token", logging.Err(err))
 		return nil, errors.New("error generating access token")
 	}
 
-	refreshToken, _, err := u.GenerateToken.GenerateRefreshToken(ctx, token)
+	refreshToken, refreshExpiresAt, err := u.GenerateToken.GenerateRefreshToken(ctx, token)
 	if err != nil {
 		span.AddEvent("Failed to generate refresh token")
 		span.SetStatus(codes.Error, "Error generating refresh token")
-		u.Logger.LogError(fmt.Sprintf("Error generating refresh token: %v", err))
+		u.Logger.LogErrorContext(ctx, "Error generating refresh token", logging.Err(err))
 		return nil, errors.New("error generating refresh token")
 	}
 
 	res := &models.Token{
-		AccessToken:  accessToken,
-		RefreshToken: refreshToken,
+		AccessToken:           accessToken,
+		TokenType:             models.TokenTypeBearer,
+		RefreshToken:          refreshToken,
+		AccessTokenExpiresAt:  accessExpiresAt,
+		RefreshTokenExpiresAt: refreshExpiresAt,
+	}
+
+	if token.Confirmation != nil && token.Confirmation.Jkt != "" {
+		res.TokenType = models.TokenTypeDpop
 	}
 
-	span.AddEvent("Login successful")
-	span.SetStatus(codes.Ok, "Login successful")
+	span.AddEvent("Tokens issued")
+	span.SetStatus(codes.Ok, "Tokens issued")
 
 	return res, nil
 }
+
+// checkConfirmation ensures a sender-constrained token is presented with a proof of its key, strict also refuses
+// proofs sent with unbound tokens since a resource must not accept a DPoP request for a bearer token
+func checkConfirmation(ctx context.Context, confirmation *models.Confirmation, strict bool) error {
+	meta := utils.RequestMetaFromContext(ctx)
+	jkt, x5t := "", ""
+	if confirmation != nil {
+		jkt, x5t = confirmation.Jkt, confirmation.X5tS256
+	}
+	if jkt != "" && jkt != meta.DpopJkt {
+		return errors.New("token is bound to another key")
+	}
+	if x5t != "" && x5t != meta.ClientCertThumbprint {
+		return errors.New("token is bound to another certificate")
+	}
+	if strict && jkt == "" && meta.DpopJkt != "" {
+		return errors.New("token is not bound to a DPoP key")
+	}
+	return nil
+}
+
+func checkAccountStatus(status string) error {
+	switch status {
+	case models.StatusActive:
+		return nil
+	case models.StatusPending:
+		return errAccountPending
+	case models.StatusLocked:
+		return errAccountLocked
+	case models.StatusDisabled:
+		return errAccountDisabled
+	default:
+		return errAccountNotFound
+	}
+}
+
+// recordLoginAttempt counts a login by outcome and method, method is "password" or a configured provider name so
+// the labels stay bounded, the email is never a label
+func (u *userService) recordLoginAttempt(ctx context.Context, method string, err error) {
+	outcome := models.LoginOutcomeError
+	switch {
+	case err == nil:
+		outcome = models.LoginOutcomeSuccess
+	case errors.Is(err, errEmailNotFound):
+		outcome = models.LoginOutcomeUnknownEmail
+	case errors.Is(err, errPasswordMismatch):
+		outcome = models.LoginOutcomeBadPassword
+	case errors.Is(err, errAccountLocked):
+		outcome = models.LoginOutcomeLocked
+	case errors.Is(err, errAccountPending), errors.Is(err, errAccountDisabled), errors.Is(err, errAccountNotFound):
+		outcome = models.LoginOutcomeInactive
+	}
+
+	u.Meter.Add(ctx, metrics.LoginAttempts, 1,
+		attribute.Key("outcome").String(outcome),
+		attribute.Key("auth.method").String(method),
+	)
+}
+
+func (u *userService) recordRegistration(ctx context.Context, outcome string) {
+	u.Meter.Add(ctx, metrics.Registrations, 1, attribute.Key("outcome").String(outcome))
+}
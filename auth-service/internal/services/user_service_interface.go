@@ -9,4 +9,13 @@ import (
 type UserService interface {
 	RegisterUser(ctx context.Context, request *requests.RegisterRequest) error
 	LoginUser(ctx context.Context, request *requests.LoginRequest) (*models.Token, error)
+	RefreshToken(ctx context.Context, request *requests.RefreshTokenRequest) (*models.Token, error)
+	VerifyAccessToken(ctx context.Context, accessToken string) (*models.Principal, error)
+	VerifySubjectToken(ctx context.Context, subjectToken string) (*models.Principal, *models.TokenClaims, error)
+	StartSession(ctx context.Context, user *models.User, method string, browser bool) (*models.Token, error)
+	LoginExternalUser(ctx context.Context, external *models.ExternalUser, browser bool) (*models.Token, error)
+	ResolveExternalUser(ctx context.Context, external *models.ExternalUser) (*models.User, error)
+	LinkExternalUser(ctx context.Context, userId string, external *models.ExternalUser) (*models.UserIdentity, error)
+	LinkDirectoryIdentity(ctx context.Context, userId, providerName string,
+		request *requests.LinkDirectoryRequest) (*models.UserIdentity, error)
 }
@@ -0,0 +1,322 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/saufiroja/go-otel/auth-service/internal/models"
+	"github.com/saufiroja/go-otel/auth-service/internal/repositories"
+	"github.com/saufiroja/go-otel/auth-service/internal/utils"
+	"github.com/saufiroja/go-otel/auth-service/pkg/logging"
+	"github.com/saufiroja/go-otel/auth-service/pkg/observability/tracing"
+	"go.opentelemetry.io/otel/trace/noop"
+	"testing"
+	"time"
+)
+
+func newTestTracer() *tracing.Tracer {
+	return &tracing.Tracer{Trace: noop.NewTracerProvider().Tracer("services-test")}
+}
+
+func TestCheckConfirmation(t *testing.T) {
+	tests := []struct {
+		name         string
+		confirmation *models.Confirmation
+		meta         utils.RequestMeta
+		strict       bool
+		wantErr      bool
+	}{
+		{
+			name: "bearer token without proof",
+		},
+		{
+			name:         "jkt proven",
+			confirmation: &models.Confirmation{Jkt: "key-1"},
+			meta:         utils.RequestMeta{DpopJkt: "key-1"},
+		},
+		{
+			name:         "jkt proven with another key",
+			confirmation: &models.Confirmation{Jkt: "key-1"},
+			meta:         utils.RequestMeta{DpopJkt: "key-2"},
+			wantErr:      true,
+		},
+		{
+			name:         "jkt without proof",
+			confirmation: &models.Confirmation{Jkt: "key-1"},
+			wantErr:      true,
+		},
+		{
+			name: "proof with bearer token",
+			meta: utils.RequestMeta{DpopJkt: "key-1"},
+		},
+		{
+			name:    "proof with bearer token at a strict resource",
+			meta:    utils.RequestMeta{DpopJkt: "key-1"},
+			strict:  true,
+			wantErr: true,
+		},
+		{
+			name:         "x5t#S256 presented",
+			confirmation: &models.Confirmation{X5tS256: "cert-1"},
+			meta:         utils.RequestMeta{ClientCertThumbprint: "cert-1"},
+		},
+		{
+			name:         "x5t#S256 with another certificate",
+			confirmation: &models.Confirmation{X5tS256: "cert-1"},
+			meta:         utils.RequestMeta{ClientCertThumbprint: "cert-2"},
+			wantErr:      true,
+		},
+		{
+			name:         "x5t#S256 without a certificate",
+			confirmation: &models.Confirmation{X5tS256: "cert-1"},
+			wantErr:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.WithValue(context.Background(), utils.RequestMetaKey, tt.meta)
+			err := checkConfirmation(ctx, tt.confirmation, tt.strict)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("checkConfirmation() error = %v, wantErr %t", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// fakeUserRepository keeps users in memory, other methods are not used
+type fakeUserRepository struct {
+	repositories.UserRepository
+	users map[string]*models.User
+}
+
+func (f *fakeUserRepository) CreateUser(_ context.Context, user *models.User) error {
+	f.users[user.UserId] = user
+	return nil
+}
+
+func (f *fakeUserRepository) GetUserById(_ context.Context, userId string) (*models.User, error) {
+	user, ok := f.users[userId]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return user, nil
+}
+
+func (f *fakeUserRepository) GetUserByEmail(_ context.Context, email string) (*models.User, error) {
+	for _, user := range f.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (f *fakeUserRepository) UpdateUserRole(_ context.Context, userId, role string, _ time.Time) error {
+	user, ok := f.users[userId]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	user.Role = role
+	return nil
+}
+
+// fakeIdentityRepository keeps identities and login states in memory
+type fakeIdentityRepository struct {
+	repositories.IdentityRepository
+	identities []*models.UserIdentity
+	states     map[string]*models.OidcLoginState
+}
+
+func (f *fakeIdentityRepository) CreateIdentity(_ context.Context, identity *models.UserIdentity) error {
+	f.identities = append(f.identities, identity)
+	return nil
+}
+
+func (f *fakeIdentityRepository) GetIdentity(_ context.Context, provider,
+	subject string) (*models.UserIdentity, error) {
+	for _, identity := range f.identities {
+		if identity.Provider == provider && identity.Subject == subject {
+			return identity, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (f *fakeIdentityRepository) TouchIdentity(_ context.Context, identityId string, loginAt time.Time) error {
+	for _, identity := range f.identities {
+		if identity.IdentityId == identityId {
+			identity.LastLoginAt = &loginAt
+		}
+	}
+	return nil
+}
+
+func (f *fakeIdentityRepository) ConsumeLoginState(_ context.Context, stateHash string,
+	now time.Time) (*models.OidcLoginState, error) {
+	state, ok := f.states[stateHash]
+	if !ok || now.After(state.ExpiresAt) {
+		return nil, sql.ErrNoRows
+	}
+	delete(f.states, stateHash)
+	return state, nil
+}
+
+type fakePasswordHasher struct{}
+
+func (fakePasswordHasher) Hash(_ context.Context, password string) (string, error) {
+	return "hashed:" + password, nil
+}
+
+func (fakePasswordHasher) Compare(_ context.Context, hashedPassword, password string) error {
+	if hashedPassword != "hashed:"+password {
+		return errors.New("password mismatch")
+	}
+	return nil
+}
+
+// fakeAuditService keeps the types of the recorded events
+type fakeAuditService struct {
+	AuditService
+	events []string
+}
+
+func (f *fakeAuditService) Record(_ context.Context, eventType, _, _ string, _ map[string]string) {
+	f.events = append(f.events, eventType)
+}
+
+// newExternalUserService is a user service over in memory repositories holding the user jane
+func newExternalUserService() (*userService, *fakeUserRepository, *fakeIdentityRepository, *fakeAuditService) {
+	users := &fakeUserRepository{users: map[string]*models.User{
+		"user-1": {UserId: "user-1", Email: "jane@example.com", Status: models.StatusActive, Role: models.RoleUser},
+	}}
+	identities := &fakeIdentityRepository{states: map[string]*models.OidcLoginState{}}
+	audit := &fakeAuditService{}
+	service := &userService{
+		UserRepository:     users,
+		IdentityRepository: identities,
+		Logger:             logging.NewLogrusAdapter(),
+		Trace:              newTestTracer(),
+		PasswordHasher:     fakePasswordHasher{},
+		AuditService:       audit,
+	}
+	return service, users, identities, audit
+}
+
+func TestResolveExternalUser(t *testing.T) {
+	tests := []struct {
+		name          string
+		external      models.ExternalUser
+		linked        bool
+		wantErr       error
+		wantUserId    string
+		wantProvision bool
+	}{
+		{
+			name:       "linked identity",
+			external:   models.ExternalUser{Provider: "google", Subject: "sub-1"},
+			linked:     true,
+			wantUserId: "user-1",
+		},
+		{
+			name: "verified email of an existing account is not linked",
+			external: models.ExternalUser{Provider: "google", Subject: "sub-2", Email: "jane@example.com",
+				EmailVerified: true, AutoProvision: true},
+			wantErr: errExternalAccountExists,
+		},
+		{
+			name: "unverified email of an existing account is not linked",
+			external: models.ExternalUser{Provider: "google", Subject: "sub-2", Email: "jane@example.com",
+				AutoProvision: true},
+			wantErr: errExternalAccountExists,
+		},
+		{
+			name: "unverified email is not provisioned",
+			external: models.ExternalUser{Provider: "google", Subject: "sub-2", Email: "john@example.com",
+				AutoProvision: true},
+			wantErr: errors.New("provider did not return a verified email"),
+		},
+		{
+			name:     "missing email is not provisioned",
+			external: models.ExternalUser{Provider: "google", Subject: "sub-2", AutoProvision: true},
+			wantErr:  errors.New("provider did not return a verified email"),
+		},
+		{
+			name: "verified email without auto provisioning",
+			external: models.ExternalUser{Provider: "google", Subject: "sub-2", Email: "john@example.com",
+				EmailVerified: true},
+			wantErr: errors.New("no account is linked to this identity"),
+		},
+		{
+			name: "verified email is provisioned",
+			external: models.ExternalUser{Provider: "google", Subject: "sub-2", Email: "john@example.com",
+				EmailVerified: true, AutoProvision: true},
+			wantProvision: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, users, identities, audit := newExternalUserService()
+			if tt.linked {
+				identities.identities = append(identities.identities, &models.UserIdentity{IdentityId: "identity-1",
+					UserId: "user-1", Provider: tt.external.Provider, Subject: tt.external.Subject})
+			}
+
+			user, err := service.ResolveExternalUser(context.Background(), &tt.external)
+			if tt.wantErr != nil {
+				if err == nil || err.Error() != tt.wantErr.Error() {
+					t.Fatalf("ResolveExternalUser() error = %v, want %v", err, tt.wantErr)
+				}
+				if len(users.users) != 1 || len(identities.identities) != 0 {
+					t.Errorf("a refused sign-in created an account or an identity")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ResolveExternalUser() error = %v", err)
+			}
+
+			if !tt.wantProvision {
+				if user.UserId != tt.wantUserId {
+					t.Errorf("user = %s, want %s", user.UserId, tt.wantUserId)
+				}
+				if identities.identities[0].LastLoginAt == nil {
+					t.Errorf("identity login was not recorded")
+				}
+				return
+			}
+
+			if user.UserId == "user-1" || user.Email != tt.external.Email || user.Role != models.RoleUser {
+				t.Errorf("provisioned user = %+v", user)
+			}
+			if len(identities.identities) != 1 || identities.identities[0].UserId != user.UserId ||
+				!identities.identities[0].Provisioned {
+				t.Errorf("provisioned identities = %+v", identities.identities)
+			}
+			if len(audit.events) != 2 {
+				t.Errorf("audit events = %v, want the registration and the link", audit.events)
+			}
+		})
+	}
+}
+
+func TestLinkExternalUser(t *testing.T) {
+	service, _, identities, _ := newExternalUserService()
+	identities.identities = append(identities.identities, &models.UserIdentity{IdentityId: "identity-1",
+		UserId: "user-2", Provider: "google", Subject: "sub-1"})
+
+	if _, err := service.LinkExternalUser(context.Background(), "user-1",
+		&models.ExternalUser{Provider: "google", Subject: "sub-1"}); err == nil {
+		t.Fatal("linked an identity that belongs to another account")
+	}
+
+	identity, err := service.LinkExternalUser(context.Background(), "user-1",
+		&models.ExternalUser{Provider: "google", Subject: "sub-2", Email: "jane@gmail.com"})
+	if err != nil {
+		t.Fatalf("LinkExternalUser() error = %v", err)
+	}
+	if identity.UserId != "user-1" || identity.Provisioned {
+		t.Errorf("identity = %+v", identity)
+	}
+}
@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"github.com/saufiroja/go-otel/auth-service/config"
+	"github.com/saufiroja/go-otel/auth-service/internal/models"
+	"github.com/saufiroja/go-otel/auth-service/pkg/logging"
+	"github.com/saufiroja/go-otel/auth-service/pkg/observability/tracing"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+)
+
+var (
+	// ErrUnknownUser lets the next provider, and finally the local database, try the login
+	ErrUnknownUser = errors.New("unknown user")
+	// ErrInvalidCredentials ends the login, the provider is the password authority for this user
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// AuthProvider verifies a username and password against an external password authority
+type AuthProvider interface {
+	Name() string
+	Authenticate(ctx context.Context, username, password string) (*models.ExternalUser, error)
+}
+
+// NewAuthProviders builds the providers listed in AUTH_PROVIDERS in the configured order
+func NewAuthProviders(conf *config.AppConfig, trace *tracing.Tracer, logger logging.Logger) []AuthProvider {
+	providers := make([]AuthProvider, 0, len(conf.Auth.Providers))
+	for _, name := range conf.Auth.Providers {
+		switch name {
+		case LdapProviderName:
+			providers = append(providers, NewLdapProvider(conf, trace))
+		default:
+			logger.LogPanic("Unknown authentication provider", logging.String("provider", name))
+		}
+	}
+	return providers
+}
+
+// MapGroupsToRole returns the most privileged role mapped from groups, or an empty role when none is mapped
+func MapGroupsToRole(groupRoles map[string]string, groups []string) string {
+	role := ""
+	for _, group := range groups {
+		mapped, ok := groupRoles[cases.Lower(language.English).String(group)]
+		if !ok {
+			continue
+		}
+		if mapped == models.RoleAdmin {
+			return models.RoleAdmin
+		}
+		role = mapped
+	}
+	return role
+}
@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/saufiroja/go-otel/auth-service/config"
+	"github.com/saufiroja/go-otel/auth-service/internal/models"
+	"time"
+)
+
+const (
+	AccessTokenCookie  = "access_token"
+	RefreshTokenCookie = "refresh_token"
+	CsrfTokenCookie    = "csrf_token"
+	CsrfTokenHeader    = "X-CSRF-Token"
+)
+
+// BrowserCookies writes the cookies used by browser clients instead of returning tokens in the body
+type BrowserCookies struct {
+	Domain   string
+	Path     string
+	Secure   bool
+	SameSite string
+}
+
+func NewBrowserCookies(conf *config.AppConfig) *BrowserCookies {
+	return &BrowserCookies{
+		Domain:   conf.Cookie.Domain,
+		Path:     conf.Cookie.Path,
+		Secure:   conf.Cookie.Secure,
+		SameSite: conf.Cookie.SameSite,
+	}
+}
+
+// SetTokenCookies stores the token pair in HttpOnly cookies and the csrf token in a cookie readable by scripts
+func (b *BrowserCookies) SetTokenCookies(c *fiber.Ctx, token *models.Token, csrfToken string) {
+	refreshExpires := time.Unix(token.RefreshTokenExpiresAt, 0)
+	c.Cookie(b.cookie(AccessTokenCookie, token.AccessToken, time.Unix(token.AccessTokenExpiresAt, 0), true))
+	c.Cookie(b.cookie(RefreshTokenCookie, token.RefreshToken, refreshExpires, true))
+	c.Cookie(b.cookie(CsrfTokenCookie, csrfToken, refreshExpires, false))
+}
+
+func (b *BrowserCookies) ClearTokenCookies(c *fiber.Ctx) {
+	expired := time.Unix(0, 0)
+	for _, name := range []string{AccessTokenCookie, RefreshTokenCookie, CsrfTokenCookie} {
+		cookie := b.cookie(name, "", expired, name != CsrfTokenCookie)
+		cookie.MaxAge = -1
+		c.Cookie(cookie)
+	}
+}
+
+func (b *BrowserCookies) cookie(name, value string, expires time.Time, httpOnly bool) *fiber.Cookie {
+	return &fiber.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     b.Path,
+		Domain:   b.Domain,
+		Expires:  expires,
+		Secure:   b.Secure,
+		HTTPOnly: httpOnly,
+		SameSite: b.SameSite,
+	}
+}
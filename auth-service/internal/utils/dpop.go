@@ -0,0 +1,320 @@
+package utils
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/saufiroja/go-otel/auth-service/config"
+	"github.com/saufiroja/go-otel/auth-service/pkg/observability/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"math/big"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DpopHeader      = "DPoP"
+	DpopNonceHeader = "DPoP-Nonce"
+	dpopProofType   = "dpop+jwt"
+	// replayCacheSweepSize is how many entries the replay cache holds before it drops the expired ones
+	replayCacheSweepSize = 10000
+)
+
+// dpopAlgorithms are the asymmetric algorithms accepted for proofs, RFC 9449 section 4.3 forbids symmetric ones
+var dpopAlgorithms = []string{"ES256", "ES384", "ES512", "RS256", "RS384", "RS512", "PS256", "PS384", "PS512",
+	"EdDSA"}
+
+// ErrUseDpopNonce asks the client to retry with the nonce sent in the DPoP-Nonce header
+var ErrUseDpopNonce = errors.New("a fresh DPoP nonce is required")
+
+// DpopVerifier checks DPoP proofs as in RFC 9449 section 4.3 and issues the server nonces of section 8
+type DpopVerifier struct {
+	Secret       string
+	RequireNonce bool
+	NonceTTL     time.Duration
+	ProofMaxAge  time.Duration
+	Trace        *tracing.Tracer
+	replays      *replayCache
+}
+
+func NewDpopVerifier(conf *config.AppConfig, trace *tracing.Tracer) *DpopVerifier {
+	return &DpopVerifier{
+		Secret:       conf.Jwt.Secret,
+		RequireNonce: conf.Dpop.RequireNonce,
+		NonceTTL:     conf.Dpop.NonceTTL,
+		ProofMaxAge:  conf.Dpop.ProofMaxAge,
+		Trace:        trace,
+		replays:      newReplayCache(),
+	}
+}
+
+// VerifyProof checks a proof for a request to method and requestUrl and returns the thumbprint of its key,
+// accessToken is the token the proof is presented with and is empty at token endpoints
+func (d *DpopVerifier) VerifyProof(ctx context.Context, proof, method, requestUrl,
+	accessToken string) (string, error) {
+	_, span := d.Trace.StartSpan(ctx, "utils.DpopVerifier.VerifyProof")
+	defer span.End()
+
+	var jwk map[string]any
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(proof, claims, func(token *jwt.Token) (interface{}, error) {
+		if typ, _ := token.Header["typ"].(string); typ != dpopProofType {
+			return nil, errors.New("proof typ must be dpop+jwt")
+		}
+		jwk, _ = token.Header["jwk"].(map[string]any)
+		return parseJwk(jwk)
+	}, jwt.WithValidMethods(dpopAlgorithms))
+	if err != nil {
+		span.AddEvent("Invalid proof")
+		span.SetStatus(codes.Error, err.Error())
+		return "", fmt.Errorf("invalid DPoP proof: %w", err)
+	}
+
+	jkt, err := JwkThumbprint(jwk)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return "", err
+	}
+	span.SetAttributes(attribute.Key("dpop.jkt").String(jkt))
+
+	jti, _ := claims["jti"].(string)
+	htm, _ := claims["htm"].(string)
+	htu, _ := claims["htu"].(string)
+	if jti == "" || htm != method || !sameHttpUri(htu, requestUrl) {
+		span.AddEvent("Proof does not match the request")
+		span.SetStatus(codes.Error, "Proof does not match the request")
+		return "", errors.New("DPoP proof does not match the request")
+	}
+
+	iat, err := claims.GetIssuedAt()
+	if err != nil || iat == nil || time.Since(iat.Time).Abs() > d.ProofMaxAge {
+		span.AddEvent("Proof too old")
+		span.SetStatus(codes.Error, "Proof too old")
+		return "", errors.New("DPoP proof is too old or from the future")
+	}
+
+	if accessToken != "" {
+		sum := sha256.Sum256([]byte(accessToken))
+		if ath, _ := claims["ath"].(string); ath != base64.RawURLEncoding.EncodeToString(sum[:]) {
+			span.AddEvent("Proof not made for the access token")
+			span.SetStatus(codes.Error, "Access token hash mismatch")
+			return "", errors.New("DPoP proof ath does not match the access token")
+		}
+	}
+
+	nonce, hasNonce := claims["nonce"].(string)
+	if (hasNonce || d.RequireNonce) && !d.validNonce(nonce) {
+		span.AddEvent("Nonce missing or stale")
+		span.SetStatus(codes.Error, "Nonce required")
+		return "", ErrUseDpopNonce
+	}
+
+	// the replay check runs last so a proof rejected for another reason does not burn its jti
+	expiresAt := iat.Time.Add(d.ProofMaxAge)
+	if d.replays.seen(jkt+":"+jti, expiresAt) {
+		span.AddEvent("Proof replayed")
+		span.SetStatus(codes.Error, "Proof replayed")
+		return "", errors.New("DPoP proof has already been used")
+	}
+
+	span.SetStatus(codes.Ok, "Proof verified")
+
+	return jkt, nil
+}
+
+// Nonce issues a server nonce, it is an HMAC of its issue time so any instance can check it without shared state
+func (d *DpopVerifier) Nonce() string {
+	issued := make([]byte, 8)
+	binary.BigEndian.PutUint64(issued, uint64(time.Now().Unix()))
+	return base64.RawURLEncoding.EncodeToString(append(issued, d.nonceMac(issued)...))
+}
+
+func (d *DpopVerifier) validNonce(nonce string) bool {
+	raw, err := base64.RawURLEncoding.DecodeString(nonce)
+	if err != nil || len(raw) != 8+sha256.Size {
+		return false
+	}
+	if !hmac.Equal(raw[8:], d.nonceMac(raw[:8])) {
+		return false
+	}
+	issued := time.Unix(int64(binary.BigEndian.Uint64(raw[:8])), 0)
+	return time.Since(issued) < d.NonceTTL
+}
+
+func (d *DpopVerifier) nonceMac(issued []byte) []byte {
+	mac := hmac.New(sha256.New, []byte("dpop-nonce:"+d.Secret))
+	mac.Write(issued)
+	return mac.Sum(nil)
+}
+
+// JwkThumbprint returns the base64url RFC 7638 thumbprint of a public JWK
+func JwkThumbprint(jwk map[string]any) (string, error) {
+	kty, _ := jwk["kty"].(string)
+	var members []string
+	switch kty {
+	case "EC":
+		members = []string{"crv", "kty", "x", "y"}
+	case "RSA":
+		members = []string{"e", "kty", "n"}
+	case "OKP":
+		members = []string{"crv", "kty", "x"}
+	default:
+		return "", errors.New("unsupported jwk kty")
+	}
+
+	// the required members in lexicographic order without whitespace, which is how json.Marshal renders a map
+	required := make(map[string]string, len(members))
+	for _, member := range members {
+		value, ok := jwk[member].(string)
+		if !ok || value == "" {
+			return "", fmt.Errorf("jwk is missing %s", member)
+		}
+		required[member] = value
+	}
+	canonical, err := json.Marshal(required)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(canonical)
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// parseJwk returns the public key of a JWK, keys carrying private material are refused
+func parseJwk(jwk map[string]any) (crypto.PublicKey, error) {
+	if jwk == nil {
+		return nil, errors.New("proof has no jwk header")
+	}
+	if _, ok := jwk["d"]; ok {
+		return nil, errors.New("jwk must not contain a private key")
+	}
+
+	member := func(name string) ([]byte, error) {
+		value, _ := jwk[name].(string)
+		decoded, err := base64.RawURLEncoding.DecodeString(value)
+		if err != nil || len(decoded) == 0 {
+			return nil, fmt.Errorf("jwk has an invalid %s", name)
+		}
+		return decoded, nil
+	}
+
+	kty, _ := jwk["kty"].(string)
+	crv, _ := jwk["crv"].(string)
+	switch kty {
+	case "EC":
+		var curve elliptic.Curve
+		switch crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, errors.New("unsupported jwk crv")
+		}
+		x, err := member("x")
+		if err != nil {
+			return nil, err
+		}
+		y, err := member("y")
+		if err != nil {
+			return nil, err
+		}
+		key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(key.X, key.Y) {
+			return nil, errors.New("jwk point is not on the curve")
+		}
+		return key, nil
+	case "RSA":
+		n, err := member("n")
+		if err != nil {
+			return nil, err
+		}
+		e, err := member("e")
+		if err != nil {
+			return nil, err
+		}
+		if len(n) < 256 || len(e) > 4 {
+			return nil, errors.New("jwk rsa key is too small or malformed")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "OKP":
+		if crv != "Ed25519" {
+			return nil, errors.New("unsupported jwk crv")
+		}
+		x, err := member("x")
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("jwk has an invalid x")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, errors.New("unsupported jwk kty")
+	}
+}
+
+// sameHttpUri compares htu with the request url ignoring query, fragment, default ports and case of scheme and
+// host, RFC 9449 section 4.3
+func sameHttpUri(htu, requestUrl string) bool {
+	normalize := func(raw string) string {
+		parsed, err := url.Parse(raw)
+		if err != nil || parsed.Host == "" {
+			return ""
+		}
+		scheme := strings.ToLower(parsed.Scheme)
+		host := strings.ToLower(parsed.Hostname())
+		port := parsed.Port()
+		if port != "" && !(scheme == "https" && port == "443") && !(scheme == "http" && port == "80") {
+			host += ":" + port
+		}
+		return scheme + "://" + host + parsed.EscapedPath()
+	}
+	normalized := normalize(htu)
+	return normalized != "" && normalized == normalize(requestUrl)
+}
+
+// replayCache remembers proof ids until they could no longer pass the iat check, it is local to the instance so the
+// proof age bounds how long a replay against another instance can go unnoticed
+type replayCache struct {
+	mu      sync.Mutex
+	entries map[string]time.Time
+}
+
+func newReplayCache() *replayCache {
+	return &replayCache{entries: make(map[string]time.Time)}
+}
+
+// seen records key and reports whether it was already recorded and unexpired
+func (r *replayCache) seen(key string, expiresAt time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	if existing, ok := r.entries[key]; ok && now.Before(existing) {
+		return true
+	}
+
+	if len(r.entries) >= replayCacheSweepSize {
+		for k, expiry := range r.entries {
+			if !now.Before(expiry) {
+				delete(r.entries, k)
+			}
+		}
+	}
+	r.entries[key] = expiresAt
+	return false
+}
@@ -0,0 +1,308 @@
+package utils
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/saufiroja/go-otel/auth-service/pkg/observability/tracing"
+	"go.opentelemetry.io/otel/trace/noop"
+	"math/big"
+	"testing"
+	"time"
+)
+
+const (
+	testDpopMethod = "POST"
+	testDpopUrl    = "https://auth.example.com/oauth/token"
+)
+
+// dpopKey is a client key able to sign proofs
+type dpopKey struct {
+	method jwt.SigningMethod
+	signer crypto.Signer
+	jwk    map[string]any
+}
+
+func newEcDpopKey(t *testing.T) *dpopKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &dpopKey{method: jwt.SigningMethodES256, signer: key, jwk: map[string]any{
+		"kty": "EC",
+		"crv": "P-256",
+		"x":   base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32))),
+		"y":   base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32))),
+	}}
+}
+
+func newRsaDpopKey(t *testing.T) *dpopKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &dpopKey{method: jwt.SigningMethodRS256, signer: key, jwk: map[string]any{
+		"kty": "RSA",
+		"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}}
+}
+
+func newEd25519DpopKey(t *testing.T) *dpopKey {
+	t.Helper()
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &dpopKey{method: jwt.SigningMethodEdDSA, signer: private, jwk: map[string]any{
+		"kty": "OKP",
+		"crv": "Ed25519",
+		"x":   base64.RawURLEncoding.EncodeToString(public),
+	}}
+}
+
+// proof signs a proof for the test request, edit changes the claims before signing
+func (k *dpopKey) proof(t *testing.T, edit func(claims jwt.MapClaims)) string {
+	t.Helper()
+	claims := jwt.MapClaims{
+		"jti": uuid.New().String(),
+		"htm": testDpopMethod,
+		"htu": testDpopUrl,
+		"iat": time.Now().Unix(),
+	}
+	if edit != nil {
+		edit(claims)
+	}
+	token := jwt.NewWithClaims(k.method, claims)
+	token.Header["typ"] = dpopProofType
+	token.Header["jwk"] = k.jwk
+	signed, err := token.SignedString(k.signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func newTestDpopVerifier() *DpopVerifier {
+	return &DpopVerifier{
+		Secret:      "test-secret",
+		NonceTTL:    time.Minute * 5,
+		ProofMaxAge: time.Minute,
+		Trace:       &tracing.Tracer{Trace: noop.NewTracerProvider().Tracer("dpop-test")},
+		replays:     newReplayCache(),
+	}
+}
+
+// nonceIssuedAt builds a nonce as Nonce does but for another issue time
+func (d *DpopVerifier) nonceIssuedAt(issuedAt time.Time) string {
+	issued := make([]byte, 8)
+	binary.BigEndian.PutUint64(issued, uint64(issuedAt.Unix()))
+	return base64.RawURLEncoding.EncodeToString(append(issued, d.nonceMac(issued)...))
+}
+
+func TestVerifyProofKeyTypes(t *testing.T) {
+	keys := map[string]*dpopKey{
+		"EC":      newEcDpopKey(t),
+		"RSA":     newRsaDpopKey(t),
+		"Ed25519": newEd25519DpopKey(t),
+	}
+
+	for name, key := range keys {
+		t.Run(name, func(t *testing.T) {
+			verifier := newTestDpopVerifier()
+			want, err := JwkThumbprint(key.jwk)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			jkt, err := verifier.VerifyProof(context.Background(), key.proof(t, nil), testDpopMethod, testDpopUrl, "")
+			if err != nil {
+				t.Fatalf("VerifyProof() error = %v", err)
+			}
+			if jkt != want {
+				t.Errorf("jkt = %q, want %q", jkt, want)
+			}
+		})
+	}
+}
+
+func TestVerifyProofRejectsMismatches(t *testing.T) {
+	key := newEcDpopKey(t)
+	accessToken := "access-token"
+	sum := sha256.Sum256([]byte(accessToken))
+	ath := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	tests := []struct {
+		name        string
+		edit        func(claims jwt.MapClaims)
+		accessToken string
+	}{
+		{name: "htm", edit: func(claims jwt.MapClaims) { claims["htm"] = "GET" }},
+		{name: "htu", edit: func(claims jwt.MapClaims) { claims["htu"] = "https://auth.example.com/oauth/revoke" }},
+		{name: "htu host", edit: func(claims jwt.MapClaims) { claims["htu"] = "https://evil.example.com/oauth/token" }},
+		{name: "missing jti", edit: func(claims jwt.MapClaims) { delete(claims, "jti") }},
+		{name: "old iat", edit: func(claims jwt.MapClaims) { claims["iat"] = time.Now().Add(-time.Hour).Unix() }},
+		{name: "future iat", edit: func(claims jwt.MapClaims) { claims["iat"] = time.Now().Add(time.Hour).Unix() }},
+		{name: "missing ath", accessToken: accessToken},
+		{
+			name:        "ath of another token",
+			edit:        func(claims jwt.MapClaims) { claims["ath"] = ath },
+			accessToken: "another-token",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifier := newTestDpopVerifier()
+			_, err := verifier.VerifyProof(context.Background(), key.proof(t, tt.edit), testDpopMethod, testDpopUrl,
+				tt.accessToken)
+			if err == nil {
+				t.Fatal("VerifyProof() accepted the proof")
+			}
+		})
+	}
+
+	t.Run("matching ath", func(t *testing.T) {
+		verifier := newTestDpopVerifier()
+		proof := key.proof(t, func(claims jwt.MapClaims) { claims["ath"] = ath })
+		if _, err := verifier.VerifyProof(context.Background(), proof, testDpopMethod, testDpopUrl,
+			accessToken); err != nil {
+			t.Fatalf("VerifyProof() error = %v", err)
+		}
+	})
+}
+
+func TestVerifyProofRejectsInvalidProofs(t *testing.T) {
+	key := newEcDpopKey(t)
+	verifier := newTestDpopVerifier()
+
+	t.Run("wrong typ", func(t *testing.T) {
+		token := jwt.NewWithClaims(key.method, jwt.MapClaims{"jti": "1", "htm": testDpopMethod,
+			"htu": testDpopUrl, "iat": time.Now().Unix()})
+		token.Header["typ"] = "JWT"
+		token.Header["jwk"] = key.jwk
+		proof, _ := token.SignedString(key.signer)
+		if _, err := verifier.VerifyProof(context.Background(), proof, testDpopMethod, testDpopUrl, ""); err == nil {
+			t.Fatal("VerifyProof() accepted a proof without the dpop+jwt typ")
+		}
+	})
+
+	t.Run("symmetric algorithm", func(t *testing.T) {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"jti": "2", "htm": testDpopMethod,
+			"htu": testDpopUrl, "iat": time.Now().Unix()})
+		token.Header["typ"] = dpopProofType
+		token.Header["jwk"] = map[string]any{"kty": "oct", "k": "c2VjcmV0"}
+		proof, _ := token.SignedString([]byte("secret"))
+		if _, err := verifier.VerifyProof(context.Background(), proof, testDpopMethod, testDpopUrl, ""); err == nil {
+			t.Fatal("VerifyProof() accepted an HMAC proof")
+		}
+	})
+
+	t.Run("signed by another key", func(t *testing.T) {
+		other := newEcDpopKey(t)
+		other.jwk = key.jwk
+		if _, err := verifier.VerifyProof(context.Background(), other.proof(t, nil), testDpopMethod, testDpopUrl,
+			""); err == nil {
+			t.Fatal("VerifyProof() accepted a proof not signed by its jwk")
+		}
+	})
+}
+
+func TestVerifyProofRejectsReplay(t *testing.T) {
+	key := newEd25519DpopKey(t)
+	verifier := newTestDpopVerifier()
+	proof := key.proof(t, nil)
+
+	if _, err := verifier.VerifyProof(context.Background(), proof, testDpopMethod, testDpopUrl, ""); err != nil {
+		t.Fatalf("first use error = %v", err)
+	}
+	if _, err := verifier.VerifyProof(context.Background(), proof, testDpopMethod, testDpopUrl, ""); err == nil {
+		t.Fatal("VerifyProof() accepted a replayed jti")
+	}
+}
+
+func TestVerifyProofNonce(t *testing.T) {
+	key := newEcDpopKey(t)
+
+	t.Run("required and missing", func(t *testing.T) {
+		verifier := newTestDpopVerifier()
+		verifier.RequireNonce = true
+		_, err := verifier.VerifyProof(context.Background(), key.proof(t, nil), testDpopMethod, testDpopUrl, "")
+		if !errors.Is(err, ErrUseDpopNonce) {
+			t.Fatalf("error = %v, want ErrUseDpopNonce", err)
+		}
+	})
+
+	t.Run("required and issued", func(t *testing.T) {
+		verifier := newTestDpopVerifier()
+		verifier.RequireNonce = true
+		nonce := verifier.Nonce()
+		proof := key.proof(t, func(claims jwt.MapClaims) { claims["nonce"] = nonce })
+		if _, err := verifier.VerifyProof(context.Background(), proof, testDpopMethod, testDpopUrl, ""); err != nil {
+			t.Fatalf("VerifyProof() error = %v", err)
+		}
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		verifier := newTestDpopVerifier()
+		verifier.RequireNonce = true
+		nonce := verifier.nonceIssuedAt(time.Now().Add(-verifier.NonceTTL - time.Second))
+		proof := key.proof(t, func(claims jwt.MapClaims) { claims["nonce"] = nonce })
+		_, err := verifier.VerifyProof(context.Background(), proof, testDpopMethod, testDpopUrl, "")
+		if !errors.Is(err, ErrUseDpopNonce) {
+			t.Fatalf("error = %v, want ErrUseDpopNonce", err)
+		}
+	})
+
+	t.Run("issued by another secret", func(t *testing.T) {
+		verifier := newTestDpopVerifier()
+		other := newTestDpopVerifier()
+		other.Secret = "other-secret"
+		nonce := other.Nonce()
+		proof := key.proof(t, func(claims jwt.MapClaims) { claims["nonce"] = nonce })
+		_, err := verifier.VerifyProof(context.Background(), proof, testDpopMethod, testDpopUrl, "")
+		if !errors.Is(err, ErrUseDpopNonce) {
+			t.Fatalf("error = %v, want ErrUseDpopNonce", err)
+		}
+	})
+
+	t.Run("optional but stale", func(t *testing.T) {
+		verifier := newTestDpopVerifier()
+		proof := key.proof(t, func(claims jwt.MapClaims) { claims["nonce"] = "stale" })
+		_, err := verifier.VerifyProof(context.Background(), proof, testDpopMethod, testDpopUrl, "")
+		if !errors.Is(err, ErrUseDpopNonce) {
+			t.Fatalf("error = %v, want ErrUseDpopNonce", err)
+		}
+	})
+
+	t.Run("rejected nonce does not burn the jti", func(t *testing.T) {
+		verifier := newTestDpopVerifier()
+		verifier.RequireNonce = true
+		jti := uuid.New().String()
+		first := key.proof(t, func(claims jwt.MapClaims) { claims["jti"] = jti })
+		if _, err := verifier.VerifyProof(context.Background(), first, testDpopMethod, testDpopUrl,
+			""); !errors.Is(err, ErrUseDpopNonce) {
+			t.Fatalf("error = %v, want ErrUseDpopNonce", err)
+		}
+		nonce := verifier.Nonce()
+		retry := key.proof(t, func(claims jwt.MapClaims) {
+			claims["jti"] = jti
+			claims["nonce"] = nonce
+		})
+		if _, err := verifier.VerifyProof(context.Background(), retry, testDpopMethod, testDpopUrl, ""); err != nil {
+			t.Fatalf("retry error = %v", err)
+		}
+	})
+}
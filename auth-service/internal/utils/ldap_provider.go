@@ -0,0 +1,155 @@
+package utils
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"github.com/go-ldap/ldap/v3"
+	"github.com/saufiroja/go-otel/auth-service/config"
+	"github.com/saufiroja/go-otel/auth-service/internal/models"
+	"github.com/saufiroja/go-otel/auth-service/pkg/observability/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"net"
+	"net/url"
+)
+
+const LdapProviderName = "ldap"
+
+// LdapProvider authenticates with a simple bind, either directly on a templated DN or on the DN found by a search
+type LdapProvider struct {
+	Conf  *config.AppConfig
+	Trace *tracing.Tracer
+}
+
+func NewLdapProvider(conf *config.AppConfig, trace *tracing.Tracer) AuthProvider {
+	return &LdapProvider{
+		Conf:  conf,
+		Trace: trace,
+	}
+}
+
+func (l *LdapProvider) Name() string {
+	return LdapProviderName
+}
+
+func (l *LdapProvider) Authenticate(ctx context.Context, username, password string) (*models.ExternalUser, error) {
+	_, span := l.Trace.StartSpan(ctx, "utils.LdapProvider.Authenticate")
+	defer span.End()
+
+	span.SetAttributes(attribute.Key("ldap.url").String(l.Conf.Ldap.Url))
+
+	// an empty password is an unauthenticated bind, which most directories accept
+	if username == "" || password == "" {
+		span.SetStatus(codes.Error, "Empty credentials")
+		return nil, ErrInvalidCredentials
+	}
+
+	conn, err := l.dial()
+	if err != nil {
+		span.AddEvent("Failed to connect to directory")
+		span.SetStatus(codes.Error, err.Error())
+		return nil, fmt.Errorf("connecting to directory: %w", err)
+	}
+	defer conn.Close()
+
+	entry, err := l.bindUser(conn, username, password)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	span.SetAttributes(attribute.Key("ldap.dn").String(entry.DN))
+
+	// the typed username is not an address the directory vouches for, an entry without mail is only usable once
+	// linked to an account
+	email := entry.GetAttributeValue(l.Conf.Ldap.EmailAttribute)
+
+	span.SetStatus(codes.Ok, "Directory bind succeeded")
+
+	return &models.ExternalUser{
+		Provider:      LdapProviderName,
+		Subject:       entry.DN,
+		Email:         email,
+		EmailVerified: email != "",
+		FullName:      entry.GetAttributeValue(l.Conf.Ldap.NameAttribute),
+		Role:          MapGroupsToRole(l.Conf.Ldap.GroupRoles, entry.GetAttributeValues(l.Conf.Ldap.GroupAttribute)),
+		AutoProvision: true,
+	}, nil
+}
+
+func (l *LdapProvider) dial() (*ldap.Conn, error) {
+	dialer := &net.Dialer{Timeout: l.Conf.Ldap.Timeout}
+	conn, err := ldap.DialURL(l.Conf.Ldap.Url, ldap.DialWithDialer(dialer))
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(l.Conf.Ldap.Timeout)
+
+	if l.Conf.Ldap.StartTls {
+		parsed, err := url.Parse(l.Conf.Ldap.Url)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		err = conn.StartTLS(&tls.Config{ServerName: parsed.Hostname(), MinVersion: tls.VersionTLS12})
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// bindUser binds as the user and returns their entry, read with the user's own rights after the bind
+func (l *LdapProvider) bindUser(conn *ldap.Conn, username, password string) (*ldap.Entry, error) {
+	attributes := []string{l.Conf.Ldap.EmailAttribute, l.Conf.Ldap.NameAttribute, l.Conf.Ldap.GroupAttribute}
+
+	userDn := ""
+	if l.Conf.Ldap.UserDnTemplate != "" {
+		userDn = fmt.Sprintf(l.Conf.Ldap.UserDnTemplate, ldap.EscapeDN(username))
+	} else {
+		if l.Conf.Ldap.BindDn != "" {
+			if err := conn.Bind(l.Conf.Ldap.BindDn, l.Conf.Ldap.BindPassword); err != nil {
+				return nil, fmt.Errorf("service account bind: %w", err)
+			}
+		}
+		entry, err := l.search(conn, l.Conf.Ldap.BaseDn, ldap.ScopeWholeSubtree,
+			fmt.Sprintf(l.Conf.Ldap.UserFilter, ldap.EscapeFilter(username)), attributes)
+		if err != nil {
+			return nil, err
+		}
+		userDn = entry.DN
+	}
+
+	err := conn.Bind(userDn, password)
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, fmt.Errorf("user bind: %w", err)
+	}
+
+	return l.search(conn, userDn, ldap.ScopeBaseObject, "(objectClass=*)", attributes)
+}
+
+func (l *LdapProvider) search(conn *ldap.Conn, baseDn string, scope int, filter string,
+	attributes []string) (*ldap.Entry, error) {
+	request := ldap.NewSearchRequest(baseDn, scope, ldap.NeverDerefAliases, 2, 0, false, filter, attributes, nil)
+	result, err := conn.Search(request)
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject) {
+		return nil, ErrUnknownUser
+	}
+	if err != nil {
+		return nil, fmt.Errorf("directory search: %w", err)
+	}
+	switch len(result.Entries) {
+	case 0:
+		return nil, ErrUnknownUser
+	case 1:
+		return result.Entries[0], nil
+	default:
+		return nil, errors.New("directory search matched more than one entry")
+	}
+}
@@ -0,0 +1,512 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+	"github.com/saufiroja/go-otel/auth-service/config"
+	"github.com/saufiroja/go-otel/auth-service/internal/models"
+	"github.com/saufiroja/go-otel/auth-service/pkg/observability/tracing"
+	"go.opentelemetry.io/otel/trace/noop"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	testLdapBaseDn     = "ou=people,dc=example,dc=com"
+	testLdapReaderDn   = "cn=reader,dc=example,dc=com"
+	testLdapReaderPass = "reader-password"
+	testLdapOddUid     = `j*()\`
+)
+
+type testLdapEntry struct {
+	dn         string
+	password   string
+	attributes map[string][]string
+}
+
+// fakeLdapServer is an in process directory answering simple binds and searches, it records the bind DNs and
+// search filters it receives
+type fakeLdapServer struct {
+	listener net.Listener
+	entries  []*testLdapEntry
+
+	mu      sync.Mutex
+	binds   []string
+	filters []*ber.Packet
+}
+
+func newFakeLdapServer(t *testing.T) *fakeLdapServer {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &fakeLdapServer{listener: listener, entries: []*testLdapEntry{
+		{dn: testLdapReaderDn, password: testLdapReaderPass},
+		{
+			dn:       "uid=jane," + testLdapBaseDn,
+			password: "jane-password",
+			attributes: map[string][]string{
+				"uid":      {"jane"},
+				"mail":     {"jane@example.com"},
+				"cn":       {"Jane Doe"},
+				"memberOf": {"CN=Admins,ou=groups,dc=example,dc=com", "cn=staff,ou=groups,dc=example,dc=com"},
+			},
+		},
+		{
+			dn:       "uid=john," + testLdapBaseDn,
+			password: "john-password",
+			attributes: map[string][]string{
+				"uid":      {"john"},
+				"cn":       {"John Doe"},
+				"memberOf": {"cn=staff,ou=groups,dc=example,dc=com"},
+			},
+		},
+		{
+			dn:         "uid=" + ldap.EscapeDN(testLdapOddUid) + "," + testLdapBaseDn,
+			password:   "odd-password",
+			attributes: map[string][]string{"uid": {testLdapOddUid}, "mail": {"odd@example.com"}},
+		},
+	}}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+
+	return server
+}
+
+func (s *fakeLdapServer) url() string {
+	return "ldap://" + s.listener.Addr().String()
+}
+
+func (s *fakeLdapServer) serve(conn net.Conn) {
+	defer conn.Close()
+
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		messageId := packet.Children[0].Value.(int64)
+		request := packet.Children[1]
+
+		switch request.Tag {
+		case ldap.ApplicationBindRequest:
+			code := s.bind(request.Children[1].Data.String(), request.Children[2].Data.String())
+			_, _ = conn.Write(ldapResponse(messageId, ldap.ApplicationBindResponse, code).Bytes())
+		case ldap.ApplicationSearchRequest:
+			entries, code := s.search(request)
+			for _, entry := range entries {
+				_, _ = conn.Write(ldapEntry(messageId, entry).Bytes())
+			}
+			_, _ = conn.Write(ldapResponse(messageId, ldap.ApplicationSearchResultDone, code).Bytes())
+		default:
+			return
+		}
+	}
+}
+
+func (s *fakeLdapServer) bind(dn, password string) uint16 {
+	s.mu.Lock()
+	s.binds = append(s.binds, dn)
+	s.mu.Unlock()
+
+	if dn == "" && password == "" {
+		return ldap.LDAPResultSuccess
+	}
+	entry := s.entry(dn)
+	if entry == nil || password == "" || entry.password != password {
+		return ldap.LDAPResultInvalidCredentials
+	}
+	return ldap.LDAPResultSuccess
+}
+
+// entry finds an entry by DN, comparing parsed DNs so escaping in the request is honoured
+func (s *fakeLdapServer) entry(dn string) *testLdapEntry {
+	parsed, err := ldap.ParseDN(dn)
+	if err != nil {
+		return nil
+	}
+	for _, entry := range s.entries {
+		if stored, _ := ldap.ParseDN(entry.dn); stored.EqualFold(parsed) {
+			return entry
+		}
+	}
+	return nil
+}
+
+func (s *fakeLdapServer) search(request *ber.Packet) ([]*testLdapEntry, uint16) {
+	baseDn := request.Children[0].Data.String()
+	scope := request.Children[1].Value.(int64)
+	filter := request.Children[6]
+
+	s.mu.Lock()
+	s.filters = append(s.filters, filter)
+	s.mu.Unlock()
+
+	if scope == ldap.ScopeBaseObject {
+		entry := s.entry(baseDn)
+		if entry == nil {
+			return nil, ldap.LDAPResultNoSuchObject
+		}
+		if !matchFilter(filter, entry) {
+			return nil, ldap.LDAPResultSuccess
+		}
+		return []*testLdapEntry{entry}, ldap.LDAPResultSuccess
+	}
+
+	base, err := ldap.ParseDN(baseDn)
+	if err != nil {
+		return nil, ldap.LDAPResultInvalidDNSyntax
+	}
+	var entries []*testLdapEntry
+	for _, entry := range s.entries {
+		parsed, _ := ldap.ParseDN(entry.dn)
+		if base.AncestorOfFold(parsed) && matchFilter(filter, entry) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, ldap.LDAPResultSuccess
+}
+
+// matchFilter evaluates the filter types the provider can produce, a wildcard that reaches the server unescaped
+// becomes a present or substrings filter and matches
+func matchFilter(filter *ber.Packet, entry *testLdapEntry) bool {
+	switch filter.Tag {
+	case ldap.FilterAnd:
+		for _, child := range filter.Children {
+			if !matchFilter(child, entry) {
+				return false
+			}
+		}
+		return true
+	case ldap.FilterOr:
+		for _, child := range filter.Children {
+			if matchFilter(child, entry) {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterNot:
+		return !matchFilter(filter.Children[0], entry)
+	case ldap.FilterPresent:
+		name := filter.Data.String()
+		return strings.EqualFold(name, "objectClass") || len(entry.attributes[name]) > 0
+	case ldap.FilterEqualityMatch:
+		for _, value := range entry.attributes[filter.Children[0].Data.String()] {
+			if value == filter.Children[1].Data.String() {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterSubstrings:
+		for _, value := range entry.attributes[filter.Children[0].Data.String()] {
+			if matchSubstrings(filter.Children[1].Children, value) {
+				return true
+			}
+		}
+		return false
+	default:
+		return false
+	}
+}
+
+func matchSubstrings(parts []*ber.Packet, value string) bool {
+	for _, part := range parts {
+		substring := part.Data.String()
+		switch part.Tag {
+		case ldap.FilterSubstringsInitial:
+			if !strings.HasPrefix(value, substring) {
+				return false
+			}
+			value = value[len(substring):]
+		case ldap.FilterSubstringsAny:
+			index := strings.Index(value, substring)
+			if index < 0 {
+				return false
+			}
+			value = value[index+len(substring):]
+		case ldap.FilterSubstringsFinal:
+			if !strings.HasSuffix(value, substring) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func ldapResponse(messageId int64, tag ber.Tag, code uint16) *ber.Packet {
+	response := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Response")
+	response.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code),
+		"Result code"))
+	response.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"))
+	response.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "",
+		"Diagnostic message"))
+	return ldapMessage(messageId, response)
+}
+
+func ldapEntry(messageId int64, entry *testLdapEntry) *ber.Packet {
+	response := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil,
+		"Search result entry")
+	response.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, entry.dn,
+		"Object name"))
+	attributes := ber.NewSequence("Attributes")
+	for name, values := range entry.attributes {
+		attribute := ber.NewSequence("Attribute")
+		attribute.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "Type"))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+		for _, value := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "Value"))
+		}
+		attribute.AppendChild(set)
+		attributes.AppendChild(attribute)
+	}
+	response.AppendChild(attributes)
+	return ldapMessage(messageId, response)
+}
+
+func ldapMessage(messageId int64, response *ber.Packet) *ber.Packet {
+	message := ber.NewSequence("LDAP message")
+	message.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageId,
+		"Message id"))
+	message.AppendChild(response)
+	return message
+}
+
+func newTestLdapProvider(server *fakeLdapServer, edit func(conf *config.AppConfig)) *LdapProvider {
+	conf := &config.AppConfig{}
+	conf.Ldap.Url = server.url()
+	conf.Ldap.BindDn = testLdapReaderDn
+	conf.Ldap.BindPassword = testLdapReaderPass
+	conf.Ldap.BaseDn = testLdapBaseDn
+	conf.Ldap.UserFilter = "(uid=%s)"
+	conf.Ldap.EmailAttribute = "mail"
+	conf.Ldap.NameAttribute = "cn"
+	conf.Ldap.GroupAttribute = "memberOf"
+	conf.Ldap.GroupRoles = map[string]string{
+		"cn=admins,ou=groups,dc=example,dc=com": models.RoleAdmin,
+		"cn=staff,ou=groups,dc=example,dc=com":  "staff",
+	}
+	conf.Ldap.Timeout = 2 * time.Second
+	if edit != nil {
+		edit(conf)
+	}
+	return &LdapProvider{Conf: conf, Trace: &tracing.Tracer{Trace: noop.NewTracerProvider().Tracer("ldap-test")}}
+}
+
+func TestLdapProviderAuthenticate(t *testing.T) {
+	userDnTemplate := func(conf *config.AppConfig) {
+		conf.Ldap.BindDn = ""
+		conf.Ldap.UserDnTemplate = "uid=%s," + testLdapBaseDn
+	}
+
+	tests := []struct {
+		name      string
+		edit      func(conf *config.AppConfig)
+		username  string
+		password  string
+		wantErr   error
+		wantDn    string
+		wantEmail string
+		wantRole  string
+	}{
+		{
+			name:      "search and bind",
+			username:  "jane",
+			password:  "jane-password",
+			wantDn:    "uid=jane," + testLdapBaseDn,
+			wantEmail: "jane@example.com",
+			wantRole:  models.RoleAdmin,
+		},
+		{
+			name:     "entry without mail",
+			username: "john",
+			password: "john-password",
+			wantDn:   "uid=john," + testLdapBaseDn,
+			wantRole: "staff",
+		},
+		{
+			name:     "bad password",
+			username: "jane",
+			password: "wrong-password",
+			wantErr:  ErrInvalidCredentials,
+		},
+		{
+			name:     "empty password",
+			username: "jane",
+			wantErr:  ErrInvalidCredentials,
+		},
+		{
+			name:     "unknown user",
+			username: "nobody",
+			password: "jane-password",
+			wantErr:  ErrUnknownUser,
+		},
+		{
+			name:     "wildcard username",
+			username: "*",
+			password: "jane-password",
+			wantErr:  ErrUnknownUser,
+		},
+		{
+			name:     "prefix wildcard username",
+			username: "ja*",
+			password: "jane-password",
+			wantErr:  ErrUnknownUser,
+		},
+		{
+			name:     "filter injection",
+			username: "nobody)(uid=jane",
+			password: "jane-password",
+			wantErr:  ErrUnknownUser,
+		},
+		{
+			name:      "filter special characters",
+			username:  testLdapOddUid,
+			password:  "odd-password",
+			wantDn:    "uid=" + ldap.EscapeDN(testLdapOddUid) + "," + testLdapBaseDn,
+			wantEmail: "odd@example.com",
+		},
+		{
+			name:      "dn template",
+			edit:      userDnTemplate,
+			username:  "jane",
+			password:  "jane-password",
+			wantDn:    "uid=jane," + testLdapBaseDn,
+			wantEmail: "jane@example.com",
+			wantRole:  models.RoleAdmin,
+		},
+		{
+			name:     "dn template bad password",
+			edit:     userDnTemplate,
+			username: "jane",
+			password: "wrong-password",
+			wantErr:  ErrInvalidCredentials,
+		},
+		{
+			name:      "dn template special characters",
+			edit:      userDnTemplate,
+			username:  testLdapOddUid,
+			password:  "odd-password",
+			wantDn:    "uid=" + ldap.EscapeDN(testLdapOddUid) + "," + testLdapBaseDn,
+			wantEmail: "odd@example.com",
+		},
+		{
+			name:     "dn template injection",
+			edit:     userDnTemplate,
+			username: "jane,ou=people",
+			password: "jane-password",
+			wantErr:  ErrInvalidCredentials,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newFakeLdapServer(t)
+			provider := newTestLdapProvider(server, tt.edit)
+
+			user, err := provider.Authenticate(context.Background(), tt.username, tt.password)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Authenticate() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Authenticate() error = %v", err)
+			}
+
+			if user.Provider != LdapProviderName || user.Subject != tt.wantDn {
+				t.Errorf("identity = %s %s, want %s %s", user.Provider, user.Subject, LdapProviderName, tt.wantDn)
+			}
+			if user.Email != tt.wantEmail || user.EmailVerified != (tt.wantEmail != "") {
+				t.Errorf("email = %q verified %t, want %q", user.Email, user.EmailVerified, tt.wantEmail)
+			}
+			if user.Role != tt.wantRole {
+				t.Errorf("role = %q, want %q", user.Role, tt.wantRole)
+			}
+		})
+	}
+}
+
+func TestLdapProviderEmptyCredentialsNeverBind(t *testing.T) {
+	server := newFakeLdapServer(t)
+	provider := newTestLdapProvider(server, nil)
+
+	for _, credentials := range [][2]string{{"jane", ""}, {"", "jane-password"}, {"", ""}} {
+		if _, err := provider.Authenticate(context.Background(), credentials[0], credentials[1]); !errors.Is(err,
+			ErrInvalidCredentials) {
+			t.Errorf("Authenticate(%q, %q) error = %v, want %v", credentials[0], credentials[1], err,
+				ErrInvalidCredentials)
+		}
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if len(server.binds) != 0 {
+		t.Errorf("binds = %q, an empty password must not reach the directory", server.binds)
+	}
+}
+
+func TestLdapProviderEscapesFilter(t *testing.T) {
+	server := newFakeLdapServer(t)
+	provider := newTestLdapProvider(server, nil)
+
+	_, _ = provider.Authenticate(context.Background(), testLdapOddUid, "odd-password")
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if len(server.filters) == 0 {
+		t.Fatal("no search reached the directory")
+	}
+	filter := server.filters[0]
+	if filter.Tag != ldap.FilterEqualityMatch || filter.Children[1].Data.String() != testLdapOddUid {
+		t.Errorf("user filter = %s, want an equality match on %q", ldap.FilterMap[uint64(filter.Tag)],
+			testLdapOddUid)
+	}
+}
+
+func TestMapGroupsToRole(t *testing.T) {
+	groupRoles := map[string]string{
+		"cn=admins,ou=groups,dc=example,dc=com": models.RoleAdmin,
+		"cn=staff,ou=groups,dc=example,dc=com":  "staff",
+	}
+
+	tests := []struct {
+		name   string
+		groups []string
+		want   string
+	}{
+		{name: "no groups"},
+		{name: "unmapped group", groups: []string{"cn=guests,ou=groups,dc=example,dc=com"}},
+		{name: "mapped group", groups: []string{"cn=staff,ou=groups,dc=example,dc=com"}, want: "staff"},
+		{name: "mapping ignores case", groups: []string{"CN=Staff,OU=Groups,DC=Example,DC=Com"}, want: "staff"},
+		{
+			name:   "admin wins over order",
+			groups: []string{"cn=admins,ou=groups,dc=example,dc=com", "cn=staff,ou=groups,dc=example,dc=com"},
+			want:   models.RoleAdmin,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MapGroupsToRole(groupRoles, tt.groups); got != tt.want {
+				t.Errorf("MapGroupsToRole() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,34 @@
+package utils
+
+import (
+	"context"
+	"github.com/saufiroja/go-otel/auth-service/pkg/logging"
+	"github.com/saufiroja/go-otel/auth-service/pkg/observability/tracing"
+)
+
+type Notifier interface {
+	SendEmailChangeVerification(ctx context.Context, userId, email, token string) error
+}
+
+// LogNotifier records that a notification was due instead of delivering it, until a mail provider is wired in. It
+// never logs the address or token, logs are shipped off the host and the token alone completes an email change
+type LogNotifier struct {
+	Logger logging.Logger
+	Trace  *tracing.Tracer
+}
+
+func NewLogNotifier(logger logging.Logger, trace *tracing.Tracer) Notifier {
+	return &LogNotifier{
+		Logger: logger,
+		Trace:  trace,
+	}
+}
+
+func (n *LogNotifier) SendEmailChangeVerification(ctx context.Context, userId, email, token string) error {
+	ctx, span := n.Trace.StartSpan(ctx, "utils.SendEmailChangeVerification")
+	defer span.End()
+
+	n.Logger.LogInfoContext(ctx, "email change verification not delivered, no mail provider configured",
+		logging.String("user_id", userId))
+	return nil
+}
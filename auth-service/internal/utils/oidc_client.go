@@ -0,0 +1,354 @@
+package utils
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/saufiroja/go-otel/auth-service/config"
+	"github.com/saufiroja/go-otel/auth-service/internal/models"
+	"github.com/saufiroja/go-otel/auth-service/pkg/observability/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// jwksRefreshInterval bounds how often an unknown key id may trigger a JWKS download
+const jwksRefreshInterval = time.Minute
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JwksUri               string `json:"jwks_uri"`
+}
+
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// OidcClient talks to one upstream OpenID Connect provider using the authorization code flow with PKCE
+type OidcClient struct {
+	Provider   config.OidcProvider
+	HttpClient *http.Client
+	Trace      *tracing.Tracer
+
+	mu            sync.Mutex
+	discovery     *oidcDiscovery
+	keys          map[string]any
+	keysFetchedAt time.Time
+}
+
+func NewOidcClients(conf *config.AppConfig, trace *tracing.Tracer) map[string]*OidcClient {
+	clients := make(map[string]*OidcClient, len(conf.Oidc.Providers))
+	for name, provider := range conf.Oidc.Providers {
+		clients[name] = &OidcClient{
+			Provider:   provider,
+			HttpClient: &http.Client{Timeout: 10 * time.Second},
+			Trace:      trace,
+		}
+	}
+	return clients
+}
+
+// AuthCodeURL builds the url the user agent is redirected to, codeVerifier never leaves the service
+func (o *OidcClient) AuthCodeURL(ctx context.Context, state, nonce, codeVerifier string) (string, error) {
+	ctx, span := o.Trace.StartSpan(ctx, "utils.OidcClient.AuthCodeURL")
+	defer span.End()
+
+	span.SetAttributes(attribute.Key("provider").String(o.Provider.Name))
+
+	discovery, err := o.discover(ctx)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return "", err
+	}
+
+	challenge := sha256.Sum256([]byte(codeVerifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {o.Provider.ClientId},
+		"redirect_uri":          {o.Provider.RedirectUrl},
+		"scope":                 {strings.Join(o.Provider.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+
+	separator := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+
+	span.SetStatus(codes.Ok, "Authorization url built")
+
+	return discovery.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// Exchange redeems an authorization code and returns the raw ID token
+func (o *OidcClient) Exchange(ctx context.Context, code, codeVerifier string) (string, error) {
+	ctx, span := o.Trace.StartSpan(ctx, "utils.OidcClient.Exchange")
+	defer span.End()
+
+	span.SetAttributes(attribute.Key("provider").String(o.Provider.Name))
+
+	discovery, err := o.discover(ctx)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return "", err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {o.Provider.RedirectUrl},
+		"code_verifier": {codeVerifier},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, discovery.TokenEndpoint,
+		strings.NewReader(form.Encode()))
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(o.Provider.ClientId), url.QueryEscape(o.Provider.ClientSecret))
+
+	res, err := o.HttpClient.Do(req)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return "", err
+	}
+	defer res.Body.Close()
+
+	span.SetAttributes(attribute.Key("http.response.status_code").Int(res.StatusCode))
+
+	body := struct {
+		IdToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}{}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return "", fmt.Errorf("decoding token response: %w", err)
+	}
+	if res.StatusCode != http.StatusOK || body.Error != "" {
+		span.SetStatus(codes.Error, "Token endpoint rejected the code")
+		return "", fmt.Errorf("token endpoint returned %d: %s %s", res.StatusCode, body.Error, body.ErrorDescription)
+	}
+	if body.IdToken == "" {
+		span.SetStatus(codes.Error, "Missing id token")
+		return "", errors.New("token response has no id_token")
+	}
+
+	span.SetStatus(codes.Ok, "Code exchanged")
+
+	return body.IdToken, nil
+}
+
+// VerifyIdToken checks the signature against the provider JWKS and the issuer, audience, expiry and nonce claims
+func (o *OidcClient) VerifyIdToken(ctx context.Context, rawIdToken, nonce string) (*models.OidcClaims, error) {
+	ctx, span := o.Trace.StartSpan(ctx, "utils.OidcClient.VerifyIdToken")
+	defer span.End()
+
+	span.SetAttributes(attribute.Key("provider").String(o.Provider.Name))
+
+	discovery, err := o.discover(ctx)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(rawIdToken, claims, func(token *jwt.Token) (any, error) {
+		kid, _ := token.Header["kid"].(string)
+		return o.key(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384"}),
+		// iss must equal the discovered issuer byte for byte, including a trailing slash
+		jwt.WithIssuer(discovery.Issuer),
+		jwt.WithAudience(o.Provider.ClientId),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	// a token issued to several audiences must name us as the authorized party
+	if aud, _ := claims.GetAudience(); len(aud) > 1 {
+		if azp, _ := claims["azp"].(string); azp != o.Provider.ClientId {
+			span.SetStatus(codes.Error, "Invalid authorized party")
+			return nil, errors.New("invalid azp claim")
+		}
+	}
+
+	if tokenNonce, _ := claims["nonce"].(string); tokenNonce == "" || tokenNonce != nonce {
+		span.SetStatus(codes.Error, "Nonce mismatch")
+		return nil, errors.New("nonce mismatch")
+	}
+
+	subject, _ := claims.GetSubject()
+	if subject == "" {
+		span.SetStatus(codes.Error, "Missing subject")
+		return nil, errors.New("missing sub claim")
+	}
+
+	result := &models.OidcClaims{Subject: subject}
+	result.Email, _ = claims["email"].(string)
+	result.Name, _ = claims["name"].(string)
+	// some providers send email_verified as a string
+	switch verified := claims["email_verified"].(type) {
+	case bool:
+		result.EmailVerified = verified
+	case string:
+		result.EmailVerified = verified == "true"
+	}
+
+	span.SetStatus(codes.Ok, "Id token verified")
+
+	return result, nil
+}
+
+func (o *OidcClient) discover(ctx context.Context) (*oidcDiscovery, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.discovery != nil {
+		return o.discovery, nil
+	}
+
+	discovery := &oidcDiscovery{}
+	// the configuration path is appended after any trailing slash, the issuer itself is compared exactly
+	err := o.getJSON(ctx, strings.TrimSuffix(o.Provider.Issuer, "/")+"/.well-known/openid-configuration", discovery)
+	if err != nil {
+		return nil, fmt.Errorf("oidc discovery: %w", err)
+	}
+	if discovery.Issuer != o.Provider.Issuer {
+		return nil, fmt.Errorf("oidc discovery: issuer %s does not match %s", discovery.Issuer, o.Provider.Issuer)
+	}
+
+	o.discovery = discovery
+	return discovery, nil
+}
+
+// key returns the verification key for kid, refreshing the JWKS when the provider has rotated its keys
+func (o *OidcClient) key(ctx context.Context, kid string) (any, error) {
+	discovery, err := o.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if key, ok := o.keys[kid]; ok {
+		return key, nil
+	}
+	if time.Since(o.keysFetchedAt) < jwksRefreshInterval {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	set := struct {
+		Keys []jsonWebKey `json:"keys"`
+	}{}
+	err = o.getJSON(ctx, discovery.JwksUri, &set)
+	if err != nil {
+		return nil, fmt.Errorf("fetching jwks: %w", err)
+	}
+
+	keys := make(map[string]any, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		publicKey, err := jwk.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[jwk.Kid] = publicKey
+	}
+	o.keys = keys
+	o.keysFetchedAt = time.Now()
+
+	if key, ok := o.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+func (o *OidcClient) getJSON(ctx context.Context, endpoint string, target any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	res, err := o.HttpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %d", endpoint, res.StatusCode)
+	}
+	return json.NewDecoder(res.Body).Decode(target)
+}
+
+func (k *jsonWebKey) publicKey() (any, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+	}
+}
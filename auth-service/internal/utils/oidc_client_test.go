@@ -0,0 +1,361 @@
+package utils
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/saufiroja/go-otel/auth-service/config"
+	"github.com/saufiroja/go-otel/auth-service/pkg/observability/tracing"
+	"go.opentelemetry.io/otel/trace/noop"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	testOidcClientId     = "auth-service"
+	testOidcClientSecret = "client-secret"
+	testOidcKid          = "provider-key-1"
+	testOidcCode         = "auth-code-1"
+)
+
+// fakeOidcProvider serves discovery, JWKS and a token endpoint that checks the PKCE verifier against the
+// challenge of the last authorization request
+type fakeOidcProvider struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	issuer string
+
+	mu        sync.Mutex
+	challenge string
+	claims    jwt.MapClaims
+}
+
+func newFakeOidcProvider(t *testing.T) *fakeOidcProvider {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := &fakeOidcProvider{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{
+			"issuer":                 provider.issuer,
+			"authorization_endpoint": provider.server.URL + "/authorize",
+			"token_endpoint":         provider.server.URL + "/token",
+			"jwks_uri":               provider.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{"keys": []map[string]string{{
+			"kid": testOidcKid,
+			"kty": "RSA",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", provider.token)
+	provider.server = httptest.NewServer(mux)
+	provider.issuer = provider.server.URL
+	t.Cleanup(provider.server.Close)
+
+	return provider
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func (p *fakeOidcProvider) token(w http.ResponseWriter, r *http.Request) {
+	clientId, clientSecret, ok := r.BasicAuth()
+	if !ok || clientId != testOidcClientId || clientSecret != testOidcClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+	if r.PostFormValue("grant_type") != "authorization_code" || r.PostFormValue("code") != testOidcCode {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	verifier := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if p.challenge == "" || base64.RawURLEncoding.EncodeToString(verifier[:]) != p.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant",
+			"error_description": "PKCE verification failed"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"id_token": p.sign(p.claims, p.key, testOidcKid)})
+}
+
+func (p *fakeOidcProvider) sign(claims jwt.MapClaims, key *rsa.PrivateKey, kid string) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		panic(err)
+	}
+	return signed
+}
+
+// idTokenClaims are the claims of a valid ID token for nonce
+func (p *fakeOidcProvider) idTokenClaims(nonce string) jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":            p.issuer,
+		"sub":            "provider-user-1",
+		"aud":            testOidcClientId,
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"iat":            time.Now().Unix(),
+		"nonce":          nonce,
+		"email":          "jane@example.com",
+		"email_verified": true,
+	}
+}
+
+func (p *fakeOidcProvider) client() *OidcClient {
+	return &OidcClient{
+		Provider: config.OidcProvider{
+			Name:         "test",
+			Issuer:       p.issuer,
+			ClientId:     testOidcClientId,
+			ClientSecret: testOidcClientSecret,
+			RedirectUrl:  "https://auth.example.com/oidc/test/callback",
+			Scopes:       []string{"openid", "email"},
+		},
+		HttpClient: p.server.Client(),
+		Trace:      &tracing.Tracer{Trace: noop.NewTracerProvider().Tracer("oidc-test")},
+	}
+}
+
+// authorize plays the user agent visiting the authorization url, the provider keeps the challenge it was sent
+func (p *fakeOidcProvider) authorize(t *testing.T, client *OidcClient, state, nonce, codeVerifier string) url.Values {
+	t.Helper()
+
+	authUrl, err := client.AuthCodeURL(context.Background(), state, nonce, codeVerifier)
+	if err != nil {
+		t.Fatalf("AuthCodeURL() error = %v", err)
+	}
+	parsed, err := url.Parse(authUrl)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query := parsed.Query()
+	p.mu.Lock()
+	p.challenge = query.Get("code_challenge")
+	p.claims = p.idTokenClaims(query.Get("nonce"))
+	p.mu.Unlock()
+
+	return query
+}
+
+func TestOidcClientAuthCodeURL(t *testing.T) {
+	provider := newFakeOidcProvider(t)
+	query := provider.authorize(t, provider.client(), "state-1", "nonce-1", "verifier-1")
+
+	challenge := sha256.Sum256([]byte("verifier-1"))
+	want := map[string]string{
+		"response_type":         "code",
+		"client_id":             testOidcClientId,
+		"state":                 "state-1",
+		"nonce":                 "nonce-1",
+		"scope":                 "openid email",
+		"code_challenge":        base64.RawURLEncoding.EncodeToString(challenge[:]),
+		"code_challenge_method": "S256",
+	}
+	for name, value := range want {
+		if got := query.Get(name); got != value {
+			t.Errorf("%s = %q, want %q", name, got, value)
+		}
+	}
+	if query.Has("code_verifier") {
+		t.Error("the code verifier was sent to the authorization endpoint")
+	}
+}
+
+func TestOidcClientPkceFlow(t *testing.T) {
+	tests := []struct {
+		name     string
+		verifier string
+		wantErr  bool
+	}{
+		{
+			name:     "verifier matches the challenge",
+			verifier: "verifier-1",
+		},
+		{
+			name:     "verifier does not match the challenge",
+			verifier: "verifier-2",
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := newFakeOidcProvider(t)
+			client := provider.client()
+			provider.authorize(t, client, "state-1", "nonce-1", "verifier-1")
+
+			idToken, err := client.Exchange(context.Background(), testOidcCode, tt.verifier)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Exchange() error = %v, wantErr %t", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			claims, err := client.VerifyIdToken(context.Background(), idToken, "nonce-1")
+			if err != nil {
+				t.Fatalf("VerifyIdToken() error = %v", err)
+			}
+			if claims.Subject != "provider-user-1" || claims.Email != "jane@example.com" || !claims.EmailVerified {
+				t.Errorf("claims = %+v", claims)
+			}
+		})
+	}
+}
+
+func TestOidcClientVerifyIdToken(t *testing.T) {
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		edit      func(claims jwt.MapClaims, provider *fakeOidcProvider)
+		otherKey  bool
+		wantErr   bool
+		wantEmail bool
+	}{
+		{
+			name:      "valid token",
+			wantEmail: true,
+		},
+		{
+			name:    "nonce mismatch",
+			edit:    func(claims jwt.MapClaims, _ *fakeOidcProvider) { claims["nonce"] = "nonce-2" },
+			wantErr: true,
+		},
+		{
+			name:    "missing nonce",
+			edit:    func(claims jwt.MapClaims, _ *fakeOidcProvider) { delete(claims, "nonce") },
+			wantErr: true,
+		},
+		{
+			name: "issuer with a trailing slash",
+			edit: func(claims jwt.MapClaims, provider *fakeOidcProvider) {
+				claims["iss"] = provider.issuer + "/"
+			},
+			wantErr: true,
+		},
+		{
+			name:    "issuer of another provider",
+			edit:    func(claims jwt.MapClaims, _ *fakeOidcProvider) { claims["iss"] = "https://evil.example.com" },
+			wantErr: true,
+		},
+		{
+			name:    "another audience",
+			edit:    func(claims jwt.MapClaims, _ *fakeOidcProvider) { claims["aud"] = "other-client" },
+			wantErr: true,
+		},
+		{
+			name: "several audiences without azp",
+			edit: func(claims jwt.MapClaims, _ *fakeOidcProvider) {
+				claims["aud"] = []string{testOidcClientId, "other-client"}
+			},
+			wantErr: true,
+		},
+		{
+			name: "expired",
+			edit: func(claims jwt.MapClaims, _ *fakeOidcProvider) {
+				claims["exp"] = time.Now().Add(-2 * time.Minute).Unix()
+			},
+			wantErr: true,
+		},
+		{
+			name: "expired within the leeway",
+			edit: func(claims jwt.MapClaims, _ *fakeOidcProvider) {
+				claims["exp"] = time.Now().Add(-30 * time.Second).Unix()
+			},
+			wantEmail: true,
+		},
+		{
+			name:    "without expiry",
+			edit:    func(claims jwt.MapClaims, _ *fakeOidcProvider) { delete(claims, "exp") },
+			wantErr: true,
+		},
+		{
+			name:    "without subject",
+			edit:    func(claims jwt.MapClaims, _ *fakeOidcProvider) { delete(claims, "sub") },
+			wantErr: true,
+		},
+		{
+			name:     "signed by another key",
+			otherKey: true,
+			wantErr:  true,
+		},
+		{
+			name:      "email_verified as a string",
+			edit:      func(claims jwt.MapClaims, _ *fakeOidcProvider) { claims["email_verified"] = "true" },
+			wantEmail: true,
+		},
+		{
+			name: "email_verified false as a string",
+			edit: func(claims jwt.MapClaims, _ *fakeOidcProvider) { claims["email_verified"] = "false" },
+		},
+		{
+			name: "email_verified missing",
+			edit: func(claims jwt.MapClaims, _ *fakeOidcProvider) { delete(claims, "email_verified") },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := newFakeOidcProvider(t)
+			claims := provider.idTokenClaims("nonce-1")
+			if tt.edit != nil {
+				tt.edit(claims, provider)
+			}
+			key := provider.key
+			if tt.otherKey {
+				key = otherKey
+			}
+
+			result, err := provider.client().VerifyIdToken(context.Background(),
+				provider.sign(claims, key, testOidcKid), "nonce-1")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("VerifyIdToken() error = %v, wantErr %t", err, tt.wantErr)
+			}
+			if err == nil && result.EmailVerified != tt.wantEmail {
+				t.Errorf("EmailVerified = %t, want %t", result.EmailVerified, tt.wantEmail)
+			}
+		})
+	}
+}
+
+func TestOidcClientDiscoveryIssuerMismatch(t *testing.T) {
+	provider := newFakeOidcProvider(t)
+	client := provider.client()
+	client.Provider.Issuer = provider.issuer + "/"
+
+	if _, err := client.AuthCodeURL(context.Background(), "state-1", "nonce-1", "verifier-1"); err == nil {
+		t.Fatal("discovery accepted an issuer that differs from the configured one")
+	}
+}
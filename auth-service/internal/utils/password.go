@@ -2,8 +2,11 @@ package utils
 
 import (
 	"context"
+	"github.com/saufiroja/go-otel/auth-service/pkg/observability/metrics"
 	"github.com/saufiroja/go-otel/auth-service/pkg/observability/tracing"
+	"go.opentelemetry.io/otel/attribute"
 	"golang.org/x/crypto/bcrypt"
+	"time"
 )
 
 type PasswordHasher interface {
@@ -13,17 +16,20 @@ type PasswordHasher interface {
 
 type BcryptHasher struct {
 	Trace *tracing.Tracer
+	Meter *metrics.Metric
 }
 
-func NewBcryptHasher(trace *tracing.Tracer) PasswordHasher {
+func NewBcryptHasher(trace *tracing.Tracer, meter *metrics.Metric) PasswordHasher {
 	return &BcryptHasher{
 		Trace: trace,
+		Meter: meter,
 	}
 }
 
 func (b *BcryptHasher) Hash(ctx context.Context, password string) (string, error) {
-	_, span := b.Trace.StartSpan(ctx, "utils.Hash")
+	ctx, span := b.Trace.StartSpan(ctx, "utils.Hash")
 	defer span.End()
+	defer b.recordDuration(ctx, "hash", time.Now())
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
 		return "", err
@@ -32,7 +38,14 @@ func (b *BcryptHasher) Hash(ctx context.Context, password string) (string, error
 }
 
 func (b *BcryptHasher) Compare(ctx context.Context, hashedPassword, password string) error {
-	_, span := b.Trace.StartSpan(ctx, "utils.Compare")
+	ctx, span := b.Trace.StartSpan(ctx, "utils.Compare")
 	defer span.End()
+	defer b.recordDuration(ctx, "compare", time.Now())
 	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
 }
+
+// recordDuration records the time since startTime, the cost of bcrypt is what makes login latency and capacity
+func (b *BcryptHasher) recordDuration(ctx context.Context, operation string, startTime time.Time) {
+	b.Meter.RecordFloat(ctx, metrics.PasswordHashDuration, time.Since(startTime).Seconds(),
+		attribute.Key("operation").String(operation))
+}
@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"context"
+	"github.com/saufiroja/go-otel/auth-service/internal/models"
+)
+
+type requestMetaKey struct{}
+
+// RequestMetaKey is the context key under which the request metadata is stored
+var RequestMetaKey = requestMetaKey{}
+
+type RequestMeta struct {
+	Ip        string
+	UserAgent string
+	// ActorId is set by the auth middleware while a request runs under an impersonation token
+	ActorId string
+	// DpopJkt is the thumbprint of the key a valid DPoP proof of this request was signed with
+	DpopJkt string
+	// ClientCertSubject and ClientCertThumbprint describe the client certificate the TLS connection verified
+	ClientCertSubject    string
+	ClientCertThumbprint string
+}
+
+// Confirmation returns the cnf claim binding tokens issued during the request to the keys the client proved, nil
+// when the client proved none
+func (m RequestMeta) Confirmation() *models.Confirmation {
+	if m.DpopJkt == "" && m.ClientCertThumbprint == "" {
+		return nil
+	}
+	return &models.Confirmation{Jkt: m.DpopJkt, X5tS256: m.ClientCertThumbprint}
+}
+
+// RequestMetaFromContext returns the metadata of the current request, empty outside of a request
+func RequestMetaFromContext(ctx context.Context) RequestMeta {
+	meta, _ := ctx.Value(RequestMetaKey).(RequestMeta)
+	return meta
+}
@@ -0,0 +1,99 @@
+package utils
+
+import (
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/xml"
+	"fmt"
+	"github.com/crewjam/saml"
+	"github.com/saufiroja/go-otel/auth-service/config"
+	"github.com/saufiroja/go-otel/auth-service/pkg/logging"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+const (
+	SamlProviderName = "saml"
+	// samlSignatureMethod signs our AuthnRequests, assertions are verified with whatever the IdP metadata allows
+	samlSignatureMethod = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"
+)
+
+// NewSamlServiceProvider builds the SAML service provider, it returns nil when SAML_ROOT_URL is not set
+func NewSamlServiceProvider(conf *config.AppConfig, logger logging.Logger) *saml.ServiceProvider {
+	if conf.Saml.RootUrl == "" {
+		return nil
+	}
+
+	keyPair, err := tls.LoadX509KeyPair(conf.Saml.CertFile, conf.Saml.KeyFile)
+	if err != nil {
+		logger.LogPanic("Error loading SAML key pair", logging.Err(err))
+	}
+	certificate, err := x509.ParseCertificate(keyPair.Certificate[0])
+	if err != nil {
+		logger.LogPanic("Error parsing SAML certificate", logging.Err(err))
+	}
+	key, ok := keyPair.PrivateKey.(*rsa.PrivateKey)
+	if !ok {
+		logger.LogPanic("SAML key must be an RSA private key")
+	}
+
+	idpMetadata, err := loadIdpMetadata(conf)
+	if err != nil {
+		logger.LogPanic("Error loading SAML IdP metadata", logging.Err(err))
+	}
+
+	rootUrl, err := url.Parse(conf.Saml.RootUrl)
+	if err != nil {
+		logger.LogPanic("Invalid SAML_ROOT_URL", logging.Err(err))
+	}
+
+	return &saml.ServiceProvider{
+		EntityID:          conf.Saml.EntityId,
+		Key:               key,
+		Certificate:       certificate,
+		MetadataURL:       *rootUrl.JoinPath("saml", "metadata"),
+		AcsURL:            *rootUrl.JoinPath("saml", "acs"),
+		IDPMetadata:       idpMetadata,
+		AuthnNameIDFormat: saml.PersistentNameIDFormat,
+		SignatureMethod:   samlSignatureMethod,
+		// InResponseTo is only enforced for SP initiated logins
+		AllowIDPInitiated: false,
+	}
+}
+
+func loadIdpMetadata(conf *config.AppConfig) (*saml.EntityDescriptor, error) {
+	var data []byte
+	var err error
+	if conf.Saml.IdpMetadataFile != "" {
+		data, err = os.ReadFile(conf.Saml.IdpMetadataFile)
+	} else {
+		data, err = fetchIdpMetadata(conf.Saml.IdpMetadataUrl)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := &saml.EntityDescriptor{}
+	if err := xml.Unmarshal(data, metadata); err != nil {
+		return nil, err
+	}
+	return metadata, nil
+}
+
+func fetchIdpMetadata(metadataUrl string) ([]byte, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	res, err := client.Get(metadataUrl)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s returned %d", metadataUrl, res.StatusCode)
+	}
+	return io.ReadAll(res.Body)
+}
@@ -0,0 +1,243 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/saufiroja/go-otel/auth-service/internal/models"
+	"strconv"
+	"strings"
+)
+
+// scimComparisonOperators are the attribute operators of RFC 7644 section 3.4.2.2, pr takes no value
+var scimComparisonOperators = map[string]bool{
+	"eq": true, "ne": true, "co": true, "sw": true, "ew": true,
+	"gt": true, "ge": true, "lt": true, "le": true,
+}
+
+// scimSchemaPrefixes may qualify attribute paths in filters and patch paths, they are stripped
+var scimSchemaPrefixes = []string{
+	strings.ToLower(models.ScimSchemaUser) + ":",
+	strings.ToLower(models.ScimSchemaGroup) + ":",
+}
+
+type scimFilterParser struct {
+	tokens []string
+	pos    int
+}
+
+// ParseScimFilter parses a SCIM filter expression such as `userName eq "a@b.c" and not (active eq false)`,
+// value paths like `emails[value co "@example.com"]` are flattened to comparisons on the sub attribute
+func ParseScimFilter(filter string) (*models.ScimFilter, error) {
+	tokens, err := tokenizeScimFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("empty filter")
+	}
+
+	parser := &scimFilterParser{tokens: tokens}
+	expression, err := parser.parseOr("")
+	if err != nil {
+		return nil, err
+	}
+	if parser.pos != len(parser.tokens) {
+		return nil, fmt.Errorf("unexpected %q", parser.tokens[parser.pos])
+	}
+	return expression, nil
+}
+
+// NormalizeScimPath lower cases an attribute path and strips the core schema urn
+func NormalizeScimPath(path string) string {
+	path = strings.ToLower(strings.TrimSpace(path))
+	for _, prefix := range scimSchemaPrefixes {
+		path = strings.TrimPrefix(path, prefix)
+	}
+	return path
+}
+
+func (p *scimFilterParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *scimFilterParser) next() string {
+	token := p.peek()
+	p.pos++
+	return token
+}
+
+func (p *scimFilterParser) expect(token string) error {
+	if got := p.next(); got != token {
+		return fmt.Errorf("expected %q but got %q", token, got)
+	}
+	return nil
+}
+
+// parseOr parses a disjunction, parent is the attribute of an enclosing value path
+func (p *scimFilterParser) parseOr(parent string) (*models.ScimFilter, error) {
+	left, err := p.parseAnd(parent)
+	if err != nil {
+		return nil, err
+	}
+	for strings.EqualFold(p.peek(), models.ScimFilterOr) {
+		p.next()
+		right, err := p.parseAnd(parent)
+		if err != nil {
+			return nil, err
+		}
+		left = &models.ScimFilter{Op: models.ScimFilterOr, Children: []*models.ScimFilter{left, right}}
+	}
+	return left, nil
+}
+
+func (p *scimFilterParser) parseAnd(parent string) (*models.ScimFilter, error) {
+	left, err := p.parseUnary(parent)
+	if err != nil {
+		return nil, err
+	}
+	for strings.EqualFold(p.peek(), models.ScimFilterAnd) {
+		p.next()
+		right, err := p.parseUnary(parent)
+		if err != nil {
+			return nil, err
+		}
+		left = &models.ScimFilter{Op: models.ScimFilterAnd, Children: []*models.ScimFilter{left, right}}
+	}
+	return left, nil
+}
+
+func (p *scimFilterParser) parseUnary(parent string) (*models.ScimFilter, error) {
+	switch token := p.peek(); {
+	case strings.EqualFold(token, models.ScimFilterNot):
+		p.next()
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		inner, err := p.parseOr(parent)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return &models.ScimFilter{Op: models.ScimFilterNot, Children: []*models.ScimFilter{inner}}, nil
+	case token == "(":
+		p.next()
+		inner, err := p.parseOr(parent)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return inner, nil
+	default:
+		return p.parseAttribute(parent)
+	}
+}
+
+func (p *scimFilterParser) parseAttribute(parent string) (*models.ScimFilter, error) {
+	token := p.next()
+	if token == "" || !isScimAttributePath(token) {
+		return nil, fmt.Errorf("expected attribute path but got %q", token)
+	}
+	attribute := NormalizeScimPath(token)
+	if parent != "" {
+		attribute = parent + "." + attribute
+	}
+
+	if p.peek() == "[" {
+		if parent != "" {
+			return nil, fmt.Errorf("nested value paths are not supported")
+		}
+		p.next()
+		inner, err := p.parseOr(attribute)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("]"); err != nil {
+			return nil, err
+		}
+		return inner, nil
+	}
+
+	operator := strings.ToLower(p.next())
+	if operator == "pr" {
+		return &models.ScimFilter{Op: operator, Attribute: attribute}, nil
+	}
+	if !scimComparisonOperators[operator] {
+		return nil, fmt.Errorf("unknown operator %q", operator)
+	}
+
+	value, err := parseScimValue(p.next())
+	if err != nil {
+		return nil, err
+	}
+	return &models.ScimFilter{Op: operator, Attribute: attribute, Value: value}, nil
+}
+
+func parseScimValue(token string) (any, error) {
+	switch {
+	case strings.HasPrefix(token, `"`):
+		var value string
+		if err := json.Unmarshal([]byte(token), &value); err != nil {
+			return nil, fmt.Errorf("invalid string %s", token)
+		}
+		return value, nil
+	case strings.EqualFold(token, "true"):
+		return true, nil
+	case strings.EqualFold(token, "false"):
+		return false, nil
+	case strings.EqualFold(token, "null"):
+		return nil, nil
+	}
+	value, err := strconv.ParseFloat(token, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value %q", token)
+	}
+	return value, nil
+}
+
+func isScimAttributePath(token string) bool {
+	switch token {
+	case "(", ")", "[", "]":
+		return false
+	}
+	return !strings.HasPrefix(token, `"`)
+}
+
+// tokenizeScimFilter splits a filter into parentheses, brackets, quoted strings and bare words
+func tokenizeScimFilter(filter string) ([]string, error) {
+	tokens := make([]string, 0)
+	for i := 0; i < len(filter); {
+		switch c := filter[i]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(' || c == ')' || c == '[' || c == ']':
+			tokens = append(tokens, string(c))
+			i++
+		case c == '"':
+			end := i + 1
+			for ; end < len(filter) && filter[end] != '"'; end++ {
+				if filter[end] == '\\' {
+					end++
+				}
+			}
+			if end >= len(filter) {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			tokens = append(tokens, filter[i:end+1])
+			i = end + 1
+		default:
+			end := i
+			for ; end < len(filter) && !strings.ContainsRune(" \t\n\r()[]\"", rune(filter[end])); end++ {
+			}
+			tokens = append(tokens, filter[i:end])
+			i = end
+		}
+	}
+	return tokens, nil
+}
@@ -0,0 +1,12 @@
+package utils
+
+import "unicode/utf8"
+
+// TruncateRunes returns s cut to at most n runes, it is returned as is when it fits
+func TruncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:n])
+}
@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"github.com/saufiroja/go-otel/auth-service/config"
+	"github.com/saufiroja/go-otel/auth-service/pkg/logging"
+	"os"
+)
+
+// NewServerTlsConfig builds the listener TLS config, it returns nil when TLS_CERT_FILE is not set. Client
+// certificates are requested but optional so browsers and api key clients keep working on the same port
+func NewServerTlsConfig(conf *config.AppConfig, logger logging.Logger) *tls.Config {
+	if conf.Tls.CertFile == "" {
+		return nil
+	}
+
+	keyPair, err := tls.LoadX509KeyPair(conf.Tls.CertFile, conf.Tls.KeyFile)
+	if err != nil {
+		logger.LogPanic("Error loading TLS key pair", logging.Err(err))
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{keyPair},
+	}
+	if conf.Tls.ClientCaFile == "" {
+		return tlsConfig
+	}
+
+	bundle, err := os.ReadFile(conf.Tls.ClientCaFile)
+	if err != nil {
+		logger.LogPanic("Error reading TLS client CA file", logging.Err(err))
+	}
+	clientCas := x509.NewCertPool()
+	if !clientCas.AppendCertsFromPEM(bundle) {
+		logger.LogPanic("TLS client CA file contains no certificates")
+	}
+	tlsConfig.ClientCAs = clientCas
+	tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+
+	return tlsConfig
+}
+
+// CertificateThumbprint returns the base64url SHA-256 of the DER certificate, the x5t#S256 of RFC 8705 section 3.1
+func CertificateThumbprint(certificate *x509.Certificate) string {
+	sum := sha256.Sum256(certificate.Raw)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,232 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"github.com/saufiroja/go-otel/auth-service/config"
+	"github.com/saufiroja/go-otel/auth-service/pkg/logging"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCertificate is a key pair and the certificate issued for it
+type testCertificate struct {
+	certificate *x509.Certificate
+	key         *ecdsa.PrivateKey
+}
+
+func (c *testCertificate) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.certificate.Raw}, PrivateKey: c.key, Leaf: c.certificate}
+}
+
+// issueCertificate creates a certificate for commonName signed by issuer, a nil issuer makes a self signed CA
+func issueCertificate(t *testing.T, commonName string, issuer *testCertificate,
+	edit func(template *x509.Certificate)) *testCertificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName, Organization: []string{"Test"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	if edit != nil {
+		edit(template)
+	}
+
+	parent, signer := template, key
+	if issuer == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		parent, signer = issuer.certificate, issuer.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCertificate{certificate: certificate, key: key}
+}
+
+func writePem(t *testing.T, path, blockType string, der []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// tlsFixture is a server certificate and a client CA written where NewServerTlsConfig reads them
+type tlsFixture struct {
+	serverCa *testCertificate
+	clientCa *testCertificate
+	conf     *config.AppConfig
+}
+
+func newTlsFixture(t *testing.T, withClientCa bool) *tlsFixture {
+	t.Helper()
+	dir := t.TempDir()
+
+	serverCa := issueCertificate(t, "Test Server CA", nil, nil)
+	server := issueCertificate(t, "localhost", serverCa, func(template *x509.Certificate) {
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+		template.IPAddresses = []net.IP{net.ParseIP("127.0.0.1")}
+	})
+	clientCa := issueCertificate(t, "Test Client CA", nil, nil)
+
+	conf := &config.AppConfig{}
+	conf.Tls.CertFile = filepath.Join(dir, "server.crt")
+	conf.Tls.KeyFile = filepath.Join(dir, "server.key")
+	writePem(t, conf.Tls.CertFile, "CERTIFICATE", server.certificate.Raw)
+	keyDer, err := x509.MarshalECPrivateKey(server.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePem(t, conf.Tls.KeyFile, "EC PRIVATE KEY", keyDer)
+	if withClientCa {
+		conf.Tls.ClientCaFile = filepath.Join(dir, "client-ca.crt")
+		writePem(t, conf.Tls.ClientCaFile, "CERTIFICATE", clientCa.certificate.Raw)
+	}
+
+	return &tlsFixture{serverCa: serverCa, clientCa: clientCa, conf: conf}
+}
+
+func (f *tlsFixture) clientCertificate(t *testing.T, commonName string, issuer *testCertificate) *testCertificate {
+	return issueCertificate(t, commonName, issuer, func(template *x509.Certificate) {
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	})
+}
+
+// get makes a request over the server TLS config, the handler answers with the verified client subject and
+// thumbprint
+func (f *tlsFixture) get(t *testing.T, client *testCertificate) (string, error) {
+	t.Helper()
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.VerifiedChains) == 0 {
+			_, _ = io.WriteString(w, "anonymous")
+			return
+		}
+		leaf := r.TLS.VerifiedChains[0][0]
+		_, _ = fmt.Fprintf(w, "%s %s", leaf.Subject.String(), CertificateThumbprint(leaf))
+	}))
+	server.TLS = NewServerTlsConfig(f.conf, logging.NewLogrusAdapter())
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(f.serverCa.certificate)
+	clientTls := &tls.Config{RootCAs: roots}
+	if client != nil {
+		// sent even when its issuer is not one the server asked for, so the server is the one deciding
+		certificate := client.tlsCertificate()
+		clientTls.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return &certificate, nil
+		}
+	}
+	httpClient := &http.Client{Transport: &http.Transport{TLSClientConfig: clientTls}}
+	defer httpClient.CloseIdleConnections()
+
+	response, err := httpClient.Get(server.URL)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	return string(body), err
+}
+
+func TestNewServerTlsConfigWithoutCertificate(t *testing.T) {
+	if tlsConfig := NewServerTlsConfig(&config.AppConfig{}, logging.NewLogrusAdapter()); tlsConfig != nil {
+		t.Fatal("expected no TLS config without TLS_CERT_FILE")
+	}
+}
+
+func TestNewServerTlsConfigWithoutClientCa(t *testing.T) {
+	fixture := newTlsFixture(t, false)
+	client := fixture.clientCertificate(t, "svc-1", fixture.clientCa)
+
+	body, err := fixture.get(t, client)
+	if err != nil {
+		t.Fatalf("request error = %v", err)
+	}
+	if body != "anonymous" {
+		t.Errorf("body = %q, a certificate must not count without a client CA", body)
+	}
+}
+
+func TestNewServerTlsConfigClientCertificateIsOptional(t *testing.T) {
+	fixture := newTlsFixture(t, true)
+
+	body, err := fixture.get(t, nil)
+	if err != nil {
+		t.Fatalf("request error = %v", err)
+	}
+	if body != "anonymous" {
+		t.Errorf("body = %q, want anonymous", body)
+	}
+}
+
+func TestNewServerTlsConfigVerifiesClientCertificate(t *testing.T) {
+	fixture := newTlsFixture(t, true)
+	client := fixture.clientCertificate(t, "svc-1", fixture.clientCa)
+
+	body, err := fixture.get(t, client)
+	if err != nil {
+		t.Fatalf("request error = %v", err)
+	}
+	want := client.certificate.Subject.String() + " " + CertificateThumbprint(client.certificate)
+	if body != want {
+		t.Errorf("body = %q, want %q", body, want)
+	}
+}
+
+func TestNewServerTlsConfigRejectsUntrustedClientCertificate(t *testing.T) {
+	fixture := newTlsFixture(t, true)
+	untrustedCa := issueCertificate(t, "Untrusted CA", nil, nil)
+	client := fixture.clientCertificate(t, "svc-1", untrustedCa)
+
+	if body, err := fixture.get(t, client); err == nil {
+		t.Fatalf("request with an untrusted certificate succeeded with %q", body)
+	}
+}
+
+func TestNewServerTlsConfigRejectsExpiredClientCertificate(t *testing.T) {
+	fixture := newTlsFixture(t, true)
+	client := issueCertificate(t, "svc-1", fixture.clientCa, func(template *x509.Certificate) {
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+		template.NotBefore = time.Now().Add(-2 * time.Hour)
+		template.NotAfter = time.Now().Add(-time.Hour)
+	})
+
+	if body, err := fixture.get(t, client); err == nil {
+		t.Fatalf("request with an expired certificate succeeded with %q", body)
+	}
+}
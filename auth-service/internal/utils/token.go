@@ -2,22 +2,45 @@ package utils
 
 import (
 	"context"
+	"errors"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/saufiroja/go-otel/auth-service/config"
 	"github.com/saufiroja/go-otel/auth-service/internal/contracts/requests"
+	"github.com/saufiroja/go-otel/auth-service/internal/models"
+	"github.com/saufiroja/go-otel/auth-service/pkg/observability/metrics"
 	"github.com/saufiroja/go-otel/auth-service/pkg/observability/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"slices"
+	"strings"
 	"time"
 )
 
+const (
+	AccessTokenType  = "access"
+	RefreshTokenType = "refresh"
+	// ExchangedTokenType tokens are issued for another audience, so they are never accepted as access tokens here
+	ExchangedTokenType = "exchanged"
+	// impersonationTokenType only labels metrics, impersonation tokens are access tokens with an act claim
+	impersonationTokenType = "impersonation"
+)
+
 type GenerateToken struct {
-	Secret string
-	Trace  *tracing.Tracer
+	Secret                string
+	Trace                 *tracing.Tracer
+	Meter                 *metrics.Metric
+	BrowserAccessTokenTTL time.Duration
+	ImpersonationTTL      time.Duration
+	ExchangeTTL           time.Duration
 }
 
-func NewGenerateToken(conf *config.AppConfig, trace *tracing.Tracer) *GenerateToken {
+func NewGenerateToken(conf *config.AppConfig, trace *tracing.Tracer, meter *metrics.Metric) *GenerateToken {
 	return &GenerateToken{
-		Secret: conf.Jwt.Secret,
-		Trace:  trace,
+		Secret:                conf.Jwt.Secret,
+		Trace:                 trace,
+		Meter:                 meter,
+		BrowserAccessTokenTTL: conf.Cookie.AccessTokenTTL,
+		ImpersonationTTL:      conf.Impersonation.TokenTTL,
+		ExchangeTTL:           conf.TokenExchange.TokenTTL,
 	}
 }
 
@@ -26,19 +49,50 @@ func (g *GenerateToken) GenerateAccessToken(ctx context.Context,
 	ctx, span := g.Trace.StartSpan(ctx, "utils.GenerateToken.GenerateAccessToken")
 	defer span.End()
 
-	expired := time.Now().Add(time.Hour * 24).Unix()
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id":   request.UserId,
-		"full_name": request.FullName,
-		"exp":       time.Now().Add(time.Hour * 24).Unix(),
-	})
+	// browser access tokens live in a cookie and are kept short since they are sent automatically
+	ttl := time.Hour * 24
+	if request.Browser {
+		ttl = g.BrowserAccessTokenTTL
+	}
 
-	tokenString, err := token.SignedString([]byte(g.Secret))
-	if err != nil {
-		return "", 0, err
+	now := time.Now()
+	return g.sign(ctx, AccessTokenType, g.claims(request, AccessTokenType, now, now.Add(ttl).Unix()))
+}
+
+// GenerateImpersonationToken issues a short lived access token whose subject is request.UserId and whose act claim
+// names request.Actor as in RFC 8693 section 4.1, sid is the actor's session so signing out ends the impersonation
+func (g *GenerateToken) GenerateImpersonationToken(ctx context.Context,
+	request *requests.GenerateTokenRequest) (string, int64, error) {
+	ctx, span := g.Trace.StartSpan(ctx, "utils.GenerateToken.GenerateImpersonationToken")
+	defer span.End()
+
+	if request.Actor == nil || request.Actor.Subject == "" {
+		return "", 0, errors.New("impersonation token needs an actor")
+	}
+
+	now := time.Now()
+	return g.sign(ctx, impersonationTokenType,
+		g.claims(request, AccessTokenType, now, now.Add(g.ImpersonationTTL).Unix()))
+}
+
+// GenerateExchangedToken issues the token of an RFC 8693 exchange, it is only valid for request.Audience and never
+// outlives request.NotAfter, the expiry of the subject token
+func (g *GenerateToken) GenerateExchangedToken(ctx context.Context,
+	request *requests.GenerateTokenRequest) (string, int64, error) {
+	ctx, span := g.Trace.StartSpan(ctx, "utils.GenerateToken.GenerateExchangedToken")
+	defer span.End()
+
+	if request.Audience == "" {
+		return "", 0, errors.New("exchanged token needs an audience")
 	}
 
-	return tokenString, expired, nil
+	now := time.Now()
+	expired := now.Add(g.ExchangeTTL).Unix()
+	if request.NotAfter != 0 && request.NotAfter < expired {
+		expired = request.NotAfter
+	}
+
+	return g.sign(ctx, ExchangedTokenType, g.claims(request, ExchangedTokenType, now, expired))
 }
 
 func (g *GenerateToken) GenerateRefreshToken(ctx context.Context,
@@ -46,17 +100,132 @@ func (g *GenerateToken) GenerateRefreshToken(ctx context.Context,
 	ctx, span := g.Trace.StartSpan(ctx, "utils.GenerateToken.GenerateRefreshToken")
 	defer span.End()
 
-	expired := time.Now().Add(time.Hour * 24 * 7).Unix()
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id":   request.UserId,
-		"full_name": request.FullName,
-		"exp":       time.Now().Add(time.Hour * 24 * 7).Unix(),
-	})
+	now := time.Now()
+	return g.sign(ctx, RefreshTokenType, g.claims(request, RefreshTokenType, now, now.Add(time.Hour*24*7).Unix()))
+}
 
-	tokenString, err := token.SignedString([]byte(g.Secret))
+// claims builds the claims shared by every token, the optional ones are only set when the request has them
+func (g *GenerateToken) claims(request *requests.GenerateTokenRequest, tokenType string, now time.Time,
+	expired int64) jwt.MapClaims {
+	claims := jwt.MapClaims{
+		"user_id":    request.UserId,
+		"sub":        request.UserId,
+		"full_name":  request.FullName,
+		"token_type": tokenType,
+		"sid":        request.SessionId,
+		"iat":        now.Unix(),
+		"exp":        expired,
+	}
+	if request.TokenId != "" {
+		claims["jti"] = request.TokenId
+	}
+	if request.Actor != nil {
+		claims["act"] = request.Actor
+	}
+	if request.Audience != "" {
+		claims["aud"] = request.Audience
+	}
+	if len(request.Scopes) > 0 {
+		claims["scope"] = strings.Join(request.Scopes, " ")
+	}
+	if request.Confirmation != nil {
+		claims["cnf"] = request.Confirmation
+	}
+	return claims
+}
+
+// sign signs claims and counts the token under issuedType
+func (g *GenerateToken) sign(ctx context.Context, issuedType string, claims jwt.MapClaims) (string, int64, error) {
+	tokenString, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(g.Secret))
 	if err != nil {
 		return "", 0, err
 	}
 
-	return tokenString, expired, nil
+	binding := "bearer"
+	if cnf, ok := claims["cnf"].(*models.Confirmation); ok && cnf.Jkt != "" {
+		binding = "dpop"
+	} else if ok && cnf.X5tS256 != "" {
+		binding = "mtls"
+	}
+	g.Meter.Add(ctx, metrics.TokensIssued, 1,
+		attribute.Key("token.type").String(issuedType),
+		attribute.Key("token.binding").String(binding),
+	)
+
+	return tokenString, claims["exp"].(int64), nil
+}
+
+// VerifyToken checks the signature and expiry of tokenString and that it is one of tokenTypes
+func (g *GenerateToken) VerifyToken(ctx context.Context, tokenString string,
+	tokenTypes ...string) (*models.TokenClaims, error) {
+	_, span := g.Trace.StartSpan(ctx, "utils.GenerateToken.VerifyToken")
+	defer span.End()
+
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(g.Secret), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, err
+	}
+
+	result := &models.TokenClaims{}
+	result.UserId, _ = claims["user_id"].(string)
+	result.FullName, _ = claims["full_name"].(string)
+	result.TokenType, _ = claims["token_type"].(string)
+	result.SessionId, _ = claims["sid"].(string)
+	result.TokenId, _ = claims["jti"].(string)
+	if act, ok := claims["act"]; ok {
+		result.Actor = parseActor(act, 0)
+		if result.Actor == nil {
+			return nil, errors.New("token has a malformed act claim")
+		}
+		result.ActorId = result.Actor.Subject
+	}
+	result.Audience, _ = claims["aud"].(string)
+	if scope, ok := claims["scope"].(string); ok {
+		result.Scopes = strings.Fields(scope)
+	}
+	if cnf, ok := claims["cnf"]; ok {
+		confirmation, ok := cnf.(map[string]any)
+		if !ok {
+			return nil, errors.New("token has a malformed cnf claim")
+		}
+		result.Confirmation = &models.Confirmation{}
+		result.Confirmation.Jkt, _ = confirmation["jkt"].(string)
+		result.Confirmation.X5tS256, _ = confirmation["x5t#S256"].(string)
+	}
+	if exp, ok := claims["exp"].(float64); ok {
+		result.ExpiresAt = int64(exp)
+	}
+
+	if result.UserId == "" {
+		return nil, errors.New("token has no user_id")
+	}
+	if !slices.Contains(tokenTypes, result.TokenType) {
+		return nil, errors.New("unexpected token type")
+	}
+
+	return result, nil
+}
+
+// parseActor reads a nested act claim, it returns nil when a level has no sub or the chain is too deep
+func parseActor(value any, depth int) *models.Actor {
+	act, ok := value.(map[string]any)
+	if !ok || depth >= models.MaxActorDepth {
+		return nil
+	}
+
+	actor := &models.Actor{}
+	actor.Subject, _ = act["sub"].(string)
+	if actor.Subject == "" {
+		return nil
+	}
+	if next, ok := act["act"]; ok {
+		actor.Actor = parseActor(next, depth+1)
+		if actor.Actor == nil {
+			return nil
+		}
+	}
+	return actor
 }
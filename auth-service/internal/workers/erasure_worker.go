@@ -0,0 +1,92 @@
+package workers
+
+import (
+	"context"
+	"github.com/saufiroja/go-otel/auth-service/config"
+	"github.com/saufiroja/go-otel/auth-service/internal/services"
+	"github.com/saufiroja/go-otel/auth-service/pkg/logging"
+	"github.com/saufiroja/go-otel/auth-service/pkg/observability/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"time"
+)
+
+// erasureBatchSize bounds how many accounts a single run erases
+const erasureBatchSize = 100
+
+// ErasureWorker periodically erases users whose erasure grace period has passed
+type ErasureWorker struct {
+	PrivacyService services.PrivacyService
+	Logger         logging.Logger
+	Trace          *tracing.Tracer
+	Interval       time.Duration
+}
+
+func NewErasureWorker(privacyService services.PrivacyService, logger logging.Logger, trace *tracing.Tracer,
+	conf *config.AppConfig) *ErasureWorker {
+	return &ErasureWorker{
+		PrivacyService: privacyService,
+		Logger:         logger,
+		Trace:          trace,
+		Interval:       conf.Gdpr.ErasureInterval,
+	}
+}
+
+// Start runs the worker until ctx is cancelled
+func (w *ErasureWorker) Start(ctx context.Context) {
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+
+	w.Logger.LogInfoContext(ctx, "erasure worker started", logging.String("interval", w.Interval.String()))
+
+	for {
+		w.RunOnce(ctx)
+
+		select {
+		case <-ctx.Done():
+			w.Logger.LogInfoContext(ctx, "erasure worker stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce processes due erasure requests in batches until none are left
+func (w *ErasureWorker) RunOnce(ctx context.Context) {
+	ctx, span := w.Trace.StartSpan(ctx, "worker.ErasureWorker.Run", trace.WithNewRoot())
+	defer span.End()
+
+	totalProcessed, totalFailed := 0, 0
+	for {
+		processed, failed, err := w.PrivacyService.ProcessDueErasures(ctx, erasureBatchSize)
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			w.Logger.LogErrorContext(ctx, "erasure worker run failed", logging.Err(err))
+			return
+		}
+		totalProcessed += processed
+		totalFailed += failed
+
+		// failed requests stay pending, stop rather than spin on them until the next tick
+		if processed+failed < erasureBatchSize || failed > 0 {
+			break
+		}
+	}
+
+	span.SetAttributes(
+		attribute.Key("erasure.processed").Int(totalProcessed),
+		attribute.Key("erasure.failed").Int(totalFailed),
+	)
+
+	if totalProcessed > 0 || totalFailed > 0 {
+		w.Logger.LogInfoContext(ctx, "erasure worker run finished", logging.Int("erased", totalProcessed),
+			logging.Int("failed", totalFailed))
+	}
+
+	if totalFailed > 0 {
+		span.SetStatus(codes.Error, "Some erasures failed")
+		return
+	}
+	span.SetStatus(codes.Ok, "Erasure run finished")
+}
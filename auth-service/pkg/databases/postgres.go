@@ -40,11 +40,11 @@ func NewPostgres(conf *config.AppConfig, logger logging.Logger) PostgresManager
 
 		db, err := sql.Open("postgres", dsn)
 		if err != nil {
-			logger.LogPanic(fmt.Sprintf("Error opening databases: %v", err))
+			logger.LogPanic("Error opening databases", logging.Err(err))
 		}
 
 		if err := db.Ping(); err != nil {
-			logger.LogPanic(fmt.Sprintf("Error connecting to databases: %v", err))
+			logger.LogPanic("Error connecting to databases", logging.Err(err))
 		}
 
 		logger.LogInfo("Database connected")
@@ -0,0 +1,72 @@
+package logging
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	LogrusBackend = "logrus"
+	SlogBackend   = "slog"
+)
+
+// NewLogger creates the adapter of backend, logrus unless it is SlogBackend
+func NewLogger(backend string) Logger {
+	if backend == SlogBackend {
+		return NewSlogAdapter()
+	}
+	return NewLogrusAdapter()
+}
+
+// core holds what every adapter shares: the level, sampling and sinks, adapters embed it and only write entries
+type core struct {
+	level   atomic.Int32
+	sampler atomic.Pointer[sampler]
+	mu      sync.RWMutex
+	sinks   []Sink
+}
+
+func newCore() *core {
+	c := &core{}
+	c.SetLevel(InfoLevel)
+	return c
+}
+
+func (c *core) SetLevel(level Level) {
+	c.level.Store(int32(level))
+}
+
+func (c *core) Level() Level {
+	return Level(c.level.Load())
+}
+
+func (c *core) SetSampling(sampling Sampling) {
+	c.sampler.Store(newSampler(sampling))
+}
+
+func (c *core) AddSink(sink Sink) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sinks = append(c.sinks, sink)
+}
+
+// entry filters an entry by level and sampling and emits it to the sinks, the adapter writes it with the returned
+// fields only when ok. Sinks come first since a panic entry panics once written
+func (c *core) entry(ctx context.Context, level Level, message string, fields []Field) ([]Field, bool) {
+	if level < c.Level() {
+		return nil, false
+	}
+	if s := c.sampler.Load(); s != nil && !s.allow(level, message) {
+		return nil, false
+	}
+	fields = withTraceContext(ctx, fields)
+
+	c.mu.RLock()
+	sinks := c.sinks
+	c.mu.RUnlock()
+	for _, sink := range sinks {
+		sink.Emit(ctx, level, message, fields)
+	}
+	return fields, true
+}
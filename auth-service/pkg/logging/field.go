@@ -0,0 +1,99 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"go.opentelemetry.io/otel/trace"
+	"strings"
+)
+
+const (
+	TraceIdKey = "trace_id"
+	SpanIdKey  = "span_id"
+)
+
+// Level is the severity of an entry
+type Level int
+
+const (
+	DebugLevel Level = iota
+	InfoLevel
+	WarnLevel
+	ErrorLevel
+	PanicLevel
+)
+
+func (l Level) String() string {
+	switch l {
+	case DebugLevel:
+		return "debug"
+	case InfoLevel:
+		return "info"
+	case WarnLevel:
+		return "warn"
+	case ErrorLevel:
+		return "error"
+	default:
+		return "panic"
+	}
+}
+
+// ParseLevel reads the name of a level as String writes it, case-insensitive
+func ParseLevel(name string) (Level, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "debug":
+		return DebugLevel, nil
+	case "info":
+		return InfoLevel, nil
+	case "warn", "warning":
+		return WarnLevel, nil
+	case "error":
+		return ErrorLevel, nil
+	case "panic":
+		return PanicLevel, nil
+	default:
+		return InfoLevel, fmt.Errorf("unknown log level %q", name)
+	}
+}
+
+// Field is a key value pair of a structured entry
+type Field struct {
+	Key   string
+	Value any
+}
+
+func String(key, value string) Field {
+	return Field{Key: key, Value: value}
+}
+
+func Int(key string, value int) Field {
+	return Field{Key: key, Value: value}
+}
+
+func Int64(key string, value int64) Field {
+	return Field{Key: key, Value: value}
+}
+
+func Any(key string, value any) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Err is the error of an entry under the "error" key
+func Err(err error) Field {
+	if err == nil {
+		return Field{Key: "error", Value: nil}
+	}
+	return Field{Key: "error", Value: err.Error()}
+}
+
+// withTraceContext appends the trace and span id of the span in ctx, fields are returned as is without one
+func withTraceContext(ctx context.Context, fields []Field) []Field {
+	spanContext := trace.SpanContextFromContext(ctx)
+	if !spanContext.IsValid() {
+		return fields
+	}
+	return append(fields,
+		String(TraceIdKey, spanContext.TraceID().String()),
+		String(SpanIdKey, spanContext.SpanID().String()),
+	)
+}
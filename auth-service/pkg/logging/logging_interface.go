@@ -1,9 +1,28 @@
 package logging
 
+import "context"
+
 type Logger interface {
-	LogInfo(message string)
-	LogError(message string)
-	LogWarn(message string)
-	LogDebug(message string)
-	LogPanic(message string)
+	LogInfo(message string, fields ...Field)
+	LogError(message string, fields ...Field)
+	LogWarn(message string, fields ...Field)
+	LogDebug(message string, fields ...Field)
+	LogPanic(message string, fields ...Field)
+	// the Context variants attach the trace and span id of the span in ctx so entries link to their trace
+	LogInfoContext(ctx context.Context, message string, fields ...Field)
+	LogErrorContext(ctx context.Context, message string, fields ...Field)
+	LogWarnContext(ctx context.Context, message string, fields ...Field)
+	LogDebugContext(ctx context.Context, message string, fields ...Field)
+	// AddSink forwards every entry written from now on to sink
+	AddSink(sink Sink)
+	// SetLevel changes the lowest level written, it is safe to call while logging
+	SetLevel(level Level)
+	Level() Level
+	// SetSampling replaces the sampling of repeated entries, the zero Sampling turns it off
+	SetSampling(sampling Sampling)
+}
+
+// Sink receives the entries of a Logger, fields already include the trace context
+type Sink interface {
+	Emit(ctx context.Context, level Level, message string, fields []Field)
 }
@@ -1,6 +1,7 @@
 package logging
 
 import (
+	"context"
 	"github.com/sirupsen/logrus"
 	"io"
 	"log"
@@ -8,36 +9,81 @@ import (
 )
 
 type LogrusAdapter struct {
+	*core
 	logrus *logrus.Logger
 }
 
 func NewLogrusAdapter() Logger {
 	logger := logrus.New()
 	logger.Formatter = &logrus.JSONFormatter{}
+	// the core filters levels so the one set with SetLevel is the only one in effect
+	logger.SetLevel(logrus.DebugLevel)
 	log.SetOutput(logger.Writer())
 	logger.SetOutput(io.MultiWriter(os.Stdout))
 
 	return &LogrusAdapter{
+		core:   newCore(),
 		logrus: logger,
 	}
 }
 
-func (l *LogrusAdapter) LogInfo(message string) {
-	l.logrus.Info(message)
+func (l *LogrusAdapter) LogInfo(message string, fields ...Field) {
+	l.log(context.Background(), InfoLevel, message, fields)
 }
 
-func (l *LogrusAdapter) LogError(message string) {
-	l.logrus.Error(message)
+func (l *LogrusAdapter) LogError(message string, fields ...Field) {
+	l.log(context.Background(), ErrorLevel, message, fields)
 }
 
-func (l *LogrusAdapter) LogWarn(message string) {
-	l.logrus.Warn(message)
+func (l *LogrusAdapter) LogWarn(message string, fields ...Field) {
+	l.log(context.Background(), WarnLevel, message, fields)
 }
 
-func (l *LogrusAdapter) LogDebug(message string) {
-	l.logrus.Debug(message)
+func (l *LogrusAdapter) LogDebug(message string, fields ...Field) {
+	l.log(context.Background(), DebugLevel, message, fields)
 }
 
-func (l *LogrusAdapter) LogPanic(message string) {
-	l.logrus.Panic(message)
+func (l *LogrusAdapter) LogPanic(message string, fields ...Field) {
+	l.log(context.Background(), PanicLevel, message, fields)
+}
+
+func (l *LogrusAdapter) LogInfoContext(ctx context.Context, message string, fields ...Field) {
+	l.log(ctx, InfoLevel, message, fields)
+}
+
+func (l *LogrusAdapter) LogErrorContext(ctx context.Context, message string, fields ...Field) {
+	l.log(ctx, ErrorLevel, message, fields)
+}
+
+func (l *LogrusAdapter) LogWarnContext(ctx context.Context, message string, fields ...Field) {
+	l.log(ctx, WarnLevel, message, fields)
+}
+
+func (l *LogrusAdapter) LogDebugContext(ctx context.Context, message string, fields ...Field) {
+	l.log(ctx, DebugLevel, message, fields)
+}
+
+func (l *LogrusAdapter) log(ctx context.Context, level Level, message string, fields []Field) {
+	fields, ok := l.entry(ctx, level, message, fields)
+	if !ok {
+		return
+	}
+
+	entry := logrus.NewEntry(l.logrus)
+	if len(fields) > 0 {
+		logrusFields := make(logrus.Fields, len(fields))
+		for _, field := range fields {
+			logrusFields[field.Key] = field.Value
+		}
+		entry = entry.WithFields(logrusFields)
+	}
+	entry.Log(logrusLevels[level], message)
+}
+
+var logrusLevels = map[Level]logrus.Level{
+	DebugLevel: logrus.DebugLevel,
+	InfoLevel:  logrus.InfoLevel,
+	WarnLevel:  logrus.WarnLevel,
+	ErrorLevel: logrus.ErrorLevel,
+	PanicLevel: logrus.PanicLevel,
 }
@@ -0,0 +1,62 @@
+package logging
+
+import (
+	"sync"
+	"time"
+)
+
+// Sampling limits how often an entry repeats, within each Tick the first Initial entries with the same level and
+// message are written and then every Thereafter-th one. Messages are constant now that values go in fields, so
+// the level and message identify the call site
+type Sampling struct {
+	Initial    int
+	Thereafter int
+	Tick       time.Duration
+}
+
+// sampler counts entries per level and message, the counts are cleared every tick so the map stays bounded by the
+// call sites logging within one
+type sampler struct {
+	Sampling
+	mu          sync.Mutex
+	windowStart time.Time
+	counts      map[samplingKey]int
+}
+
+type samplingKey struct {
+	level   Level
+	message string
+}
+
+func newSampler(sampling Sampling) *sampler {
+	if sampling.Tick <= 0 {
+		return nil
+	}
+	return &sampler{
+		Sampling: sampling,
+		counts:   make(map[samplingKey]int),
+	}
+}
+
+// allow reports whether an entry is written, errors and panics are never sampled
+func (s *sampler) allow(level Level, message string) bool {
+	if level >= ErrorLevel {
+		return true
+	}
+
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now.Sub(s.windowStart) >= s.Tick {
+		s.windowStart = now
+		clear(s.counts)
+	}
+
+	key := samplingKey{level: level, message: message}
+	s.counts[key]++
+	count := s.counts[key]
+	if count <= s.Initial {
+		return true
+	}
+	return s.Thereafter > 0 && (count-s.Initial)%s.Thereafter == 0
+}
@@ -0,0 +1,107 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"os"
+)
+
+// slogPanicLevel sits above slog.LevelError as slog has no panic level
+const slogPanicLevel = slog.Level(12)
+
+type SlogAdapter struct {
+	*core
+	slog *slog.Logger
+}
+
+// NewSlogAdapter writes JSON lines with the same time, level and msg keys and lowercase level names as the logrus
+// adapter so queries work on either backend
+func NewSlogAdapter() Logger {
+	handler := slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
+		// the core filters levels so the one set with SetLevel is the only one in effect
+		Level: slog.LevelDebug,
+		ReplaceAttr: func(groups []string, attr slog.Attr) slog.Attr {
+			if len(groups) == 0 && attr.Key == slog.LevelKey {
+				level, _ := attr.Value.Any().(slog.Level)
+				attr.Value = slog.StringValue(slogLevelNames[level])
+			}
+			return attr
+		},
+	})
+	logger := slog.New(handler)
+	slog.SetDefault(logger)
+
+	return &SlogAdapter{
+		core: newCore(),
+		slog: logger,
+	}
+}
+
+func (s *SlogAdapter) LogInfo(message string, fields ...Field) {
+	s.log(context.Background(), InfoLevel, message, fields)
+}
+
+func (s *SlogAdapter) LogError(message string, fields ...Field) {
+	s.log(context.Background(), ErrorLevel, message, fields)
+}
+
+func (s *SlogAdapter) LogWarn(message string, fields ...Field) {
+	s.log(context.Background(), WarnLevel, message, fields)
+}
+
+func (s *SlogAdapter) LogDebug(message string, fields ...Field) {
+	s.log(context.Background(), DebugLevel, message, fields)
+}
+
+func (s *SlogAdapter) LogPanic(message string, fields ...Field) {
+	s.log(context.Background(), PanicLevel, message, fields)
+}
+
+func (s *SlogAdapter) LogInfoContext(ctx context.Context, message string, fields ...Field) {
+	s.log(ctx, InfoLevel, message, fields)
+}
+
+func (s *SlogAdapter) LogErrorContext(ctx context.Context, message string, fields ...Field) {
+	s.log(ctx, ErrorLevel, message, fields)
+}
+
+func (s *SlogAdapter) LogWarnContext(ctx context.Context, message string, fields ...Field) {
+	s.log(ctx, WarnLevel, message, fields)
+}
+
+func (s *SlogAdapter) LogDebugContext(ctx context.Context, message string, fields ...Field) {
+	s.log(ctx, DebugLevel, message, fields)
+}
+
+func (s *SlogAdapter) log(ctx context.Context, level Level, message string, fields []Field) {
+	fields, ok := s.entry(ctx, level, message, fields)
+	if !ok {
+		return
+	}
+
+	attributes := make([]slog.Attr, len(fields))
+	for i, field := range fields {
+		attributes[i] = slog.Any(field.Key, field.Value)
+	}
+	s.slog.LogAttrs(ctx, slogLevels[level], message, attributes...)
+
+	if level == PanicLevel {
+		panic(message)
+	}
+}
+
+var slogLevels = map[Level]slog.Level{
+	DebugLevel: slog.LevelDebug,
+	InfoLevel:  slog.LevelInfo,
+	WarnLevel:  slog.LevelWarn,
+	ErrorLevel: slog.LevelError,
+	PanicLevel: slogPanicLevel,
+}
+
+var slogLevelNames = map[slog.Level]string{
+	slog.LevelDebug: "debug",
+	slog.LevelInfo:  "info",
+	slog.LevelWarn:  "warning",
+	slog.LevelError: "error",
+	slogPanicLevel:  "panic",
+}
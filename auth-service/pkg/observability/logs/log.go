@@ -0,0 +1,125 @@
+package logs
+
+import (
+	"context"
+	"fmt"
+	"github.com/saufiroja/go-otel/auth-service/config"
+	"github.com/saufiroja/go-otel/auth-service/pkg/logging"
+	"github.com/saufiroja/go-otel/auth-service/pkg/observability/providers"
+	"github.com/saufiroja/go-otel/auth-service/pkg/observability/tracing"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploggrpc"
+	otellog "go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/log/global"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	"time"
+)
+
+// LogExporter is a logging.Sink shipping entries to the collector next to traces and metrics, fields go through
+// the same redaction policy as span attributes
+type LogExporter struct {
+	Logger    otellog.Logger
+	Provider  *sdklog.LoggerProvider
+	Redaction *tracing.RedactionPolicy
+}
+
+// NewLogExporter creates the OTLP logger provider, add the returned exporter to a logging.Logger with AddSink
+func NewLogExporter(ctx context.Context, serviceName string, provider *providers.ProviderFactory,
+	conf *config.AppConfig, logger logging.Logger) *LogExporter {
+	res, err := provider.CreateResource(ctx, serviceName)
+	if err != nil {
+		logger.LogPanic(err.Error())
+	}
+
+	exp, err := otlploggrpc.New(ctx,
+		otlploggrpc.WithInsecure(),
+		otlploggrpc.WithEndpoint(conf.Otel.OTLPEndpoint),
+	)
+	if err != nil {
+		logger.LogPanic("failed to create OTLP log exporter", logging.Err(err))
+	}
+
+	loggerProvider := sdklog.NewLoggerProvider(
+		sdklog.WithResource(res),
+		sdklog.WithProcessor(sdklog.NewBatchProcessor(exp)),
+	)
+
+	global.SetLoggerProvider(loggerProvider)
+
+	logger.LogInfo("logs initialized")
+
+	return &LogExporter{
+		Logger:    global.Logger(serviceName),
+		Provider:  loggerProvider,
+		Redaction: tracing.NewRedactionPolicy(conf),
+	}
+}
+
+// Shutdown exports the records still in the batch queue, entries emitted afterwards are dropped
+func (l *LogExporter) Shutdown(ctx context.Context) error {
+	return l.Provider.Shutdown(ctx)
+}
+
+// Emit sends the entry as an OTLP log record, the SDK takes the trace and span id from ctx so the fields carrying
+// them are not repeated as attributes
+func (l *LogExporter) Emit(ctx context.Context, level logging.Level, message string, fields []logging.Field) {
+	var record otellog.Record
+	now := time.Now()
+	record.SetTimestamp(now)
+	record.SetObservedTimestamp(now)
+	record.SetSeverity(severities[level])
+	record.SetSeverityText(level.String())
+	record.SetBody(otellog.StringValue(message))
+
+	attributes := make([]otellog.KeyValue, 0, len(fields))
+	for _, field := range fields {
+		if field.Key == logging.TraceIdKey || field.Key == logging.SpanIdKey {
+			continue
+		}
+		redacted, ok := l.Redaction.RedactValue(field.Key, field.Value)
+		if !ok {
+			continue
+		}
+		attributes = append(attributes, otellog.KeyValue{Key: field.Key, Value: value(redacted)})
+	}
+	record.AddAttributes(attributes...)
+
+	l.Logger.Emit(ctx, record)
+}
+
+var severities = map[logging.Level]otellog.Severity{
+	logging.DebugLevel: otellog.SeverityDebug,
+	logging.InfoLevel:  otellog.SeverityInfo,
+	logging.WarnLevel:  otellog.SeverityWarn,
+	logging.ErrorLevel: otellog.SeverityError,
+	logging.PanicLevel: otellog.SeverityFatal,
+}
+
+// value converts a field value to its log value, types without one are sent formatted
+func value(v any) otellog.Value {
+	switch v := v.(type) {
+	case nil:
+		return otellog.Value{}
+	case string:
+		return otellog.StringValue(v)
+	case bool:
+		return otellog.BoolValue(v)
+	case int:
+		return otellog.IntValue(v)
+	case int64:
+		return otellog.Int64Value(v)
+	case float64:
+		return otellog.Float64Value(v)
+	case time.Duration:
+		return otellog.StringValue(v.String())
+	case time.Time:
+		return otellog.StringValue(v.Format(time.RFC3339Nano))
+	case []byte:
+		return otellog.BytesValue(v)
+	case fmt.Stringer:
+		return otellog.StringValue(v.String())
+	case error:
+		return otellog.StringValue(v.Error())
+	default:
+		return otellog.StringValue(fmt.Sprintf("%v", v))
+	}
+}
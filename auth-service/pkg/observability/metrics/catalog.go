@@ -0,0 +1,215 @@
+package metrics
+
+import (
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// namespace prefixes the instruments of this service, instruments named by the semantic conventions keep their name
+const namespace = "auth-service."
+
+// HTTP server instruments of the semantic conventions
+var (
+	HttpServerRequestDuration = Instrument{
+		Name:        semconv.HTTPServerRequestDurationName,
+		Description: semconv.HTTPServerRequestDurationDescription,
+		Unit:        semconv.HTTPServerRequestDurationUnit,
+		Kind:        Float64Histogram,
+		Buckets:     []float64{0.005, 0.01, 0.025, 0.05, 0.075, 0.1, 0.25, 0.5, 0.75, 1, 2.5, 5, 7.5, 10},
+	}
+	HttpServerActiveRequests = Instrument{
+		Name:        semconv.HTTPServerActiveRequestsName,
+		Description: semconv.HTTPServerActiveRequestsDescription,
+		Unit:        semconv.HTTPServerActiveRequestsUnit,
+		Kind:        Int64UpDownCounter,
+	}
+)
+
+// authentication instruments, their attributes are fixed sets of outcomes, methods and token types
+var (
+	LoginAttempts = Instrument{
+		Name:        namespace + "login_attempts",
+		Description: "Number of login attempts by outcome",
+		Unit:        "{attempt}",
+		Kind:        Int64Counter,
+	}
+	Registrations = Instrument{
+		Name:        namespace + "registrations",
+		Description: "Number of registrations by outcome",
+		Unit:        "{registration}",
+		Kind:        Int64Counter,
+	}
+	TokensIssued = Instrument{
+		Name:        namespace + "tokens_issued",
+		Description: "Number of tokens signed by type",
+		Unit:        "{token}",
+		Kind:        Int64Counter,
+	}
+	PasswordHashDuration = Instrument{
+		Name:        namespace + "password_hash.duration",
+		Description: "Duration of password hashing and comparison",
+		Unit:        "s",
+		Kind:        Float64Histogram,
+		Buckets:     []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5},
+	}
+	ActiveSessions = Instrument{
+		Name:        namespace + "active_sessions",
+		Description: "Number of sessions neither revoked nor past their refresh token lifetime",
+		Unit:        "{session}",
+		Kind:        Int64ObservableGauge,
+	}
+)
+
+// request counters of the controllers
+var (
+	ApiKeyCreations = Instrument{
+		Name:        namespace + "number_of_api_key_creations",
+		Description: "Number of api key creation requests",
+		Unit:        "{request}",
+		Kind:        Int64Counter,
+	}
+	DataExports = Instrument{
+		Name:        namespace + "number_of_data_exports",
+		Description: "Number of data export requests",
+		Unit:        "{request}",
+		Kind:        Int64Counter,
+	}
+	DeviceAuthorizations = Instrument{
+		Name:        namespace + "number_of_device_authorizations",
+		Description: "Number of device authorization requests",
+		Unit:        "{request}",
+		Kind:        Int64Counter,
+	}
+	DeviceCodePolls = Instrument{
+		Name:        namespace + "number_of_device_code_polls",
+		Description: "Number of device code polls",
+		Unit:        "{request}",
+		Kind:        Int64Counter,
+	}
+	DeviceDecisions = Instrument{
+		Name:        namespace + "number_of_device_decisions",
+		Description: "Number of device code approvals and denials",
+		Unit:        "{request}",
+		Kind:        Int64Counter,
+	}
+	EmailChangeRequests = Instrument{
+		Name:        namespace + "number_of_email_change_requests",
+		Description: "Number of email change requests",
+		Unit:        "{request}",
+		Kind:        Int64Counter,
+	}
+	ErasureRequests = Instrument{
+		Name:        namespace + "number_of_erasure_requests",
+		Description: "Number of erasure requests",
+		Unit:        "{request}",
+		Kind:        Int64Counter,
+	}
+	Impersonations = Instrument{
+		Name:        namespace + "number_of_impersonations",
+		Description: "Number of impersonation requests",
+		Unit:        "{request}",
+		Kind:        Int64Counter,
+	}
+	LoginRequests = Instrument{
+		Name:        namespace + "number_of_login_requests",
+		Description: "Number of login requests",
+		Unit:        "{request}",
+		Kind:        Int64Counter,
+	}
+	OidcAuthorizeRequests = Instrument{
+		Name:        namespace + "number_of_oidc_authorize_requests",
+		Description: "Number of social login requests",
+		Unit:        "{request}",
+		Kind:        Int64Counter,
+	}
+	PasswordChanges = Instrument{
+		Name:        namespace + "number_of_password_changes",
+		Description: "Number of password change requests",
+		Unit:        "{request}",
+		Kind:        Int64Counter,
+	}
+	PatCreations = Instrument{
+		Name:        namespace + "number_of_pat_creations",
+		Description: "Number of personal access token creation requests",
+		Unit:        "{request}",
+		Kind:        Int64Counter,
+	}
+	ProfileUpdates = Instrument{
+		Name:        namespace + "number_of_profile_updates",
+		Description: "Number of profile update requests",
+		Unit:        "{request}",
+		Kind:        Int64Counter,
+	}
+	RefreshRequests = Instrument{
+		Name:        namespace + "number_of_refresh_requests",
+		Description: "Number of token refresh requests",
+		Unit:        "{request}",
+		Kind:        Int64Counter,
+	}
+	RegisterRequests = Instrument{
+		Name:        namespace + "number_of_register_requests",
+		Description: "Number of register requests",
+		Unit:        "{request}",
+		Kind:        Int64Counter,
+	}
+	SamlLoginRequests = Instrument{
+		Name:        namespace + "number_of_saml_login_requests",
+		Description: "Number of SAML login requests",
+		Unit:        "{request}",
+		Kind:        Int64Counter,
+	}
+	ScimUserCreations = Instrument{
+		Name:        namespace + "number_of_scim_user_creations",
+		Description: "Number of scim user creation requests",
+		Unit:        "{request}",
+		Kind:        Int64Counter,
+	}
+	SessionRevocations = Instrument{
+		Name:        namespace + "number_of_session_revocations",
+		Description: "Number of session revocation requests",
+		Unit:        "{request}",
+		Kind:        Int64Counter,
+	}
+	StatusChanges = Instrument{
+		Name:        namespace + "number_of_status_changes",
+		Description: "Number of account status change requests",
+		Unit:        "{request}",
+		Kind:        Int64Counter,
+	}
+	TokenExchanges = Instrument{
+		Name:        namespace + "number_of_token_exchanges",
+		Description: "Number of token exchange requests",
+		Unit:        "{request}",
+		Kind:        Int64Counter,
+	}
+)
+
+// Catalog is every instrument of the service, NewMetric creates them all and refuses to start when two disagree
+var Catalog = []Instrument{
+	HttpServerRequestDuration,
+	HttpServerActiveRequests,
+	LoginAttempts,
+	Registrations,
+	TokensIssued,
+	PasswordHashDuration,
+	ActiveSessions,
+	ApiKeyCreations,
+	DataExports,
+	DeviceAuthorizations,
+	DeviceCodePolls,
+	DeviceDecisions,
+	EmailChangeRequests,
+	ErasureRequests,
+	Impersonations,
+	LoginRequests,
+	OidcAuthorizeRequests,
+	PasswordChanges,
+	PatCreations,
+	ProfileUpdates,
+	RefreshRequests,
+	RegisterRequests,
+	SamlLoginRequests,
+	ScimUserCreations,
+	SessionRevocations,
+	StatusChanges,
+	TokenExchanges,
+}
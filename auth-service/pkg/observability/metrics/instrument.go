@@ -0,0 +1,114 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"go.opentelemetry.io/otel/metric"
+	"regexp"
+)
+
+// InstrumentKind is the OpenTelemetry instrument an Instrument is created as
+type InstrumentKind int
+
+const (
+	Int64Counter InstrumentKind = iota
+	Float64Counter
+	Int64UpDownCounter
+	Float64UpDownCounter
+	Int64Histogram
+	Float64Histogram
+	Int64Gauge
+	Float64Gauge
+	Int64ObservableCounter
+	Float64ObservableCounter
+	Int64ObservableUpDownCounter
+	Float64ObservableUpDownCounter
+	Int64ObservableGauge
+	Float64ObservableGauge
+)
+
+// Instrument is an entry of the Catalog, it is created once when the meter starts
+type Instrument struct {
+	Name        string
+	Description string
+	Unit        string
+	Kind        InstrumentKind
+	// Buckets are the explicit boundaries of a histogram, the SDK defaults apply when empty
+	Buckets []float64
+}
+
+// unitPattern accepts the UCUM units in use and {annotations} for counts, so a count is never spelled both
+// "request" and "{request}"
+var unitPattern = regexp.MustCompile(`^(s|ms|By|1|%|\{[a-z_]+\})$`)
+
+// validateCatalog rejects a catalog declaring a name twice or using a unit outside of unitPattern
+func validateCatalog(catalog []Instrument) error {
+	declared := make(map[string]Instrument, len(catalog))
+	for _, instrument := range catalog {
+		if instrument.Name == "" {
+			return errors.New("instrument has no name")
+		}
+		if !unitPattern.MatchString(instrument.Unit) {
+			return fmt.Errorf("instrument %s has unit %q, use a UCUM unit or a {count} annotation",
+				instrument.Name, instrument.Unit)
+		}
+		if existing, ok := declared[instrument.Name]; ok {
+			if existing.Unit != instrument.Unit {
+				return fmt.Errorf("instrument %s is declared with units %q and %q", instrument.Name, existing.Unit,
+					instrument.Unit)
+			}
+			return fmt.Errorf("instrument %s is declared twice", instrument.Name)
+		}
+		if len(instrument.Buckets) > 0 && instrument.Kind != Int64Histogram && instrument.Kind != Float64Histogram {
+			return fmt.Errorf("instrument %s has buckets but is not a histogram", instrument.Name)
+		}
+		declared[instrument.Name] = instrument
+	}
+	return nil
+}
+
+// create builds the OpenTelemetry instrument of i on meter
+func (i Instrument) create(meter metric.Meter) (any, error) {
+	description := metric.WithDescription(i.Description)
+	unit := metric.WithUnit(i.Unit)
+	switch i.Kind {
+	case Int64Counter:
+		return meter.Int64Counter(i.Name, description, unit)
+	case Float64Counter:
+		return meter.Float64Counter(i.Name, description, unit)
+	case Int64UpDownCounter:
+		return meter.Int64UpDownCounter(i.Name, description, unit)
+	case Float64UpDownCounter:
+		return meter.Float64UpDownCounter(i.Name, description, unit)
+	case Int64Histogram:
+		options := []metric.Int64HistogramOption{description, unit}
+		if len(i.Buckets) > 0 {
+			options = append(options, metric.WithExplicitBucketBoundaries(i.Buckets...))
+		}
+		return meter.Int64Histogram(i.Name, options...)
+	case Float64Histogram:
+		options := []metric.Float64HistogramOption{description, unit}
+		if len(i.Buckets) > 0 {
+			options = append(options, metric.WithExplicitBucketBoundaries(i.Buckets...))
+		}
+		return meter.Float64Histogram(i.Name, options...)
+	case Int64Gauge:
+		return meter.Int64Gauge(i.Name, description, unit)
+	case Float64Gauge:
+		return meter.Float64Gauge(i.Name, description, unit)
+	case Int64ObservableCounter:
+		return meter.Int64ObservableCounter(i.Name, description, unit)
+	case Float64ObservableCounter:
+		return meter.Float64ObservableCounter(i.Name, description, unit)
+	case Int64ObservableUpDownCounter:
+		return meter.Int64ObservableUpDownCounter(i.Name, description, unit)
+	case Float64ObservableUpDownCounter:
+		return meter.Float64ObservableUpDownCounter(i.Name, description, unit)
+	case Int64ObservableGauge:
+		return meter.Int64ObservableGauge(i.Name, description, unit)
+	case Float64ObservableGauge:
+		return meter.Float64ObservableGauge(i.Name, description, unit)
+	default:
+		return nil, fmt.Errorf("instrument %s has an unknown kind", i.Name)
+	}
+}
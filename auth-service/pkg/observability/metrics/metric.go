@@ -7,27 +7,45 @@ import (
 	"github.com/saufiroja/go-otel/auth-service/pkg/logging"
 	"github.com/saufiroja/go-otel/auth-service/pkg/observability/providers"
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
 	"go.opentelemetry.io/otel/metric"
 	sdkMetrics "go.opentelemetry.io/otel/sdk/metric"
-	"time"
+	"math"
 )
 
 type Metric struct {
 	Meter       metric.Meter
 	logger      logging.Logger
 	ServiceName string
+	// instruments holds the created instrument of every Catalog entry by name, it is not written after NewMetric
+	instruments map[string]registeredInstrument
+}
+
+type registeredInstrument struct {
+	Instrument
+	created any
+}
+
+// Observation is one value an observable callback reports, int64 instruments round it
+type Observation struct {
+	Value      float64
+	Attributes []attribute.KeyValue
 }
 
 func NewMetric(ctx context.Context, serviceName string, provider *providers.ProviderFactory,
-	conf *config.AppConfig, logging logging.Logger) *Metric {
+	conf *config.AppConfig, logger logging.Logger) *Metric {
 	res, err := provider.CreateResource(ctx, serviceName)
+	if err != nil {
+		logger.LogPanic(err.Error())
+	}
+
 	metricsExp, err := otlpmetricgrpc.New(ctx,
 		otlpmetricgrpc.WithInsecure(),
 		otlpmetricgrpc.WithEndpoint(conf.Otel.OTLPEndpoint),
 	)
 	if err != nil {
-		logging.LogPanic(fmt.Sprintf("failed to create OTLP metric exporter: %v", err))
+		logger.LogPanic("failed to create OTLP metric exporter", logging.Err(err))
 	}
 
 	meterProvider := sdkMetrics.NewMeterProvider(
@@ -38,36 +56,124 @@ func NewMetric(ctx context.Context, serviceName string, provider *providers.Prov
 
 	otel.SetMeterProvider(meterProvider)
 
-	logging.LogInfo("metrics initialized")
-
-	return &Metric{
+	m := &Metric{
 		Meter:       otel.Meter(serviceName),
-		logger:      logging,
+		logger:      logger,
 		ServiceName: serviceName,
 	}
+	if err := m.register(Catalog); err != nil {
+		logger.LogPanic("invalid metric catalog", logging.Err(err))
+	}
+
+	logger.LogInfo("metrics initialized")
+
+	return m
 }
 
-func (m *Metric) Counter(ctx context.Context, name string, description, unit string) {
-	counter, err := m.Meter.Int64Counter(fmt.Sprintf("%s.%s", m.ServiceName, name),
-		metric.WithDescription(description),
-		metric.WithUnit(unit),
-	)
-	if err != nil {
-		m.logger.LogError(fmt.Sprintf("failed to create counter: %v", err))
-		return
+// register validates catalog and creates each of its instruments once
+func (m *Metric) register(catalog []Instrument) error {
+	if err := validateCatalog(catalog); err != nil {
+		return err
+	}
+
+	m.instruments = make(map[string]registeredInstrument, len(catalog))
+	for _, instrument := range catalog {
+		created, err := instrument.create(m.Meter)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", instrument.Name, err)
+		}
+		m.instruments[instrument.Name] = registeredInstrument{Instrument: instrument, created: created}
 	}
-	counter.Add(ctx, 1)
+	return nil
 }
 
-func (m *Metric) Histogram(ctx context.Context, name string, description, unit string, duration time.Duration) {
-	histogram, err := m.Meter.Int64Histogram(fmt.Sprintf("%s.%s", m.ServiceName, name),
-		metric.WithDescription(description),
-		metric.WithUnit(unit),
-	)
-	if err != nil {
-		m.logger.LogError(fmt.Sprintf("failed to create histogram: %v", err))
-		return
+// Add adds value to an int64 counter or up-down counter
+func (m *Metric) Add(ctx context.Context, instrument Instrument, value int64, attributes ...attribute.KeyValue) {
+	options := metric.WithAttributeSet(attribute.NewSet(attributes...))
+	switch created := m.lookup(instrument).(type) {
+	case metric.Int64Counter:
+		created.Add(ctx, value, options)
+	case metric.Int64UpDownCounter:
+		created.Add(ctx, value, options)
+	default:
+		m.logger.LogError("cannot add int64 to instrument", logging.String("instrument", instrument.Name))
+	}
+}
+
+// AddFloat adds value to a float64 counter or up-down counter
+func (m *Metric) AddFloat(ctx context.Context, instrument Instrument, value float64,
+	attributes ...attribute.KeyValue) {
+	options := metric.WithAttributeSet(attribute.NewSet(attributes...))
+	switch created := m.lookup(instrument).(type) {
+	case metric.Float64Counter:
+		created.Add(ctx, value, options)
+	case metric.Float64UpDownCounter:
+		created.Add(ctx, value, options)
+	default:
+		m.logger.LogError("cannot add float64 to instrument", logging.String("instrument", instrument.Name))
+	}
+}
+
+// Record records value on an int64 histogram or gauge
+func (m *Metric) Record(ctx context.Context, instrument Instrument, value int64, attributes ...attribute.KeyValue) {
+	options := metric.WithAttributeSet(attribute.NewSet(attributes...))
+	switch created := m.lookup(instrument).(type) {
+	case metric.Int64Histogram:
+		created.Record(ctx, value, options)
+	case metric.Int64Gauge:
+		created.Record(ctx, value, options)
+	default:
+		m.logger.LogError("cannot record int64 on instrument", logging.String("instrument", instrument.Name))
+	}
+}
+
+// RecordFloat records value on a float64 histogram or gauge
+func (m *Metric) RecordFloat(ctx context.Context, instrument Instrument, value float64,
+	attributes ...attribute.KeyValue) {
+	options := metric.WithAttributeSet(attribute.NewSet(attributes...))
+	switch created := m.lookup(instrument).(type) {
+	case metric.Float64Histogram:
+		created.Record(ctx, value, options)
+	case metric.Float64Gauge:
+		created.Record(ctx, value, options)
+	default:
+		m.logger.LogError("cannot record float64 on instrument", logging.String("instrument", instrument.Name))
+	}
+}
+
+// Observe registers callback to report an observable instrument at every collection, the returned registration
+// unregisters it
+func (m *Metric) Observe(instrument Instrument,
+	callback func(ctx context.Context) ([]Observation, error)) (metric.Registration, error) {
+	created, ok := m.lookup(instrument).(metric.Observable)
+	if !ok {
+		return nil, fmt.Errorf("instrument %s is not observable", instrument.Name)
 	}
 
-	histogram.Record(ctx, duration.Milliseconds())
+	return m.Meter.RegisterCallback(func(ctx context.Context, observer metric.Observer) error {
+		observations, err := callback(ctx)
+		if err != nil {
+			return err
+		}
+		for _, observation := range observations {
+			options := metric.WithAttributeSet(attribute.NewSet(observation.Attributes...))
+			switch observable := created.(type) {
+			case metric.Int64Observable:
+				observer.ObserveInt64(observable, int64(math.Round(observation.Value)), options)
+			case metric.Float64Observable:
+				observer.ObserveFloat64(observable, observation.Value, options)
+			}
+		}
+		return nil
+	}, created)
+}
+
+// lookup returns the created instrument, nil when instrument is not the Catalog entry of its name
+func (m *Metric) lookup(instrument Instrument) any {
+	registered, ok := m.instruments[instrument.Name]
+	if !ok || registered.Kind != instrument.Kind || registered.Unit != instrument.Unit {
+		m.logger.LogError("instrument is not in the metric catalog", logging.String("instrument", instrument.Name))
+		return nil
+	}
+	return registered.created
 }
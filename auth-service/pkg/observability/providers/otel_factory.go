@@ -2,7 +2,6 @@ package providers
 
 import (
 	"context"
-	"fmt"
 	"github.com/saufiroja/go-otel/auth-service/pkg/logging"
 	"go.opentelemetry.io/otel/sdk/resource"
 	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
@@ -29,7 +28,7 @@ func (f *ProviderFactory) CreateResource(ctx context.Context, serviceName string
 		),
 	)
 	if err != nil {
-		f.logging.LogError(fmt.Sprintf("failed to create resource: %v", err))
+		f.logging.LogError("failed to create resource", logging.Err(err))
 		return nil, err
 	}
 	return res, nil
@@ -0,0 +1,244 @@
+package tracing
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/saufiroja/go-otel/auth-service/config"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+type redactAction int
+
+// freeTextKeys carry text built from errors, the key says nothing about what is in it so the text itself is scrubbed
+var freeTextKeys = []string{"error", "message", "description"}
+
+var (
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+	// postgres reports the offending row as Key (column)=(value), the value is the user input that failed
+	keyValuePattern = regexp.MustCompile(`\)=\([^)]*\)`)
+)
+
+const (
+	redactKeep redactAction = iota
+	redactMask
+	redactHash
+	redactDrop
+)
+
+// RedactionPolicy decides what happens to each span attribute before export, allowed keys are kept, otherwise the
+// strictest matching action applies
+type RedactionPolicy struct {
+	Drop  []string
+	Hash  []string
+	Mask  []string
+	Allow []string
+	// HashKey keys the HMAC of hashed values so guessable values like emails cannot be looked up
+	HashKey []byte
+	actions sync.Map
+}
+
+func NewRedactionPolicy(conf *config.AppConfig) *RedactionPolicy {
+	return &RedactionPolicy{
+		Drop:    conf.Otel.RedactDrop,
+		Hash:    conf.Otel.RedactHash,
+		Mask:    conf.Otel.RedactMask,
+		Allow:   conf.Otel.RedactAllow,
+		HashKey: []byte("span-redaction:" + conf.Jwt.Secret),
+	}
+}
+
+// Redact returns attributes with the policy applied, the slice is only copied when something changes
+func (p *RedactionPolicy) Redact(attributes []attribute.KeyValue) []attribute.KeyValue {
+	var redacted []attribute.KeyValue
+	for i, kv := range attributes {
+		action := p.action(string(kv.Key))
+		if action == redactKeep && kv.Value.Type() == attribute.STRING && matchesAny(string(kv.Key), freeTextKeys) {
+			if text := p.RedactText(kv.Value.AsString()); text != kv.Value.AsString() {
+				if redacted == nil {
+					redacted = append(make([]attribute.KeyValue, 0, len(attributes)), attributes[:i]...)
+				}
+				redacted = append(redacted, kv.Key.String(text))
+				continue
+			}
+		}
+		if action == redactKeep {
+			if redacted != nil {
+				redacted = append(redacted, kv)
+			}
+			continue
+		}
+		if redacted == nil {
+			redacted = append(make([]attribute.KeyValue, 0, len(attributes)), attributes[:i]...)
+		}
+		switch action {
+		case redactHash:
+			redacted = append(redacted, kv.Key.String(p.hash(kv.Value.Emit())))
+		case redactMask:
+			redacted = append(redacted, kv.Key.String(mask(kv.Value.Emit())))
+		}
+	}
+	if redacted == nil {
+		return attributes
+	}
+	return redacted
+}
+
+// RedactValue applies the policy to a value outside a span, like a log field, ok is false when it must be dropped
+func (p *RedactionPolicy) RedactValue(key string, value any) (redacted any, ok bool) {
+	switch p.action(key) {
+	case redactDrop:
+		return nil, false
+	case redactHash:
+		return p.hash(fmt.Sprint(value)), true
+	case redactMask:
+		return mask(fmt.Sprint(value)), true
+	}
+	if matchesAny(key, freeTextKeys) {
+		switch text := value.(type) {
+		case string:
+			return p.RedactText(text), true
+		case error:
+			return p.RedactText(text.Error()), true
+		}
+	}
+	return value, true
+}
+
+// RedactText scrubs free text such as an error message or a span name, emails are hashed so the same address can
+// still be followed across spans and values echoed back by postgres are removed
+func (p *RedactionPolicy) RedactText(text string) string {
+	text = emailPattern.ReplaceAllStringFunc(text, p.hash)
+	return keyValuePattern.ReplaceAllString(text, ")=(redacted)")
+}
+
+// action resolves the action for key once, span keys are a small fixed set so the cache stays bounded
+func (p *RedactionPolicy) action(key string) redactAction {
+	if cached, ok := p.actions.Load(key); ok {
+		return cached.(redactAction)
+	}
+
+	action := redactKeep
+	switch {
+	case matchesAny(key, p.Allow):
+	case matchesAny(key, p.Drop):
+		action = redactDrop
+	case matchesAny(key, p.Hash):
+		action = redactHash
+	case matchesAny(key, p.Mask):
+		action = redactMask
+	}
+	p.actions.Store(key, action)
+	return action
+}
+
+func (p *RedactionPolicy) hash(value string) string {
+	mac := hmac.New(sha256.New, p.HashKey)
+	mac.Write([]byte(value))
+	return "hmac:" + hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+// mask keeps the first character so redacted values can still be told apart at a glance
+func mask(value string) string {
+	first, size := utf8.DecodeRuneInString(value)
+	if size == 0 {
+		return ""
+	}
+	return string(first) + "***"
+}
+
+// matchesAny reports whether a name matches key as a whole, as its last dotted part or as one of its words
+func matchesAny(key string, names []string) bool {
+	words := strings.FieldsFunc(key, func(r rune) bool {
+		return r == '.' || r == '_'
+	})
+	for _, name := range names {
+		if key == name || strings.HasSuffix(key, "."+name) {
+			return true
+		}
+		for _, word := range words {
+			if word == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// RedactingProcessor applies a RedactionPolicy to ended spans before handing them to the next processor, span
+// attributes are only complete once a span ends so they cannot be filtered at OnStart
+type RedactingProcessor struct {
+	next   sdktrace.SpanProcessor
+	policy *RedactionPolicy
+}
+
+func NewRedactingProcessor(next sdktrace.SpanProcessor, policy *RedactionPolicy) sdktrace.SpanProcessor {
+	return &RedactingProcessor{
+		next:   next,
+		policy: policy,
+	}
+}
+
+func (r *RedactingProcessor) OnStart(parent context.Context, s sdktrace.ReadWriteSpan) {
+	r.next.OnStart(parent, s)
+}
+
+func (r *RedactingProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	r.next.OnEnd(&redactedSpan{ReadOnlySpan: s, policy: r.policy})
+}
+
+func (r *RedactingProcessor) Shutdown(ctx context.Context) error {
+	return r.next.Shutdown(ctx)
+}
+
+func (r *RedactingProcessor) ForceFlush(ctx context.Context) error {
+	return r.next.ForceFlush(ctx)
+}
+
+// redactedSpan is an ended span whose name, status, events and attributes are read through the policy
+type redactedSpan struct {
+	sdktrace.ReadOnlySpan
+	policy *RedactionPolicy
+}
+
+func (s *redactedSpan) Name() string {
+	return s.policy.RedactText(s.ReadOnlySpan.Name())
+}
+
+func (s *redactedSpan) Status() sdktrace.Status {
+	status := s.ReadOnlySpan.Status()
+	status.Description = s.policy.RedactText(status.Description)
+	return status
+}
+
+func (s *redactedSpan) Attributes() []attribute.KeyValue {
+	return s.policy.Redact(s.ReadOnlySpan.Attributes())
+}
+
+func (s *redactedSpan) Events() []sdktrace.Event {
+	events := s.ReadOnlySpan.Events()
+	redacted := make([]sdktrace.Event, len(events))
+	for i, event := range events {
+		event.Name = s.policy.RedactText(event.Name)
+		event.Attributes = s.policy.Redact(event.Attributes)
+		redacted[i] = event
+	}
+	return redacted
+}
+
+func (s *redactedSpan) Links() []sdktrace.Link {
+	links := s.ReadOnlySpan.Links()
+	redacted := make([]sdktrace.Link, len(links))
+	for i, link := range links {
+		link.Attributes = s.policy.Redact(link.Attributes)
+		redacted[i] = link
+	}
+	return redacted
+}
@@ -0,0 +1,194 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"github.com/saufiroja/go-otel/auth-service/config"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"strings"
+	"testing"
+)
+
+const (
+	testPassword = "hunter2-password"
+	testToken    = "eyJhbGciOiJIUzI1NiJ9.secret-token"
+	testEmail    = "jane.doe@example.com"
+	testCookie   = "session=cookie-value"
+)
+
+func newRedactionConfig() *config.AppConfig {
+	conf := &config.AppConfig{}
+	conf.Jwt.Secret = "test-secret"
+	conf.Otel.RedactDrop = []string{"password", "secret", "token", "authorization", "cookie"}
+	conf.Otel.RedactHash = []string{"email", "dn"}
+	conf.Otel.RedactMask = []string{"full_name", "client.address", "ip"}
+	conf.Otel.RedactAllow = []string{"token.type", "token.binding", "token_id"}
+	return conf
+}
+
+// exportRedacted runs spans through the redacting processor into an in memory exporter
+func exportRedacted(t *testing.T, record func(tracer trace.Tracer)) tracetest.SpanStubs {
+	t.Helper()
+
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithSampler(sdktrace.AlwaysSample()),
+		sdktrace.WithSpanProcessor(NewRedactingProcessor(sdktrace.NewSimpleSpanProcessor(exporter),
+			NewRedactionPolicy(newRedactionConfig()))),
+	)
+	t.Cleanup(func() { _ = provider.Shutdown(context.Background()) })
+
+	record(provider.Tracer("redaction-test"))
+
+	return exporter.GetSpans()
+}
+
+func TestRedactingProcessorRemovesSecrets(t *testing.T) {
+	spans := exportRedacted(t, func(tracer trace.Tracer) {
+		_, linked := tracer.Start(context.Background(), "linked")
+		linked.End()
+
+		_, span := tracer.Start(context.Background(), "service.LoginUser",
+			trace.WithLinks(trace.Link{
+				SpanContext: linked.SpanContext(),
+				Attributes: []attribute.KeyValue{
+					attribute.String("refresh_token", testToken),
+					attribute.String("user.email", testEmail),
+				},
+			}))
+		span.SetAttributes(
+			attribute.String("password", testPassword),
+			attribute.String("http.request.header.authorization", "Bearer "+testToken),
+			attribute.String("http.request.header.cookie", testCookie),
+			attribute.String("email", testEmail),
+			attribute.String("token_id", "tok_123"),
+			attribute.String("user_id", "user-1"),
+		)
+		span.AddEvent("password mismatch", trace.WithAttributes(
+			attribute.String("error.email", testEmail),
+			attribute.String("access_token", testToken),
+			attribute.String("set_cookie", testCookie),
+		))
+		span.End()
+	})
+
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+
+	var values []string
+	collect := func(attributes []attribute.KeyValue) {
+		for _, kv := range attributes {
+			values = append(values, kv.Value.Emit())
+		}
+	}
+	for _, span := range spans {
+		collect(span.Attributes)
+		for _, event := range span.Events {
+			collect(event.Attributes)
+		}
+		for _, link := range span.Links {
+			collect(link.Attributes)
+		}
+	}
+
+	for _, secret := range []string{testPassword, testToken, testEmail, testCookie} {
+		for _, value := range values {
+			if strings.Contains(value, secret) {
+				t.Errorf("exported value %q contains %q", value, secret)
+			}
+		}
+	}
+}
+
+func TestRedactingProcessorErrorText(t *testing.T) {
+	// errors from lib/pq echo the values of the failing statement back
+	err := errors.New(`pq: duplicate key value violates unique constraint "users_email_key" ` +
+		`Key (email)=(` + testEmail + `) already exists.`)
+
+	spans := exportRedacted(t, func(tracer trace.Tracer) {
+		_, span := tracer.Start(context.Background(), "repository.UpdateUser "+testEmail)
+		span.AddEvent("failed to update user", trace.WithAttributes(attribute.Key("error").String(err.Error())))
+		span.RecordError(err)
+		span.SetAttributes(attribute.String("error", err.Error()))
+		span.SetStatus(codes.Error, err.Error())
+		span.End()
+	})
+
+	values := []string{spans[0].Name, spans[0].Status.Description}
+	for _, kv := range spans[0].Attributes {
+		values = append(values, kv.Value.Emit())
+	}
+	for _, event := range spans[0].Events {
+		values = append(values, event.Name)
+		for _, kv := range event.Attributes {
+			values = append(values, kv.Value.Emit())
+		}
+	}
+
+	for _, value := range values {
+		if strings.Contains(value, testEmail) {
+			t.Errorf("exported value %q contains %q", value, testEmail)
+		}
+	}
+	if !strings.Contains(spans[0].Status.Description, "users_email_key") {
+		t.Errorf("status description = %q, want the constraint kept", spans[0].Status.Description)
+	}
+}
+
+func TestRedactingProcessorActions(t *testing.T) {
+	spans := exportRedacted(t, func(tracer trace.Tracer) {
+		_, span := tracer.Start(context.Background(), "service.RegisterUser")
+		span.SetAttributes(
+			attribute.String("password", testPassword),
+			attribute.String("email", testEmail),
+			attribute.String("full_name", "Jane Doe"),
+			attribute.String("token_id", "tok_123"),
+			attribute.String("user_id", "user-1"),
+		)
+		span.End()
+	})
+
+	attributes := make(map[attribute.Key]string)
+	for _, kv := range spans[0].Attributes {
+		attributes[kv.Key] = kv.Value.Emit()
+	}
+
+	if _, ok := attributes["password"]; ok {
+		t.Errorf("password was exported")
+	}
+	if email := attributes["email"]; !strings.HasPrefix(email, "hmac:") {
+		t.Errorf("email = %q, want an hmac", email)
+	}
+	if name := attributes["full_name"]; name != "J***" {
+		t.Errorf("full_name = %q, want J***", name)
+	}
+	if tokenId := attributes["token_id"]; tokenId != "tok_123" {
+		t.Errorf("allowed token_id = %q, want it unchanged", tokenId)
+	}
+	if userId := attributes["user_id"]; userId != "user-1" {
+		t.Errorf("user_id = %q, want it unchanged", userId)
+	}
+}
+
+func TestRedactValue(t *testing.T) {
+	policy := NewRedactionPolicy(newRedactionConfig())
+
+	if _, ok := policy.RedactValue("password", testPassword); ok {
+		t.Errorf("password was kept")
+	}
+	if value, ok := policy.RedactValue("email", testEmail); !ok || value == testEmail {
+		t.Errorf("email = %v, want it hashed", value)
+	}
+	if value, ok := policy.RedactValue("error", errors.New("no user "+testEmail)); !ok ||
+		strings.Contains(value.(string), testEmail) {
+		t.Errorf("error = %v, want the email hashed", value)
+	}
+	if value, ok := policy.RedactValue("user_id", "user-1"); !ok || value != "user-1" {
+		t.Errorf("user_id = %v, want it unchanged", value)
+	}
+}
@@ -0,0 +1,268 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"github.com/saufiroja/go-otel/auth-service/config"
+	"github.com/saufiroja/go-otel/auth-service/pkg/logging"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	SamplingDecisionKey = attribute.Key("sampling.decision")
+	SamplingRatioKey    = attribute.Key("sampling.ratio")
+
+	// SamplingDecisionParent spans follow the sampled flag of their parent
+	SamplingDecisionParent = "parent"
+	// SamplingDecisionRatio and SamplingDecisionRoute spans were picked by trace id ratio, the route one by an
+	// override of the url path
+	SamplingDecisionRatio = "ratio"
+	SamplingDecisionRoute = "route"
+	// SamplingDecisionDeferred spans are recorded but only exported when their trace fails or runs long
+	SamplingDecisionDeferred = "deferred"
+	SamplingDecisionError    = "delayed_error"
+	SamplingDecisionSlow     = "delayed_slow"
+
+	// maxPendingTraces and maxPendingSpans bound the memory held by traces awaiting a delayed decision
+	maxPendingTraces = 1024
+	maxPendingSpans  = 256
+	// pendingTraceTimeout frees the spans of traces whose root ended first or never ends here, a child that outlives
+	// its root opens an entry nothing else would delete
+	pendingTraceTimeout = time.Minute
+)
+
+// Sampler makes the head decision of OTEL_TRACES_SAMPLER with per route ratios for root spans, spans it does not
+// sample are still recorded when a delayed decision may keep them
+type Sampler struct {
+	parentBased bool
+	delayed     bool
+	ratio       float64
+	// routes are the url path prefixes with their own ratio, longest first
+	routes []routeRatio
+}
+
+type routeRatio struct {
+	prefix  string
+	ratio   float64
+	sampler sdktrace.Sampler
+}
+
+// NewSampler reads OTEL_TRACES_SAMPLER, an unknown name falls back to the SDK default parentbased_always_on
+func NewSampler(conf *config.AppConfig, logger logging.Logger) *Sampler {
+	s := &Sampler{
+		parentBased: strings.HasPrefix(conf.Otel.Sampler, "parentbased_"),
+		delayed:     conf.Otel.SampleErrors || conf.Otel.SlowSpanThreshold > 0,
+	}
+	switch strings.TrimPrefix(conf.Otel.Sampler, "parentbased_") {
+	case "always_on":
+		s.ratio = 1
+	case "always_off":
+		// off means nothing is recorded, not even the spans a delayed decision could keep
+		s.ratio = 0
+		s.delayed = false
+	case "traceidratio":
+		s.ratio = conf.Otel.SamplerArg
+	default:
+		logger.LogWarn("unknown trace sampler, using parentbased_always_on",
+			logging.String("sampler", conf.Otel.Sampler))
+		s.parentBased = true
+		s.ratio = 1
+	}
+
+	s.routes = append(s.routes, routeRatio{ratio: s.ratio, sampler: sdktrace.TraceIDRatioBased(s.ratio)})
+	for prefix, ratio := range conf.Otel.RouteSampleRatios {
+		s.routes = append(s.routes, routeRatio{prefix: prefix, ratio: ratio, sampler: sdktrace.TraceIDRatioBased(ratio)})
+	}
+	// the default has the empty prefix so it sorts last and matches every path
+	for i := 1; i < len(s.routes); i++ {
+		for j := i; j > 0 && len(s.routes[j].prefix) > len(s.routes[j-1].prefix); j-- {
+			s.routes[j], s.routes[j-1] = s.routes[j-1], s.routes[j]
+		}
+	}
+
+	return s
+}
+
+func (s *Sampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	parent := trace.SpanContextFromContext(p.ParentContext)
+	if parent.IsValid() && (s.parentBased || !parent.IsRemote()) {
+		if parent.IsSampled() {
+			return s.result(sdktrace.RecordAndSample, parent, SamplingDecisionParent)
+		}
+		// children of a deferred span are deferred with it, a remote caller that dropped the trace is obeyed
+		if s.delayed && !parent.IsRemote() && trace.SpanFromContext(p.ParentContext).IsRecording() {
+			return s.result(sdktrace.RecordOnly, parent, SamplingDecisionDeferred)
+		}
+		return s.result(sdktrace.Drop, parent, SamplingDecisionParent)
+	}
+
+	route := s.route(p.Attributes)
+	decision := SamplingDecisionRatio
+	if route.prefix != "" {
+		decision = SamplingDecisionRoute
+	}
+	result := route.sampler.ShouldSample(p)
+	if result.Decision == sdktrace.RecordAndSample {
+		result.Attributes = append(result.Attributes, SamplingDecisionKey.String(decision),
+			SamplingRatioKey.Float64(route.ratio))
+		return result
+	}
+	if s.delayed {
+		return s.result(sdktrace.RecordOnly, parent, SamplingDecisionDeferred)
+	}
+	return result
+}
+
+func (s *Sampler) Description() string {
+	return fmt.Sprintf("AuthServiceSampler{parentBased=%t,ratio=%g,routes=%d,delayed=%t}", s.parentBased, s.ratio,
+		len(s.routes)-1, s.delayed)
+}
+
+func (s *Sampler) result(decision sdktrace.SamplingDecision, parent trace.SpanContext,
+	reason string) sdktrace.SamplingResult {
+	result := sdktrace.SamplingResult{Decision: decision, Tracestate: parent.TraceState()}
+	if decision != sdktrace.Drop {
+		result.Attributes = []attribute.KeyValue{SamplingDecisionKey.String(reason)}
+	}
+	return result
+}
+
+// route returns the ratio of the longest prefix of the url.path attribute, the default for other spans
+func (s *Sampler) route(attributes []attribute.KeyValue) routeRatio {
+	path := ""
+	for _, kv := range attributes {
+		if kv.Key == semconv.URLPathKey {
+			path = kv.Value.AsString()
+			break
+		}
+	}
+	for _, route := range s.routes {
+		if strings.HasPrefix(path, route.prefix) {
+			return route
+		}
+	}
+	return s.routes[len(s.routes)-1]
+}
+
+// DelayedSamplingProcessor holds the deferred spans of a trace until its local root ends, then exports all of them
+// when any failed or the root ran longer than the slow threshold
+type DelayedSamplingProcessor struct {
+	next          sdktrace.SpanProcessor
+	sampleErrors  bool
+	slowThreshold time.Duration
+	mu            sync.Mutex
+	pending       map[trace.TraceID]*pendingTrace
+}
+
+type pendingTrace struct {
+	spans    []sdktrace.ReadOnlySpan
+	decision string
+	// opened is the end time of the first span, span times are used so the age does not depend on export delays
+	opened time.Time
+}
+
+func NewDelayedSamplingProcessor(next sdktrace.SpanProcessor, conf *config.AppConfig) sdktrace.SpanProcessor {
+	return &DelayedSamplingProcessor{
+		next:          next,
+		sampleErrors:  conf.Otel.SampleErrors,
+		slowThreshold: conf.Otel.SlowSpanThreshold,
+		pending:       make(map[trace.TraceID]*pendingTrace),
+	}
+}
+
+func (d *DelayedSamplingProcessor) OnStart(parent context.Context, s sdktrace.ReadWriteSpan) {
+	d.next.OnStart(parent, s)
+}
+
+func (d *DelayedSamplingProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	if s.SpanContext().IsSampled() {
+		d.next.OnEnd(s)
+		return
+	}
+
+	decision := ""
+	if d.sampleErrors && s.Status().Code == codes.Error {
+		decision = SamplingDecisionError
+	} else if d.slowThreshold > 0 && s.EndTime().Sub(s.StartTime()) >= d.slowThreshold {
+		decision = SamplingDecisionSlow
+	}
+	root := !s.Parent().IsValid() || s.Parent().IsRemote()
+	traceId := s.SpanContext().TraceID()
+
+	d.mu.Lock()
+	pending, ok := d.pending[traceId]
+	if !ok {
+		pending = &pendingTrace{opened: s.EndTime()}
+		if !root && len(d.pending) >= maxPendingTraces {
+			d.evictExpired(s.EndTime())
+		}
+		// a full buffer only loses the children of new traces, their root is still decided on its own
+		if !root && len(d.pending) < maxPendingTraces {
+			d.pending[traceId] = pending
+		}
+	}
+	if pending.decision == "" {
+		pending.decision = decision
+	}
+	if !root {
+		if len(pending.spans) < maxPendingSpans {
+			pending.spans = append(pending.spans, s)
+		}
+		d.mu.Unlock()
+		return
+	}
+	delete(d.pending, traceId)
+	d.mu.Unlock()
+
+	if pending.decision == "" {
+		return
+	}
+	for _, span := range append(pending.spans, s) {
+		d.next.OnEnd(&sampledSpan{ReadOnlySpan: span, decision: pending.decision})
+	}
+}
+
+// evictExpired drops the traces pending for longer than pendingTraceTimeout, d.mu must be held
+func (d *DelayedSamplingProcessor) evictExpired(now time.Time) {
+	for traceId, pending := range d.pending {
+		if now.Sub(pending.opened) > pendingTraceTimeout {
+			delete(d.pending, traceId)
+		}
+	}
+}
+
+func (d *DelayedSamplingProcessor) Shutdown(ctx context.Context) error {
+	return d.next.Shutdown(ctx)
+}
+
+func (d *DelayedSamplingProcessor) ForceFlush(ctx context.Context) error {
+	return d.next.ForceFlush(ctx)
+}
+
+// sampledSpan is a deferred span kept by a delayed decision, it reads as sampled so exporters accept it
+type sampledSpan struct {
+	sdktrace.ReadOnlySpan
+	decision string
+}
+
+func (s *sampledSpan) SpanContext() trace.SpanContext {
+	spanContext := s.ReadOnlySpan.SpanContext()
+	return spanContext.WithTraceFlags(spanContext.TraceFlags().WithSampled(true))
+}
+
+func (s *sampledSpan) Attributes() []attribute.KeyValue {
+	attributes := make([]attribute.KeyValue, 0, len(s.ReadOnlySpan.Attributes()))
+	for _, kv := range s.ReadOnlySpan.Attributes() {
+		if kv.Key != SamplingDecisionKey {
+			attributes = append(attributes, kv)
+		}
+	}
+	return append(attributes, SamplingDecisionKey.String(s.decision))
+}
@@ -0,0 +1,303 @@
+package tracing
+
+import (
+	"context"
+	"github.com/saufiroja/go-otel/auth-service/config"
+	"github.com/saufiroja/go-otel/auth-service/pkg/logging"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"sync"
+	"testing"
+	"time"
+)
+
+var (
+	testTraceId = trace.TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e,
+		0x47, 0x36}
+	testSpanId = trace.SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7}
+)
+
+// recordingSink keeps the entries a logger emits
+type recordingSink struct {
+	mu      sync.Mutex
+	entries []string
+}
+
+func (r *recordingSink) Emit(_ context.Context, level logging.Level, message string, _ []logging.Field) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = append(r.entries, level.String()+": "+message)
+}
+
+func newSamplerConfig(sampler string, ratio float64) *config.AppConfig {
+	conf := &config.AppConfig{}
+	conf.Otel.Sampler = sampler
+	conf.Otel.SamplerArg = ratio
+	conf.Otel.RouteSampleRatios = map[string]float64{}
+	return conf
+}
+
+func newTestSampler(t *testing.T, conf *config.AppConfig) (*Sampler, *recordingSink) {
+	t.Helper()
+	sink := &recordingSink{}
+	logger := logging.NewLogrusAdapter()
+	logger.AddSink(sink)
+	return NewSampler(conf, logger), sink
+}
+
+func remoteParent(sampled bool) context.Context {
+	flags := trace.TraceFlags(0)
+	if sampled {
+		flags = trace.FlagsSampled
+	}
+	return trace.ContextWithRemoteSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    testTraceId,
+		SpanID:     testSpanId,
+		TraceFlags: flags,
+		Remote:     true,
+	}))
+}
+
+func decisionOf(result sdktrace.SamplingResult) string {
+	for _, kv := range result.Attributes {
+		if kv.Key == SamplingDecisionKey {
+			return kv.Value.AsString()
+		}
+	}
+	return ""
+}
+
+func TestSamplerDecisions(t *testing.T) {
+	tests := []struct {
+		name         string
+		sampler      string
+		ratio        float64
+		routes       map[string]float64
+		sampleErrors bool
+		parent       context.Context
+		path         string
+		decision     sdktrace.SamplingDecision
+		reason       string
+	}{
+		{
+			name:     "parent based follows a sampled remote parent",
+			sampler:  "parentbased_traceidratio",
+			ratio:    0,
+			parent:   remoteParent(true),
+			decision: sdktrace.RecordAndSample,
+			reason:   SamplingDecisionParent,
+		},
+		{
+			name:     "parent based follows a dropped remote parent",
+			sampler:  "parentbased_always_on",
+			parent:   remoteParent(false),
+			decision: sdktrace.Drop,
+		},
+		{
+			name:     "ratio ignores a remote parent",
+			sampler:  "traceidratio",
+			ratio:    0,
+			parent:   remoteParent(true),
+			decision: sdktrace.Drop,
+		},
+		{
+			name:     "ratio samples a root",
+			sampler:  "traceidratio",
+			ratio:    1,
+			parent:   context.Background(),
+			decision: sdktrace.RecordAndSample,
+			reason:   SamplingDecisionRatio,
+		},
+		{
+			name:     "route override samples its path",
+			sampler:  "parentbased_traceidratio",
+			ratio:    0,
+			routes:   map[string]float64{"/oauth/token": 1, "/oauth": 0},
+			parent:   context.Background(),
+			path:     "/oauth/token",
+			decision: sdktrace.RecordAndSample,
+			reason:   SamplingDecisionRoute,
+		},
+		{
+			name:     "route override drops other paths",
+			sampler:  "parentbased_traceidratio",
+			ratio:    1,
+			routes:   map[string]float64{"/health": 0},
+			parent:   context.Background(),
+			path:     "/health/live",
+			decision: sdktrace.Drop,
+		},
+		{
+			name:         "unsampled root is deferred for a delayed decision",
+			sampler:      "parentbased_traceidratio",
+			ratio:        0,
+			sampleErrors: true,
+			parent:       context.Background(),
+			decision:     sdktrace.RecordOnly,
+			reason:       SamplingDecisionDeferred,
+		},
+		{
+			name:         "always off never defers",
+			sampler:      "parentbased_always_off",
+			sampleErrors: true,
+			parent:       context.Background(),
+			decision:     sdktrace.Drop,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := newSamplerConfig(tt.sampler, tt.ratio)
+			conf.Otel.SampleErrors = tt.sampleErrors
+			for prefix, ratio := range tt.routes {
+				conf.Otel.RouteSampleRatios[prefix] = ratio
+			}
+			sampler, _ := newTestSampler(t, conf)
+
+			var attributes []attribute.KeyValue
+			if tt.path != "" {
+				attributes = append(attributes, semconv.URLPath(tt.path))
+			}
+			result := sampler.ShouldSample(sdktrace.SamplingParameters{
+				ParentContext: tt.parent,
+				TraceID:       testTraceId,
+				Name:          "server",
+				Kind:          trace.SpanKindServer,
+				Attributes:    attributes,
+			})
+
+			if result.Decision != tt.decision {
+				t.Fatalf("decision = %v, want %v", result.Decision, tt.decision)
+			}
+			if reason := decisionOf(result); reason != tt.reason {
+				t.Errorf("sampling.decision = %q, want %q", reason, tt.reason)
+			}
+		})
+	}
+}
+
+func TestSamplerUnknownNameWarns(t *testing.T) {
+	sampler, sink := newTestSampler(t, newSamplerConfig("jaeger_remote", 0))
+
+	if len(sink.entries) != 1 || sink.entries[0] != "warn: unknown trace sampler, using parentbased_always_on" {
+		t.Fatalf("entries = %v, want one warning", sink.entries)
+	}
+	result := sampler.ShouldSample(sdktrace.SamplingParameters{
+		ParentContext: remoteParent(false),
+		TraceID:       testTraceId,
+		Name:          "server",
+	})
+	if result.Decision != sdktrace.Drop {
+		t.Errorf("decision = %v, want the dropped parent to be followed", result.Decision)
+	}
+}
+
+// newDelayedProvider samples nothing at the head so every exported span was kept by a delayed decision
+func newDelayedProvider(t *testing.T, sampleErrors bool, slowThreshold time.Duration) (trace.Tracer,
+	*tracetest.InMemoryExporter) {
+	t.Helper()
+
+	conf := newSamplerConfig("parentbased_traceidratio", 0)
+	conf.Otel.SampleErrors = sampleErrors
+	conf.Otel.SlowSpanThreshold = slowThreshold
+	sampler, _ := newTestSampler(t, conf)
+
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithSampler(sampler),
+		sdktrace.WithSpanProcessor(NewDelayedSamplingProcessor(sdktrace.NewSimpleSpanProcessor(exporter), conf)),
+	)
+	t.Cleanup(func() { _ = provider.Shutdown(context.Background()) })
+
+	return provider.Tracer("sampler-test"), exporter
+}
+
+func assertExported(t *testing.T, spans tracetest.SpanStubs, names []string, decision string) {
+	t.Helper()
+
+	if len(spans) != len(names) {
+		t.Fatalf("exported %d spans, want %d", len(spans), len(names))
+	}
+	for i, span := range spans {
+		if span.Name != names[i] {
+			t.Errorf("span %d = %q, want %q", i, span.Name, names[i])
+		}
+		if !span.SpanContext.IsSampled() {
+			t.Errorf("span %q is not marked sampled", span.Name)
+		}
+		got := ""
+		for _, kv := range span.Attributes {
+			if kv.Key == SamplingDecisionKey {
+				got = kv.Value.AsString()
+			}
+		}
+		if got != decision {
+			t.Errorf("span %q sampling.decision = %q, want %q", span.Name, got, decision)
+		}
+	}
+}
+
+func TestDelayedSamplingExportsFailedTraces(t *testing.T) {
+	tracer, exporter := newDelayedProvider(t, true, 0)
+
+	ctx, root := tracer.Start(context.Background(), "root")
+	_, child := tracer.Start(ctx, "child")
+	child.SetStatus(codes.Error, "boom")
+	child.End()
+	root.End()
+
+	assertExported(t, exporter.GetSpans(), []string{"child", "root"}, SamplingDecisionError)
+}
+
+func TestDelayedSamplingExportsSlowTraces(t *testing.T) {
+	tracer, exporter := newDelayedProvider(t, false, time.Second)
+
+	start := time.Now()
+	ctx, root := tracer.Start(context.Background(), "root", trace.WithTimestamp(start))
+	_, child := tracer.Start(ctx, "child", trace.WithTimestamp(start))
+	child.End(trace.WithTimestamp(start.Add(time.Millisecond)))
+	root.End(trace.WithTimestamp(start.Add(2 * time.Second)))
+
+	assertExported(t, exporter.GetSpans(), []string{"child", "root"}, SamplingDecisionSlow)
+}
+
+func TestDelayedSamplingDropsHealthyTraces(t *testing.T) {
+	tracer, exporter := newDelayedProvider(t, true, time.Second)
+
+	start := time.Now()
+	ctx, root := tracer.Start(context.Background(), "root", trace.WithTimestamp(start))
+	_, child := tracer.Start(ctx, "child", trace.WithTimestamp(start))
+	child.End(trace.WithTimestamp(start.Add(time.Millisecond)))
+	root.End(trace.WithTimestamp(start.Add(10 * time.Millisecond)))
+
+	if spans := exporter.GetSpans(); len(spans) != 0 {
+		t.Fatalf("exported %d spans of a healthy trace", len(spans))
+	}
+}
+
+func TestDelayedSamplingEvictsOrphanedChildren(t *testing.T) {
+	tracer, exporter := newDelayedProvider(t, true, 0)
+
+	// children ending after their root leave entries no root will delete
+	start := time.Now().Add(-2 * pendingTraceTimeout)
+	for i := 0; i < maxPendingTraces; i++ {
+		ctx, root := tracer.Start(context.Background(), "orphan root", trace.WithTimestamp(start))
+		_, child := tracer.Start(ctx, "orphan child", trace.WithTimestamp(start))
+		root.End(trace.WithTimestamp(start))
+		child.End(trace.WithTimestamp(start.Add(time.Millisecond)))
+	}
+
+	ctx, root := tracer.Start(context.Background(), "root")
+	_, child := tracer.Start(ctx, "child")
+	_, failed := tracer.Start(ctx, "failed")
+	child.End()
+	failed.SetStatus(codes.Error, "boom")
+	failed.End()
+	root.End()
+
+	assertExported(t, exporter.GetSpans(), []string{"child", "failed", "root"}, SamplingDecisionError)
+}
@@ -2,17 +2,24 @@ package tracing
 
 import (
 	"context"
-	"fmt"
 	"github.com/saufiroja/go-otel/auth-service/config"
 	"github.com/saufiroja/go-otel/auth-service/pkg/logging"
 	"github.com/saufiroja/go-otel/auth-service/pkg/observability/providers"
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/baggage"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	"go.opentelemetry.io/otel/trace"
 )
 
+type serverContextKey struct{}
+
+// ServerContextKey is the request user value holding the context of the server span, handlers start their spans
+// from the fasthttp request context which cannot carry it as a parent itself
+var ServerContextKey = serverContextKey{}
+
 // Tracer is a wrapper for OpenTelemetry Tracer
 type Tracer struct {
 	Trace trace.Tracer
@@ -20,10 +27,10 @@ type Tracer struct {
 
 // NewTracer creates a new tracer provider
 func NewTracer(ctx context.Context, serviceName string, provider *providers.ProviderFactory,
-	conf *config.AppConfig, logging logging.Logger) *Tracer {
+	conf *config.AppConfig, logger logging.Logger) *Tracer {
 	res, err := provider.CreateResource(ctx, serviceName)
 	if err != nil {
-		logging.LogPanic(err.Error())
+		logger.LogPanic(err.Error())
 	}
 
 	client := otlptracegrpc.NewClient(
@@ -32,26 +39,43 @@ func NewTracer(ctx context.Context, serviceName string, provider *providers.Prov
 	)
 	exp, err := otlptrace.New(ctx, client)
 	if err != nil {
-		logging.LogPanic(fmt.Sprintf("failed to create OTLP trace exporter: %v", err))
+		logger.LogPanic("failed to create OTLP trace exporter", logging.Err(err))
 	}
 
+	// attributes are redacted before spans reach the batcher so secrets never sit in the export queue, deferred
+	// spans are decided before that so only the ones kept are redacted
+	processor := NewRedactingProcessor(sdktrace.NewBatchSpanProcessor(exp), NewRedactionPolicy(conf))
+	sampler := NewSampler(conf, logger)
+	if sampler.delayed {
+		processor = NewDelayedSamplingProcessor(processor, conf)
+	}
 	tp := sdktrace.NewTracerProvider(
-		sdktrace.WithSampler(sdktrace.AlwaysSample()),
-		sdktrace.WithBatcher(exp),
+		sdktrace.WithSampler(sampler),
+		sdktrace.WithSpanProcessor(processor),
 		sdktrace.WithResource(res),
 	)
 
 	// set tracing global
 	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
 
-	logging.LogInfo("tracing initialized")
+	logger.LogInfo("tracing initialized")
 
 	return &Tracer{
 		Trace: otel.Tracer(serviceName),
 	}
 }
 
-// StartSpan starts a new span
+// StartSpan starts a new span, a context without a span inherits the server span and baggage of its request
 func (t *Tracer) StartSpan(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		if server, ok := ctx.Value(ServerContextKey).(context.Context); ok {
+			ctx = trace.ContextWithSpan(ctx, trace.SpanFromContext(server))
+			ctx = baggage.ContextWithBaggage(ctx, baggage.FromContext(server))
+		}
+	}
 	return t.Trace.Start(ctx, name, opts...)
 }
@@ -0,0 +1,12 @@
+\c accountdb;
+
+DROP TABLE IF EXISTS email_changes;
+CREATE TABLE email_changes (
+    change_id varchar(100) PRIMARY KEY,
+    user_id varchar(100) NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+    new_email varchar(100) NOT NULL,
+    token_hash varchar(100) NOT NULL UNIQUE,
+    expires_at TIMESTAMP NOT NULL,
+    consumed_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,16 @@
+\c accountdb;
+
+ALTER TABLE users ADD COLUMN status varchar(20) NOT NULL DEFAULT 'active';
+ALTER TABLE users ADD COLUMN role varchar(20) NOT NULL DEFAULT 'user';
+
+DROP TABLE IF EXISTS user_status_changes;
+CREATE TABLE user_status_changes (
+    change_id varchar(100) PRIMARY KEY,
+    user_id varchar(100) NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+    from_status varchar(20) NOT NULL,
+    to_status varchar(20) NOT NULL,
+    changed_by varchar(100) NOT NULL,
+    reason text NOT NULL,
+    changed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX idx_user_status_changes_user_id ON user_status_changes(user_id);
@@ -0,0 +1,13 @@
+\c accountdb;
+
+DROP TABLE IF EXISTS erasure_requests;
+CREATE TABLE erasure_requests (
+    request_id varchar(100) PRIMARY KEY,
+    user_id varchar(100) NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+    status varchar(20) NOT NULL DEFAULT 'pending',
+    requested_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    scheduled_at TIMESTAMP NOT NULL,
+    completed_at TIMESTAMP
+);
+CREATE INDEX idx_erasure_requests_due ON erasure_requests(status, scheduled_at);
+CREATE UNIQUE INDEX idx_erasure_requests_pending_user ON erasure_requests(user_id) WHERE status = 'pending';
@@ -0,0 +1,46 @@
+\c accountdb;
+
+DROP TABLE IF EXISTS audit_event_details;
+DROP TABLE IF EXISTS audit_events;
+CREATE TABLE audit_events (
+    sequence bigint PRIMARY KEY,
+    event_id varchar(100) NOT NULL UNIQUE,
+    event_type varchar(100) NOT NULL,
+    actor_id varchar(100) NOT NULL,
+    target_id varchar(100) NOT NULL,
+    trace_id varchar(32) NOT NULL,
+    details_hash varchar(64) NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    prev_hash varchar(64) NOT NULL,
+    hash varchar(64) NOT NULL
+);
+CREATE INDEX idx_audit_events_actor_id ON audit_events(actor_id);
+CREATE INDEX idx_audit_events_target_id ON audit_events(target_id);
+CREATE INDEX idx_audit_events_event_type ON audit_events(event_type);
+
+DROP TABLE IF EXISTS audit_event_details;
+CREATE TABLE audit_event_details (
+    event_id varchar(100) PRIMARY KEY REFERENCES audit_events(event_id),
+    salt varchar(32) NOT NULL,
+    ip varchar(100) NOT NULL,
+    user_agent text NOT NULL,
+    metadata jsonb NOT NULL DEFAULT '{}'
+);
+
+DROP TABLE IF EXISTS audit_chain_head;
+CREATE TABLE audit_chain_head (
+    id smallint PRIMARY KEY CHECK (id = 1),
+    sequence bigint NOT NULL,
+    hash varchar(64) NOT NULL,
+    mac varchar(64) NOT NULL
+);
+
+CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_events_no_update_delete
+    BEFORE UPDATE OR DELETE ON audit_events
+    FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
@@ -0,0 +1,15 @@
+\c accountdb;
+
+DROP TABLE IF EXISTS sessions;
+CREATE TABLE sessions (
+    session_id varchar(100) PRIMARY KEY,
+    user_id varchar(100) NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+    refresh_token_id varchar(100) NOT NULL,
+    device_name varchar(200) NOT NULL,
+    user_agent text NOT NULL,
+    ip varchar(100) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_used_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    revoked_at TIMESTAMP
+);
+CREATE INDEX idx_sessions_user_id ON sessions(user_id);
@@ -0,0 +1,15 @@
+\c accountdb;
+
+DROP TABLE IF EXISTS personal_access_tokens;
+CREATE TABLE personal_access_tokens (
+    token_id varchar(100) PRIMARY KEY,
+    user_id varchar(100) NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+    name varchar(100) NOT NULL,
+    token_hash varchar(64) NOT NULL UNIQUE,
+    scopes text NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    last_used_at TIMESTAMP,
+    revoked_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX idx_personal_access_tokens_user_id ON personal_access_tokens(user_id);
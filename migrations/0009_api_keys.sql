@@ -0,0 +1,27 @@
+\c accountdb;
+
+DROP TABLE IF EXISTS service_accounts;
+CREATE TABLE service_accounts (
+    service_account_id varchar(100) PRIMARY KEY,
+    org_id varchar(100) NOT NULL,
+    name varchar(100) NOT NULL,
+    created_by varchar(100) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX idx_service_accounts_org_id ON service_accounts(org_id);
+
+DROP TABLE IF EXISTS api_keys;
+CREATE TABLE api_keys (
+    key_id varchar(100) PRIMARY KEY,
+    service_account_id varchar(100) NOT NULL REFERENCES service_accounts(service_account_id) ON DELETE CASCADE,
+    key_prefix varchar(32) NOT NULL UNIQUE,
+    key_hash varchar(64) NOT NULL,
+    scopes text NOT NULL,
+    allowed_cidrs text NOT NULL DEFAULT '',
+    expires_at TIMESTAMP,
+    rotated_to varchar(100),
+    last_used_at TIMESTAMP,
+    revoked_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX idx_api_keys_service_account_id ON api_keys(service_account_id);
@@ -0,0 +1,26 @@
+\c accountdb;
+
+DROP TABLE IF EXISTS user_identities;
+CREATE TABLE user_identities (
+    identity_id varchar(100) PRIMARY KEY,
+    user_id varchar(100) NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+    provider varchar(50) NOT NULL,
+    subject varchar(255) NOT NULL,
+    email varchar(100) NOT NULL DEFAULT '',
+    provisioned boolean NOT NULL DEFAULT false,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_login_at TIMESTAMP,
+    UNIQUE (provider, subject)
+);
+CREATE INDEX idx_user_identities_user_id ON user_identities(user_id);
+
+DROP TABLE IF EXISTS oidc_login_states;
+CREATE TABLE oidc_login_states (
+    state_hash varchar(64) PRIMARY KEY,
+    provider varchar(50) NOT NULL,
+    nonce varchar(64) NOT NULL,
+    code_verifier varchar(128) NOT NULL,
+    link_user_id varchar(100),
+    browser boolean NOT NULL DEFAULT false,
+    expires_at TIMESTAMP NOT NULL
+);
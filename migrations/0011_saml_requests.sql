@@ -0,0 +1,9 @@
+\c accountdb;
+
+DROP TABLE IF EXISTS saml_requests;
+CREATE TABLE saml_requests (
+    request_id varchar(100) PRIMARY KEY,
+    link_user_id varchar(100),
+    browser boolean NOT NULL DEFAULT false,
+    expires_at TIMESTAMP NOT NULL
+);
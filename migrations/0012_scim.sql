@@ -0,0 +1,11 @@
+\c accountdb;
+
+DROP TABLE IF EXISTS scim_users;
+CREATE TABLE scim_users (
+    user_id varchar(100) PRIMARY KEY REFERENCES users(user_id) ON DELETE CASCADE,
+    org_id varchar(100) NOT NULL,
+    external_id varchar(255),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (org_id, external_id)
+);
+CREATE INDEX idx_scim_users_org_id ON scim_users(org_id);
@@ -0,0 +1,15 @@
+\c accountdb;
+
+DROP TABLE IF EXISTS device_codes;
+CREATE TABLE device_codes (
+    device_code_hash varchar(64) PRIMARY KEY,
+    user_code varchar(9) NOT NULL UNIQUE,
+    client_id varchar(100) NOT NULL,
+    status varchar(20) NOT NULL DEFAULT 'pending',
+    user_id varchar(100) REFERENCES users(user_id) ON DELETE CASCADE,
+    poll_interval integer NOT NULL,
+    last_polled_at TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX idx_device_codes_expires_at ON device_codes(expires_at);
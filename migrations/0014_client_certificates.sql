@@ -0,0 +1,14 @@
+\c accountdb;
+
+DROP TABLE IF EXISTS client_certificates;
+CREATE TABLE client_certificates (
+    certificate_id varchar(100) PRIMARY KEY,
+    service_account_id varchar(100) NOT NULL REFERENCES service_accounts(service_account_id) ON DELETE CASCADE,
+    subject_dn varchar(1000) NOT NULL,
+    scopes text NOT NULL,
+    created_by varchar(100) NOT NULL,
+    revoked_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX idx_client_certificates_subject_dn ON client_certificates(subject_dn) WHERE revoked_at IS NULL;
+CREATE INDEX idx_client_certificates_service_account_id ON client_certificates(service_account_id);